@@ -3,8 +3,13 @@ package api_structs
 import (
     "encoding/json"
     obfs "github.com/blackhillsinfosec/skyhook-obfuscation"
+    "github.com/blackhillsinfosec/skyhook/audit"
     "github.com/blackhillsinfosec/skyhook/config"
+    "github.com/blackhillsinfosec/skyhook/server/lockout"
+    "github.com/blackhillsinfosec/skyhook/server/session"
+    "github.com/blackhillsinfosec/skyhook/server/share"
     "github.com/blackhillsinfosec/skyhook/server/upload"
+    "time"
 )
 
 var (
@@ -48,11 +53,23 @@ type LoginResponse struct {
 type LoginPayload struct {
     Username string `json:"username" binding:"required"`
     Password string `json:"password" binding:"required"`
+    // Totp is the current TOTP code, required only for users that
+    // have enrolled a TOTP secret.
+    Totp string `json:"totp,omitempty"`
+}
+
+// JwtResponse is the JSON body returned by the JWT middleware
+// upon successful authentication or token refresh.
+type JwtResponse struct {
+    Code   int       `json:"code"`
+    Expire time.Time `json:"expire"`
+    Token  string    `json:"token"`
 }
 
 // CredList is a list of user credentials.
 //
-// Warning: this _does_ include the cleartext password.
+// Passwords are never included in responses. A cleartext password
+// is accepted in requests only when it's being changed.
 type CredList struct {
     Users []config.Credential `json:"users" binding:"required"`
 }
@@ -62,6 +79,9 @@ type CredList struct {
 type CredListResponse struct {
     BaseResponse `mapstructure:",squash"`
     CredList     `mapstructure:",squash"`
+    // TotpUsers are the usernames of users that have enrolled a
+    // TOTP secret.
+    TotpUsers []string `json:"totp_users"`
     //ConfigUri    string `yaml:"config_uri" json:"config_uri" mapstructure:"config_uri"`
 }
 
@@ -99,8 +119,19 @@ type GetObfuscatorsResponse struct {
     Obfuscators  []obfs.ObfuscatorConfig `json:"obfuscators"`
 }
 
+// ObfuscationProfilesResponse is used as the response object to
+// various handler functions.
+type ObfuscationProfilesResponse struct {
+    BaseResponse `mapstructure:",squash"`
+    Profiles     []config.ObfuscationProfile `json:"profiles"`
+}
+
 type RegisterUploadRequest struct {
     Path string `json:"path" yaml:"path"`
+    // Size is the expected size of the file in bytes, allowing
+    // upload limits to be enforced before content is sent. Zero
+    // when unknown.
+    Size uint64 `json:"size,omitempty" yaml:"size,omitempty"`
 }
 
 type RegisterUploadResponse struct {
@@ -109,11 +140,148 @@ type RegisterUploadResponse struct {
     //   Id                    string `json:"id" yaml:"id"`
 }
 
+// UploadStatusResponse describes the progress of a registered
+// upload, allowing clients to resume by sending only the byte
+// ranges absent from Received.
+type UploadStatusResponse struct {
+    BaseResponse `mapstructure:",squash"`
+    Path         string             `json:"path" yaml:"path"`
+    Received     []upload.ByteRange `json:"received" yaml:"received"`
+    Expiration   time.Time          `json:"expiration" yaml:"expiration"`
+}
+
+// ArchiveRequest is the request payload sent when retrieving a
+// chunk of a directory archive. Format is one of archive.Formats.
+type ArchiveRequest struct {
+    Format string `json:"format" yaml:"format"`
+}
+
+// FileOperationRequest is the optional request payload sent to the
+// file management endpoints.
+type FileOperationRequest struct {
+    // Destination is the web path that content is moved or copied
+    // to.
+    Destination string `json:"destination" yaml:"destination"`
+    // Overwrite allows a move or copy to replace an existing file.
+    Overwrite bool `json:"overwrite" yaml:"overwrite"`
+    // Recursive allows a non-empty directory to be deleted.
+    Recursive bool `json:"recursive" yaml:"recursive"`
+}
+
+// UploadFinishedRequest is the request payload sent when an upload
+// is finished. The uploaded file is verified against Size and Sha256
+// before it's deregistered.
+//
+// Size is required unless it was declared at registration, since
+// the absence of the final chunks can't otherwise be detected.
+type UploadFinishedRequest struct {
+    Size   *uint64 `json:"size,omitempty" yaml:"size,omitempty"`
+    Sha256 string  `json:"sha256" yaml:"sha256"`
+}
+
+// UploadFinishedResponse is used as the response object when
+// an upload fails verification. Gaps lists the byte ranges that
+// have yet to be received.
+type UploadFinishedResponse struct {
+    BaseResponse `mapstructure:",squash"`
+    Gaps         []upload.ByteRange `json:"gaps" yaml:"gaps"`
+}
+
 type ListUploadsResponse struct {
     BaseResponse `mapstructure:",squash"`
     Uploads      []upload.Upload `json:"uploads" yaml:"uploads"`
 }
 
+// AdminUpload describes the progress of a registered upload to
+// administrators.
+type AdminUpload struct {
+    upload.Upload `mapstructure:",squash"`
+    BytesReceived uint64 `json:"bytes_received" yaml:"bytes_received"`
+}
+
+// AdminUploadsResponse lists the uploads registered with the file
+// server.
+type AdminUploadsResponse struct {
+    BaseResponse `mapstructure:",squash"`
+    Uploads      []AdminUpload `json:"uploads" yaml:"uploads"`
+}
+
+// AdminUploadRequest identifies an upload to be extended or
+// canceled by an administrator.
+type AdminUploadRequest struct {
+    // Path is the path of the upload, relative to the webroot.
+    Path string `json:"path" yaml:"path"`
+    // Hours is the number of hours to extend the upload's
+    // expiration by.
+    Hours uint `json:"hours" yaml:"hours"`
+}
+
+// AdminUploadResponse returns an upload after it has been extended.
+type AdminUploadResponse struct {
+    BaseResponse `mapstructure:",squash"`
+    Upload       AdminUpload `json:"upload" yaml:"upload"`
+}
+
+// ShareRequest is sent to the admin server to mint a share token.
+type ShareRequest struct {
+    // Path is the path of the shared file, relative to the webroot.
+    Path string `json:"path" yaml:"path"`
+    // Hours is the number of hours until the token expires.
+    Hours uint `json:"hours" yaml:"hours"`
+    // SingleUse revokes the token once the file is served.
+    SingleUse bool `json:"single_use" yaml:"single_use"`
+    // MaxBytes is the total number of bytes that can be served
+    // using the token, or zero when unlimited.
+    MaxBytes uint64 `json:"max_bytes" yaml:"max_bytes"`
+}
+
+// ShareLinks describes a share token along with a link to the shared
+// file for each configured link FQDN.
+type ShareLinks struct {
+    share.Share `mapstructure:",squash"`
+    Links       map[string]string `json:"links" yaml:"links"`
+}
+
+// SharesResponse lists the unexpired share tokens.
+type SharesResponse struct {
+    BaseResponse `mapstructure:",squash"`
+    Shares       []ShareLinks `json:"shares" yaml:"shares"`
+}
+
+// ShareResponse returns a newly minted share token.
+type ShareResponse struct {
+    BaseResponse `mapstructure:",squash"`
+    Share        ShareLinks `json:"share" yaml:"share"`
+}
+
+// SessionsResponse lists the active sessions of both servers.
+type SessionsResponse struct {
+    BaseResponse `mapstructure:",squash"`
+    Sessions     []session.Session `json:"sessions" yaml:"sessions"`
+}
+
+// LockoutsResponse lists the usernames and client IP addresses
+// throttled due to failed logins.
+type LockoutsResponse struct {
+    BaseResponse `mapstructure:",squash"`
+    Lockouts     []lockout.Entry `json:"lockouts" yaml:"lockouts"`
+}
+
+// TotpEnrollResponse returns a newly enrolled TOTP secret along with
+// its otpauth provisioning URI, which is the payload of the QR code
+// scanned by authenticator apps.
+type TotpEnrollResponse struct {
+    BaseResponse `mapstructure:",squash"`
+    Secret       string `json:"secret" yaml:"secret"`
+    Uri          string `json:"uri" yaml:"uri"`
+}
+
+// AuditLogResponse returns records from the audit log.
+type AuditLogResponse struct {
+    BaseResponse `mapstructure:",squash"`
+    Records      []audit.Record `json:"records"`
+}
+
 type AdvancedConfigResponse struct {
     BaseResponse `mapstructure:",squash"`
     ApiRoutes    config.FileServerApiRoutes `json:"api_routes" yaml:"api_routes"`
@@ -130,6 +298,8 @@ type LinksResponse map[string]Links
 type Links struct {
     Standard  StandardLinks        `json:"standard" yaml:"standard" mapstructure:"standard"`
     Encrypted EncryptedLoaderLinks `yaml:"encrypted" json:"encrypted" mapstructure:"encrypted"`
+    // Shares maps each unexpired share token to a link to its file.
+    Shares map[string]string `yaml:"shares" json:"shares" mapstructure:"shares"`
 }
 
 type EncryptedLoaderLinks struct {
@@ -148,16 +318,26 @@ type EncryptedJsResponse struct {
 }
 
 // OperatingConfigData details the current operating configuration for API consumers. It
-// details routes to various API endpoints and obfuscation configurations.
+// details routes to various API endpoints and the obfuscation configuration of the user.
 //
 // Use JsonCryptMarshal to retrieve the configuration as a JSON string encrypted with
 // a user token, thus preventing disclosure of the configuration should TLS interception
 // occur.
 type OperatingConfigData struct {
-    ApiRoutes    config.FileServerApiRoutes `json:"api_routes" yaml:"api_routes"`
-    Obfuscators  []obfs.ObfuscatorConfig    `json:"obfuscators" yaml:"obfuscators"`
-    AuthConfig   config.SafeAuthOptions     `json:"auth_config" yaml:"auth_config"`
-    UploadConfig UploadConfigData           `json:"upload_config" yaml:"upload_config"`
+    ApiRoutes config.FileServerApiRoutes `json:"api_routes" yaml:"api_routes"`
+    // Profile is the name of the obfuscation profile assigned to the
+    // user, which is described by Obfuscators.
+    Profile      string                  `json:"profile" yaml:"profile"`
+    Obfuscators  []obfs.ObfuscatorConfig `json:"obfuscators" yaml:"obfuscators"`
+    AuthConfig   config.SafeAuthOptions  `json:"auth_config" yaml:"auth_config"`
+    UploadConfig UploadConfigData        `json:"upload_config" yaml:"upload_config"`
+    // CompressionConfig advertises the compression algorithms that
+    // clients may request for file chunks. Chunks are compressed
+    // prior to obfuscation when the response echoes the header.
+    CompressionConfig CompressionConfigData `json:"compression_config" yaml:"compression_config"`
+    // StatusCodes maps status codes remapped by the response profile
+    // back to those Skyhook would have sent.
+    StatusCodes map[int]int `json:"status_codes,omitempty" yaml:"status_codes,omitempty"`
 }
 
 // JsonCryptMarshal marshals itself to a JSON object and passes the output it through
@@ -182,10 +362,47 @@ func (oc OperatingConfigData) JsonCryptMarshal(token string) (string, error) {
     }
 }
 
-func NewOperatingConfigData(conf config.SkyhookConfig) OperatingConfigData {
+// JsonCryptUnmarshal reverses JsonCryptMarshal, decrypting data with the user's
+// token and unmarshalling the resulting JSON object into oc.
+func (oc *OperatingConfigData) JsonCryptUnmarshal(data, token string) (err error) {
+
+    //=============================
+    // DECRYPT WITH THE USER'S TOKEN
+    //=============================
+
+    var apiConfig []byte
+    if apiConfig, err = obfs.Base64Decode([]byte(data)); err != nil {
+        return err
+    }
+
+    x := obfs.XOR{Key: token}
+    if apiConfig, err = x.Deobfuscate(apiConfig); err != nil {
+        return err
+    }
+
+    //===============================
+    // UNMARSHAL THE CONFIG FROM JSON
+    //===============================
+
+    return json.Unmarshal(apiConfig, oc)
+}
+
+// NewOperatingConfigData returns the operating configuration of
+// cred, which includes the obfuscators of the user's obfuscation
+// profile.
+func NewOperatingConfigData(conf config.SkyhookConfig, cred config.Credential) OperatingConfigData {
+    profile := cred.Profile
+    if profile == "" {
+        profile = config.DefaultProfile
+    }
+    obfuscators, ok := conf.GetProfile(profile)
+    if !ok {
+        obfuscators = conf.GetObfuscatorConfigs()
+    }
     return OperatingConfigData{
         ApiRoutes:   conf.FileServer.Routes.Api,
-        Obfuscators: conf.GetObfuscatorConfigs(),
+        Profile:     profile,
+        Obfuscators: obfuscators,
         AuthConfig: config.SafeAuthOptions{
             Header: conf.Auth.Header,
             Jwt:    conf.Auth.Jwt.SafeJwtOptions,
@@ -194,9 +411,19 @@ func NewOperatingConfigData(conf config.SkyhookConfig) OperatingConfigData {
             RangeHeaderName: conf.FileServer.RangeHeaderOptions.Name,
             RangePrefix:     conf.FileServer.RangeHeaderOptions.RangePrefix,
         },
+        CompressionConfig: CompressionConfigData{
+            HeaderName: conf.FileServer.CompressionOptions.Name,
+            Algorithms: conf.FileServer.CompressionOptions.Algorithms,
+        },
+        StatusCodes: conf.FileServer.ResponseProfile.StatusCodes(),
     }
 }
 
+type CompressionConfigData struct {
+    HeaderName string   `json:"header_name" yaml:"header_name"`
+    Algorithms []string `json:"algorithms" yaml:"algorithms"`
+}
+
 type UploadConfigData struct {
     RangeHeaderName string `json:"range_header_name" yaml:"range_header_name"`
     RangePrefix     string `json:"range_prefix" yaml:"range_prefix"`
@@ -0,0 +1,48 @@
+package api_structs
+
+import (
+    obfs "github.com/blackhillsinfosec/skyhook-obfuscation"
+    "github.com/blackhillsinfosec/skyhook/config"
+    "reflect"
+    "testing"
+)
+
+func TestNewOperatingConfigData(t *testing.T) {
+    def := []obfs.ObfuscatorConfig{{Algo: "xor", Config: map[string]interface{}{"key": "default"}}}
+    red := []obfs.ObfuscatorConfig{{Algo: "xor", Config: map[string]interface{}{"key": "red"}}}
+    conf := config.SkyhookConfig{}
+    conf.FileServer.Obfuscators = def
+    conf.FileServer.ObfuscationProfiles = []config.ObfuscationProfile{{Name: "red", Obfuscators: red}}
+
+    for profile, want := range map[string]struct {
+        name        string
+        obfuscators []obfs.ObfuscatorConfig
+    }{
+        "":                    {config.DefaultProfile, def},
+        config.DefaultProfile: {config.DefaultProfile, def},
+        "red":                 {"red", red},
+    } {
+        od := NewOperatingConfigData(conf, config.Credential{Username: "op", Profile: profile})
+        if od.Profile != want.name || !reflect.DeepEqual(od.Obfuscators, want.obfuscators) {
+            t.Errorf("%q: got profile %s with %v", profile, od.Profile, od.Obfuscators)
+        }
+    }
+
+    // Users of deleted profiles receive the default obfuscators
+    od := NewOperatingConfigData(conf, config.Credential{Username: "op", Profile: "deleted"})
+    if !reflect.DeepEqual(od.Obfuscators, def) {
+        t.Errorf("unexpected obfuscators for a deleted profile: %v", od.Obfuscators)
+    }
+
+    // The operating config survives encryption with the user's token
+    blob, err := od.JsonCryptMarshal("token")
+    if err != nil {
+        t.Fatal(err)
+    }
+    dec := OperatingConfigData{}
+    if err = dec.JsonCryptUnmarshal(blob, "token"); err != nil {
+        t.Fatal(err)
+    } else if dec.Profile != od.Profile || len(dec.Obfuscators) != 1 {
+        t.Errorf("unexpected decrypted config: %+v", dec)
+    }
+}
@@ -0,0 +1,295 @@
+// Package audit records authentication and file transfer events
+// as JSON lines, enabling operators to determine who accessed
+// which files, when, and from where.
+//
+// Records are written to a size-rotated file and, optionally,
+// forwarded to a syslog server. Call Init before logging; Log is
+// a no-op until then.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/blackhillsinfosec/skyhook/config"
+	"github.com/blackhillsinfosec/skyhook/log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Level indicates the severity of a Record.
+type Level string
+
+const (
+	LevelInfo  Level = "info"
+	LevelWarn  Level = "warn"
+	LevelError Level = "error"
+)
+
+// Event identifies the action described by a Record.
+type Event string
+
+const (
+	EventLogin           Event = "login"
+	EventLoginFailed     Event = "login_failed"
+	EventLogout          Event = "logout"
+	EventConfigFetch     Event = "config_fetch"
+	EventInspect         Event = "inspect"
+	EventDownloadChunk   Event = "download_chunk"
+	EventDownloadArchive Event = "download_archive"
+	EventUploadRegister  Event = "upload_register"
+	EventUploadChunk     Event = "upload_chunk"
+	EventUploadFinish    Event = "upload_finish"
+	EventUploadCancel    Event = "upload_cancel"
+	EventUploadExpire    Event = "upload_expire"
+	EventUploadExtend    Event = "upload_extend"
+	EventMkdir           Event = "mkdir"
+	EventDelete          Event = "delete"
+	EventMove            Event = "move"
+	EventCopy            Event = "copy"
+	EventShareCreate     Event = "share_create"
+	EventShareRevoke     Event = "share_revoke"
+	EventShareDownload   Event = "share_download"
+	EventSessionRevoke   Event = "session_revoke"
+	EventTotpEnroll      Event = "totp_enroll"
+	EventTotpDisable     Event = "totp_disable"
+	EventLockout         Event = "lockout"
+	EventLockoutClear    Event = "lockout_clear"
+)
+
+// Record is a single audit log entry.
+type Record struct {
+	Time  time.Time `json:"time"`
+	Level Level     `json:"level"`
+	Event Event     `json:"event"`
+	// Server is the server that handled the request, i.e.,
+	// "file" or "admin".
+	Server     string `json:"server,omitempty"`
+	User       string `json:"user,omitempty"`
+	RemoteAddr string `json:"remote_addr,omitempty"`
+	// Path is the deobfuscated path to the targeted file, relative
+	// to the file server's webroot.
+	Path string `json:"path,omitempty"`
+	// Range is the inclusive byte range of a transferred chunk,
+	// e.g., "0-1023".
+	Range string `json:"range,omitempty"`
+	// Bytes is the number of bytes transferred.
+	Bytes   int64  `json:"bytes,omitempty"`
+	Status  int    `json:"status,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Query filters records returned by Logger.Query. Zero values
+// match all records.
+type Query struct {
+	Event Event
+	User  string
+	Path  string
+	Since time.Time
+	Until time.Time
+	// Limit is the maximum number of records to return. The most
+	// recent records are returned when the limit is exceeded.
+	Limit int
+}
+
+// Match determines if r satisfies q.
+func (q Query) Match(r Record) bool {
+	return (q.Event == "" || r.Event == q.Event) &&
+		(q.User == "" || r.User == q.User) &&
+		(q.Path == "" || r.Path == q.Path) &&
+		(q.Since.IsZero() || !r.Time.Before(q.Since)) &&
+		(q.Until.IsZero() || !r.Time.After(q.Until))
+}
+
+// Logger writes records to a rotating file and an optional
+// syslog sink.
+type Logger struct {
+	mu     sync.Mutex
+	file   *rotatingFile
+	syslog syslogWriter
+}
+
+// New initializes a Logger from opts.
+func New(opts config.AuditOptions) (l *Logger, err error) {
+	if opts.File == "" {
+		return nil, errors.New("audit log file is required")
+	}
+
+	l = &Logger{}
+	if l.file, err = openRotatingFile(opts.File, int64(opts.MaxSize)*1024*1024, int(opts.MaxBackups)); err != nil {
+		return nil, err
+	}
+
+	if opts.Syslog.Enabled {
+		if l.syslog, err = dialSyslog(opts.Syslog); err != nil {
+			l.file.Close()
+			return nil, errors.New(fmt.Sprintf("failed to connect to syslog: %v", err))
+		}
+	}
+
+	return l, nil
+}
+
+// Log writes r to each sink. Time and Level are set when
+// empty, with Level being derived from Status.
+func (l *Logger) Log(r Record) {
+	if r.Time.IsZero() {
+		r.Time = time.Now().UTC()
+	}
+	if r.Level == "" {
+		switch {
+		case r.Status >= 500:
+			r.Level = LevelError
+		case r.Status >= 400:
+			r.Level = LevelWarn
+		default:
+			r.Level = LevelInfo
+		}
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		log.ERR.Printf("Failed to marshal audit record: %v", err)
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, err = l.file.Write(append(b, '\n')); err != nil {
+		log.ERR.Printf("Failed to write audit record: %v", err)
+	}
+
+	if l.syslog != nil {
+		switch r.Level {
+		case LevelError:
+			err = l.syslog.Err(string(b))
+		case LevelWarn:
+			err = l.syslog.Warning(string(b))
+		default:
+			err = l.syslog.Info(string(b))
+		}
+		if err != nil {
+			log.ERR.Printf("Failed to send audit record to syslog: %v", err)
+		}
+	}
+}
+
+// Query reads the current and rotated log files, returning records
+// that match q in chronological order.
+func (l *Logger) Query(q Query) (records []Record, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, name := range l.file.Files() {
+
+		var f *os.File
+		if f, err = os.Open(name); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return records, err
+		}
+
+		s := bufio.NewScanner(f)
+		s.Buffer(make([]byte, 64*1024), 1024*1024)
+		for s.Scan() {
+			r := Record{}
+			if json.Unmarshal(s.Bytes(), &r) != nil || !q.Match(r) {
+				continue
+			}
+			records = append(records, r)
+			if q.Limit > 0 && len(records) > q.Limit {
+				records = records[1:]
+			}
+		}
+
+		err = s.Err()
+		f.Close()
+		if err != nil {
+			return records, err
+		}
+	}
+
+	return records, nil
+}
+
+// Close closes each sink.
+func (l *Logger) Close() (err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.syslog != nil {
+		l.syslog.Close()
+	}
+	return l.file.Close()
+}
+
+//=============
+// PACKAGE LEVEL
+//=============
+
+var (
+	stdMu sync.RWMutex
+	std   *Logger
+)
+
+// Init initializes the package level Logger used by Log and
+// Search. Auditing is disabled when opts.File is empty.
+func Init(opts config.AuditOptions) (err error) {
+	var l *Logger
+	if opts.File != "" {
+		if l, err = New(opts); err != nil {
+			return err
+		}
+		log.INFO.Printf("Writing audit log to: %s", opts.File)
+	} else {
+		log.WARN.Println("Audit logging is disabled")
+	}
+
+	stdMu.Lock()
+	defer stdMu.Unlock()
+	if std != nil {
+		std.Close()
+	}
+	std = l
+	return nil
+}
+
+// Enabled determines if auditing has been initialized.
+func Enabled() bool {
+	stdMu.RLock()
+	defer stdMu.RUnlock()
+	return std != nil
+}
+
+// Log writes r to the package level Logger.
+func Log(r Record) {
+	stdMu.RLock()
+	defer stdMu.RUnlock()
+	if std != nil {
+		std.Log(r)
+	}
+}
+
+// Search queries the package level Logger.
+func Search(q Query) ([]Record, error) {
+	stdMu.RLock()
+	defer stdMu.RUnlock()
+	if std == nil {
+		return nil, errors.New("audit logging is disabled")
+	}
+	return std.Query(q)
+}
+
+// Close closes the package level Logger.
+func Close() (err error) {
+	stdMu.Lock()
+	defer stdMu.Unlock()
+	if std != nil {
+		err = std.Close()
+		std = nil
+	}
+	return err
+}
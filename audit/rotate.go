@@ -0,0 +1,93 @@
+package audit
+
+import (
+	"fmt"
+	"os"
+)
+
+// rotatingFile is an io.Writer that rotates the underlying file
+// once it exceeds maxSize bytes. Rotated files are suffixed with
+// an increasing index, e.g., audit.log.1 is the most recent and
+// audit.log.<maxBackups> the oldest.
+//
+// rotatingFile isn't safe for concurrent use.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	f          *os.File
+	size       int64
+}
+
+// openRotatingFile opens the file at path for appending, creating
+// it when necessary.
+func openRotatingFile(path string, maxSize int64, maxBackups int) (r *rotatingFile, err error) {
+	r = &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	return r, r.open()
+}
+
+func (r *rotatingFile) open() (err error) {
+	if r.f, err = os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600); err != nil {
+		return err
+	}
+	var stat os.FileInfo
+	if stat, err = r.f.Stat(); err != nil {
+		r.f.Close()
+		return err
+	}
+	r.size = stat.Size()
+	return nil
+}
+
+// Write writes b to the file, rotating it first when b would
+// exceed maxSize.
+func (r *rotatingFile) Write(b []byte) (n int, err error) {
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(b)) > r.maxSize {
+		if err = r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err = r.f.Write(b)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate shifts each backup up by one index, discarding the
+// oldest, and reopens an empty file at path.
+func (r *rotatingFile) rotate() (err error) {
+	if err = r.f.Close(); err != nil {
+		return err
+	}
+
+	if r.maxBackups > 0 {
+		os.Remove(r.backup(r.maxBackups))
+		for i := r.maxBackups - 1; i > 0; i-- {
+			os.Rename(r.backup(i), r.backup(i+1))
+		}
+		if err = os.Rename(r.path, r.backup(1)); err != nil {
+			return err
+		}
+	} else if err = os.Remove(r.path); err != nil {
+		return err
+	}
+
+	return r.open()
+}
+
+func (r *rotatingFile) backup(i int) string {
+	return fmt.Sprintf("%s.%d", r.path, i)
+}
+
+// Files returns the path to each backup, oldest first, followed
+// by the path to the current file. Backups may not exist.
+func (r *rotatingFile) Files() (names []string) {
+	for i := r.maxBackups; i > 0; i-- {
+		names = append(names, r.backup(i))
+	}
+	return append(names, r.path)
+}
+
+// Close closes the underlying file.
+func (r *rotatingFile) Close() error {
+	return r.f.Close()
+}
@@ -0,0 +1,10 @@
+package audit
+
+// syslogWriter is the subset of syslog.Writer methods used
+// by Logger.
+type syslogWriter interface {
+	Info(m string) error
+	Warning(m string) error
+	Err(m string) error
+	Close() error
+}
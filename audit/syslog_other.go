@@ -0,0 +1,14 @@
+//go:build windows || plan9
+
+package audit
+
+import (
+	"errors"
+	"github.com/blackhillsinfosec/skyhook/config"
+)
+
+// dialSyslog always fails because log/syslog isn't available
+// on this platform.
+func dialSyslog(opts config.AuditSyslogOptions) (syslogWriter, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
@@ -0,0 +1,13 @@
+//go:build !windows && !plan9
+
+package audit
+
+import (
+	"github.com/blackhillsinfosec/skyhook/config"
+	"log/syslog"
+)
+
+// dialSyslog connects to the syslog server described by opts.
+func dialSyslog(opts config.AuditSyslogOptions) (syslogWriter, error) {
+	return syslog.Dial(opts.Network, opts.Address, syslog.LOG_INFO|syslog.LOG_DAEMON, opts.Tag)
+}
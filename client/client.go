@@ -0,0 +1,334 @@
+package client
+
+import (
+    "bytes"
+    "crypto/tls"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    obfs "github.com/blackhillsinfosec/skyhook-obfuscation"
+    structs "github.com/blackhillsinfosec/skyhook/api_structs"
+    "github.com/blackhillsinfosec/skyhook/log"
+    "io"
+    "net/http"
+    "net/url"
+    "path"
+    "reflect"
+    "strings"
+    "time"
+)
+
+// Client interacts with the API of a running Skyhook file server
+// the same way the embedded web application does:
+//
+// - Authentication occurs via POST /login
+// - The operating config is decrypted from the JWT issued upon
+//   authentication using the user's token
+// - All file paths and file chunks are obfuscated using the chain
+//   described by the operating config
+//
+// Use New to initialize a Client and Login before calling any other
+// method.
+type Client struct {
+    // BaseUrl is the scheme and authority of the file server,
+    // e.g., https://files.domain.com:443.
+    BaseUrl string
+    // Token is the user's token, which is used to decrypt the
+    // operating config.
+    Token string
+    // Http is the client used to send all requests.
+    Http *http.Client
+    // Config is the operating config decrypted from the JWT.
+    //
+    // This value is populated by Login and RefreshConfig.
+    Config structs.OperatingConfigData
+    // Progress is an optional callback executed after each chunk
+    // is transferred.
+    Progress func(done, total int64)
+    // Compression is the algorithm requested for file chunks, e.g.,
+    // gzip. It's only requested when advertised by the operating
+    // config.
+    Compression string
+
+    chain []obfs.Obfuscator
+    jwt   string
+}
+
+// New initializes a Client. Setting insecure to true disables
+// verification of the server's certificate.
+func New(baseUrl, token string, insecure bool) *Client {
+    return &Client{
+        BaseUrl: strings.TrimRight(baseUrl, "/"),
+        Token:   token,
+        Http: &http.Client{
+            Timeout: 5 * time.Minute,
+            Transport: &http.Transport{
+                Proxy:           http.ProxyFromEnvironment,
+                TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure},
+            },
+        },
+    }
+}
+
+// Login authenticates to the file server and decrypts the
+// operating config from the JWT. totp is the current TOTP code of
+// the user, which is ignored when the user hasn't enrolled TOTP.
+func (c *Client) Login(username, password, totp string) (err error) {
+
+    //======================
+    // SEND THE LOGIN PAYLOAD
+    //======================
+
+    var pay []byte
+    if pay, err = json.Marshal(structs.LoginPayload{
+        Username: username,
+        Password: password,
+        Totp:     totp,
+    }); err != nil {
+        return err
+    }
+
+    var resp *http.Response
+    if resp, err = c.Http.Post(c.BaseUrl+"/login", "application/json", bytes.NewReader(pay)); err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        if retry := resp.Header.Get("Retry-After"); retry != "" {
+            return errors.New(fmt.Sprintf("authentication failed (status code %d), retry after %s seconds", resp.StatusCode, retry))
+        }
+        return errors.New(fmt.Sprintf("authentication failed (status code %d)", resp.StatusCode))
+    }
+
+    jResp := structs.JwtResponse{}
+    if err = json.NewDecoder(resp.Body).Decode(&jResp); err != nil {
+        return errors.New(fmt.Sprintf("failed to parse login response: %v", err))
+    }
+
+    //=========================================
+    // DECRYPT THE OPERATING CONFIG FROM THE JWT
+    //=========================================
+
+    var claims map[string]interface{}
+    if claims, err = parseJwtClaims(jResp.Token); err != nil {
+        return err
+    }
+
+    // The name of the config claim is configurable on the server,
+    // so each string claim is tried until one decrypts.
+    for _, v := range claims {
+        if s, ok := v.(string); ok {
+            oc := structs.OperatingConfigData{}
+            if oc.JsonCryptUnmarshal(s, c.Token) == nil && oc.ApiRoutes.Download != "" {
+                c.jwt = jResp.Token
+                return c.SetConfig(oc)
+            }
+        }
+    }
+
+    return errors.New("failed to decrypt operating config from JWT (incorrect token?)")
+}
+
+// Logout invalidates the current session.
+func (c *Client) Logout() (err error) {
+    var resp *http.Response
+    if resp, err = c.do(http.MethodPost, c.Config.ApiRoutes.Logout, nil, nil); err != nil {
+        return err
+    }
+    resp.Body.Close()
+    c.jwt = ""
+    return nil
+}
+
+// RefreshConfig retrieves the current operating config from the
+// file server, allowing the client to pick up changes to the
+// obfuscation chain.
+func (c *Client) RefreshConfig() (err error) {
+    var resp *http.Response
+    if resp, err = c.do(http.MethodGet, c.Config.ApiRoutes.OperatingConfig, nil, nil); err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return errors.New(fmt.Sprintf("failed to retrieve operating config (status code %d)", resp.StatusCode))
+    }
+
+    var b []byte
+    if b, err = io.ReadAll(resp.Body); err != nil {
+        return err
+    }
+
+    oc := structs.OperatingConfigData{}
+    if err = oc.JsonCryptUnmarshal(string(b), c.Token); err != nil {
+        return errors.New(fmt.Sprintf("failed to decrypt operating config: %v", err))
+    }
+    return c.SetConfig(oc)
+}
+
+// rotated refreshes the operating config after a failed request,
+// reporting whether the obfuscators have changed since, e.g., due
+// to the server rotating its keys.
+func (c *Client) rotated() bool {
+    prev := c.Config.Obfuscators
+    if err := c.RefreshConfig(); err != nil {
+        log.WARN.Printf("Failed to refresh operating config: %v", err)
+        return false
+    }
+    if reflect.DeepEqual(prev, c.Config.Obfuscators) {
+        return false
+    }
+    log.INFO.Print("Obfuscation chain changed; retrying with the new chain")
+    return true
+}
+
+// SetConfig sets the operating config and parses its obfuscators
+// into the chain used by the client.
+func (c *Client) SetConfig(oc structs.OperatingConfigData) error {
+    chain, failures := obfs.ParseObfuscators(&oc.Obfuscators)
+    if len(failures) > 0 {
+        return errors.New(fmt.Sprintf("failed to parse obfuscator(s): %s", strings.Join(failures, ", ")))
+    }
+    c.Config = oc
+    c.chain = *chain
+    return nil
+}
+
+// Obfuscate obfuscates data using the configured chain.
+func (c *Client) Obfuscate(data []byte) ([]byte, error) {
+    return obfs.Obfuscate(data, c.chain)
+}
+
+// Deobfuscate deobfuscates data using the configured chain.
+func (c *Client) Deobfuscate(data []byte) ([]byte, error) {
+    return obfs.Deobfuscate(data, c.chain)
+}
+
+// obfPath cleans pth into an absolute web path, obfuscates
+// it, and appends it to route.
+func (c *Client) obfPath(route, pth string) (string, error) {
+    b, err := c.Obfuscate([]byte(path.Clean("/" + pth)))
+    if err != nil {
+        return "", err
+    }
+    return strings.TrimRight(route, "/") + "/" + url.PathEscape(string(b)), nil
+}
+
+// rangeHeader returns the name and value of the range header
+// described by the operating config.
+func (c *Client) rangeHeader(start, end int64) (string, string) {
+    return c.Config.UploadConfig.RangeHeaderName,
+        fmt.Sprintf("%s=%d-%d", c.Config.UploadConfig.RangePrefix, start, end)
+}
+
+// compression returns the name of the compression header and the
+// algorithm to request, which is empty when Compression isn't
+// advertised by the operating config.
+func (c *Client) compression() (string, string) {
+    cc := c.Config.CompressionConfig
+    for _, a := range cc.Algorithms {
+        if c.Compression != "" && a == c.Compression {
+            return cc.HeaderName, a
+        }
+    }
+    return cc.HeaderName, ""
+}
+
+// do sends an authenticated request to route.
+func (c *Client) do(method, route string, body []byte, headers map[string]string) (*http.Response, error) {
+    if c.jwt == "" {
+        return nil, errors.New("client is not authenticated")
+    }
+
+    var r io.Reader
+    if body != nil {
+        r = bytes.NewReader(body)
+    }
+
+    req, err := http.NewRequest(method, c.BaseUrl+route, r)
+    if err != nil {
+        return nil, err
+    }
+
+    auth := c.Config.AuthConfig.Header
+    req.Header.Set(auth.Name, fmt.Sprintf("%s %s", auth.Scheme, c.jwt))
+    for k, v := range headers {
+        req.Header.Set(k, v)
+    }
+
+    resp, err := c.Http.Do(req)
+    if err == nil {
+        // Restore status codes remapped by the response profile
+        if code, ok := c.Config.StatusCodes[resp.StatusCode]; ok {
+            resp.StatusCode = code
+        }
+    }
+    return resp, err
+}
+
+// doPath sends an authenticated request for pth, which is
+// obfuscated and appended to route. When non-nil, payload is
+// obfuscated and sent as the request body.
+//
+// Upon an error response, the operating config is refreshed. When
+// the obfuscation chain has changed since, e.g., because the server
+// rotated its keys, the request is sent once more using the new
+// chain.
+func (c *Client) doPath(method, route, pth string, payload []byte, headers map[string]string) (resp *http.Response, err error) {
+    for retried := false; ; retried = true {
+        var r string
+        if r, err = c.obfPath(route, pth); err != nil {
+            return nil, err
+        }
+
+        var body []byte
+        if payload != nil {
+            if body, err = c.Obfuscate(payload); err != nil {
+                return nil, err
+            }
+        }
+
+        resp, err = c.do(method, r, body, headers)
+        if err != nil || resp.StatusCode < http.StatusBadRequest || retried || !c.rotated() {
+            return resp, err
+        }
+        resp.Body.Close()
+    }
+}
+
+// readObfResponse reads and deobfuscates the body of resp. When
+// dst is non-nil, the output is unmarshalled into it as JSON.
+func (c *Client) readObfResponse(resp *http.Response, dst interface{}) (data []byte, err error) {
+    defer resp.Body.Close()
+    if data, err = io.ReadAll(resp.Body); err != nil || len(data) == 0 {
+        return data, err
+    }
+    if data, err = c.Deobfuscate(data); err != nil {
+        return data, errors.New(fmt.Sprintf("failed to deobfuscate response: %v", err))
+    }
+    if dst != nil {
+        err = json.Unmarshal(data, dst)
+    }
+    return data, err
+}
+
+// parseJwtClaims extracts claims from the payload segment of token.
+//
+// The signature is not verified; the client trusts the server it
+// authenticated to.
+func parseJwtClaims(token string) (claims map[string]interface{}, err error) {
+    segs := strings.Split(token, ".")
+    if len(segs) != 3 {
+        return nil, errors.New("malformed JWT returned by server")
+    }
+
+    var b []byte
+    if b, err = base64.RawURLEncoding.DecodeString(segs[1]); err != nil {
+        return nil, errors.New(fmt.Sprintf("failed to decode JWT payload: %v", err))
+    }
+
+    err = json.Unmarshal(b, &claims)
+    return claims, err
+}
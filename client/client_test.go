@@ -0,0 +1,127 @@
+package client
+
+import (
+    "encoding/base64"
+    "encoding/json"
+    obfs "github.com/blackhillsinfosec/skyhook-obfuscation"
+    structs "github.com/blackhillsinfosec/skyhook/api_structs"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strings"
+    "testing"
+)
+
+// testConfig returns an operating config with a XOR and Base64 chain.
+func testConfig() structs.OperatingConfigData {
+    oc := structs.OperatingConfigData{
+        Obfuscators: []obfs.ObfuscatorConfig{
+            {Algo: "xor", Config: map[string]interface{}{"key": "secret"}},
+            {Algo: "base64", Config: map[string]interface{}{"rounds": 2}},
+        },
+    }
+    oc.ApiRoutes.Download = "/files"
+    return oc
+}
+
+// testJwt returns an unsigned JWT carrying claims.
+func testJwt(t *testing.T, claims map[string]interface{}) string {
+    b, err := json.Marshal(claims)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return "e30." + base64.RawURLEncoding.EncodeToString(b) + ".sig"
+}
+
+func TestClient_SetConfig(t *testing.T) {
+    c := New("https://127.0.0.1/", "token", true)
+    if c.BaseUrl != "https://127.0.0.1" {
+        t.Errorf("trailing slash wasn't trimmed from %s", c.BaseUrl)
+    }
+    if err := c.SetConfig(testConfig()); err != nil {
+        t.Fatal(err)
+    } else if len(c.chain) != 2 {
+        t.Fatalf("expected a chain of 2 obfuscators, got %d", len(c.chain))
+    }
+
+    // The chain is applied in order and reversed when deobfuscating
+    want, _ := obfs.Obfuscate([]byte("content"), []obfs.Obfuscator{&obfs.XOR{Key: "secret"}, &obfs.Base64{Rounds: 2}})
+    if got, err := c.Obfuscate([]byte("content")); err != nil || string(got) != string(want) {
+        t.Errorf("unexpected obfuscation output %q: %v", got, err)
+    } else if plain, err := c.Deobfuscate(got); err != nil || string(plain) != "content" {
+        t.Errorf("unexpected deobfuscation output %q: %v", plain, err)
+    }
+
+    // Unknown algorithms are rejected without replacing the config
+    bad := testConfig()
+    bad.Obfuscators = append(bad.Obfuscators, obfs.ObfuscatorConfig{Algo: "rot13"})
+    bad.ApiRoutes.Download = "/other"
+    if err := c.SetConfig(bad); err == nil || !strings.Contains(err.Error(), "rot13") {
+        t.Errorf("unknown obfuscator wasn't reported: %v", err)
+    } else if c.Config.ApiRoutes.Download != "/files" || len(c.chain) != 2 {
+        t.Error("failed config replaced the previous one")
+    }
+}
+
+func TestClient_ObfPath(t *testing.T) {
+    c := New("https://127.0.0.1", "token", true)
+    if err := c.SetConfig(testConfig()); err != nil {
+        t.Fatal(err)
+    }
+
+    for _, pth := range []string{"dir/file", "/dir/file", "/dir/../dir/file/"} {
+        r, err := c.obfPath("/files/", pth)
+        if err != nil {
+            t.Fatal(err)
+        } else if !strings.HasPrefix(r, "/files/") {
+            t.Fatalf("%s: route wasn't prefixed: %s", pth, r)
+        }
+
+        seg, err := url.PathUnescape(strings.TrimPrefix(r, "/files/"))
+        if err != nil {
+            t.Fatal(err)
+        } else if dec, err := c.Deobfuscate([]byte(seg)); err != nil || string(dec) != "/dir/file" {
+            t.Errorf("%s: path was obfuscated as %q: %v", pth, dec, err)
+        }
+    }
+}
+
+func TestParseJwtClaims(t *testing.T) {
+    claims, err := parseJwtClaims(testJwt(t, map[string]interface{}{"id": "op"}))
+    if err != nil || claims["id"] != "op" {
+        t.Errorf("unexpected claims %v: %v", claims, err)
+    }
+
+    for _, token := range []string{"", "a.b", "a.!!!.c", "a." + base64.RawURLEncoding.EncodeToString([]byte("[]")) + ".c"} {
+        if _, err = parseJwtClaims(token); err == nil {
+            t.Errorf("malformed token %q was parsed", token)
+        }
+    }
+}
+
+func TestClient_Login(t *testing.T) {
+    oc := testConfig()
+    blob, err := oc.JsonCryptMarshal("token")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        json.NewEncoder(w).Encode(structs.JwtResponse{
+            Token: testJwt(t, map[string]interface{}{"id": "op", "cfg": blob}),
+        })
+    }))
+    defer srv.Close()
+
+    // The config claim is found by decrypting each string claim
+    c := New(srv.URL, "token", false)
+    if err = c.Login("op", "password", ""); err != nil {
+        t.Fatal(err)
+    } else if c.Config.ApiRoutes.Download != "/files" || len(c.chain) != 2 {
+        t.Errorf("operating config wasn't decrypted: %+v", c.Config)
+    }
+
+    if err = New(srv.URL, "wrong", false).Login("op", "password", ""); err == nil {
+        t.Error("operating config was decrypted with the wrong token")
+    }
+}
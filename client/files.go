@@ -0,0 +1,429 @@
+package client
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    structs "github.com/blackhillsinfosec/skyhook/api_structs"
+    "github.com/blackhillsinfosec/skyhook/log"
+    "github.com/blackhillsinfosec/skyhook/server/inspector"
+    "github.com/blackhillsinfosec/skyhook/server/obf-stream"
+    "github.com/blackhillsinfosec/skyhook/server/upload"
+    "io"
+    "net/http"
+)
+
+var (
+    // ErrUploadNotFound is returned when the file server has no
+    // upload registered for the requested path.
+    ErrUploadNotFound = errors.New("upload not found")
+)
+
+// List inspects pth on the file server, returning the entries
+// of a directory or a single entry describing a file.
+func (c *Client) List(pth string) (ir inspector.InspectResponse, err error) {
+    var resp *http.Response
+    if resp, err = c.doPath(http.MethodPatch, c.Config.ApiRoutes.Download, pth, nil, nil); err != nil {
+        return ir, err
+    }
+
+    if resp.StatusCode != http.StatusOK {
+        resp.Body.Close()
+        return ir, errors.New(fmt.Sprintf("failed to inspect %s (status code %d)", pth, resp.StatusCode))
+    }
+
+    _, err = c.readObfResponse(resp, &ir)
+    return ir, err
+}
+
+// Stat returns information about the file at pth.
+func (c *Client) Stat(pth string) (fi inspector.FileInfo, err error) {
+    var ir inspector.InspectResponse
+    if ir, err = c.List(pth); err != nil {
+        return fi, err
+    }
+    if len(ir.Entries) != 1 || ir.Entries[0].IsDir {
+        return fi, errors.New(fmt.Sprintf("%s is not a file", pth))
+    }
+    return ir.Entries[0], nil
+}
+
+// Download retrieves the file at pth in chunks of chunkSize bytes,
+// writing each deobfuscated chunk to dst.
+func (c *Client) Download(pth string, dst io.Writer, chunkSize int64) (err error) {
+
+    //=================
+    // GET THE FILE SIZE
+    //=================
+
+    var fi inspector.FileInfo
+    if fi, err = c.Stat(pth); err != nil {
+        return err
+    }
+
+    //===================
+    // RETRIEVE EACH CHUNK
+    //===================
+
+    for off := int64(0); off < fi.Size; off += chunkSize {
+
+        end := off + chunkSize - 1
+        if end >= fi.Size {
+            end = fi.Size - 1
+        }
+
+        name, value := c.rangeHeader(off, end)
+        headers := map[string]string{name: value}
+        if cName, algo := c.compression(); algo != "" {
+            headers[cName] = algo
+        }
+
+        var resp *http.Response
+        if resp, err = c.doPath(http.MethodGet, c.Config.ApiRoutes.Download, pth, nil, headers); err != nil {
+            return err
+        }
+
+        if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
+            resp.Body.Close()
+            return errors.New(fmt.Sprintf("failed to download chunk at offset %d (status code %d)", off, resp.StatusCode))
+        }
+
+        // The server echoes the compression header when the chunk
+        // was compressed prior to obfuscation
+        cName, _ := c.compression()
+        algo := resp.Header.Get(cName)
+
+        var chunk []byte
+        if chunk, err = c.readObfResponse(resp, nil); err != nil {
+            return err
+        } else if algo != "" {
+            if chunk, err = decompress(chunk, algo); err != nil {
+                return errors.New(fmt.Sprintf("failed to decompress chunk at offset %d: %v", off, err))
+            }
+        }
+        if int64(len(chunk)) != end-off+1 {
+            return errors.New(fmt.Sprintf("short chunk at offset %d: expected %d bytes, got %d", off, end-off+1, len(chunk)))
+        }
+
+        if _, err = dst.Write(chunk); err != nil {
+            return err
+        }
+
+        if c.Progress != nil {
+            c.Progress(end+1, fi.Size)
+        }
+    }
+
+    return nil
+}
+
+// DownloadArchive retrieves an archive of the directory at pth in
+// format, one of archive.Formats, writing it to dst in chunks of
+// chunkSize bytes. The size of the archive isn't known in advance,
+// so Progress receives a total of zero.
+func (c *Client) DownloadArchive(pth, format string, dst io.Writer, chunkSize int64) (err error) {
+
+    var pay []byte
+    if pay, err = json.Marshal(structs.ArchiveRequest{Format: format}); err != nil {
+        return err
+    }
+
+    // Chunks are requested until one falls short, which marks the
+    // end of the archive
+    for off := int64(0); ; off += chunkSize {
+
+        name, value := c.rangeHeader(off, off+chunkSize-1)
+        headers := map[string]string{name: value}
+        if cName, algo := c.compression(); algo != "" {
+            headers[cName] = algo
+        }
+
+        var resp *http.Response
+        if resp, err = c.doPath(http.MethodPost, c.Config.ApiRoutes.Download, pth, pay, headers); err != nil {
+            return err
+        }
+
+        if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && off > 0 {
+            // The previous chunk ended exactly at the end of the archive
+            resp.Body.Close()
+            return nil
+        } else if resp.StatusCode != http.StatusPartialContent {
+            resp.Body.Close()
+            return errors.New(fmt.Sprintf("failed to download archive chunk at offset %d (status code %d)", off, resp.StatusCode))
+        }
+
+        cName, _ := c.compression()
+        algo := resp.Header.Get(cName)
+
+        var chunk []byte
+        if chunk, err = c.readObfResponse(resp, nil); err != nil {
+            return err
+        } else if algo != "" {
+            if chunk, err = decompress(chunk, algo); err != nil {
+                return errors.New(fmt.Sprintf("failed to decompress archive chunk at offset %d: %v", off, err))
+            }
+        }
+
+        if _, err = dst.Write(chunk); err != nil {
+            return err
+        }
+
+        if c.Progress != nil {
+            c.Progress(off+int64(len(chunk)), 0)
+        }
+        if int64(len(chunk)) < chunkSize {
+            return nil
+        }
+    }
+}
+
+// Upload sends size bytes from src to pth in chunks of chunkSize
+// bytes.
+//
+// When an upload for pth is already registered, only the byte
+// ranges the server has yet to receive are sent, allowing an
+// interrupted upload to be resumed. Otherwise, a new upload is
+// registered. Once all chunks are sent, the upload is finished
+// and verified by the server using the SHA-256 digest of src.
+func (c *Client) Upload(src io.ReaderAt, size int64, pth string, chunkSize int64) (err error) {
+
+    //=============================
+    // RESUME OR REGISTER THE UPLOAD
+    //=============================
+
+    var gaps []upload.ByteRange
+    var status structs.UploadStatusResponse
+    if status, err = c.UploadStatus(pth); err == nil {
+        gaps = upload.Gaps(status.Received, uint64(size))
+        log.INFO.Printf("Resuming upload: %d byte range(s) remaining", len(gaps))
+    } else if err == ErrUploadNotFound {
+        // Declaring the size allows the server to reject uploads
+        // exceeding its limits before any content is sent
+        var req []byte
+        if req, err = json.Marshal(structs.RegisterUploadRequest{Size: uint64(size)}); err != nil {
+            return err
+        } else if err = c.uploadRequest(http.MethodPut, pth, req, nil, nil); err != nil {
+            return errors.New(fmt.Sprintf("failed to register upload: %v", err))
+        }
+        gaps = upload.Gaps(nil, uint64(size))
+    } else {
+        return err
+    }
+
+    //=================
+    // SEND FILE CHUNKS
+    //=================
+
+    done := size
+    for _, g := range gaps {
+        done -= int64(g.End - g.Start)
+    }
+
+    for _, g := range gaps {
+        if err = c.sendRange(src, pth, int64(g.Start), int64(g.End), chunkSize, &done, size); err != nil {
+            return errors.New(fmt.Sprintf("%v (run the upload again to resume)", err))
+        }
+    }
+
+    //============================
+    // FINISH AND VERIFY THE UPLOAD
+    //============================
+
+    h := sha256.New()
+    if _, err = io.Copy(h, io.NewSectionReader(src, 0, size)); err != nil {
+        return err
+    }
+
+    var pay []byte
+    usize := uint64(size)
+    if pay, err = json.Marshal(structs.UploadFinishedRequest{
+        Size:   &usize,
+        Sha256: hex.EncodeToString(h.Sum(nil)),
+    }); err != nil {
+        return err
+    }
+
+    fResp := structs.UploadFinishedResponse{}
+    if err = c.uploadRequest(http.MethodPatch, pth, pay, nil, &fResp); err != nil {
+        err = errors.New(fmt.Sprintf("failed to finish upload: %v", err))
+        for _, g := range fResp.Gaps {
+            log.ERR.Printf("Missing byte range: %d-%d", g.Start, g.End)
+        }
+    }
+    return err
+}
+
+// sendRange sends the bytes between start and end (exclusive) from
+// src to the upload of pth in chunks of chunkSize bytes.
+func (c *Client) sendRange(src io.ReaderAt, pth string, start, end, chunkSize int64, done *int64, total int64) (err error) {
+    buff := make([]byte, chunkSize)
+    for off := start; off < end; off += chunkSize {
+
+        n := chunkSize
+        if off+n > end {
+            n = end - off
+        }
+
+        if _, err = src.ReadAt(buff[:n], off); err != nil && err != io.EOF {
+            return err
+        }
+
+        name, value := c.rangeHeader(off, off+n)
+        headers := map[string]string{name: value}
+
+        // Chunks are compressed prior to obfuscation
+        chunk := buff[:n]
+        if cName, algo := c.compression(); algo != "" {
+            if chunk, err = compress(chunk, algo); err != nil {
+                return err
+            }
+            headers[cName] = algo
+        }
+
+        if err = c.uploadRequest(http.MethodPost, pth, chunk, headers, nil); err != nil {
+            return errors.New(fmt.Sprintf("failed to send chunk at offset %d: %v", off, err))
+        }
+
+        *done += n
+        if c.Progress != nil {
+            c.Progress(*done, total)
+        }
+    }
+    return nil
+}
+
+// UploadStatus retrieves the status of the upload registered for
+// pth. ErrUploadNotFound is returned when no such upload exists.
+func (c *Client) UploadStatus(pth string) (status structs.UploadStatusResponse, err error) {
+    var resp *http.Response
+    if resp, err = c.doPath(http.MethodGet, c.Config.ApiRoutes.Upload, pth, nil, nil); err != nil {
+        return status, err
+    }
+
+    switch resp.StatusCode {
+    case http.StatusOK:
+        _, err = c.readObfResponse(resp, &status)
+    case http.StatusNotFound:
+        resp.Body.Close()
+        err = ErrUploadNotFound
+    default:
+        resp.Body.Close()
+        err = errors.New(fmt.Sprintf("failed to retrieve upload status (status code %d)", resp.StatusCode))
+    }
+    return status, err
+}
+
+// CancelUpload cancels the upload registered for pth, removing any
+// partially uploaded content from the server.
+func (c *Client) CancelUpload(pth string) (err error) {
+    return c.uploadRequest(http.MethodDelete, pth, nil, nil, nil)
+}
+
+// ListUploads returns all uploads currently registered with the
+// file server.
+func (c *Client) ListUploads() (uploads structs.ListUploadsResponse, err error) {
+    var resp *http.Response
+    if resp, err = c.do(http.MethodGet, c.Config.ApiRoutes.Upload, nil, nil); err != nil {
+        return uploads, err
+    }
+    if resp.StatusCode != http.StatusOK {
+        resp.Body.Close()
+        return uploads, errors.New(fmt.Sprintf("failed to list uploads (status code %d)", resp.StatusCode))
+    }
+    _, err = c.readObfResponse(resp, &uploads)
+    return uploads, err
+}
+
+// Mkdir creates the directory at pth on the file server, including
+// any missing parents.
+func (c *Client) Mkdir(pth string) error {
+    return c.pathRequest(http.MethodPut, c.Config.ApiRoutes.Manage, pth, nil, nil, nil)
+}
+
+// Delete deletes the file or directory at pth from the file server.
+// Non-empty directories are deleted only when recursive is set.
+func (c *Client) Delete(pth string, recursive bool) error {
+    return c.manageRequest(http.MethodDelete, pth, structs.FileOperationRequest{Recursive: recursive})
+}
+
+// Move moves the file or directory at src to dst on the file
+// server. An existing file at dst is replaced only when overwrite
+// is set.
+func (c *Client) Move(src, dst string, overwrite bool) error {
+    return c.manageRequest(http.MethodPatch, src, structs.FileOperationRequest{Destination: dst, Overwrite: overwrite})
+}
+
+// Copy copies the file or directory at src to dst on the file
+// server. An existing file at dst is replaced only when overwrite
+// is set.
+func (c *Client) Copy(src, dst string, overwrite bool) error {
+    return c.manageRequest(http.MethodPost, src, structs.FileOperationRequest{Destination: dst, Overwrite: overwrite})
+}
+
+// manageRequest sends req to the file management endpoint for pth.
+func (c *Client) manageRequest(method, pth string, req structs.FileOperationRequest) error {
+    payload, err := json.Marshal(req)
+    if err != nil {
+        return err
+    }
+    return c.pathRequest(method, c.Config.ApiRoutes.Manage, pth, payload, nil, nil)
+}
+
+// uploadRequest sends a request for the upload of pth via
+// pathRequest.
+func (c *Client) uploadRequest(method, pth string, payload []byte, headers map[string]string, errDst interface{}) (err error) {
+    return c.pathRequest(method, c.Config.ApiRoutes.Upload, pth, payload, headers, errDst)
+}
+
+// pathRequest sends a request for pth beneath route via doPath and
+// returns an error describing any non-200 response. When errDst is
+// non-nil, error responses are unmarshalled into it.
+func (c *Client) pathRequest(method, route, pth string, payload []byte, headers map[string]string, errDst interface{}) (err error) {
+    var resp *http.Response
+    if resp, err = c.doPath(method, route, pth, payload, headers); err != nil {
+        return err
+    }
+
+    if resp.StatusCode == http.StatusOK {
+        resp.Body.Close()
+        return nil
+    }
+
+    // Error responses may carry an obfuscated BaseResponse
+    data, rErr := c.readObfResponse(resp, nil)
+    br := structs.BaseResponse{}
+    if rErr == nil && json.Unmarshal(data, &br) == nil && br.Message != "" {
+        if errDst != nil {
+            json.Unmarshal(data, errDst)
+        }
+        return errors.New(fmt.Sprintf("%s (status code %d)", br.Message, resp.StatusCode))
+    }
+    return errors.New(fmt.Sprintf("status code %d", resp.StatusCode))
+}
+
+// compress compresses data with algo.
+func compress(data []byte, algo string) ([]byte, error) {
+    buff := bytes.Buffer{}
+    w, err := obf_stream.NewCompressor(&buff, algo)
+    if err != nil {
+        return nil, err
+    } else if _, err = w.Write(data); err != nil {
+        return nil, err
+    } else if err = w.Close(); err != nil {
+        return nil, err
+    }
+    return buff.Bytes(), nil
+}
+
+// decompress decompresses data with algo.
+func decompress(data []byte, algo string) ([]byte, error) {
+    r, err := obf_stream.NewDecompressor(bytes.NewReader(data), algo)
+    if err != nil {
+        return nil, err
+    }
+    defer r.Close()
+    return io.ReadAll(r)
+}
@@ -6,9 +6,9 @@ import (
     "fmt"
     "github.com/blackhillsinfosec/skyhook/config"
     "github.com/blackhillsinfosec/skyhook/log"
+    "github.com/blackhillsinfosec/skyhook/server"
     "github.com/spf13/cobra"
     "github.com/spf13/viper"
-    "golang.org/x/crypto/acme/autocert"
     "gopkg.in/yaml.v3"
     "net/http"
     "os"
@@ -24,8 +24,9 @@ var (
     runAcmeCmd = &cobra.Command{
         Use:     "run",
         Aliases: []string{"run"},
-        Short:   "Get a certificate via Lets Encrypt",
-        RunE:    runAcmeServer,
+        Short: "Get a certificate via Lets Encrypt. Set tls_config.mode " +
+            "to acme to have \"server run\" manage and renew certificates instead.",
+        RunE: runAcmeServer,
     }
     genAcmeConfigCmd = &cobra.Command{
         Use:     "generate-config",
@@ -162,10 +163,10 @@ func startAcme(conf *config.AcmeOptions, die chan uint8) {
     // CONFIGURE AND RUN THE SERVER
     //=============================
 
-    certMan := autocert.Manager{
-        Prompt:     autocert.AcceptTOS,
-        HostPolicy: autocert.HostWhitelist(conf.Fqdn),
-        Cache:      autocert.DirCache(conf.CertDir),
+    certMan, err := server.NewCertManager(conf)
+    if err != nil {
+        log.ERR.Printf("Failed to initialize ACME certificate manager: %v", err)
+        return
     }
     srv := &http.Server{
         Addr:      ":https",
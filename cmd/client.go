@@ -0,0 +1,363 @@
+package cmd
+
+import (
+    "errors"
+    "fmt"
+    "github.com/blackhillsinfosec/skyhook/client"
+    "github.com/blackhillsinfosec/skyhook/log"
+    "github.com/blackhillsinfosec/skyhook/server/archive"
+    "github.com/spf13/cobra"
+    "golang.org/x/exp/slices"
+    "os"
+    "path"
+    "strings"
+    "text/tabwriter"
+)
+
+var (
+    //===============
+    // COBRA COMMANDS
+    //===============
+
+    clientCmd = &cobra.Command{
+        Use:     "client",
+        Aliases: []string{"c", "cli"},
+        Short:   "Interact with a running Skyhook file server.",
+    }
+    clientListCmd = &cobra.Command{
+        Use:     "list [remote path]",
+        Aliases: []string{"ls", "inspect"},
+        Short:   "List a directory or inspect a file on the file server.",
+        Args:    cobra.MaximumNArgs(1),
+        RunE:    runClientList,
+    }
+    clientDownloadCmd = &cobra.Command{
+        Use:     "download <remote path> [local path]",
+        Aliases: []string{"dl", "get"},
+        Short:   "Download a file, or a directory as an archive, from the file server.",
+        Args:    cobra.RangeArgs(1, 2),
+        RunE:    runClientDownload,
+    }
+    clientUploadCmd = &cobra.Command{
+        Use:     "upload <local path> <remote path>",
+        Aliases: []string{"up", "put"},
+        Short:   "Upload a file to the file server, resuming any interrupted upload.",
+        Args:    cobra.ExactArgs(2),
+        RunE:    runClientUpload,
+    }
+    clientCancelCmd = &cobra.Command{
+        Use:     "cancel <remote path>",
+        Aliases: []string{"rm-upload"},
+        Short:   "Cancel an upload, removing any partially uploaded content.",
+        Args:    cobra.ExactArgs(1),
+        RunE:    runClientCancel,
+    }
+    clientMkdirCmd = &cobra.Command{
+        Use:   "mkdir <remote path>",
+        Short: "Create a directory, including any missing parents, on the file server.",
+        Args:  cobra.ExactArgs(1),
+        RunE:  runClientMkdir,
+    }
+    clientDeleteCmd = &cobra.Command{
+        Use:     "delete <remote path>",
+        Aliases: []string{"rm"},
+        Short:   "Delete a file or directory from the file server.",
+        Args:    cobra.ExactArgs(1),
+        RunE:    runClientDelete,
+    }
+    clientMoveCmd = &cobra.Command{
+        Use:     "move <remote source> <remote destination>",
+        Aliases: []string{"mv"},
+        Short:   "Move a file or directory on the file server.",
+        Args:    cobra.ExactArgs(2),
+        RunE:    runClientMove,
+    }
+    clientCopyCmd = &cobra.Command{
+        Use:     "copy <remote source> <remote destination>",
+        Aliases: []string{"cp"},
+        Short:   "Copy a file or directory on the file server.",
+        Args:    cobra.ExactArgs(2),
+        RunE:    runClientCopy,
+    }
+
+    //================
+    // OTHER VARIABLES
+    //================
+
+    // clientUrl is the base URL of the file server.
+    clientUrl string
+    // clientUsername is the username used to authenticate.
+    clientUsername string
+    // clientPassword is the password used to authenticate.
+    clientPassword string
+    // clientToken is the user token used to decrypt the
+    // operating config.
+    clientToken string
+    // clientTotp is the TOTP code sent when authenticating.
+    clientTotp string
+    // clientInsecure disables certificate verification.
+    clientInsecure bool
+    // clientChunkSize is the size of each transferred chunk
+    // in megabytes.
+    clientChunkSize uint
+    // clientCompression is the algorithm requested to compress
+    // file chunks.
+    clientCompression string
+    // clientArchive is the format of the archive requested when
+    // downloading a directory.
+    clientArchive string
+    // clientRecursive allows non-empty directories to be deleted.
+    clientRecursive bool
+    // clientOverwrite allows moves and copies to replace an
+    // existing file.
+    clientOverwrite bool
+)
+
+func init() {
+    RootCmd.AddCommand(clientCmd)
+    clientCmd.AddCommand(clientListCmd, clientDownloadCmd, clientUploadCmd, clientCancelCmd,
+        clientMkdirCmd, clientDeleteCmd, clientMoveCmd, clientCopyCmd)
+
+    flags := clientCmd.PersistentFlags()
+    flags.StringVarP(&clientUrl, "url", "u", "",
+        "Base URL of the file server, e.g., https://your.fqdn.here.")
+    flags.StringVarP(&clientUsername, "username", "U", "", "Username.")
+    flags.StringVarP(&clientPassword, "password", "P", "",
+        "Password. Read from the SKYHOOK_PASSWORD environment variable when omitted.")
+    flags.StringVarP(&clientToken, "token", "t", "",
+        "User token. Read from the SKYHOOK_TOKEN environment variable when omitted.")
+    flags.StringVar(&clientTotp, "totp", "",
+        "Current TOTP code, required when the user has enrolled TOTP. Read from the SKYHOOK_TOTP environment variable when omitted.")
+    flags.BoolVarP(&clientInsecure, "insecure", "k", false,
+        "Disable verification of the server's certificate.")
+    flags.UintVarP(&clientChunkSize, "chunk-size", "s", 10,
+        "Size of each transferred chunk in megabytes.")
+    flags.StringVarP(&clientCompression, "compression", "z", "",
+        "Compress file chunks with gzip or zstd when enabled by the file server.")
+    clientDownloadCmd.Flags().StringVarP(&clientArchive, "archive", "a", "",
+        fmt.Sprintf("Download a directory as an archive in the given format (%s).", strings.Join(archive.Formats, ", ")))
+    clientDeleteCmd.Flags().BoolVarP(&clientRecursive, "recursive", "r", false,
+        "Delete non-empty directories and their content.")
+    for _, cmd := range []*cobra.Command{clientMoveCmd, clientCopyCmd} {
+        cmd.Flags().BoolVarP(&clientOverwrite, "overwrite", "f", false,
+            "Replace an existing file at the destination.")
+    }
+    clientCmd.MarkPersistentFlagRequired("url")
+    clientCmd.MarkPersistentFlagRequired("username")
+}
+
+// clientLogin initializes a client.Client and authenticates to
+// the file server.
+func clientLogin() (c *client.Client, err error) {
+    if clientPassword == "" {
+        clientPassword = os.Getenv("SKYHOOK_PASSWORD")
+    }
+    if clientToken == "" {
+        clientToken = os.Getenv("SKYHOOK_TOKEN")
+    }
+    if clientTotp == "" {
+        clientTotp = os.Getenv("SKYHOOK_TOTP")
+    }
+    if clientPassword == "" || clientToken == "" {
+        return nil, errors.New("a password and user token are required")
+    }
+    if clientChunkSize == 0 {
+        return nil, errors.New("chunk size must be greater than zero")
+    }
+
+    c = client.New(clientUrl, clientToken, clientInsecure)
+    c.Compression = clientCompression
+    if err = c.Login(clientUsername, clientPassword, clientTotp); err != nil {
+        log.ERR.Printf("Failed to authenticate to file server: %v", err)
+        return nil, err
+    }
+    if clientCompression != "" && !slices.Contains(c.Config.CompressionConfig.Algorithms, clientCompression) {
+        log.WARN.Printf("File server doesn't support %s compression; chunks will be uncompressed", clientCompression)
+    }
+    return c, err
+}
+
+// clientLogout logs c out, logging any error.
+func clientLogout(c *client.Client) {
+    if err := c.Logout(); err != nil {
+        log.WARN.Printf("Failed to log out: %v", err)
+    }
+}
+
+// clientProgress logs the progress of a transfer. total is zero
+// when the size of the transfer isn't known in advance.
+func clientProgress(done, total int64) {
+    if total == 0 {
+        log.INFO.Printf("Transferred %d bytes", done)
+        return
+    }
+    log.INFO.Printf("Transferred %d/%d bytes (%.2f%%)", done, total, 100*float64(done)/float64(total))
+}
+
+func runClientList(cmd *cobra.Command, args []string) (err error) {
+    pth := "/"
+    if len(args) > 0 {
+        pth = args[0]
+    }
+
+    var c *client.Client
+    if c, err = clientLogin(); err != nil {
+        return err
+    }
+    defer clientLogout(c)
+
+    ir, err := c.List(pth)
+    if err != nil {
+        return err
+    }
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+    for _, e := range ir.Entries {
+        name := e.Name
+        if e.IsDir {
+            name += "/"
+        }
+        fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", e.Mode, e.Size, e.ModTime.Format("2006-01-02 15:04:05"), name)
+    }
+    return w.Flush()
+}
+
+func runClientDownload(cmd *cobra.Command, args []string) (err error) {
+    if clientArchive != "" && !archive.ValidFormat(clientArchive) {
+        return errors.New(fmt.Sprintf("unsupported archive format: %s", clientArchive))
+    }
+
+    remote := args[0]
+    _, local := path.Split(path.Clean("/" + remote))
+    if clientArchive != "" {
+        if local == "" {
+            local = "root"
+        }
+        local += "." + clientArchive
+    }
+    if len(args) > 1 {
+        local = args[1]
+    }
+
+    var c *client.Client
+    if c, err = clientLogin(); err != nil {
+        return err
+    }
+    defer clientLogout(c)
+    c.Progress = clientProgress
+
+    var f *os.File
+    if f, err = os.OpenFile(local, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600); err != nil {
+        return err
+    }
+
+    log.INFO.Printf("Downloading %s to %s", remote, local)
+    if clientArchive != "" {
+        err = c.DownloadArchive(remote, clientArchive, f, int64(clientChunkSize)*1024*1024)
+    } else {
+        err = c.Download(remote, f, int64(clientChunkSize)*1024*1024)
+    }
+    if err != nil {
+        f.Close()
+        os.Remove(local)
+        return err
+    }
+
+    log.INFO.Printf("Download finished: %s", local)
+    return f.Close()
+}
+
+func runClientUpload(cmd *cobra.Command, args []string) (err error) {
+    local, remote := args[0], args[1]
+
+    var f *os.File
+    if f, err = os.Open(local); err != nil {
+        return err
+    }
+    defer f.Close()
+
+    var stat os.FileInfo
+    if stat, err = f.Stat(); err != nil {
+        return err
+    } else if stat.IsDir() {
+        return errors.New(fmt.Sprintf("%s is a directory", local))
+    }
+
+    var c *client.Client
+    if c, err = clientLogin(); err != nil {
+        return err
+    }
+    defer clientLogout(c)
+    c.Progress = clientProgress
+
+    log.INFO.Printf("Uploading %s to %s", local, remote)
+    if err = c.Upload(f, stat.Size(), remote, int64(clientChunkSize)*1024*1024); err == nil {
+        log.INFO.Printf("Upload finished: %s", remote)
+    }
+    return err
+}
+
+func runClientCancel(cmd *cobra.Command, args []string) (err error) {
+    var c *client.Client
+    if c, err = clientLogin(); err != nil {
+        return err
+    }
+    defer clientLogout(c)
+
+    if err = c.CancelUpload(args[0]); err == nil {
+        log.INFO.Printf("Upload canceled: %s", args[0])
+    }
+    return err
+}
+
+func runClientMkdir(cmd *cobra.Command, args []string) (err error) {
+    var c *client.Client
+    if c, err = clientLogin(); err != nil {
+        return err
+    }
+    defer clientLogout(c)
+
+    if err = c.Mkdir(args[0]); err == nil {
+        log.INFO.Printf("Directory created: %s", args[0])
+    }
+    return err
+}
+
+func runClientDelete(cmd *cobra.Command, args []string) (err error) {
+    var c *client.Client
+    if c, err = clientLogin(); err != nil {
+        return err
+    }
+    defer clientLogout(c)
+
+    if err = c.Delete(args[0], clientRecursive); err == nil {
+        log.INFO.Printf("Deleted: %s", args[0])
+    }
+    return err
+}
+
+func runClientMove(cmd *cobra.Command, args []string) (err error) {
+    var c *client.Client
+    if c, err = clientLogin(); err != nil {
+        return err
+    }
+    defer clientLogout(c)
+
+    if err = c.Move(args[0], args[1], clientOverwrite); err == nil {
+        log.INFO.Printf("Moved %s to %s", args[0], args[1])
+    }
+    return err
+}
+
+func runClientCopy(cmd *cobra.Command, args []string) (err error) {
+    var c *client.Client
+    if c, err = clientLogin(); err != nil {
+        return err
+    }
+    defer clientLogout(c)
+
+    if err = c.Copy(args[0], args[1], clientOverwrite); err == nil {
+        log.INFO.Printf("Copied %s to %s", args[0], args[1])
+    }
+    return err
+}
@@ -1,11 +1,18 @@
 package cmd
 
 import (
+    "context"
+    "errors"
     "fmt"
     obfs "github.com/blackhillsinfosec/skyhook-obfuscation"
+    "github.com/blackhillsinfosec/skyhook/audit"
     "github.com/blackhillsinfosec/skyhook/config"
     "github.com/blackhillsinfosec/skyhook/log"
     "github.com/blackhillsinfosec/skyhook/server"
+    "github.com/blackhillsinfosec/skyhook/server/lockout"
+    mw "github.com/blackhillsinfosec/skyhook/server/middleware"
+    "github.com/blackhillsinfosec/skyhook/server/session"
+    "github.com/blackhillsinfosec/skyhook/server/share"
     "github.com/blackhillsinfosec/skyhook/server/upload"
     "github.com/fsnotify/fsnotify"
     "github.com/gin-gonic/gin"
@@ -13,15 +20,19 @@ import (
     "github.com/impostorkeanu/go-commoners/rando"
     "github.com/spf13/cobra"
     "github.com/spf13/viper"
+    "golang.org/x/crypto/acme/autocert"
     "golang.org/x/exp/maps"
     "golang.org/x/exp/slices"
     "golang.org/x/sync/semaphore"
     "gopkg.in/yaml.v3"
     "io/fs"
+    "net/http"
     "os"
+    "os/signal"
     "path"
     "strings"
     "sync"
+    "syscall"
     "time"
 )
 
@@ -43,6 +54,12 @@ var (
         Short:   "Run the Skyhook servers.",
         RunE:    runSkyhook,
     }
+    migratePasswordsCmd = &cobra.Command{
+        Use:     "migrate-passwords",
+        Aliases: []string{"migrate", "mp"},
+        Short:   "Hash all cleartext passwords in a Skyhook server configuration file.",
+        RunE:    migratePasswords,
+    }
     genServerConfigCmd = &cobra.Command{
         Use:     "generate-config",
         Aliases: genAliases,
@@ -78,10 +95,13 @@ var (
 func init() {
     gin.SetMode(gin.ReleaseMode)
     RootCmd.AddCommand(serverCmd)
-    serverCmd.AddCommand(genServerConfigCmd, runServersCmd)
+    serverCmd.AddCommand(genServerConfigCmd, runServersCmd, migratePasswordsCmd)
     runServersCmd.Flags().StringVarP(&configFile, "config-file", "c",
         "", "Configuration file.")
     runServersCmd.MarkFlagRequired("config-file")
+    migratePasswordsCmd.Flags().StringVarP(&configFile, "config-file", "c",
+        "", "Configuration file.")
+    migratePasswordsCmd.MarkFlagRequired("config-file")
     runServersCmd.Flags().Bool("no-admin-server", false,
         "Run only the file server. Make any updates by updating the config file.")
 
@@ -122,10 +142,15 @@ func runSkyhook(cmd *cobra.Command, args []string) (err error) {
         return err
     }
 
+    if err = audit.Init(gConfig.Audit); err != nil {
+        log.ERR.Printf("Failed to initialize audit log: %v", err)
+        return err
+    }
+    defer audit.Close()
+
     noRunAdmin, _ := cmd.Flags().GetBool("no-admin-server")
     if noRunAdmin {
         err = runWithoutAdmin()
-        fServer.Run(false)
     } else {
         err = runWithAdmin()
     }
@@ -133,62 +158,144 @@ func runSkyhook(cmd *cobra.Command, args []string) (err error) {
     return err
 }
 
+// runWithoutAdmin runs only the file server, reloading its config
+// whenever the config file changes. It blocks until SIGINT or SIGTERM
+// is received.
 func runWithoutAdmin() (err error) {
+    var obfsChain *[]obfs.Obfuscator
+    var profiles *server.ObfProfiles
+    if gConfig, obfsChain, profiles, err = loadConfig(); err != nil {
+        return err
+    }
+    fsConfig = &gConfig.FileServer
+
+    upMgr, err := newUploadManager(&fsConfig.UploadOptions)
+    if err != nil {
+        log.ERR.Printf("Failed to initialize upload manager: %v", err)
+        return err
+    }
+    certMan, stopChallenges, err := startCertManager()
+    if err != nil {
+        return err
+    }
+    defer stopChallenges()
+
+    fServer = server.SkyhookServer{
+        Config:          fsConfig,
+        Tls:             &gConfig.Tls,
+        Users:           &gConfig.Users,
+        ObfuscatorChain: mw.NewObfChain(obfsChain),
+        Profiles:        profiles,
+        UploadManager:   upMgr,
+        Sessions:        session.NewStore(),
+        Lockouts:        lockout.NewTracker(),
+        Global:          gConfig,
+        CertManager:     certMan,
+    }
+
+    if err = fServer.Run(true); err != nil {
+        return err
+    }
+    go warmCertificates(certMan)
+    log.INFO.Printf("File server started on: %s", fsConfig.Listener())
+
+    //========================
+    // RELOAD ON CONFIG CHANGES
+    //========================
+
+    // The engine is built by Run, so watching starts only after
+    // it returns.
     _viper.OnConfigChange(func(e fsnotify.Event) {
         log.INFO.Printf("Config file changed: %s", e.Name)
         log.INFO.Printf("Reloading server config")
-        if err := loadConfig(); err != nil {
+        if err := reloadConfig(); err != nil {
             log.WARN.Printf("Failed to reload configuration file: %v", err)
             log.INFO.Printf("Preserving previously loaded config file")
         }
     })
     _viper.WatchConfig()
-    return loadConfig()
-}
-
-func loadConfig() (err error) {
 
     //=================================
-    // LOAD AND VALIDATE THE NEW CONFIG
+    // ROTATE OBFUSCATION KEYS IN MEMORY
     //=================================
 
+    // Without the admin server, rotated keys aren't written to the
+    // config file, so they're lost upon restart or reload.
+    if rot := fsConfig.RotationOptions; rot.Interval > 0 {
+        log.INFO.Printf("Rotating obfuscation keys every %v", rot.Every())
+        stopRotation := server.ScheduleRotation(rot.Every(), func() {
+            if err := conSem.Acquire(ctx{}, 1); err != nil {
+                log.ERR.Println("Failed to acquire semaphore to rotate obfuscation keys")
+                return
+            }
+            defer conSem.Release(1)
+            if err := server.RotateChains(fServer.Global, fServer.ObfuscatorChain, fServer.Profiles); err != nil {
+                log.ERR.Printf("Failed to rotate obfuscation keys: %v", err)
+            }
+        })
+        defer stopRotation()
+    }
+
+    done := make(chan struct{})
+    handleSignals(func() { close(done) })
+
+    log.INFO.Printf("Blocking until shutdown request")
+    <-done
+
+    sCtx, cancel := context.WithTimeout(context.Background(), gConfig.Shutdown.Timeout())
+    defer cancel()
+    return fServer.Shutdown(sCtx)
+}
+
+// reloadConfig loads the config file and applies it to the running
+// file server, logging which changes were applied live and which
+// require a restart.
+func reloadConfig() (err error) {
     if err = conSem.Acquire(ctx{}, 1); err != nil {
         log.ERR.Println("Failed to acquire semaphore to reload config file")
         return err
     }
     defer conSem.Release(1)
 
-    if err = _viper.ReadInConfig(); err != nil {
-        log.ERR.Printf("Failed to read config file: %v", err)
+    buff, obfsChain, profiles, err := loadConfig()
+    if err != nil {
         return err
     }
 
-    buff := config.SkyhookConfig{}
-
-    if err = _viper.UnmarshalExact(&buff); err != nil {
-        log.ERR.Printf("Failed to unmarshal config file (poorly formatted YAML?): %v", err)
+    var changes server.ReloadChanges
+    if changes, err = fServer.Reload(buff, obfsChain, profiles); err != nil {
         return err
     }
+    changes.Log()
 
-    if err = buff.Validate(); err != nil {
-        log.ERR.Printf("New configuration failed validation: %v", err)
-        return err
-    }
+    gConfig = buff
+    fsConfig = &buff.FileServer
+    return nil
+}
 
-    //=======================
-    // NOTIFY OF PORT CHANGES
-    //=======================
+// loadConfig reads and validates the config file, returning it
+// along with the parsed obfuscator chain.
+func loadConfig() (buff *config.SkyhookConfig, obfsChain *[]obfs.Obfuscator, profiles *server.ObfProfiles, err error) {
 
-    restartMsg := "Stop and restart the server to implement this change"
+    //=================================
+    // LOAD AND VALIDATE THE NEW CONFIG
+    //=================================
 
-    if fsConfig != nil && buff.FileServer.Port != fsConfig.Port {
-        log.WARN.Printf("File server port changed to: %d", buff.FileServer.Port)
-        log.WARN.Println(restartMsg)
+    if err = _viper.ReadInConfig(); err != nil {
+        log.ERR.Printf("Failed to read config file: %v", err)
+        return nil, nil, nil, err
     }
 
-    if fsConfig != nil && buff.FileServer.Interface != fsConfig.Interface {
-        log.WARN.Printf("File server interface changed to: %v", buff.FileServer.Interface)
-        log.WARN.Println(restartMsg)
+    buff = &config.SkyhookConfig{}
+
+    if err = _viper.UnmarshalExact(buff); err != nil {
+        log.ERR.Printf("Failed to unmarshal config file (poorly formatted YAML?): %v", err)
+        return nil, nil, nil, err
+    }
+
+    if err = buff.Validate(); err != nil {
+        log.ERR.Printf("New configuration failed validation: %v", err)
+        return nil, nil, nil, err
     }
 
     if len(buff.Users) == 0 {
@@ -196,34 +303,41 @@ func loadConfig() (err error) {
         log.ERR.Print("Configure a user to access the file server")
     }
 
-    //========================
-    // UPDATE TO LATEST CONFIG
-    //========================
-
-    gConfig = &buff
-    fsConfig = &buff.FileServer
-    fServer.Config = fsConfig
-    fServer.Tls = &gConfig.Tls
-    fServer.Users = &gConfig.Users
+    //==========================
+    // PARSE THE OBFUSCATOR CHAIN
+    //==========================
 
-    obfsChain, failures := obfs.ParseObfuscators(&fsConfig.Obfuscators)
+    obfsChain, failures := obfs.ParseObfuscators(&buff.FileServer.Obfuscators)
     if len(failures) > 0 {
+        err = errors.New(fmt.Sprintf("failed to parse obfuscator(s): %s", strings.Join(failures, ", ")))
         log.ERR.Printf("Failed to parse obfuscator(s): %s", strings.Join(failures, ", "))
+        return nil, nil, nil, err
     }
 
-    if len(fsConfig.Obfuscators) == 0 {
+    if len(buff.FileServer.Obfuscators) == 0 {
         log.WARN.Println("Zero (0) obfuscators have been configured")
         log.WARN.Println("File obfuscation will be disabled")
     } else {
         var algos []string
-        for _, o := range fsConfig.Obfuscators {
+        for _, o := range buff.FileServer.Obfuscators {
             algos = append(algos, o.Algo)
         }
         log.INFO.Printf("Current obfuscation pipeline: %s", strings.Join(algos, "|"))
     }
-    fServer.ObfuscatorChain = obfsChain
 
-    return err
+    if profiles, err = server.NewObfProfiles(buff.FileServer.ObfuscationProfiles); err != nil {
+        log.ERR.Printf("Failed to parse obfuscation profiles: %v", err)
+        return nil, nil, nil, err
+    }
+    for _, p := range buff.FileServer.ObfuscationProfiles {
+        var algos []string
+        for _, o := range p.Obfuscators {
+            algos = append(algos, o.Algo)
+        }
+        log.INFO.Printf("Obfuscation pipeline of profile %s: %s", p.Name, strings.Join(algos, "|"))
+    }
+
+    return buff, obfsChain, profiles, nil
 }
 
 // runWithAdmin runs both the file and admin server, allowing for a
@@ -243,27 +357,49 @@ func runWithAdmin() (err error) {
     if len(failures) > 0 {
         log.ERR.Printf("Failed to parse obfuscator(s): %s", strings.Join(failures, ", "))
     }
+    // The admin server replaces the chain shared with the file server
+    defChain := mw.NewObfChain(obfsChain)
+    profiles, err := server.NewObfProfiles(fsConfig.ObfuscationProfiles)
+    if err != nil {
+        log.ERR.Printf("Failed to parse obfuscation profiles: %v", err)
+        return err
+    }
 
-    log.INFO.Printf("File server started on: %s", fsConfig.Socket())
-    log.INFO.Printf("Admin server started on: %s", asConfig.Socket())
+    log.INFO.Printf("File server started on: %s", fsConfig.Listener())
+    log.INFO.Printf("Admin server started on: %s", asConfig.Listener())
     log.INFO.Printf("Blocking until shutdown request")
 
     // Initialize the server.
-    upMgr, err := upload.NewManager(&fsConfig.UploadOptions.RegistrantsFile, &fsConfig.UploadOptions.MaxUploadDuration)
+    upMgr, err := newUploadManager(&fsConfig.UploadOptions)
     if err != nil {
         log.ERR.Printf("Failed to initialize upload manager: %v", err)
         panic(err)
     }
+    certMan, stopChallenges, err := startCertManager()
+    if err != nil {
+        return err
+    }
+    defer stopChallenges()
+
+    shares, sessions, lockouts := share.NewTokens(), session.NewStore(), lockout.NewTracker()
     fServer = server.SkyhookServer{
         Config:          fsConfig,
         Tls:             &gConfig.Tls,
         Users:           &gConfig.Users,
-        ObfuscatorChain: obfsChain,
-        UploadManager:   &upMgr,
+        ObfuscatorChain: defChain,
+        Profiles:        profiles,
+        UploadManager:   upMgr,
+        Shares:          shares,
+        Sessions:        sessions,
+        Lockouts:        lockouts,
         Global:          gConfig,
+        CertManager:     certMan,
     }
 
-    fServer.Run(true)
+    if err = fServer.Run(true); err != nil {
+        return err
+    }
+    go warmCertificates(certMan)
 
     //=======================
     // START THE ADMIN SERVER
@@ -275,21 +411,48 @@ func runWithAdmin() (err error) {
         Config:               asConfig,
         Users:                &gConfig.Users,
         Tls:                  &gConfig.Tls,
-        ObfuscatorChain:      obfsChain,
+        ObfuscatorChain:      defChain,
+        Profiles:             profiles,
         Kill:                 make(chan uint8, 1),
         ConfigFileMu:         sync.Mutex{},
         ConfigFile:           &configFile,
         Global:               gConfig,
         EncryptedJsGenerator: fServer.GenEncryptedLoader,
+        CertManager:          certMan,
+        UploadManager:        upMgr,
+        Shares:               shares,
+        Sessions:             sessions,
+        Lockouts:             lockouts,
     }
 
-    err = aServer.Run()
+    if rot := fsConfig.RotationOptions; rot.Interval > 0 {
+        log.INFO.Printf("Rotating obfuscation keys every %v", rot.Every())
+        stopRotation := server.ScheduleRotation(rot.Every(), func() {
+            if err := aServer.RotateObfuscators(); err != nil {
+                log.ERR.Printf("Failed to rotate obfuscation keys: %v", err)
+            }
+        })
+        defer stopRotation()
+    }
 
-    gConfig.FileServer.Obfuscators = *obfs.UnparseObfuscators(aServer.ObfuscatorChain)
+    handleSignals(func() { aServer.Kill <- 1 })
+    err = aServer.Run()
 
-    // This error is expected.
-    if strings.Contains(strings.ToLower(err.Error()), "http: server closed") {
-        err = nil
+    //==================
+    // STOP BOTH SERVERS
+    //==================
+    // Both servers drain concurrently within a single deadline.
+
+    sCtx, cancel := context.WithTimeout(context.Background(), gConfig.Shutdown.Timeout())
+    defer cancel()
+    aErr := make(chan error, 1)
+    go func() { aErr <- aServer.Shutdown(sCtx) }()
+    fErr := fServer.Shutdown(sCtx)
+    if sErr := <-aErr; sErr != nil && err == nil {
+        err = sErr
+    }
+    if fErr != nil && err == nil {
+        err = fErr
     }
 
     //======================================
@@ -297,48 +460,197 @@ func runWithAdmin() (err error) {
     //======================================
 
     log.INFO.Print("Attempting to save current config file")
-    if buff, err := yaml.Marshal(&gConfig); err != nil {
-        log.ERR.Printf("Failed to marshal config file for writing: %v", err)
-    } else {
-        if cBuff, err := os.ReadFile(configFile); err == nil {
-
-            //========================
-            // SAVE BACKUP CONFIG FILE
-            //========================
-
-            backFile := fmt.Sprintf("%s.%s.%v.%s",
-                strings.Trim(configFile, ".yml"),
-                "backup",
-                time.Now().Unix(),
-                "yml")
-            log.INFO.Printf("Writing backup config file: %s", backFile)
-            if err := os.WriteFile(backFile, cBuff, 0600); err != nil {
-                log.ERR.Printf("Failed to write backup config: %v", err)
-            } else {
-
-                //=========================
-                // SAVE CURRENT CONFIG FILE
-                //=========================
-
-                log.INFO.Printf("Writing config file: %v", configFile)
-                if err := os.WriteFile(configFile, buff, 0600); err != nil {
-                    log.ERR.Printf("Failed to write config file: %v", err)
-                }
+    gConfig.FileServer.Obfuscators = *obfs.UnparseObfuscators(aServer.ObfuscatorChain.Load())
+    if wErr := aServer.FlushConfig(); wErr != nil {
+        log.ERR.Printf("Failed to save config file: %v", wErr)
+    }
+
+    return err
+
+}
+
+// startCertManager initializes ACME certificate management when
+// enabled by the TLS config, returning a nil manager otherwise.
+//
+// When an HTTP-01 challenge address is configured, a listener is
+// started to answer challenges. stop closes it.
+func startCertManager() (m *autocert.Manager, stop func(), err error) {
+    stop = func() {}
+    if !gConfig.Tls.IsAcme() {
+        return nil, stop, nil
+    }
+
+    opts := gConfig.Tls.Acme
+    if m, err = server.NewCertManager(opts); err != nil {
+        log.ERR.Printf("Failed to initialize ACME certificate manager: %v", err)
+        return nil, stop, err
+    }
+    log.INFO.Printf("Managing certificates via ACME directory: %s", opts.DirectoryUrl)
+
+    if opts.HttpChallengeAddress != "" {
+        srv := server.NewAcmeChallengeServer(m, opts.HttpChallengeAddress)
+        go func() {
+            log.INFO.Printf("Answering ACME HTTP-01 challenges on: %s", opts.HttpChallengeAddress)
+            if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+                log.ERR.Printf("ACME HTTP-01 challenge server failed: %v", err)
             }
+        }()
+        stop = func() { srv.Close() }
+    }
 
-        } else {
+    return m, stop, nil
+}
 
-            //===================================
-            // FAILED TO READ CURRENT CONFIG FILE
-            //===================================
+// warmCertificates obtains certificates for the configured FQDNs
+// once the servers are listening. m may be nil.
+func warmCertificates(m *autocert.Manager) {
+    if m == nil {
+        return
+    }
+    if err := server.WarmCertificates(m, gConfig.Tls.Acme.Fqdns()); err != nil {
+        log.ERR.Printf("%v", err)
+        log.WARN.Println("Certificates will be requested again upon the next TLS handshake")
+    }
+}
 
-            log.ERR.Printf("Failed to read config file: %v", err)
+// newUploadManager opens the registrants store configured by opts
+// and initializes an upload.Manager enforcing its limits, which are
+// converted from megabytes to bytes.
+func newUploadManager(opts *config.FileServerUploadOptions) (*upload.Manager, error) {
+    store, err := upload.OpenStore(opts.RegistrantsStore, opts.RegistrantsFile)
+    if err != nil {
+        return nil, err
+    }
 
-        }
+    const mb = 1 << 20
+    m, err := upload.NewManager(store, &opts.MaxUploadDuration, upload.Limits{
+        MaxFileSize:  uint64(opts.MaxFileSize) * mb,
+        UserQuota:    uint64(opts.UserQuota) * mb,
+        MinFreeSpace: uint64(opts.MinFreeSpace) * mb,
+    })
+    if err != nil {
+        store.Close()
     }
+    return m, err
+}
 
+// handleSignals calls shutdown in a new goroutine upon receiving
+// SIGINT or SIGTERM. Receiving a second signal exits immediately.
+func handleSignals(shutdown func()) {
+    sigs := make(chan os.Signal, 1)
+    signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+    go func() {
+        sig := <-sigs
+        log.WARN.Printf("Received %v, shutting down gracefully (signal again to force)", sig)
+        go shutdown()
+        sig = <-sigs
+        log.ERR.Printf("Received %v, forcing shutdown", sig)
+        os.Exit(1)
+    }()
+}
+
+// writeConfigFile writes a backup of the current config file to
+// disk and then overwrites the config file with buff.
+func writeConfigFile(buff []byte) (err error) {
+    var cBuff []byte
+    if cBuff, err = os.ReadFile(configFile); err != nil {
+
+        //===================================
+        // FAILED TO READ CURRENT CONFIG FILE
+        //===================================
+
+        log.ERR.Printf("Failed to read config file: %v", err)
+        return err
+
+    }
+
+    //========================
+    // SAVE BACKUP CONFIG FILE
+    //========================
+
+    backFile := fmt.Sprintf("%s.%s.%v.%s",
+        strings.Trim(configFile, ".yml"),
+        "backup",
+        time.Now().Unix(),
+        "yml")
+    log.INFO.Printf("Writing backup config file: %s", backFile)
+    if err = os.WriteFile(backFile, cBuff, 0600); err != nil {
+        log.ERR.Printf("Failed to write backup config: %v", err)
+        return err
+    }
+
+    //=========================
+    // SAVE CURRENT CONFIG FILE
+    //=========================
+
+    log.INFO.Printf("Writing config file: %v", configFile)
+    if err = os.WriteFile(configFile, buff, 0600); err != nil {
+        log.ERR.Printf("Failed to write config file: %v", err)
+    }
     return err
+}
+
+// migratePasswords hashes all cleartext passwords found in
+// the config file, rewriting it after saving a backup.
+func migratePasswords(cmd *cobra.Command, args []string) (err error) {
 
+    //=======================
+    // READ THE CURRENT CONFIG
+    //=======================
+
+    log.INFO.Printf("Using config file at %s", configFile)
+    if _, err = os.Stat(configFile); err != nil {
+        return err
+    }
+
+    _viper.SetConfigType("yaml")
+    _viper.SetConfigFile(configFile)
+
+    if err = _viper.ReadInConfig(); err != nil {
+        log.ERR.Printf("Failed to read config file: %v", err)
+        return err
+    }
+
+    buff := config.SkyhookConfig{}
+    if err = _viper.UnmarshalExact(&buff); err != nil {
+        log.ERR.Printf("Failed to unmarshal config file (poorly formatted YAML?): %v", err)
+        return err
+    }
+
+    //========================
+    // HASH CLEARTEXT PASSWORDS
+    //========================
+
+    var count int
+    for i := range buff.Users {
+        var migrated bool
+        if migrated, err = buff.Users[i].MigratePassword(); err != nil {
+            log.ERR.Printf("Failed to hash password for %s: %v", buff.Users[i].Username, err)
+            return err
+        } else if migrated {
+            log.INFO.Printf("Hashed password for %s", buff.Users[i].Username)
+            count++
+        }
+    }
+
+    if count == 0 {
+        log.INFO.Println("No cleartext passwords found")
+        return nil
+    }
+
+    //==============================
+    // WRITE THE MIGRATED CONFIG FILE
+    //==============================
+
+    var out []byte
+    if out, err = yaml.Marshal(&buff); err != nil {
+        log.ERR.Printf("Failed to marshal config file for writing: %v", err)
+        return err
+    }
+    if err = writeConfigFile(out); err == nil {
+        log.INFO.Printf("Migrated %d password(s)", count)
+    }
+    return err
 }
 
 func handleDir(dEnt fs.DirEntry, root string, routes *map[string]string) {
@@ -440,6 +752,8 @@ func genSkyhookConfig(cmd *cobra.Command, args []string) {
         "download": "/files",
         "upload":   "/upload",
         "config":   "/config",
+        "manage":   "/manage",
+        "share":    "/share",
     }
 
     if randApiPathsLen > 0 {
@@ -490,6 +804,7 @@ func genSkyhookConfig(cmd *cobra.Command, args []string) {
             CertPath: "",
             KeyPath:  "",
         },
+        TlsProfile: config.TlsProfile{Preset: config.TlsPresetNginx},
         FileServer: config.FileServerOptions{
             LinkFqdns: []string{"your.fqdn.here"},
             EncryptedLoader: config.LandingFileEncryptionOptions{
@@ -505,18 +820,30 @@ func genSkyhookConfig(cmd *cobra.Command, args []string) {
             RootDir: "webroot",
             UploadOptions: config.FileServerUploadOptions{
                 RegistrantsFile:   "skyhook_upload_registrants.json",
+                RegistrantsStore:  upload.StoreJSON,
                 MaxUploadDuration: 24,
+                MinFreeSpace:      1024,
             },
             RangeHeaderOptions: config.FileServerRangeHeaderOptions{
                 Name:        rando.AnyString(uint32(20), ""),
                 RangePrefix: "bytes",
             },
+            RotationOptions: config.ObfuscatorRotationOptions{
+                Interval:    0,
+                GracePeriod: 30,
+            },
+            CompressionOptions: config.FileServerCompressionOptions{
+                Name:       rando.AnyString(uint32(20), ""),
+                Algorithms: []string{config.CompressionGzip, config.CompressionZstd},
+            },
             Routes: config.FileServerRouteOptions{
                 Api: config.FileServerApiRoutes{
                     Logout:          apiRoutes["logout"],
                     Download:        apiRoutes["download"],
                     Upload:          apiRoutes["upload"],
                     OperatingConfig: apiRoutes["config"],
+                    Manage:          apiRoutes["manage"],
+                    Share:           apiRoutes["share"],
                 },
                 LandingPage:     landingRoutes,
                 EncryptedLoader: loaderRoutes,
@@ -544,20 +871,50 @@ func genSkyhookConfig(cmd *cobra.Command, args []string) {
                     },
                 },
                 SigningKey: uuid.New().String(),
+                Timeout:    10080,
+                MaxRefresh: 10080,
             },
-        },
-        Users: []config.Credential{
-            {
-                Username: rando.AnyString(uint32(7), "-"),
-                Password: rando.AnyString(uint32(20), " "),
-                IsAdmin:  true,
-                Token:    rando.AnyAsciiString(uint32(10), true, ""),
+            Totp: config.TotpOptions{
+                Issuer: "Skyhook",
+                Skew:   30,
+            },
+            Lockout: config.LockoutOptions{
+                UserAttempts: 5,
+                IpAttempts:   20,
+                Backoff:      1,
+                MaxBackoff:   60,
+                Duration:     15,
             },
-            {
-                Username: rando.AnyString(uint32(7), "-"),
-                Password: rando.AnyString(uint32(20), " "),
-                IsAdmin:  false,
-                Token:    rando.AnyAsciiString(uint32(10), true, ""),
-            }}})
+        },
+        Audit: config.AuditOptions{
+            File:       "skyhook_audit.log",
+            MaxSize:    100,
+            MaxBackups: 5,
+            Syslog:     config.AuditSyslogOptions{Tag: "skyhook"},
+        },
+        Shutdown: config.ShutdownOptions{
+            Deadline: 30,
+        },
+        Users: genUsers()})
     fmt.Println(string(configBytes))
 }
+
+// genUsers generates an admin and standard user with random
+// credentials. Passwords are hashed, so the cleartext values are
+// logged to stderr.
+func genUsers() (users []config.Credential) {
+    for _, isAdmin := range []bool{true, false} {
+        cred := config.Credential{
+            Username: rando.AnyString(uint32(7), "-"),
+            IsAdmin:  isAdmin,
+            Token:    rando.AnyAsciiString(uint32(10), true, ""),
+        }
+        password := rando.AnyString(uint32(20), " ")
+        if err := cred.SetPassword(password); err != nil {
+            panic(fmt.Sprintf("Failed to hash generated password: %v", err))
+        }
+        log.WARN.Printf("Generated user (admin: %v): %s / %s", isAdmin, cred.Username, password)
+        users = append(users, cred)
+    }
+    return users
+}
@@ -131,18 +131,9 @@ func checkNonZero(t *reflect.Type, v *reflect.Value) (zNames []string, ok bool)
 				vF.SetString(tag)
 				continue
 
-			case "uint16":
+			case "uint", "uint8", "uint16", "uint32", "uint64":
 
-				if v, err := strconv.ParseUint(tag, 10, 16); err != nil {
-					panic(err)
-				} else {
-					vF.SetUint(v)
-				}
-				continue
-
-			case "uint8":
-
-				if v, err := strconv.ParseUint(tag, 10, 8); err != nil {
+				if v, err := strconv.ParseUint(tag, 10, vF.Type().Bits()); err != nil {
 					panic(err)
 				} else {
 					vF.SetUint(v)
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+const (
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024
+	argon2Threads = 2
+	argon2KeyLen  = 32
+	argon2SaltLen = 16
+)
+
+var (
+	// ErrUnsupportedHash is returned when a password hash is in
+	// a format that can't be verified.
+	ErrUnsupportedHash = errors.New("unsupported password hash format")
+
+	// dummyHash is verified against when a username isn't found,
+	// preventing timing-based username enumeration.
+	dummyHash, _ = HashPassword("skyhook-dummy-password")
+)
+
+// HashPassword derives an argon2id hash from password, returning it
+// in PHC string format, e.g.:
+//
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// VerifyPassword checks password against hash in constant time.
+//
+// Both argon2id hashes in PHC string format and bcrypt hashes are
+// supported.
+func VerifyPassword(hash, password string) (bool, error) {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		return verifyArgon2id(hash, password)
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	return false, ErrUnsupportedHash
+}
+
+// verifyArgon2id checks password against an argon2id hash in PHC
+// string format.
+func verifyArgon2id(hash, password string) (bool, error) {
+	s := strings.Split(hash, "$")
+	if len(s) != 6 {
+		return false, ErrUnsupportedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(s[2], "v=%d", &version); err != nil {
+		return false, ErrUnsupportedHash
+	} else if version != argon2.Version {
+		return false, errors.New(fmt.Sprintf("unsupported argon2 version: %d", version))
+	}
+
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(s[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, ErrUnsupportedHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(s[4])
+	if err != nil {
+		return false, ErrUnsupportedHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(s[5])
+	if err != nil {
+		return false, ErrUnsupportedHash
+	}
+
+	other := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+// IsCleartext determines if c has a password that is stored
+// in cleartext.
+func (c *Credential) IsCleartext() bool {
+	return c.Password != ""
+}
+
+// SetPassword hashes password and stores it in c, clearing any
+// cleartext password.
+func (c *Credential) SetPassword(password string) (err error) {
+	var hash string
+	if hash, err = HashPassword(password); err != nil {
+		return err
+	}
+	c.PasswordHash = hash
+	c.Password = ""
+	return nil
+}
+
+// CheckPassword determines if password is valid for c.
+//
+// Credentials that still have a cleartext password are compared
+// in constant time. Run "skyhook server migrate-passwords" to hash
+// them.
+func (c *Credential) CheckPassword(password string) bool {
+	if c.PasswordHash != "" {
+		ok, _ := VerifyPassword(c.PasswordHash, password)
+		return ok
+	} else if c.Password != "" {
+		return subtle.ConstantTimeCompare([]byte(c.Password), []byte(password)) == 1
+	}
+	return false
+}
+
+// MigratePassword hashes the cleartext password of c, if any.
+// True is returned when c was changed.
+func (c *Credential) MigratePassword() (bool, error) {
+	if !c.IsCleartext() {
+		return false, nil
+	}
+	return true, c.SetPassword(c.Password)
+}
+
+// CheckDummyPassword verifies password against a throwaway hash,
+// consuming roughly the same time as CheckPassword. Use it when
+// no credential matches a username.
+func CheckDummyPassword(password string) {
+	VerifyPassword(dummyHash, password)
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"testing"
+)
+
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	} else if !strings.HasPrefix(hash, "$argon2id$v=19$m=65536,t=3,p=2$") {
+		t.Fatalf("unexpected hash format: %s", hash)
+	}
+
+	if ok, err := VerifyPassword(hash, "secret"); err != nil || !ok {
+		t.Errorf("correct password wasn't verified: %v", err)
+	}
+	if ok, err := VerifyPassword(hash, "wrong"); err != nil || ok {
+		t.Errorf("wrong password was verified: %v", err)
+	}
+
+	// Each hash is salted
+	if other, _ := HashPassword("secret"); other == hash {
+		t.Error("hashes of the same password are identical")
+	}
+}
+
+func TestVerifyPassword_Bcrypt(t *testing.T) {
+	b, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each bcrypt variant shares the same algorithm
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		hash := prefix + string(b[4:])
+		if ok, err := VerifyPassword(hash, "secret"); err != nil || !ok {
+			t.Errorf("%s: correct password wasn't verified: %v", prefix, err)
+		}
+		if ok, err := VerifyPassword(hash, "wrong"); err != nil || ok {
+			t.Errorf("%s: wrong password was verified: %v", prefix, err)
+		}
+	}
+}
+
+func TestVerifyPassword_Unsupported(t *testing.T) {
+	for _, hash := range []string{
+		"",
+		"secret",
+		"$1$salt$hash",
+		"$argon2i$v=19$m=65536,t=3,p=2$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=65536,t=3,p=2$c2FsdA",
+		"$argon2id$v=19$m=65536,t=3,p=2$c2FsdA$aGFzaA$extra",
+		"$argon2id$version$m=65536,t=3,p=2$c2FsdA$aGFzaA",
+		"$argon2id$v=19$memory$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=65536,t=3,p=2$!salt$aGFzaA",
+		"$argon2id$v=19$m=65536,t=3,p=2$c2FsdA$!hash",
+	} {
+		if ok, err := VerifyPassword(hash, "secret"); ok || err != ErrUnsupportedHash {
+			t.Errorf("%q: got %v, %v", hash, ok, err)
+		}
+	}
+}
+
+func TestCredential_MigratePassword(t *testing.T) {
+	c := Credential{Username: "op", Password: "secret"}
+	if changed, err := c.MigratePassword(); err != nil || !changed {
+		t.Fatalf("cleartext password wasn't migrated: %v", err)
+	} else if c.Password != "" || c.IsCleartext() {
+		t.Error("cleartext password wasn't cleared")
+	} else if !c.CheckPassword("secret") || c.CheckPassword("wrong") {
+		t.Error("migrated password isn't verified")
+	}
+
+	// Hashed credentials are left unchanged
+	hash := c.PasswordHash
+	if changed, err := c.MigratePassword(); err != nil || changed {
+		t.Errorf("hashed credential was migrated: %v", err)
+	} else if c.PasswordHash != hash {
+		t.Error("hash was replaced")
+	}
+}
+
+func TestCredential_CheckPassword(t *testing.T) {
+	if !(&Credential{Username: "op", Password: "secret"}).CheckPassword("secret") {
+		t.Error("cleartext password wasn't verified")
+	}
+	if (&Credential{Username: "op", Password: "secret"}).CheckPassword("wrong") {
+		t.Error("wrong cleartext password was verified")
+	}
+
+	// Credentials without a password never match, even an empty one
+	for _, password := range []string{"", "secret"} {
+		if (&Credential{Username: "op"}).CheckPassword(password) {
+			t.Errorf("%q was verified without a password", password)
+		}
+	}
+}
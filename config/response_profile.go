@@ -0,0 +1,174 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/exp/slices"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Names of the outcomes in ResponseOutcomes.
+const (
+	OutcomeNotFound      = "not_found"
+	OutcomeUnauthorized  = "unauthorized"
+	OutcomeForbidden     = "forbidden"
+	OutcomeNotAcceptable = "not_acceptable"
+	OutcomeConflict      = "conflict"
+	OutcomeTooLarge      = "too_large"
+	OutcomeBadRange      = "bad_range"
+)
+
+// ResponseOutcomes maps the names of outcomes that a ResponseProfile
+// can remap to the status code Skyhook answers them with.
+var ResponseOutcomes = map[string]int{
+	OutcomeNotFound:      http.StatusNotFound,
+	OutcomeUnauthorized:  http.StatusUnauthorized,
+	OutcomeForbidden:     http.StatusForbidden,
+	OutcomeNotAcceptable: http.StatusNotAcceptable,
+	OutcomeConflict:      http.StatusConflict,
+	OutcomeTooLarge:      http.StatusRequestEntityTooLarge,
+	OutcomeBadRange:      http.StatusRequestedRangeNotSatisfiable,
+}
+
+// ResponseRoutes are the names of the file server routes whose
+// content type can be set by a ResponseProfile. Other than login,
+// each is named after its field in FileServerApiRoutes.
+var ResponseRoutes = []string{"login", "logout", "download", "upload", "config", "manage", "share"}
+
+// ResponseProfile shapes the responses of the file server, such
+// that captured traffic resembles that of the site being
+// impersonated. Responses served by the decoy are left untouched.
+type ResponseProfile struct {
+	// Server is the value of the Server header. No Server header is
+	// sent when empty.
+	Server string `yaml:"server,omitempty" json:"server" mapstructure:"server"`
+	// Headers are added to each response that doesn't already set
+	// them.
+	Headers map[string]string `yaml:"headers,omitempty" json:"headers" mapstructure:"headers"`
+	// Cookies are set by each response.
+	Cookies []ResponseCookie `yaml:"cookies,omitempty" json:"cookies" mapstructure:"cookies"`
+	// ContentTypes maps the names in ResponseRoutes to the
+	// Content-Type of their responses, e.g., download to
+	// application/octet-stream.
+	ContentTypes map[string]string `yaml:"content_types,omitempty" json:"content_types" mapstructure:"content_types"`
+	// Outcomes maps the names in ResponseOutcomes to the response
+	// sent in their place.
+	Outcomes map[string]ResponseOutcome `yaml:"outcomes,omitempty" json:"outcomes" mapstructure:"outcomes"`
+}
+
+// ResponseCookie is a cookie set by each response.
+type ResponseCookie struct {
+	Name     string `yaml:"name" json:"name" mapstructure:"name"`
+	Value    string `yaml:"value" json:"value" mapstructure:"value"`
+	Path     string `yaml:"path,omitempty" json:"path" mapstructure:"path"`
+	MaxAge   int    `yaml:"max_age,omitempty" json:"max_age" mapstructure:"max_age"`
+	HttpOnly bool   `yaml:"http_only,omitempty" json:"http_only" mapstructure:"http_only"`
+	Secure   bool   `yaml:"secure,omitempty" json:"secure" mapstructure:"secure"`
+}
+
+// Cookie returns c as an http.Cookie.
+func (c *ResponseCookie) Cookie() *http.Cookie {
+	return &http.Cookie{
+		Name:     c.Name,
+		Value:    c.Value,
+		Path:     c.Path,
+		MaxAge:   c.MaxAge,
+		HttpOnly: c.HttpOnly,
+		Secure:   c.Secure,
+	}
+}
+
+// ResponseOutcome is the response sent in place of an outcome.
+//
+// A Body replaces the body Skyhook would have sent, which includes
+// the messages explaining failed requests to clients.
+type ResponseOutcome struct {
+	// Status is the status code sent. The status code of the
+	// outcome is retained when zero.
+	Status int `yaml:"status,omitempty" json:"status" mapstructure:"status"`
+	// Body replaces the body of the response when not empty.
+	Body string `yaml:"body,omitempty" json:"body" mapstructure:"body"`
+	// ContentType is the Content-Type of Body. It's detected from
+	// Body when empty.
+	ContentType string `yaml:"content_type,omitempty" json:"content_type" mapstructure:"content_type"`
+}
+
+// Outcome returns the outcome that status is remapped to, if any.
+func (p *ResponseProfile) Outcome(status int) (ResponseOutcome, bool) {
+	for name, s := range ResponseOutcomes {
+		if s == status {
+			o, ok := p.Outcomes[name]
+			return o, ok
+		}
+	}
+	return ResponseOutcome{}, false
+}
+
+// StatusCodes maps the status codes sent in place of outcomes back
+// to those of the outcomes, allowing clients to interpret remapped
+// responses.
+func (p *ResponseProfile) StatusCodes() map[int]int {
+	codes := make(map[int]int)
+	for name, o := range p.Outcomes {
+		if s := ResponseOutcomes[name]; o.Status != 0 && o.Status != s {
+			codes[o.Status] = s
+		}
+	}
+	return codes
+}
+
+// Validate ResponseProfile.
+//
+// Clients must be able to tell outcomes apart, so no two outcomes
+// may be sent with the same status code and none may be sent with
+// the status code of a successful file transfer.
+func (p *ResponseProfile) Validate() error {
+	for _, c := range p.Cookies {
+		if err := c.Cookie().Valid(); err != nil {
+			return errors.New(fmt.Sprintf("invalid response_profile cookie: %v", err))
+		}
+	}
+
+	for name := range p.ContentTypes {
+		if !slices.Contains(ResponseRoutes, name) {
+			return errors.New(fmt.Sprintf("unknown response_profile route %s (supported: %s)",
+				name, strings.Join(ResponseRoutes, ", ")))
+		}
+	}
+
+	sent := make(map[int]string)
+	for _, name := range outcomeNames() {
+		status := ResponseOutcomes[name]
+		if o, ok := p.Outcomes[name]; ok && o.Status != 0 {
+			status = o.Status
+		}
+		if status < 100 || status > 599 {
+			return errors.New(fmt.Sprintf("invalid response_profile status code for %s: %d", name, status))
+		} else if status == http.StatusOK || status == http.StatusPartialContent {
+			return errors.New(fmt.Sprintf("response_profile outcome %s can't be sent with status code %d", name, status))
+		} else if other, ok := sent[status]; ok {
+			return errors.New(fmt.Sprintf("response_profile outcomes %s and %s share status code %d", other, name, status))
+		}
+		sent[status] = name
+	}
+
+	for name := range p.Outcomes {
+		if _, ok := ResponseOutcomes[name]; !ok {
+			return errors.New(fmt.Sprintf("unknown response_profile outcome %s (supported: %s)",
+				name, strings.Join(outcomeNames(), ", ")))
+		}
+	}
+	return nil
+}
+
+// outcomeNames returns the sorted names of ResponseOutcomes.
+func outcomeNames() []string {
+	names := make([]string, 0, len(ResponseOutcomes))
+	for name := range ResponseOutcomes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestResponseProfile_Validate(t *testing.T) {
+	for _, p := range []ResponseProfile{
+		{Cookies: []ResponseCookie{{Name: "bad name", Value: "x"}}},
+		{ContentTypes: map[string]string{"landing": "text/html"}},
+		{Outcomes: map[string]ResponseOutcome{"teapot": {Status: http.StatusTeapot}}},
+		{Outcomes: map[string]ResponseOutcome{OutcomeNotFound: {Status: 1000}}},
+		{Outcomes: map[string]ResponseOutcome{OutcomeNotFound: {Status: http.StatusOK}}},
+		{Outcomes: map[string]ResponseOutcome{OutcomeNotFound: {Status: http.StatusForbidden}}},
+		{Outcomes: map[string]ResponseOutcome{
+			OutcomeConflict: {Status: http.StatusBadRequest},
+			OutcomeBadRange: {Status: http.StatusBadRequest},
+		}},
+	} {
+		if err := p.Validate(); err == nil {
+			t.Errorf("invalid profile was accepted: %+v", p)
+		}
+	}
+
+	p := ResponseProfile{
+		Cookies:      []ResponseCookie{{Name: "JSESSIONID", Value: "0A1B", HttpOnly: true}},
+		ContentTypes: map[string]string{"download": "application/octet-stream"},
+		Outcomes: map[string]ResponseOutcome{
+			OutcomeNotFound:  {Status: http.StatusForbidden, Body: "Forbidden"},
+			OutcomeForbidden: {Status: http.StatusNotFound},
+			OutcomeBadRange:  {Body: "Bad range"},
+		},
+	}
+	if err := p.Validate(); err != nil {
+		t.Errorf("valid profile was rejected: %v", err)
+	}
+}
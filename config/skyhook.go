@@ -1,20 +1,77 @@
 package config
 
 import (
+    "errors"
     "fmt"
     obfs "github.com/blackhillsinfosec/skyhook-obfuscation"
     "github.com/blackhillsinfosec/skyhook/log"
     "net"
+    "net/url"
     "os"
+    "path"
+    "path/filepath"
+    "time"
+)
+
+const (
+    // TlsModeManual indicates that certificates are managed by
+    // the operator and read from disk.
+    TlsModeManual = "manual"
+    // TlsModeAcme indicates that certificates are obtained and
+    // renewed automatically via ACME.
+    TlsModeAcme = "acme"
+
+    // LetsEncryptUrl is the default ACME directory.
+    LetsEncryptUrl = "https://acme-v02.api.letsencrypt.org/directory"
+
+    // TransportTls serves HTTPS on ServerOptions.Interface.
+    TransportTls = "tls"
+    // TransportHttp serves cleartext HTTP on ServerOptions.Interface.
+    TransportHttp = "http"
+    // TransportUnix serves cleartext HTTP on ServerOptions.UnixSocket.
+    TransportUnix = "unix"
 )
 
 // ManualTlsOptions are the values used to configure
 // self-managed SSL certificates.
+//
+// Certificates can instead be managed automatically by setting Mode
+// to TlsModeAcme and configuring Acme.
 type ManualTlsOptions struct {
+    // Mode is either TlsModeManual or TlsModeAcme. Defaults to
+    // TlsModeManual.
+    Mode string `mapstructure:"mode" yaml:"mode,omitempty"`
     // CertPath is the path to the certificate file.
-    CertPath string `nonzero:"" mapstructure:"cert_path" yaml:"cert_path"`
+    CertPath string `mapstructure:"cert_path" yaml:"cert_path"`
     // KeyPath is the path to the key file.
-    KeyPath string `nonzero:"" mapstructure:"key_path" yaml:"key_path"`
+    KeyPath string `mapstructure:"key_path" yaml:"key_path"`
+    // Acme configures automated certificate management when Mode
+    // is TlsModeAcme.
+    Acme *AcmeOptions `mapstructure:"acme" yaml:"acme,omitempty"`
+}
+
+// Validate ManualTlsOptions.
+func (t *ManualTlsOptions) Validate() (err error) {
+    switch t.Mode {
+    case "", TlsModeManual:
+        t.Mode = TlsModeManual
+        if t.CertPath == "" || t.KeyPath == "" {
+            return errors.New("tls_config requires cert_path and key_path in manual mode")
+        }
+    case TlsModeAcme:
+        if t.Acme == nil {
+            return errors.New("tls_config requires an acme section in acme mode")
+        }
+        return t.Acme.Validate()
+    default:
+        return errors.New(fmt.Sprintf("unsupported tls_config mode: %s", t.Mode))
+    }
+    return nil
+}
+
+// IsAcme determines if certificates are managed via ACME.
+func (t *ManualTlsOptions) IsAcme() bool {
+    return t.Mode == TlsModeAcme
 }
 
 // AcmeOptions has values to configured automated
@@ -25,10 +82,40 @@ type AcmeOptions struct {
     CertDir string `nonzero:"skyhook-acme" mapstructure:"cert_directory" yaml:"cert_directory"`
     // Fqdn determines the FQDN to pull a certificate for.
     Fqdn string `nonzero:""`
+    // AltFqdns are additional FQDNs that certificates may be
+    // obtained for, e.g., those listed in LinkFqdns.
+    AltFqdns []string `mapstructure:"alt_fqdns" yaml:"alt_fqdns,omitempty"`
     // Email address to use while interacting with LetsEncrypt.
     //
     // This value is optional.
     Email string
+    // DirectoryUrl is the ACME directory to obtain certificates
+    // from. Defaults to LetsEncryptUrl.
+    //
+    // Point this to a local ACME server, such as pebble, for
+    // testing.
+    DirectoryUrl string `nonzero:"https://acme-v02.api.letsencrypt.org/directory" mapstructure:"directory_url" yaml:"directory_url"`
+    // DirectoryCaFile is an optional path to a PEM file of CA
+    // certificates trusted when connecting to DirectoryUrl.
+    DirectoryCaFile string `mapstructure:"directory_ca_file" yaml:"directory_ca_file,omitempty"`
+    // HttpChallengeAddress is the address where HTTP-01 challenges
+    // are answered, e.g., ":80". HTTP-01 is disabled when empty,
+    // leaving TLS-ALPN-01, which is answered by the servers
+    // themselves and requires one of them to be reachable on 443.
+    HttpChallengeAddress string `mapstructure:"http_challenge_address" yaml:"http_challenge_address,omitempty"`
+    // RenewBefore is the number of days before expiration that a
+    // certificate is renewed.
+    RenewBefore uint16 `nonzero:"30" mapstructure:"renew_before" yaml:"renew_before"`
+}
+
+// Fqdns returns Fqdn followed by AltFqdns.
+func (l *AcmeOptions) Fqdns() []string {
+    return append([]string{l.Fqdn}, l.AltFqdns...)
+}
+
+// RenewBeforeDuration returns RenewBefore as a time.Duration.
+func (l *AcmeOptions) RenewBeforeDuration() time.Duration {
+    return time.Duration(l.RenewBefore) * 24 * time.Hour
 }
 
 // Validate AcmeOptions.
@@ -48,6 +135,53 @@ func (l *AcmeOptions) Validate() (err error) {
 type FileServerUploadOptions struct {
     RegistrantsFile   string `nonzero:"" yaml:"registrants_file" json:"registrants_file" mapstructure:"registrants_file"`
     MaxUploadDuration uint   `nonzero:"24" yaml:"max_upload_duration" json:"max_upload_duration" mapstructure:"max_upload_duration"`
+    // RegistrantsStore is the format of RegistrantsFile: "json" for a
+    // JSON file rewritten upon each change, or "bolt" for an embedded
+    // bbolt database. Registrants aren't migrated between formats.
+    RegistrantsStore string `nonzero:"json" yaml:"registrants_store" json:"registrants_store" mapstructure:"registrants_store"`
+    // MaxFileSize is the maximum size of an uploaded file in
+    // megabytes. Unlimited when zero.
+    MaxFileSize uint `yaml:"max_file_size" json:"max_file_size" mapstructure:"max_file_size"`
+    // UserQuota is the maximum number of megabytes of content
+    // within each user's root directory, including the declared
+    // size of uploads in progress. Unlimited when zero.
+    UserQuota uint `yaml:"user_quota" json:"user_quota" mapstructure:"user_quota"`
+    // MinFreeSpace is the number of megabytes that must remain free
+    // on the filesystem of the webroot. Uploads that would consume
+    // it are rejected. Disabled when zero.
+    MinFreeSpace uint `yaml:"min_free_space" json:"min_free_space" mapstructure:"min_free_space"`
+}
+
+// ObfuscatorRotationOptions schedule automatic rotation of the keys
+// of every obfuscation chain.
+type ObfuscatorRotationOptions struct {
+    // Interval is the number of minutes between rotations. Rotation
+    // is disabled when zero.
+    Interval uint32 `yaml:"interval" json:"interval" mapstructure:"interval"`
+    // GracePeriod is the number of minutes a replaced chain remains
+    // accepted by the file server, allowing in-flight transfers to
+    // finish before clients retrieve the new chain.
+    GracePeriod uint32 `nonzero:"30" yaml:"grace_period" json:"grace_period" mapstructure:"grace_period"`
+}
+
+// Every returns Interval as a time.Duration.
+func (r *ObfuscatorRotationOptions) Every() time.Duration {
+    return time.Duration(r.Interval) * time.Minute
+}
+
+// Grace returns GracePeriod as a time.Duration.
+func (r *ObfuscatorRotationOptions) Grace() time.Duration {
+    return time.Duration(r.GracePeriod) * time.Minute
+}
+
+// DefaultProfile is the name of the obfuscation profile described
+// by FileServerOptions.Obfuscators.
+const DefaultProfile = "default"
+
+// ObfuscationProfile is a named obfuscation chain.
+type ObfuscationProfile struct {
+    Name        string                  `nonzero:"" yaml:"name" json:"name" mapstructure:"name"`
+    Obfuscators []obfs.ObfuscatorConfig `yaml:"obfuscators" json:"obfuscators" mapstructure:"obfuscators"`
 }
 
 // FileServerRangeHeaderOptions enables configuration of the HTTP Range
@@ -60,6 +194,100 @@ type FileServerRangeHeaderOptions struct {
     RangePrefix string `nonzero:"bytes" yaml:"range_prefix" json:"range_prefix" mapstructure:"range_prefix"`
 }
 
+const (
+    // CompressionGzip compresses file chunks with gzip.
+    CompressionGzip = "gzip"
+    // CompressionZstd compresses file chunks with Zstandard.
+    CompressionZstd = "zstd"
+)
+
+// FileServerCompressionOptions enables compression of file chunks
+// prior to obfuscation.
+//
+// Compression is negotiated for each request: clients set the
+// header to one of the enabled algorithms, and the file server
+// echoes the algorithm back when it's applied. Ranges always refer
+// to offsets in the uncompressed file.
+type FileServerCompressionOptions struct {
+    // Name of the header used to negotiate compression.
+    Name string `nonzero:"Transfer-Coding" yaml:"name" json:"name" mapstructure:"name"`
+    // Algorithms that clients may request. Compression is disabled
+    // when empty.
+    //
+    // Supported values: gzip, zstd
+    Algorithms []string `yaml:"algorithms" json:"algorithms" mapstructure:"algorithms"`
+}
+
+// Enabled determines if algo is one of the configured Algorithms.
+func (c *FileServerCompressionOptions) Enabled(algo string) bool {
+    for _, a := range c.Algorithms {
+        if a == algo {
+            return true
+        }
+    }
+    return false
+}
+
+// Validate FileServerCompressionOptions.
+func (c *FileServerCompressionOptions) Validate() error {
+    for _, a := range c.Algorithms {
+        switch a {
+        case CompressionGzip, CompressionZstd:
+        default:
+            return errors.New(fmt.Sprintf("unsupported compression algorithm: %s", a))
+        }
+    }
+    return nil
+}
+
+const (
+    // DecoyStatic serves the decoy from a directory.
+    DecoyStatic = "static"
+    // DecoyProxy proxies the decoy from an upstream site.
+    DecoyProxy = "proxy"
+)
+
+// FileServerDecoyOptions configure a cover site served in place of
+// the file server's responses to requests that match no route or
+// fail authentication, e.g., those of scanners.
+type FileServerDecoyOptions struct {
+    // Mode selects how the decoy is served. The decoy is disabled
+    // when empty.
+    //
+    // Supported values: static, proxy
+    Mode string `yaml:"mode" json:"mode" mapstructure:"mode"`
+    // StaticDir is the directory served in static mode.
+    StaticDir string `yaml:"static_directory,omitempty" json:"static_directory" mapstructure:"static_directory"`
+    // Upstream is the base URL of the site proxied in proxy mode.
+    Upstream string `yaml:"upstream,omitempty" json:"upstream" mapstructure:"upstream"`
+    // InsecureUpstream disables verification of the upstream's
+    // certificate.
+    InsecureUpstream bool `yaml:"insecure_upstream,omitempty" json:"insecure_upstream" mapstructure:"insecure_upstream"`
+}
+
+// Enabled determines if a decoy is configured.
+func (d *FileServerDecoyOptions) Enabled() bool {
+    return d.Mode != ""
+}
+
+// Validate FileServerDecoyOptions.
+func (d *FileServerDecoyOptions) Validate() error {
+    switch d.Mode {
+    case "":
+    case DecoyStatic:
+        if stat, err := os.Stat(d.StaticDir); err != nil || !stat.IsDir() {
+            return errors.New(fmt.Sprintf("decoy static directory doesn't exist: %s", d.StaticDir))
+        }
+    case DecoyProxy:
+        if u, err := url.Parse(d.Upstream); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+            return errors.New(fmt.Sprintf("decoy upstream must be an http or https URL: %s", d.Upstream))
+        }
+    default:
+        return errors.New(fmt.Sprintf("unsupported decoy mode: %s", d.Mode))
+    }
+    return nil
+}
+
 // EncryptedInterfaceLoaderRoutes is used to configure routes
 // for the encrypted loader.
 type EncryptedInterfaceLoaderRoutes struct {
@@ -81,12 +309,18 @@ type FileServerApiRoutes struct {
     Download        string `nonzero:"/files" yaml:"download" mapstructure:"download" json:"download"`
     Upload          string `nonzero:"/upload" yaml:"upload" mapstructure:"upload" json:"upload"`
     OperatingConfig string `nonzero:"/config" yaml:"config" json:"config" mapstructure:"config"`
+    // Manage is the route to file management endpoints, which
+    // create directories and delete, move and copy content.
+    Manage string `nonzero:"/manage" yaml:"manage" json:"manage" mapstructure:"manage"`
+    // Share is the route serving files to holders of share tokens,
+    // which are minted by the admin server.
+    Share string `nonzero:"/share" yaml:"share" json:"share" mapstructure:"share"`
 }
 
 // FileServerRouteOptions aggregates various sets of options
 // for web routes hosted by the file server.
 type FileServerRouteOptions struct {
-    Api             FileServerApiRoutes            `yaml:"api" mapstructure:"api"`
+    Api             FileServerApiRoutes            `nonzero:"" yaml:"api" mapstructure:"api"`
     EncryptedLoader EncryptedInterfaceLoaderRoutes `json:"encrypted_loader" yaml:"encrypted_loader" mapstructure:"encrypted_loader"`
     // LandingPage routes define routes to the underlying web
     // application embedded in the binary. As there are many
@@ -105,11 +339,22 @@ type FileServerOptions struct {
     // Obfuscators is a slice of objects used to obfuscate and deobfuscate data. This field
     // always has the current chain of obfuscation configurations.
     Obfuscators        []obfs.ObfuscatorConfig
+    // ObfuscationProfiles are additional named obfuscation chains
+    // that can be assigned to users, allowing the chain of one set
+    // of users to change without affecting the others. Users without
+    // a profile are assigned Obfuscators, i.e., DefaultProfile.
+    ObfuscationProfiles []ObfuscationProfile `yaml:"obfuscation_profiles,omitempty" json:"obfuscation_profiles" mapstructure:"obfuscation_profiles"`
     UploadOptions      FileServerUploadOptions      `nonzero:"" yaml:"upload_options" json:"upload_options" mapstructure:"upload_options"`
     Routes             FileServerRouteOptions       `nonzero:"" yaml:"routes" json:"routes" mapstructure:"routes"`
     EncryptedLoader    LandingFileEncryptionOptions `nonzero:"" yaml:"encrypted_loader" json:"encrypted_loader" mapstructure:"encrypted_loader"`
     LinkFqdns          []string                     `nonzero:"" yaml:"link_fqdns" json:"link_fqdns" mapstructure:"link_fqdns"`
     RangeHeaderOptions FileServerRangeHeaderOptions `nonzero:"" yaml:"range_header_options" json:"range_header_options" mapstructure:"range_header_options"`
+    CompressionOptions FileServerCompressionOptions `nonzero:"" yaml:"compression_options" json:"compression_options" mapstructure:"compression_options"`
+    RotationOptions    ObfuscatorRotationOptions    `nonzero:"" yaml:"rotation_options" json:"rotation_options" mapstructure:"rotation_options"`
+    DecoyOptions       FileServerDecoyOptions       `yaml:"decoy" json:"decoy" mapstructure:"decoy"`
+    // ResponseProfile shapes the headers, content types and error
+    // responses of the file server.
+    ResponseProfile ResponseProfile `yaml:"response_profile,omitempty" json:"response_profile" mapstructure:"response_profile"`
 }
 
 // Validate FileServerOptions.
@@ -120,6 +365,28 @@ func (fs *FileServerOptions) Validate() (err error) {
         return err
     }
 
+    if err = fs.CompressionOptions.Validate(); err != nil {
+        return err
+    }
+
+    if err = fs.DecoyOptions.Validate(); err != nil {
+        return err
+    }
+
+    if err = fs.ResponseProfile.Validate(); err != nil {
+        return err
+    }
+
+    names := map[string]bool{DefaultProfile: true}
+    for _, p := range fs.ObfuscationProfiles {
+        if p.Name == "" {
+            return errors.New("obfuscation profiles require a name")
+        } else if names[p.Name] {
+            return errors.New(fmt.Sprintf("duplicate obfuscation profile name: %s", p.Name))
+        }
+        names[p.Name] = true
+    }
+
     if _, iErr := os.Stat(fs.RootDir); iErr != nil {
 
         //===================
@@ -170,6 +437,24 @@ type ServerOptions struct {
     Interface string `nonzero:"lo"`
     // Port is the port number the server will listen on.
     Port uint16
+    // Transport is the kind of listener the server uses. Defaults
+    // to TransportTls.
+    //
+    // TransportHttp and TransportUnix serve cleartext HTTP, and are
+    // meant for deployments behind a redirector that terminates TLS
+    // on the same host.
+    Transport string `yaml:"transport,omitempty" mapstructure:"transport"`
+    // UnixSocket is the path of the socket the server listens on
+    // when Transport is TransportUnix.
+    UnixSocket string `yaml:"unix_socket,omitempty" mapstructure:"unix_socket"`
+    // TrustedProxies are the IP addresses and CIDR ranges of proxies
+    // trusted to convey the client's address via the X-Forwarded-For
+    // and X-Real-IP headers. No proxy is trusted when empty.
+    //
+    // Requests received on a Unix socket originate from 127.0.0.1,
+    // which must be trusted by TransportUnix. Otherwise, every client
+    // would share a single address, e.g., for login throttling.
+    TrustedProxies []string `yaml:"trusted_proxies,omitempty" mapstructure:"trusted_proxies"`
     // ip address of Interface.
     //
     // Validate must be called for this value to be populated.
@@ -180,8 +465,55 @@ type ServerOptions struct {
 
 // Validate ServerOptions.
 func (s *ServerOptions) Validate() (err error) {
-    s.ip, err = FindInterface(s.Interface)
-    return err
+    if s.ip, err = FindInterface(s.Interface); err != nil {
+        return err
+    }
+
+    for _, p := range s.TrustedProxies {
+        if net.ParseIP(p) == nil {
+            if _, _, err = net.ParseCIDR(p); err != nil {
+                return errors.New(fmt.Sprintf("trusted proxy isn't an IP address or CIDR range: %s", p))
+            }
+        }
+    }
+
+    switch s.Transport {
+    case "", TransportTls:
+        s.Transport = TransportTls
+    case TransportHttp:
+        if ip := net.ParseIP(s.ip); ip == nil || !ip.IsLoopback() {
+            log.WARN.Printf("Serving cleartext HTTP on non-loopback address %s", s.Socket())
+            log.WARN.Println("Traffic to this listener is unencrypted; bind it to loopback behind a TLS-terminating proxy")
+        }
+    case TransportUnix:
+        if s.UnixSocket == "" {
+            return errors.New("unix_socket is required by the unix transport")
+        } else if !s.trustsLoopback() {
+            return errors.New("trusted_proxies must include 127.0.0.1 for the unix transport, " +
+                "since requests received on the socket carry no client address")
+        }
+    default:
+        return errors.New(fmt.Sprintf("unsupported transport: %s", s.Transport))
+    }
+    return nil
+}
+
+// trustsLoopback determines if TrustedProxies includes 127.0.0.1.
+func (s *ServerOptions) trustsLoopback() bool {
+    loopback := net.IPv4(127, 0, 0, 1)
+    for _, p := range s.TrustedProxies {
+        if ip := net.ParseIP(p); ip != nil && ip.Equal(loopback) {
+            return true
+        } else if _, n, err := net.ParseCIDR(p); err == nil && n.Contains(loopback) {
+            return true
+        }
+    }
+    return false
+}
+
+// Cleartext determines if the server serves HTTP without TLS.
+func (s *ServerOptions) Cleartext() bool {
+    return s.Transport == TransportHttp || s.Transport == TransportUnix
 }
 
 // IP gets the ServerOptions' validated ip value.
@@ -194,6 +526,29 @@ func (s *ServerOptions) Socket() string {
     return net.JoinHostPort(s.ip, fmt.Sprintf("%v", s.Port))
 }
 
+// Listener describes the listener of the server for logging, e.g.,
+// https://127.0.0.1:443 or unix:/run/skyhook.sock.
+func (s *ServerOptions) Listener() string {
+    switch s.Transport {
+    case TransportHttp:
+        return "http://" + s.Socket()
+    case TransportUnix:
+        return "unix:" + s.UnixSocket
+    }
+    return "https://" + s.Socket()
+}
+
+// Origin returns the origin of the server's listener, which is
+// accepted by CORS. It's empty for TransportUnix, since browsers
+// reach the socket via the origin of the proxy in front of it, which
+// must be listed in AddtlCorsUrls.
+func (s *ServerOptions) Origin() string {
+    if s.Transport == TransportUnix {
+        return ""
+    }
+    return s.Listener()
+}
+
 // AdminAuthHeaderOptions provides options related to JWT header
 // authentication.
 type AdminAuthHeaderOptions struct {
@@ -202,8 +557,10 @@ type AdminAuthHeaderOptions struct {
 }
 
 type AuthOptions struct {
-    Header AdminAuthHeaderOptions `nonzero:"" yaml:"header" mapstructure:"header" json:"header"`
-    Jwt    JwtOptions             `nonzero:"" mapstructure:"jwt" yaml:"jwt" json:"jwt"`
+    Header  AdminAuthHeaderOptions `nonzero:"" yaml:"header" mapstructure:"header" json:"header"`
+    Jwt     JwtOptions             `nonzero:"" mapstructure:"jwt" yaml:"jwt" json:"jwt"`
+    Totp    TotpOptions            `nonzero:"" mapstructure:"totp" yaml:"totp" json:"totp"`
+    Lockout LockoutOptions         `nonzero:"" mapstructure:"lockout" yaml:"lockout" json:"lockout"`
 }
 
 // JwtOptions provides options related to JWT header
@@ -211,6 +568,48 @@ type AuthOptions struct {
 type JwtOptions struct {
     SafeJwtOptions `mapstructure:",squash" yaml:",inline"`
     SigningKey     string `nonzero:"" yaml:"signing_key" mapstructure:"signing_key" json:"signing_key"`
+    // Timeout is the number of minutes a token remains valid.
+    Timeout uint `nonzero:"10080" yaml:"timeout" mapstructure:"timeout" json:"timeout"`
+    // MaxRefresh is the number of minutes after a token is issued
+    // or refreshed during which it can be refreshed, even if it has
+    // expired.
+    MaxRefresh uint `nonzero:"10080" yaml:"max_refresh" mapstructure:"max_refresh" json:"max_refresh"`
+}
+
+// Lifetime returns Timeout as a time.Duration.
+func (j *JwtOptions) Lifetime() time.Duration {
+    return time.Duration(j.Timeout) * time.Minute
+}
+
+// RefreshWindow returns MaxRefresh as a time.Duration.
+func (j *JwtOptions) RefreshWindow() time.Duration {
+    return time.Duration(j.MaxRefresh) * time.Minute
+}
+
+// SessionLifetime returns the time after a token is issued or
+// refreshed during which it, or a token refreshed from it, can be
+// used.
+func (j *JwtOptions) SessionLifetime() time.Duration {
+    return max(j.Lifetime(), j.RefreshWindow())
+}
+
+// LockoutOptions throttle failed logins to both servers by client
+// IP address and username.
+type LockoutOptions struct {
+    // UserAttempts is the number of failed logins after which a
+    // username is locked out.
+    UserAttempts uint `nonzero:"5" yaml:"user_attempts" mapstructure:"user_attempts" json:"user_attempts"`
+    // IpAttempts is the number of failed logins after which a client
+    // IP address is locked out.
+    IpAttempts uint `nonzero:"20" yaml:"ip_attempts" mapstructure:"ip_attempts" json:"ip_attempts"`
+    // Backoff is the number of seconds a client must wait after a
+    // failed login. It doubles with each subsequent failure, up to
+    // MaxBackoff seconds.
+    Backoff    uint `nonzero:"1" yaml:"backoff" mapstructure:"backoff" json:"backoff"`
+    MaxBackoff uint `nonzero:"60" yaml:"max_backoff" mapstructure:"max_backoff" json:"max_backoff"`
+    // Duration is the number of minutes a lockout lasts. Failures
+    // are forgotten once Duration has elapsed since the last one.
+    Duration uint `nonzero:"15" yaml:"duration" mapstructure:"duration" json:"duration"`
 }
 
 type SafeJwtOptions struct {
@@ -225,8 +624,10 @@ type JwtFieldKeys struct {
 }
 
 type SafeAuthOptions struct {
-    Header AdminAuthHeaderOptions `yaml:"header" json:"header"`
-    Jwt    SafeJwtOptions         `json:"jwt" yaml:"jwt"`
+    Header  AdminAuthHeaderOptions `yaml:"header" json:"header"`
+    Jwt     SafeJwtOptions         `json:"jwt" yaml:"jwt"`
+    Totp    TotpOptions            `json:"totp" yaml:"totp"`
+    Lockout LockoutOptions         `json:"lockout" yaml:"lockout"`
 }
 
 // AdminServerOptions are options related to the admin
@@ -238,25 +639,131 @@ type AdminServerOptions struct {
 
 // Validate AdminServerOptions.
 func (as *AdminServerOptions) Validate() (err error) {
-    as.ip, err = FindInterface(as.Interface)
-    return err
+    return as.ServerOptions.Validate()
 }
 
 // Credential objects represent a set of login credentials.
 type Credential struct {
     Username string `nonzero:"" mapstructure:"username" yaml:"username" json:"username"`
-    Password string `nonzero:"" mapstructure:"password" yaml:"password" json:"password"`
+    // Password is a cleartext password.
+    //
+    // It's supported only for configs that predate password
+    // hashing and for receiving new passwords from the admin
+    // server. Use SetPassword to hash it into PasswordHash.
+    Password string `mapstructure:"password" yaml:"password,omitempty" json:"password,omitempty"`
+    // PasswordHash is an argon2id or bcrypt password hash. It's
+    // never sent to clients.
+    PasswordHash string `mapstructure:"password_hash" yaml:"password_hash,omitempty" json:"-"`
     IsAdmin  bool   `mapstructure:"is_admin" yaml:"is_admin" json:"is_admin"`
     Token    string `nonzero:"" yaml:"token" json:"token" mapstructure:"token"`
+    // RootDir is a subdirectory of FileServerOptions.RootDir that the
+    // user is jailed to. The entire webroot is accessible when empty.
+    RootDir string `mapstructure:"root_directory" yaml:"root_directory,omitempty" json:"root_directory"`
+    // Permissions restrict the actions the user can take on the file
+    // server. All actions are permitted when nil.
+    Permissions *UserPermissions `mapstructure:"permissions" yaml:"permissions,omitempty" json:"permissions,omitempty"`
+    // Profile is the name of the obfuscation profile assigned to the
+    // user. DefaultProfile is assigned when empty.
+    Profile string `mapstructure:"profile" yaml:"profile,omitempty" json:"profile,omitempty"`
+    // TotpSecret is the base32 secret of the user's TOTP second
+    // factor, enrolled through the admin server. It's never sent
+    // to clients.
+    TotpSecret string `mapstructure:"totp_secret" yaml:"totp_secret,omitempty" json:"-"`
+}
+
+// UserPermissions determine which file server actions a user
+// is allowed to take.
+type UserPermissions struct {
+    // List allows the user to enumerate directories.
+    List bool `mapstructure:"list" yaml:"list" json:"list"`
+    // Download allows the user to inspect and download files.
+    Download bool `mapstructure:"download" yaml:"download" json:"download"`
+    // Upload allows the user to register, send, and finish uploads.
+    Upload bool `mapstructure:"upload" yaml:"upload" json:"upload"`
+    // Delete allows the user to remove content from disk, e.g.,
+    // by canceling an upload.
+    Delete bool `mapstructure:"delete" yaml:"delete" json:"delete"`
+}
+
+// AllPermissions returns UserPermissions that allow every action.
+func AllPermissions() UserPermissions {
+    return UserPermissions{List: true, Download: true, Upload: true, Delete: true}
+}
+
+// Perms returns the permissions of the user, defaulting to
+// AllPermissions when none are configured.
+func (c *Credential) Perms() UserPermissions {
+    if c.Permissions == nil {
+        return AllPermissions()
+    }
+    return *c.Permissions
+}
+
+// WebPath returns the web path to the user's root directory,
+// relative to the file server's webroot, e.g., "/engagement-1".
+func (c *Credential) WebPath() string {
+    return path.Clean("/" + c.RootDir)
+}
+
+// Webroot returns the absolute path to the directory that the user
+// is jailed to, given the file server's webroot.
+func (c *Credential) Webroot(root string) string {
+    return filepath.Join(root, filepath.FromSlash(c.WebPath()))
+}
+
+// AuditOptions configure the structured audit log, which records
+// authentication and file transfer events as JSON lines.
+type AuditOptions struct {
+    // File is the path to the audit log file. Auditing is disabled
+    // when empty.
+    File string `yaml:"file" json:"file" mapstructure:"file"`
+    // MaxSize is the size in megabytes at which File is rotated.
+    MaxSize uint16 `nonzero:"100" yaml:"max_size" json:"max_size" mapstructure:"max_size"`
+    // MaxBackups is the number of rotated files to retain.
+    MaxBackups uint8 `nonzero:"5" yaml:"max_backups" json:"max_backups" mapstructure:"max_backups"`
+    // Syslog optionally sends each record to a syslog server.
+    Syslog AuditSyslogOptions `nonzero:"" yaml:"syslog" json:"syslog" mapstructure:"syslog"`
+}
+
+// AuditSyslogOptions configure the syslog sink of the audit log.
+type AuditSyslogOptions struct {
+    Enabled bool `yaml:"enabled" json:"enabled" mapstructure:"enabled"`
+    // Network is the network used to reach Address, e.g., "udp".
+    //
+    // The local syslog server is used when Network and Address
+    // are empty.
+    Network string `yaml:"network" json:"network" mapstructure:"network"`
+    // Address is the address of the syslog server, e.g.,
+    // "logs.domain.com:514".
+    Address string `yaml:"address" json:"address" mapstructure:"address"`
+    // Tag is the tag applied to each syslog message.
+    Tag string `nonzero:"skyhook" yaml:"tag" json:"tag" mapstructure:"tag"`
+}
+
+// ShutdownOptions configure how the servers stop upon receiving
+// SIGINT or SIGTERM.
+type ShutdownOptions struct {
+    // Deadline is the number of seconds each server is given to drain
+    // in-flight requests, e.g., chunk transfers, before remaining
+    // connections are closed.
+    Deadline uint16 `nonzero:"30" yaml:"deadline" json:"deadline" mapstructure:"deadline"`
+}
+
+// Timeout returns Deadline as a time.Duration.
+func (s *ShutdownOptions) Timeout() time.Duration {
+    return time.Duration(s.Deadline) * time.Second
 }
 
 // SkyhookConfig holds all options related to a Skyhook configuration.
 type SkyhookConfig struct {
     Tls         ManualTlsOptions   `yaml:"tls_config" mapstructure:"tls_config"`
+    TlsProfile  TlsProfile         `yaml:"tls_profile,omitempty" mapstructure:"tls_profile"`
     AdminServer AdminServerOptions `nonzero:"" mapstructure:"admin_server_config" yaml:"admin_server_config"`
     FileServer  FileServerOptions  `nonzero:"" mapstructure:"file_server_config" yaml:"file_server_config"`
     Users       []Credential       `nonzero:""`
     Auth        AuthOptions        `nonzero:"" mapstructure:"auth_config" yaml:"auth_config"`
+    Audit       AuditOptions       `nonzero:"" mapstructure:"audit_config" yaml:"audit_config"`
+    Shutdown    ShutdownOptions    `nonzero:"" mapstructure:"shutdown_config" yaml:"shutdown_config"`
 }
 
 func (sc *SkyhookConfig) GetUser(username string) (Credential, bool) {
@@ -273,6 +780,32 @@ func (sc *SkyhookConfig) GetObfuscatorConfigs() (configs []obfs.ObfuscatorConfig
     return sc.FileServer.Obfuscators
 }
 
+// GetProfile returns the obfuscation configuration of the named
+// profile. The default profile is returned when name is empty or
+// DefaultProfile.
+func (sc *SkyhookConfig) GetProfile(name string) ([]obfs.ObfuscatorConfig, bool) {
+    if name == "" || name == DefaultProfile {
+        return sc.FileServer.Obfuscators, true
+    }
+    for _, p := range sc.FileServer.ObfuscationProfiles {
+        if p.Name == name {
+            return p.Obfuscators, true
+        }
+    }
+    return nil, false
+}
+
+// CheckProfiles ensures that the obfuscation profile assigned to
+// each user exists.
+func (sc *SkyhookConfig) CheckProfiles(users []Credential) error {
+    for _, cred := range users {
+        if _, ok := sc.GetProfile(cred.Profile); !ok {
+            return errors.New(fmt.Sprintf("user %s is assigned an unknown obfuscation profile: %s", cred.Username, cred.Profile))
+        }
+    }
+    return nil
+}
+
 // Validate SkyhookConfig.
 func (sc *SkyhookConfig) Validate() (err error) {
 
@@ -281,6 +814,24 @@ func (sc *SkyhookConfig) Validate() (err error) {
         return err
     }
 
+    //=====================
+    // VALIDATE CREDENTIALS
+    //=====================
+
+    var cleartext bool
+    for _, cred := range sc.Users {
+        if cred.Password == "" && cred.PasswordHash == "" {
+            return errors.New(fmt.Sprintf("user %s has no password or password hash", cred.Username))
+        } else if cred.IsCleartext() {
+            cleartext = true
+        }
+    }
+
+    if cleartext {
+        log.WARN.Println("Config file contains cleartext passwords")
+        log.WARN.Println("Run \"skyhook server migrate-passwords\" to hash them")
+    }
+
     if err = sc.AdminServer.Validate(); err != nil {
         log.ERR.Println("Validation of admin server config failed")
         return err
@@ -291,5 +842,38 @@ func (sc *SkyhookConfig) Validate() (err error) {
         return err
     }
 
+    // TLS options are unused when both servers serve cleartext
+    if !sc.FileServer.Cleartext() || !sc.AdminServer.Cleartext() {
+        if err = sc.Tls.Validate(); err != nil {
+            log.ERR.Println("Validation of TLS config failed")
+            return err
+        } else if err = sc.TlsProfile.Validate(); err != nil {
+            log.ERR.Println("Validation of TLS profile failed")
+            return err
+        }
+    }
+
+    if err = sc.CheckProfiles(sc.Users); err != nil {
+        return err
+    }
+
+    //=============================
+    // CREATE USER ROOT DIRECTORIES
+    //=============================
+
+    for _, cred := range sc.Users {
+        if cred.RootDir == "" {
+            continue
+        }
+        root := cred.Webroot(sc.FileServer.RootDir)
+        if _, iErr := os.Stat(root); iErr != nil {
+            log.WARN.Printf("Creating root directory for %s: %s", cred.Username, root)
+            if err = os.MkdirAll(root, 0700); err != nil {
+                log.ERR.Printf("Failed to create user root directory: %v", err)
+                return err
+            }
+        }
+    }
+
     return nil
 }
@@ -0,0 +1,47 @@
+package config
+
+import (
+    "testing"
+)
+
+func TestServerOptions_Unix(t *testing.T) {
+    for _, test := range []struct {
+        proxies []string
+        valid   bool
+    }{
+        {nil, false},
+        {[]string{"10.0.0.1"}, false},
+        {[]string{"127.0.0.1"}, true},
+        {[]string{"10.0.0.1", "127.0.0.0/8"}, true},
+    } {
+        s := ServerOptions{Interface: "lo", Transport: TransportUnix, UnixSocket: "/tmp/skyhook.sock", TrustedProxies: test.proxies}
+        if err := s.Validate(); (err == nil) != test.valid {
+            t.Errorf("trusted proxies %v: validation returned %v", test.proxies, err)
+        }
+    }
+}
+
+func TestServerOptions_Origin(t *testing.T) {
+    for transport, want := range map[string]string{
+        TransportTls:  "https://127.0.0.1:8443",
+        TransportHttp: "http://127.0.0.1:8443",
+        TransportUnix: "",
+    } {
+        s := ServerOptions{Port: 8443, Transport: transport, ip: "127.0.0.1"}
+        if got := s.Origin(); got != want {
+            t.Errorf("%s: got origin %q, want %q", transport, got, want)
+        }
+    }
+}
+
+func TestSkyhookConfig_CheckProfiles(t *testing.T) {
+    sc := SkyhookConfig{}
+    sc.FileServer.ObfuscationProfiles = []ObfuscationProfile{{Name: "red"}}
+
+    if err := sc.CheckProfiles([]Credential{{Username: "a"}, {Username: "b", Profile: DefaultProfile}, {Username: "c", Profile: "red"}}); err != nil {
+        t.Error(err)
+    }
+    if err := sc.CheckProfiles([]Credential{{Username: "d", Profile: "blue"}}); err == nil {
+        t.Error("unknown profile wasn't reported")
+    }
+}
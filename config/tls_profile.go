@@ -0,0 +1,255 @@
+package config
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"golang.org/x/exp/slices"
+	"sort"
+	"strings"
+)
+
+const (
+	// TlsPresetGo leaves Go's default TLS parameters untouched.
+	TlsPresetGo = "go"
+	// TlsPresetNginx mimics nginx with the Mozilla intermediate
+	// configuration, as shipped by most distributions.
+	TlsPresetNginx = "nginx"
+	// TlsPresetApache mimics Apache httpd with mod_ssl and without
+	// mod_http2.
+	TlsPresetApache = "apache"
+	// TlsPresetIis mimics IIS on Windows Server 2019, which doesn't
+	// support TLS 1.3.
+	TlsPresetIis = "iis"
+	// TlsPresetModern accepts only TLS 1.3.
+	TlsPresetModern = "modern"
+)
+
+// TlsPresets are the named TLS profiles that a TlsProfile can be
+// based on.
+var TlsPresets = map[string]TlsProfile{
+	TlsPresetGo: {},
+	TlsPresetNginx: {
+		MinVersion: "1.2",
+		MaxVersion: "1.3",
+		CipherSuites: []string{
+			"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+			"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+			"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+			"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+			"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256",
+			"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256",
+		},
+		Curves: []string{"X25519", "P-256", "P-384"},
+		Alpn:   []string{"h2", "http/1.1"},
+	},
+	TlsPresetApache: {
+		MinVersion: "1.2",
+		MaxVersion: "1.3",
+		CipherSuites: []string{
+			"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+			"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+			"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256",
+			"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256",
+			"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+			"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+		},
+		Curves: []string{"X25519", "P-256", "P-384", "P-521"},
+		Alpn:   []string{"http/1.1"},
+	},
+	TlsPresetIis: {
+		MinVersion: "1.2",
+		MaxVersion: "1.2",
+		CipherSuites: []string{
+			"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+			"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+			"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+			"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+			"TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA",
+			"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA",
+			"TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA",
+			"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA",
+		},
+		Curves:                []string{"P-256", "P-384"},
+		Alpn:                  []string{"h2", "http/1.1"},
+		DisableSessionTickets: boolPtr(true),
+	},
+	TlsPresetModern: {
+		MinVersion: "1.3",
+		MaxVersion: "1.3",
+		Curves:     []string{"X25519", "P-256", "P-384"},
+		Alpn:       []string{"h2", "http/1.1"},
+	},
+}
+
+var (
+	tlsVersions = map[string]uint16{
+		"1.0": tls.VersionTLS10,
+		"1.1": tls.VersionTLS11,
+		"1.2": tls.VersionTLS12,
+		"1.3": tls.VersionTLS13,
+	}
+	tlsCurves = map[string]tls.CurveID{
+		"X25519": tls.X25519,
+		"P-256":  tls.CurveP256,
+		"P-384":  tls.CurveP384,
+		"P-521":  tls.CurveP521,
+	}
+)
+
+// TlsProfile determines the TLS parameters negotiated by both
+// servers, and thereby their TLS fingerprint. Empty fields are taken
+// from Preset, and Go's defaults apply to those still empty.
+//
+// Go chooses among the enabled cipher suites in its own order and
+// always enables every TLS 1.3 suite, so CipherSuites restricts the
+// TLS 1.0-1.2 suites that can be negotiated.
+type TlsProfile struct {
+	// Preset is the name of a profile in TlsPresets.
+	Preset string `yaml:"preset,omitempty" json:"preset" mapstructure:"preset"`
+	// MinVersion and MaxVersion bound the TLS version, e.g., "1.2".
+	MinVersion string `yaml:"min_version,omitempty" json:"min_version" mapstructure:"min_version"`
+	MaxVersion string `yaml:"max_version,omitempty" json:"max_version" mapstructure:"max_version"`
+	// CipherSuites are the IANA names of the enabled cipher suites,
+	// e.g., TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256.
+	CipherSuites []string `yaml:"cipher_suites,omitempty" json:"cipher_suites" mapstructure:"cipher_suites"`
+	// Curves are the key exchange curves in order of preference.
+	//
+	// Supported values: X25519, P-256, P-384, P-521
+	Curves []string `yaml:"curves,omitempty" json:"curves" mapstructure:"curves"`
+	// Alpn are the application protocols offered, in order of
+	// preference. HTTP/2 is disabled when "h2" is absent. HTTP/1.1
+	// is always offered.
+	Alpn []string `yaml:"alpn,omitempty" json:"alpn" mapstructure:"alpn"`
+	// DisableSessionTickets prevents sessions from being resumed
+	// via tickets.
+	DisableSessionTickets *bool `yaml:"disable_session_tickets,omitempty" json:"disable_session_tickets" mapstructure:"disable_session_tickets"`
+}
+
+// Resolve returns p with its empty fields taken from its preset.
+func (p *TlsProfile) Resolve() (TlsProfile, error) {
+	if p.Preset == "" {
+		return *p, nil
+	}
+	base, ok := TlsPresets[p.Preset]
+	if !ok {
+		names := make([]string, 0, len(TlsPresets))
+		for name := range TlsPresets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return TlsProfile{}, errors.New(fmt.Sprintf("unknown tls_profile preset %s (supported: %s)",
+			p.Preset, strings.Join(names, ", ")))
+	}
+
+	r := *p
+	if r.MinVersion == "" {
+		r.MinVersion = base.MinVersion
+	}
+	if r.MaxVersion == "" {
+		r.MaxVersion = base.MaxVersion
+	}
+	if r.CipherSuites == nil {
+		r.CipherSuites = base.CipherSuites
+	}
+	if r.Curves == nil {
+		r.Curves = base.Curves
+	}
+	if r.Alpn == nil {
+		r.Alpn = base.Alpn
+	}
+	if r.DisableSessionTickets == nil {
+		r.DisableSessionTickets = base.DisableSessionTickets
+	}
+	return r, nil
+}
+
+// Validate TlsProfile.
+func (p *TlsProfile) Validate() error {
+	_, err := p.Apply(&tls.Config{})
+	return err
+}
+
+// Apply sets the parameters of p on a clone of c, returning the
+// clone. Protocols already in c.NextProtos, such as those of an
+// ACME challenge, are retained after those of p.
+func (p *TlsProfile) Apply(c *tls.Config) (*tls.Config, error) {
+	r, err := p.Resolve()
+	if err != nil {
+		return nil, err
+	}
+	c = c.Clone()
+
+	if r.MinVersion != "" {
+		if c.MinVersion, err = tlsVersion(r.MinVersion); err != nil {
+			return nil, err
+		}
+	}
+	if r.MaxVersion != "" {
+		if c.MaxVersion, err = tlsVersion(r.MaxVersion); err != nil {
+			return nil, err
+		}
+	}
+	if c.MinVersion != 0 && c.MaxVersion != 0 && c.MinVersion > c.MaxVersion {
+		return nil, errors.New("tls_profile min_version exceeds max_version")
+	}
+
+	if r.CipherSuites != nil {
+		suites := make(map[string]uint16)
+		for _, s := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+			suites[s.Name] = s.ID
+		}
+		c.CipherSuites = make([]uint16, 0, len(r.CipherSuites))
+		for _, name := range r.CipherSuites {
+			id, ok := suites[name]
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("unsupported tls_profile cipher suite: %s", name))
+			}
+			c.CipherSuites = append(c.CipherSuites, id)
+		}
+	}
+
+	if r.Curves != nil {
+		c.CurvePreferences = make([]tls.CurveID, 0, len(r.Curves))
+		for _, name := range r.Curves {
+			id, ok := tlsCurves[name]
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("unsupported tls_profile curve: %s", name))
+			}
+			c.CurvePreferences = append(c.CurvePreferences, id)
+		}
+	}
+
+	if r.Alpn != nil {
+		protos := append([]string{}, r.Alpn...)
+		for _, proto := range c.NextProtos {
+			if !slices.Contains(protos, proto) {
+				protos = append(protos, proto)
+			}
+		}
+		c.NextProtos = protos
+	}
+
+	if r.DisableSessionTickets != nil {
+		c.SessionTicketsDisabled = *r.DisableSessionTickets
+	}
+	return c, nil
+}
+
+// Http2 determines if p allows HTTP/2 to be negotiated.
+func (p *TlsProfile) Http2() bool {
+	r, err := p.Resolve()
+	return err == nil && (r.Alpn == nil || slices.Contains(r.Alpn, "h2"))
+}
+
+// tlsVersion parses a TLS version such as "1.2".
+func tlsVersion(v string) (uint16, error) {
+	if id, ok := tlsVersions[v]; ok {
+		return id, nil
+	}
+	return 0, errors.New(fmt.Sprintf("unsupported tls_profile version: %s", v))
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
@@ -0,0 +1,191 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// testCertificate generates a self-signed ECDSA certificate.
+func testCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// serveProfile starts a TLS listener configured by p that completes
+// handshakes and closes each connection, returning its address.
+func serveProfile(t *testing.T, p TlsProfile) string {
+	conf, err := p.Apply(&tls.Config{Certificates: []tls.Certificate{testCertificate(t)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := tls.Listen("tcp", "127.0.0.1:0", conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	return l.Addr().String()
+}
+
+// handshake connects to addr with client, returning the negotiated
+// connection state.
+func handshake(addr string, client *tls.Config) (tls.ConnectionState, error) {
+	client = client.Clone()
+	client.InsecureSkipVerify = true
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", addr, client)
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	defer conn.Close()
+	return conn.ConnectionState(), nil
+}
+
+func TestTlsProfile_Presets(t *testing.T) {
+	nginx := serveProfile(t, TlsProfile{Preset: TlsPresetNginx})
+	apache := serveProfile(t, TlsProfile{Preset: TlsPresetApache})
+	iis := serveProfile(t, TlsProfile{Preset: TlsPresetIis})
+	modern := serveProfile(t, TlsProfile{Preset: TlsPresetModern})
+	alpn := []string{"h2", "http/1.1"}
+
+	if cs, err := handshake(nginx, &tls.Config{NextProtos: alpn}); err != nil {
+		t.Fatal(err)
+	} else if cs.Version != tls.VersionTLS13 || cs.NegotiatedProtocol != "h2" {
+		t.Errorf("nginx: negotiated version %x and protocol %q", cs.Version, cs.NegotiatedProtocol)
+	}
+
+	if cs, err := handshake(nginx, &tls.Config{
+		MaxVersion:   tls.VersionTLS12,
+		CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384},
+	}); err != nil {
+		t.Fatal(err)
+	} else if cs.CipherSuite != tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384 {
+		t.Errorf("nginx: negotiated cipher suite %s", tls.CipherSuiteName(cs.CipherSuite))
+	}
+
+	if _, err := handshake(nginx, &tls.Config{
+		MaxVersion:   tls.VersionTLS12,
+		CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA},
+	}); err == nil {
+		t.Errorf("nginx: negotiated a CBC cipher suite")
+	}
+
+	if cs, err := handshake(apache, &tls.Config{NextProtos: alpn}); err != nil {
+		t.Fatal(err)
+	} else if cs.NegotiatedProtocol != "http/1.1" {
+		t.Errorf("apache: negotiated protocol %q", cs.NegotiatedProtocol)
+	}
+
+	if cs, err := handshake(iis, &tls.Config{
+		CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA},
+	}); err != nil {
+		t.Fatal(err)
+	} else if cs.Version != tls.VersionTLS12 || cs.CipherSuite != tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA {
+		t.Errorf("iis: negotiated version %x and cipher suite %s", cs.Version, tls.CipherSuiteName(cs.CipherSuite))
+	}
+
+	if _, err := handshake(modern, &tls.Config{MaxVersion: tls.VersionTLS12}); err == nil {
+		t.Errorf("modern: negotiated TLS 1.2")
+	}
+}
+
+func TestTlsProfile_SessionTickets(t *testing.T) {
+	for _, test := range []struct {
+		preset string
+		resume bool
+	}{{TlsPresetNginx, true}, {TlsPresetIis, false}} {
+		addr := serveProfile(t, TlsProfile{Preset: test.preset})
+		client := &tls.Config{MaxVersion: tls.VersionTLS12, ClientSessionCache: tls.NewLRUClientSessionCache(1)}
+
+		var cs tls.ConnectionState
+		var err error
+		for i := 0; i < 2 && err == nil; i++ {
+			cs, err = handshake(addr, client)
+		}
+		if err != nil {
+			t.Fatal(err)
+		} else if cs.DidResume != test.resume {
+			t.Errorf("%s: expected resumption %t", test.preset, test.resume)
+		}
+	}
+}
+
+func TestTlsProfile_Overrides(t *testing.T) {
+	addr := serveProfile(t, TlsProfile{
+		Preset:     TlsPresetNginx,
+		MinVersion: "1.2",
+		MaxVersion: "1.2",
+		Curves:     []string{"P-384"},
+		Alpn:       []string{"http/1.1"},
+	})
+
+	if _, err := handshake(addr, &tls.Config{CurvePreferences: []tls.CurveID{tls.CurveP256}}); err == nil {
+		t.Errorf("negotiated a curve that isn't enabled")
+	}
+	if cs, err := handshake(addr, &tls.Config{
+		CurvePreferences: []tls.CurveID{tls.CurveP384},
+		NextProtos:       []string{"h2", "http/1.1"},
+	}); err != nil {
+		t.Fatal(err)
+	} else if cs.Version != tls.VersionTLS12 || cs.NegotiatedProtocol != "http/1.1" {
+		t.Errorf("negotiated version %x and protocol %q", cs.Version, cs.NegotiatedProtocol)
+	}
+
+	p := TlsProfile{Preset: TlsPresetApache}
+	if p.Http2() {
+		t.Errorf("apache preset allows HTTP/2")
+	} else if p = (TlsProfile{Preset: TlsPresetApache, Alpn: []string{"h2"}}); !p.Http2() {
+		t.Errorf("overridden ALPN doesn't allow HTTP/2")
+	}
+}
+
+func TestTlsProfile_Validate(t *testing.T) {
+	for _, p := range []TlsProfile{
+		{Preset: "caddy"},
+		{MinVersion: "1.4"},
+		{MinVersion: "1.3", MaxVersion: "1.2"},
+		{CipherSuites: []string{"TLS_NOT_A_SUITE"}},
+		{Curves: []string{"P-224"}},
+	} {
+		if err := p.Validate(); err == nil {
+			t.Errorf("invalid profile was accepted: %+v", p)
+		}
+	}
+	for name := range TlsPresets {
+		p := TlsProfile{Preset: name}
+		if err := p.Validate(); err != nil {
+			t.Errorf("preset %s is invalid: %v", name, err)
+		}
+	}
+}
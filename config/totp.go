@@ -0,0 +1,120 @@
+package config
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// TotpStep is the RFC 6238 time step.
+	TotpStep = 30 * time.Second
+	// TotpDigits is the number of digits in a TOTP code.
+	TotpDigits = 6
+
+	totpSecretLen = 20
+)
+
+// totpEncoding encodes TOTP secrets as expected by authenticator
+// apps, i.e., unpadded base32.
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TotpOptions configure the TOTP second factor of credentials that
+// have enrolled a secret.
+type TotpOptions struct {
+	// Issuer names Skyhook in authenticator apps.
+	Issuer string `nonzero:"Skyhook" yaml:"issuer" mapstructure:"issuer" json:"issuer"`
+	// Skew is the number of seconds of clock drift tolerated in
+	// either direction. It's rounded down to a multiple of TotpStep,
+	// so values below 30 accept only the current code.
+	Skew uint `nonzero:"30" yaml:"skew" mapstructure:"skew" json:"skew"`
+}
+
+// Steps returns the number of time steps tolerated in either
+// direction.
+func (t *TotpOptions) Steps() uint {
+	return t.Skew / uint(TotpStep/time.Second)
+}
+
+// GenerateTotpSecret returns a random base32 TOTP secret.
+func GenerateTotpSecret() (string, error) {
+	b := make([]byte, totpSecretLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// TotpCounter returns the RFC 6238 time step counter for t.
+func TotpCounter(t time.Time) uint64 {
+	return uint64(t.Unix()) / uint64(TotpStep/time.Second)
+}
+
+// TotpCode returns the code generated by secret for counter, per
+// RFC 4226 with HMAC-SHA1.
+func TotpCode(secret string, counter uint64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", err
+	}
+
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", TotpDigits, bin%1000000), nil
+}
+
+// VerifyTotp checks code against the codes generated by secret for
+// the time steps within skew steps of t, returning the counter of
+// the matching step.
+func VerifyTotp(secret, code string, t time.Time, skew uint) (uint64, bool) {
+	if len(code) != TotpDigits {
+		return 0, false
+	}
+
+	now := TotpCounter(t)
+	for i := -int64(skew); i <= int64(skew); i++ {
+		counter := uint64(int64(now) + i)
+		if want, err := TotpCode(secret, counter); err != nil {
+			return 0, false
+		} else if subtle.ConstantTimeCompare([]byte(want), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// TotpUri returns the otpauth URI used to provision secret for
+// account into an authenticator app, usually rendered as a QR code.
+func TotpUri(issuer, account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(TotpDigits))
+	v.Set("period", fmt.Sprint(int(TotpStep/time.Second)))
+	return (&url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: v.Encode(),
+	}).String()
+}
+
+// HasTotp determines if c has enrolled a TOTP secret, requiring a
+// code upon login.
+func (c *Credential) HasTotp() bool {
+	return c.TotpSecret != ""
+}
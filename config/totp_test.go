@@ -0,0 +1,75 @@
+package config
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 seed of the RFC 6238 test vectors.
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestTotpCode(t *testing.T) {
+	// RFC 6238 Appendix B, truncated to six digits
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, want := range vectors {
+		if got, err := TotpCode(rfcSecret, TotpCounter(time.Unix(unix, 0))); err != nil {
+			t.Fatal(err)
+		} else if got != want {
+			t.Errorf("T=%d: got %s, want %s", unix, got, want)
+		}
+	}
+}
+
+func TestVerifyTotp(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	prev, _ := TotpCode(rfcSecret, TotpCounter(now.Add(-TotpStep)))
+	next, _ := TotpCode(rfcSecret, TotpCounter(now.Add(TotpStep)))
+	late, _ := TotpCode(rfcSecret, TotpCounter(now.Add(2*TotpStep)))
+
+	if counter, ok := VerifyTotp(rfcSecret, "081804", now, 0); !ok || counter != TotpCounter(now) {
+		t.Fatalf("current code was rejected")
+	}
+	if _, ok := VerifyTotp(rfcSecret, prev, now, 0); ok {
+		t.Fatalf("previous code was accepted without skew")
+	}
+	if _, ok := VerifyTotp(rfcSecret, prev, now, 1); !ok {
+		t.Fatalf("previous code was rejected within skew")
+	}
+	if counter, ok := VerifyTotp(rfcSecret, next, now, 1); !ok || counter != TotpCounter(now)+1 {
+		t.Fatalf("next code was rejected within skew")
+	}
+	if _, ok := VerifyTotp(rfcSecret, late, now, 1); ok {
+		t.Fatalf("code beyond skew was accepted")
+	}
+	if _, ok := VerifyTotp(rfcSecret, "", now, 1); ok {
+		t.Fatalf("empty code was accepted")
+	}
+}
+
+func TestTotpOptions_Steps(t *testing.T) {
+	for skew, want := range map[uint]uint{0: 0, 29: 0, 30: 1, 95: 3} {
+		if got := (&TotpOptions{Skew: skew}).Steps(); got != want {
+			t.Errorf("skew %d: got %d steps, want %d", skew, got, want)
+		}
+	}
+}
+
+func TestTotpUri(t *testing.T) {
+	secret, err := GenerateTotpSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri := TotpUri("Skyhook", "op", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/Skyhook:op?") || !strings.Contains(uri, "secret="+secret) {
+		t.Fatalf("unexpected provisioning uri: %s", uri)
+	}
+}
@@ -1,6 +1,6 @@
 module github.com/blackhillsinfosec/skyhook
 
-go 1.19
+go 1.22
 
 require (
 	github.com/appleboy/gin-jwt/v2 v2.9.1
@@ -10,12 +10,14 @@ require (
 	github.com/gin-gonic/gin v1.9.0
 	github.com/google/uuid v1.3.0
 	github.com/impostorkeanu/go-commoners v0.0.2
+	github.com/klauspost/compress v1.18.0
 	github.com/spf13/cobra v1.7.0
 	github.com/spf13/viper v1.14.0
 	github.com/tdewolff/minify v2.3.6+incompatible
+	go.etcd.io/bbolt v1.3.10
 	golang.org/x/crypto v0.8.0
 	golang.org/x/exp v0.0.0-20230519143937-03e91628a987
-	golang.org/x/sync v0.1.0
+	golang.org/x/sync v0.5.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
@@ -0,0 +1,123 @@
+package server
+
+import (
+    "context"
+    "crypto/tls"
+    "crypto/x509"
+    "errors"
+    "fmt"
+    "github.com/blackhillsinfosec/skyhook/config"
+    "github.com/blackhillsinfosec/skyhook/log"
+    "golang.org/x/crypto/acme"
+    "golang.org/x/crypto/acme/autocert"
+    "net"
+    "net/http"
+    "os"
+    "time"
+)
+
+// NewCertManager initializes an autocert.Manager that obtains and
+// renews certificates for the FQDNs in opts, caching them in
+// opts.CertDir.
+//
+// A single manager should be shared by both servers so that
+// certificates are obtained once. Certificates are renewed
+// automatically once they've been loaded by a TLS handshake or
+// WarmCertificates.
+func NewCertManager(opts *config.AcmeOptions) (m *autocert.Manager, err error) {
+    hClient := http.DefaultClient
+    if opts.DirectoryCaFile != "" {
+
+        //============================
+        // TRUST THE DIRECTORY'S CA(S)
+        //============================
+
+        var pem []byte
+        if pem, err = os.ReadFile(opts.DirectoryCaFile); err != nil {
+            return nil, errors.New(fmt.Sprintf("failed to read ACME directory CA file: %v", err))
+        }
+        pool := x509.NewCertPool()
+        if !pool.AppendCertsFromPEM(pem) {
+            return nil, errors.New(fmt.Sprintf("no certificates found in ACME directory CA file: %s", opts.DirectoryCaFile))
+        }
+        hClient = &http.Client{Transport: &http.Transport{
+            Proxy:           http.ProxyFromEnvironment,
+            TLSClientConfig: &tls.Config{RootCAs: pool},
+        }}
+    }
+
+    // HTTP-01 requests carry a port in the Host header when the
+    // challenge server isn't on port 80, e.g., behind a port
+    // forward, which the whitelist would otherwise reject.
+    whitelist := autocert.HostWhitelist(opts.Fqdns()...)
+    policy := func(ctx context.Context, host string) error {
+        if h, _, err := net.SplitHostPort(host); err == nil {
+            host = h
+        }
+        return whitelist(ctx, host)
+    }
+
+    return &autocert.Manager{
+        Prompt:      autocert.AcceptTOS,
+        Cache:       autocert.DirCache(opts.CertDir),
+        HostPolicy:  policy,
+        RenewBefore: opts.RenewBeforeDuration(),
+        Email:       opts.Email,
+        Client: &acme.Client{
+            DirectoryURL: opts.DirectoryUrl,
+            HTTPClient:   hClient,
+        },
+    }, nil
+}
+
+// NewAcmeChallengeServer returns a server that answers HTTP-01
+// challenges for m on addr. All other requests receive a 404.
+func NewAcmeChallengeServer(m *autocert.Manager, addr string) *http.Server {
+    return &http.Server{
+        Addr:              addr,
+        Handler:           m.HTTPHandler(http.NotFoundHandler()),
+        ReadHeaderTimeout: 10 * time.Second,
+        ErrorLog:          log.ERR,
+    }
+}
+
+// WarmCertificates loads a certificate for each FQDN, obtaining it
+// from the ACME directory when it's missing from the cache. This
+// replaces waiting for the first TLS handshake and schedules
+// renewal of each certificate.
+//
+// Call this after the servers are listening, since they answer
+// TLS-ALPN-01 challenges.
+func WarmCertificates(m *autocert.Manager, fqdns []string) (err error) {
+    for _, fqdn := range fqdns {
+        var cert *tls.Certificate
+        if cert, err = m.GetCertificate(&tls.ClientHelloInfo{ServerName: fqdn}); err != nil {
+            return errors.New(fmt.Sprintf("failed to obtain certificate for %s: %v", fqdn, err))
+        }
+        if cert.Leaf != nil {
+            log.INFO.Printf("Loaded certificate for %s (expires %s)", fqdn, cert.Leaf.NotAfter.Format(time.RFC3339))
+        }
+    }
+    return nil
+}
+
+// listenAndServeTLS serves srv with the certificate and key files in
+// opts, or with certificates from m when it is non-nil. The TLS
+// parameters are determined by profile.
+func listenAndServeTLS(srv *http.Server, opts *config.ManualTlsOptions, profile *config.TlsProfile, m *autocert.Manager) (err error) {
+    base, certFile, keyFile := &tls.Config{}, opts.CertPath, opts.KeyPath
+    if m != nil {
+        // Only the challenge protocol is taken from m, leaving the
+        // others to profile
+        base = &tls.Config{GetCertificate: m.GetCertificate, NextProtos: []string{acme.ALPNProto}}
+        certFile, keyFile = "", ""
+    }
+
+    if srv.TLSConfig, err = profile.Apply(base); err != nil {
+        return err
+    } else if !profile.Http2() {
+        // A non-nil map keeps net/http from enabling HTTP/2
+        srv.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+    }
+    return srv.ListenAndServeTLS(certFile, keyFile)
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+    "crypto/tls"
+    "github.com/blackhillsinfosec/skyhook/config"
+    "golang.org/x/crypto/acme/autocert"
+    "net"
+    "net/http"
+    "os"
+    "testing"
+)
+
+/*
+ACME tests run against a local ACME test server, such as pebble:
+
+    https://github.com/letsencrypt/pebble
+
+# How to Run
+
+- Start pebble, e.g., from its repository:
+
+    PEBBLE_VA_NOSLEEP=1 pebble -config test/config/pebble-config.json
+
+- Export the below variables and run the tests:
+
+    SKYHOOK_ACME_DIRECTORY=https://127.0.0.1:14000/dir
+    SKYHOOK_ACME_CA=<pebble>/test/certs/pebble.minica.pem
+
+Pebble resolves the FQDN via -dnsserver, e.g., pebble-challtestsrv
+started with -defaultIPv4 127.0.0.1. It must also return a Location
+header when finalizing orders, which the acme package requires but
+releases that finalize asynchronously omit.
+
+Pebble validates challenges against ports 5002 (HTTP-01) and 5001
+(TLS-ALPN-01) of the FQDN, which defaults to skyhook.test. Override
+them with SKYHOOK_ACME_FQDN, SKYHOOK_ACME_HTTP_ADDR and
+SKYHOOK_ACME_TLS_ADDR.
+*/
+
+func acmeTestOptions(t *testing.T) *config.AcmeOptions {
+    dir := os.Getenv("SKYHOOK_ACME_DIRECTORY")
+    if dir == "" {
+        t.Skip("SKYHOOK_ACME_DIRECTORY is not set")
+    }
+    opts := &config.AcmeOptions{
+        CertDir:         t.TempDir(),
+        Fqdn:            envOr("SKYHOOK_ACME_FQDN", "skyhook.test"),
+        DirectoryUrl:    dir,
+        DirectoryCaFile: os.Getenv("SKYHOOK_ACME_CA"),
+    }
+    if err := opts.Validate(); err != nil {
+        t.Fatalf("failed to validate ACME options: %v", err)
+    }
+    return opts
+}
+
+func envOr(name, def string) string {
+    if v := os.Getenv(name); v != "" {
+        return v
+    }
+    return def
+}
+
+// serve starts srv on addr, stopping it when the test ends.
+func serve(t *testing.T, srv *http.Server, addr string, useTls bool) {
+    l, err := net.Listen("tcp", addr)
+    if err != nil {
+        t.Fatalf("failed to listen on %s: %v", addr, err)
+    }
+    if useTls {
+        l = tls.NewListener(l, srv.TLSConfig)
+    }
+    go srv.Serve(l)
+    t.Cleanup(func() { srv.Close() })
+}
+
+// checkCert obtains a certificate from m and ensures it's valid
+// for fqdn.
+func checkCert(t *testing.T, m *autocert.Manager, fqdn string) {
+    if err := WarmCertificates(m, []string{fqdn}); err != nil {
+        t.Fatal(err)
+    }
+    cert, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: fqdn})
+    if err != nil {
+        t.Fatalf("failed to load cached certificate: %v", err)
+    } else if err = cert.Leaf.VerifyHostname(fqdn); err != nil {
+        t.Fatalf("certificate isn't valid for %s: %v", fqdn, err)
+    }
+}
+
+func TestCertManager_TlsAlpn01(t *testing.T) {
+    opts := acmeTestOptions(t)
+    m, err := NewCertManager(opts)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // The managed TLS config answers TLS-ALPN-01 challenges
+    srv := &http.Server{Handler: http.NotFoundHandler(), TLSConfig: m.TLSConfig()}
+    serve(t, srv, envOr("SKYHOOK_ACME_TLS_ADDR", ":5001"), true)
+
+    checkCert(t, m, opts.Fqdn)
+}
+
+func TestCertManager_Http01(t *testing.T) {
+    opts := acmeTestOptions(t)
+    m, err := NewCertManager(opts)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // No TLS listener is started, so TLS-ALPN-01 fails and the
+    // manager falls back to HTTP-01
+    serve(t, NewAcmeChallengeServer(m, ""), envOr("SKYHOOK_ACME_HTTP_ADDR", ":5002"), false)
+
+    checkCert(t, m, opts.Fqdn)
+}
+
+func TestCertManager_DirectoryCaFile(t *testing.T) {
+    f := t.TempDir() + "/ca.pem"
+    if err := os.WriteFile(f, []byte("not a certificate"), 0600); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := NewCertManager(&config.AcmeOptions{DirectoryCaFile: f}); err == nil {
+        t.Fatal("expected an error for a CA file without certificates")
+    }
+}
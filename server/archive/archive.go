@@ -0,0 +1,171 @@
+// Package archive streams directories from the file server as tar,
+// gzipped tar or zip archives.
+//
+// Archives are generated on the fly rather than written to disk.
+// Output is deterministic for an unchanged directory, allowing an
+// archive to be retrieved in chunks by generating it again and
+// skipping to the requested offset. Streams avoids the cost of
+// doing so when chunks are requested in order.
+package archive
+
+import (
+    "archive/tar"
+    "archive/zip"
+    "compress/gzip"
+    "errors"
+    "fmt"
+    "golang.org/x/exp/slices"
+    "io"
+    "io/fs"
+    "os"
+    "path"
+    "path/filepath"
+)
+
+const (
+    // FormatTar is an uncompressed tar archive.
+    FormatTar = "tar"
+    // FormatTarGz is a gzip compressed tar archive.
+    FormatTarGz = "tgz"
+    // FormatZip is a zip archive with deflated entries.
+    FormatZip = "zip"
+)
+
+// Formats lists the supported archive formats.
+var Formats = []string{FormatTar, FormatTarGz, FormatZip}
+
+// ValidFormat determines if format is supported.
+func ValidFormat(format string) bool {
+    return slices.Contains(Formats, format)
+}
+
+// entryWriter adds entries to an archive.
+type entryWriter interface {
+    // add adds a directory, or a file whose content is read from
+    // r, named name to the archive.
+    add(name string, fi fs.FileInfo, r io.Reader) error
+    io.Closer
+}
+
+// Write writes an archive of the directory at root to w in format.
+//
+// Entries are written in lexical order beneath a single directory
+// named name, which is what the archive extracts to. Symbolic links
+// and other irregular files are skipped; links are never followed
+// out of root.
+func Write(w io.Writer, root, name, format string) (err error) {
+
+    var ew entryWriter
+    switch format {
+    case FormatTar:
+        ew = &tarWriter{tw: tar.NewWriter(w)}
+    case FormatTarGz:
+        gw := gzip.NewWriter(w)
+        ew = &tarWriter{tw: tar.NewWriter(gw), gw: gw}
+    case FormatZip:
+        ew = &zipWriter{zw: zip.NewWriter(w)}
+    default:
+        return errors.New(fmt.Sprintf("unsupported archive format: %s", format))
+    }
+
+    err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+        if err != nil {
+            return err
+        } else if !d.IsDir() && !d.Type().IsRegular() {
+            return nil
+        }
+
+        var fi fs.FileInfo
+        if fi, err = d.Info(); err != nil {
+            return err
+        }
+
+        var rel string
+        if rel, err = filepath.Rel(root, p); err != nil {
+            return err
+        }
+        entry := path.Join(name, filepath.ToSlash(rel))
+
+        if d.IsDir() {
+            return ew.add(entry+"/", fi, nil)
+        }
+
+        var f *os.File
+        if f, err = os.Open(p); err != nil {
+            return err
+        }
+        defer f.Close()
+        return ew.add(entry, fi, f)
+    })
+
+    if cErr := ew.Close(); err == nil {
+        err = cErr
+    }
+    return err
+}
+
+// tarWriter adds entries to a tar archive, which is optionally
+// gzip compressed.
+type tarWriter struct {
+    tw *tar.Writer
+    gw *gzip.Writer
+}
+
+func (t *tarWriter) add(name string, fi fs.FileInfo, r io.Reader) (err error) {
+    var hdr *tar.Header
+    if hdr, err = tar.FileInfoHeader(fi, ""); err != nil {
+        return err
+    }
+    hdr.Name = name
+    // Owner names are looked up by FileInfoHeader and are of no use
+    // to the recipient
+    hdr.Uname, hdr.Gname = "", ""
+
+    if err = t.tw.WriteHeader(hdr); err != nil || r == nil {
+        return err
+    }
+    return copyEntry(t.tw, r, hdr.Size)
+}
+
+func (t *tarWriter) Close() error {
+    if err := t.tw.Close(); err != nil || t.gw == nil {
+        return err
+    }
+    return t.gw.Close()
+}
+
+// zipWriter adds entries to a zip archive.
+type zipWriter struct {
+    zw *zip.Writer
+}
+
+func (z *zipWriter) add(name string, fi fs.FileInfo, r io.Reader) (err error) {
+    var hdr *zip.FileHeader
+    if hdr, err = zip.FileInfoHeader(fi); err != nil {
+        return err
+    }
+    hdr.Name = name
+    if r != nil {
+        hdr.Method = zip.Deflate
+    }
+
+    var w io.Writer
+    if w, err = z.zw.CreateHeader(hdr); err != nil || r == nil {
+        return err
+    }
+    return copyEntry(w, r, fi.Size())
+}
+
+func (z *zipWriter) Close() error {
+    return z.zw.Close()
+}
+
+// copyEntry copies exactly size bytes from r to w, failing when the
+// file was truncated after its header was written. Content appended
+// since is ignored.
+func copyEntry(w io.Writer, r io.Reader, size int64) error {
+    if n, err := io.CopyN(w, r, size); err != nil {
+        return errors.New(fmt.Sprintf("read %d of %d bytes from file: %v", n, size, err))
+    }
+    return nil
+}
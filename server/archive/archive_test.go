@@ -0,0 +1,97 @@
+package archive
+
+import (
+    "bytes"
+    "crypto/rand"
+    "io"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+// testTree creates a directory tree containing nested directories,
+// files and a symbolic link.
+func testTree(t *testing.T) string {
+    root := t.TempDir()
+    for _, d := range []string{"a/b", "empty"} {
+        if err := os.MkdirAll(filepath.Join(root, d), 0700); err != nil {
+            t.Fatal(err)
+        }
+    }
+    for name, size := range map[string]int{"a/rand.bin": 200000, "a/b/small.txt": 10, "top.bin": 70000} {
+        b := make([]byte, size)
+        rand.Read(b)
+        if err := os.WriteFile(filepath.Join(root, name), b, 0600); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := os.Symlink("/etc/passwd", filepath.Join(root, "link")); err != nil {
+        t.Fatal(err)
+    }
+    return root
+}
+
+func writeArchive(t *testing.T, root, format string) []byte {
+    buff := bytes.Buffer{}
+    if err := Write(&buff, root, "tree", format); err != nil {
+        t.Fatal(err)
+    }
+    return buff.Bytes()
+}
+
+func TestWrite_Deterministic(t *testing.T) {
+    root := testTree(t)
+    for _, format := range Formats {
+        t.Run(format, func(t *testing.T) {
+            first := writeArchive(t, root, format)
+            if second := writeArchive(t, root, format); !bytes.Equal(first, second) {
+                t.Fatal("archives of an unchanged directory differ")
+            } else if bytes.Contains(first, []byte("passwd")) {
+                t.Fatal("symbolic link was followed")
+            }
+        })
+    }
+}
+
+func TestWrite_UnsupportedFormat(t *testing.T) {
+    if err := Write(io.Discard, t.TempDir(), "tree", "rar"); err == nil {
+        t.Fatal("expected an error for an unsupported format")
+    }
+}
+
+func TestStreams(t *testing.T) {
+    root := testTree(t)
+    want := writeArchive(t, root, FormatTarGz)
+    ss := NewStreams(time.Minute)
+
+    // readChunk reads the chunk at off, as the file server does
+    readChunk := func(off, size int64) []byte {
+        s, err := ss.Open("key", root, "tree", FormatTarGz, off)
+        if err != nil {
+            t.Fatalf("failed to open stream at %d: %v", off, err)
+        }
+        b, err := io.ReadAll(io.LimitReader(s, size))
+        ss.Release(s, err != nil)
+        if err != nil {
+            t.Fatal(err)
+        }
+        return b
+    }
+
+    const size = 4096
+    offsets := []int64{0, size, 2 * size, size, 5 * size, 6 * size}
+    for _, off := range offsets {
+        end := off + size
+        if end > int64(len(want)) {
+            end = int64(len(want))
+        }
+        if got := readChunk(off, size); !bytes.Equal(got, want[off:end]) {
+            t.Fatalf("chunk at %d differs from the archive", off)
+        }
+    }
+
+    if _, err := ss.Open("key", root, "tree", FormatTarGz, int64(len(want))); err != ErrOutOfRange {
+        t.Fatalf("expected ErrOutOfRange at the end of the archive, got %v", err)
+    }
+}
@@ -0,0 +1,133 @@
+package archive
+
+import (
+    "bufio"
+    "errors"
+    "io"
+    "sync"
+    "time"
+)
+
+// ErrOutOfRange is returned by Streams.Open when the requested
+// offset is at or beyond the end of the archive.
+var ErrOutOfRange = errors.New("offset is beyond the end of the archive")
+
+// Streams tracks archives being retrieved in chunks.
+//
+// Each chunk request would otherwise generate its archive from the
+// beginning, reading the directory up to the requested offset again.
+// Instead, the generator of an archive is paused after each chunk
+// and resumed when the following chunk is requested. Generators that
+// aren't resumed within the idle period are stopped.
+type Streams struct {
+    mu      sync.Mutex
+    idle    time.Duration
+    streams map[string]*Stream
+}
+
+// NewStreams initializes Streams that stop generators after idle.
+func NewStreams(idle time.Duration) *Streams {
+    return &Streams{idle: idle, streams: make(map[string]*Stream)}
+}
+
+// Stream is an archive being generated, positioned at an offset.
+type Stream struct {
+    key   string
+    off   int64
+    r     *bufio.Reader
+    pr    *io.PipeReader
+    timer *time.Timer
+}
+
+// Read reads the archive, advancing the offset of the stream.
+func (s *Stream) Read(b []byte) (n int, err error) {
+    n, err = s.r.Read(b)
+    s.off += int64(n)
+    return n, err
+}
+
+// close stops the generator of the stream.
+func (s *Stream) close() {
+    s.pr.Close()
+}
+
+// Open returns a Stream positioned at off of the archive of the
+// directory at root, described by key. The stream must be passed to
+// Release once the chunk has been read from it.
+//
+// A paused stream for key positioned at off is resumed. Otherwise,
+// a new generator is started and the archive is read up to off.
+// ErrOutOfRange is returned when off is beyond the archive.
+func (ss *Streams) Open(key, root, name, format string, off int64) (s *Stream, err error) {
+
+    //======================
+    // RESUME A PAUSED STREAM
+    //======================
+
+    ss.mu.Lock()
+    if s = ss.streams[key]; s != nil {
+        delete(ss.streams, key)
+        s.timer.Stop()
+        if s.off != off {
+            s.close()
+            s = nil
+        }
+    }
+    ss.mu.Unlock()
+
+    //=============================
+    // GENERATE THE ARCHIVE FROM OFF
+    //=============================
+
+    if s == nil {
+        pr, pw := io.Pipe()
+        go func() {
+            pw.CloseWithError(Write(pw, root, name, format))
+        }()
+
+        s = &Stream{key: key, r: bufio.NewReader(pr), pr: pr}
+        if _, err = io.CopyN(io.Discard, s, off); err == io.EOF {
+            s.close()
+            return nil, ErrOutOfRange
+        } else if err != nil {
+            s.close()
+            return nil, err
+        }
+    }
+
+    // A stream positioned at its end has nothing left to send
+    if _, err = s.r.Peek(1); err == io.EOF {
+        s.close()
+        return nil, ErrOutOfRange
+    } else if err != nil {
+        s.close()
+        return nil, err
+    }
+    return s, nil
+}
+
+// Release pauses s so that it can be resumed by Open for the
+// following chunk, replacing any stream paused for the same
+// archive. Streams that failed are stopped instead.
+func (ss *Streams) Release(s *Stream, failed bool) {
+    if failed {
+        s.close()
+        return
+    }
+
+    ss.mu.Lock()
+    defer ss.mu.Unlock()
+    if prev := ss.streams[s.key]; prev != nil {
+        prev.timer.Stop()
+        prev.close()
+    }
+    ss.streams[s.key] = s
+    s.timer = time.AfterFunc(ss.idle, func() {
+        ss.mu.Lock()
+        defer ss.mu.Unlock()
+        if ss.streams[s.key] == s {
+            delete(ss.streams, s.key)
+            s.close()
+        }
+    })
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+    "fmt"
+    jwt "github.com/appleboy/gin-jwt/v2"
+    obfuscate "github.com/blackhillsinfosec/skyhook-obfuscation"
+    "github.com/blackhillsinfosec/skyhook/audit"
+    mw "github.com/blackhillsinfosec/skyhook/server/middleware"
+    "github.com/gin-gonic/gin"
+    "net/http"
+    "path"
+    "strings"
+)
+
+// auditEvent returns a handler that records event to the audit log
+// after the remaining handlers have responded to the request.
+//
+// The targeted path is taken from the relFilePath context variable
+// set by mw.DeobfUploadFilePath, falling back to deobfuscating the
+// filepath route parameter. Byte ranges are taken from the context
+// variables set by mw.RangeHeader or the standard Range header, and
+// any message from the auditMessage context variable.
+func (ss *SkyhookServer) auditEvent(event audit.Event) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        c.Next()
+
+        r := newAuditRecord(c, "file", event, ss.Global.Auth.Jwt.FieldKeys.Username)
+
+        //===============
+        // DERIVE THE PATH
+        //===============
+
+        if v, ok := c.Get("relFilePath"); ok {
+            r.Path = v.(string)
+        } else if p := strings.TrimPrefix(c.Param("filepath"), "/"); p != "" {
+            if dec, err := obfuscate.Deobfuscate([]byte(p), *mw.CtxObfChain(c, ss.ObfuscatorChain)); err == nil {
+                r.Path = path.Clean("/" + string(dec))
+                if cred := mw.CtxCredential(c); cred != nil {
+                    r.Path = path.Join(cred.WebPath(), r.Path)
+                }
+            }
+        }
+
+        //=====================
+        // DERIVE THE BYTE RANGE
+        //=====================
+
+        if start, ok := c.Get("rangeStart"); ok {
+            end := c.MustGet("rangeEnd").(uint64)
+            r.Range = fmt.Sprintf("%d-%d", start.(uint64), end-1)
+            r.Bytes = int64(end - start.(uint64))
+        } else if event == audit.EventDownloadChunk {
+            // Response bodies are obfuscated, so the size of a
+            // partial response is derived from its range instead.
+            var start, end int64
+            r.Range = strings.TrimPrefix(c.Request.Header.Get("Range"), "bytes=")
+            if _, err := fmt.Sscanf(r.Range, "%d-%d", &start, &end); err == nil && r.Status == http.StatusPartialContent {
+                r.Bytes = end - start + 1
+            } else {
+                r.Bytes = int64(c.Writer.Size())
+            }
+        }
+
+        if v, ok := c.Get("auditMessage"); ok {
+            r.Message = v.(string)
+        }
+
+        audit.Log(r)
+    }
+}
+
+// newAuditRecord initializes an audit.Record describing the
+// response to c. The user is identified by the credential assigned
+// by mw.UserCredential, falling back to the usernameField claim of
+// the request's JWT.
+func newAuditRecord(c *gin.Context, server string, event audit.Event, usernameField string) audit.Record {
+    r := audit.Record{
+        Event:      event,
+        Server:     server,
+        RemoteAddr: c.ClientIP(),
+        Status:     c.Writer.Status(),
+    }
+    if cred := mw.CtxCredential(c); cred != nil {
+        r.User = cred.Username
+    } else if v, ok := jwt.ExtractClaims(c)[usernameField].(string); ok {
+        r.User = v
+    }
+    return r
+}
+
+// auditLogout returns a handler that records a logout to the audit
+// log before passing the request to next, which is expected to be
+// the LogoutHandler of the JWT middleware.
+func auditLogout(server string, authMiddleWare *jwt.GinJWTMiddleware, usernameField *string, next gin.HandlerFunc) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        next(c)
+        r := newAuditRecord(c, server, audit.EventLogout, *usernameField)
+        if claims, err := authMiddleWare.GetClaimsFromJWT(c); err == nil {
+            r.User, _ = claims[*usernameField].(string)
+        }
+        audit.Log(r)
+    }
+}
@@ -2,13 +2,17 @@ package chunk_fs
 
 import (
     obfuscate "github.com/blackhillsinfosec/skyhook-obfuscation"
+    "github.com/blackhillsinfosec/skyhook/config"
     "github.com/blackhillsinfosec/skyhook/log"
     "net/http"
+    "os"
 )
 
-func New(root string, obfsChain *[]obfuscate.Obfuscator) http.FileSystem {
+// New returns an ObfChunkFilesystem jailed to root. Access to
+// files and directories is restricted by perms.
+func New(root string, obfsChain *[]obfuscate.Obfuscator, perms config.UserPermissions) http.FileSystem {
     fs := http.Dir(root)
-    return &ObfChunkFilesystem{httpFs: fs, chain: obfsChain}
+    return &ObfChunkFilesystem{httpFs: fs, chain: obfsChain, perms: perms}
 }
 
 // ObfChunkFilesystem implements Open such that the path
@@ -24,9 +28,12 @@ func New(root string, obfsChain *[]obfuscate.Obfuscator) http.FileSystem {
 //   clients
 //   - ObfResponseWriter obfuscates the data prior to writing to
 //     http.ResponseWriter
+// - Files can be opened only with the download permission, and
+//   directories only with the list permission
 type ObfChunkFilesystem struct {
     httpFs http.FileSystem
     chain  *[]obfuscate.Obfuscator
+    perms  config.UserPermissions
 }
 
 // Open deobfuscates name and proxies the file request to an
@@ -34,15 +41,38 @@ type ObfChunkFilesystem struct {
 // http.File object.
 //
 // Each individual chunk is obfuscated using ObfChunkFilesystem.chain.
+//
+// os.ErrPermission is returned when the target is a file and
+// downloads aren't permitted, or when it's a directory and
+// listing isn't permitted.
 func (fs ObfChunkFilesystem) Open(name string) (http.File, error) {
     if len(name) > 0 && name[0:1] == "/" {
         name = name[1:]
     }
 
-    if dec, err := obfuscate.Deobfuscate([]byte(name), *fs.chain); err != nil {
+    dec, err := obfuscate.Deobfuscate([]byte(name), *fs.chain)
+    if err != nil {
         log.ERR.Printf("Failed to decode: %v", err)
         return nil, err
-    } else {
-        return fs.httpFs.Open(string(dec))
     }
+
+    //===================
+    // ENFORCE PERMISSIONS
+    //===================
+
+    f, err := fs.httpFs.Open(string(dec))
+    if err != nil {
+        return f, err
+    }
+
+    var stat os.FileInfo
+    if stat, err = f.Stat(); err != nil {
+        f.Close()
+        return nil, err
+    } else if (stat.IsDir() && !fs.perms.List) || (!stat.IsDir() && !fs.perms.Download) {
+        f.Close()
+        return nil, &os.PathError{Op: "open", Path: string(dec), Err: os.ErrPermission}
+    }
+
+    return f, nil
 }
@@ -4,6 +4,7 @@ import (
     "encoding/json"
     "errors"
     obfuscate "github.com/blackhillsinfosec/skyhook-obfuscation"
+    "github.com/blackhillsinfosec/skyhook/config"
     "github.com/blackhillsinfosec/skyhook/log"
     "io/fs"
     "net/http"
@@ -34,9 +35,12 @@ func (d fileInfoItems) name(i int) string {
 //
 // - It accepts a file name, which is expected to be obfuscated.
 // - The file name is base64 decoded and deobfuscated
+// - Directories can be inspected only with the list permission,
+//   and files only with the list or download permission
 type InspectFileServer struct {
     Webroot string
     chain   *[]obfuscate.Obfuscator
+    perms   config.UserPermissions
 }
 
 func (is InspectFileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -78,6 +82,8 @@ func (is InspectFileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
             // DIRECTORY/FILE FOUND
             //=====================
 
+            defer f.Close()
+
             var stat fs.FileInfo
             if stat, err = f.Stat(); err != nil {
 
@@ -87,6 +93,17 @@ func (is InspectFileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
                 log.ERR.Printf("Failed to stat requested target for inspection: %v", err)
                 http.Error(w, "Not found.", http.StatusNotFound)
+                return
+            }
+
+            if (stat.IsDir() && !is.perms.List) || (!stat.IsDir() && !is.perms.List && !is.perms.Download) {
+
+                //==================
+                // PERMISSION DENIED
+                //==================
+
+                http.Error(w, "Forbidden.", http.StatusForbidden)
+                return
             }
 
             var entries []FileInfo
@@ -149,11 +166,13 @@ func (is InspectFileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 // New returns an InspectFileServer capable of
 // inspecting and returning JSON formatted fs.FileInfo
-// data structures.
-func New(webroot string, obfChain *[]obfuscate.Obfuscator) InspectFileServer {
+// data structures. Inspection is jailed to webroot and
+// restricted by perms.
+func New(webroot string, obfChain *[]obfuscate.Obfuscator, perms config.UserPermissions) InspectFileServer {
     return InspectFileServer{
         Webroot: webroot,
         chain:   obfChain,
+        perms:   perms,
     }
 }
 
@@ -0,0 +1,72 @@
+package server
+
+import (
+    "errors"
+    "github.com/blackhillsinfosec/skyhook/config"
+    "golang.org/x/crypto/acme/autocert"
+    "net"
+    "net/http"
+    "os"
+)
+
+// listenAndServe serves srv with the transport configured by opts.
+// TLS options, profile and m are used only by config.TransportTls.
+func listenAndServe(srv *http.Server, opts *config.ServerOptions, tlsOpts *config.ManualTlsOptions, profile *config.TlsProfile, m *autocert.Manager) error {
+    switch opts.Transport {
+    case config.TransportHttp:
+        return srv.ListenAndServe()
+    case config.TransportUnix:
+        l, err := listenUnix(opts.UnixSocket)
+        if err != nil {
+            return err
+        }
+        srv.Handler = unixPeer{srv.Handler}
+        return srv.Serve(l)
+    }
+    return listenAndServeTLS(srv, tlsOpts, profile, m)
+}
+
+// listenUnix listens on the Unix socket at name, replacing a socket
+// left behind by a previous run. The socket is accessible only to
+// the owner and group of the process.
+func listenUnix(name string) (net.Listener, error) {
+    if stat, err := os.Lstat(name); err == nil {
+        if stat.Mode()&os.ModeSocket == 0 {
+            return nil, errors.New("unix socket path exists and isn't a socket: " + name)
+        } else if err = os.Remove(name); err != nil {
+            return nil, err
+        }
+    }
+
+    l, err := net.Listen("unix", name)
+    if err != nil {
+        return nil, err
+    }
+    if err = os.Chmod(name, 0660); err != nil {
+        l.Close()
+        return nil, err
+    }
+    return l, nil
+}
+
+// corsOrigins returns the origins accepted by CORS for the server
+// configured by opts.
+func corsOrigins(opts *config.ServerOptions) (origins []string) {
+    if o := opts.Origin(); o != "" {
+        origins = append(origins, o)
+    }
+    return append(origins, opts.AddtlCorsUrls...)
+}
+
+// unixPeer attributes requests received on a Unix socket to
+// 127.0.0.1, since such peers have no IP address. This allows the
+// proxy in front of the socket to be trusted via TrustedProxies,
+// which config.ServerOptions.Validate requires.
+type unixPeer struct {
+    h http.Handler
+}
+
+func (u unixPeer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    r.RemoteAddr = "127.0.0.1:0"
+    u.h.ServeHTTP(w, r)
+}
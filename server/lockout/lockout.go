@@ -0,0 +1,189 @@
+// Package lockout throttles failed logins by client IP address and
+// username, backing off exponentially and locking out clients and
+// usernames that fail too often.
+package lockout
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// KindUser identifies entries tracking a username.
+	KindUser = "user"
+	// KindIP identifies entries tracking a client IP address.
+	KindIP = "ip"
+
+	// pruneThreshold is the number of entries beyond which stale
+	// entries are pruned as failures are recorded.
+	pruneThreshold = 1024
+)
+
+// Policy determines how failed logins are throttled.
+type Policy struct {
+	// UserAttempts and IPAttempts are the number of failures after
+	// which a username or IP address is locked out.
+	UserAttempts uint
+	IPAttempts   uint
+	// Backoff is the time a client must wait after the first failure.
+	// It doubles with each subsequent failure, up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Lockout is the time a username or IP address remains locked
+	// out. Failures are also forgotten once Lockout has elapsed since
+	// the last one.
+	Lockout time.Duration
+}
+
+// Entry describes the failed logins of a username or IP address.
+type Entry struct {
+	Kind        string    `json:"kind" yaml:"kind"`
+	Key         string    `json:"key" yaml:"key"`
+	Failures    uint      `json:"failures" yaml:"failures"`
+	LastFailure time.Time `json:"last_failure" yaml:"last_failure"`
+	// RetryAt is the time before which further attempts are refused.
+	RetryAt time.Time `json:"retry_at" yaml:"retry_at"`
+	// Locked indicates that the entry has reached its attempt limit,
+	// as opposed to backing off.
+	Locked bool `json:"locked" yaml:"locked"`
+}
+
+// Tracker tracks failed logins. It's safe for concurrent use.
+//
+// Entries are held only in memory, so restarting Skyhook clears
+// every lockout.
+type Tracker struct {
+	mu      sync.Mutex
+	entries map[string]*Entry
+	// now returns the current time, allowing tests to fix the clock.
+	now func() time.Time
+}
+
+// NewTracker initializes an empty Tracker.
+func NewTracker() *Tracker {
+	return &Tracker{entries: make(map[string]*Entry), now: time.Now}
+}
+
+// Check determines if a login for username from ip may be attempted,
+// returning the time to wait when it may not.
+func (t *Tracker) Check(p Policy, ip, username string) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	var wait time.Duration
+	for _, e := range []*Entry{t.lookup(p, KindIP, ip), t.lookup(p, KindUser, username)} {
+		if e != nil && now.Before(e.RetryAt) {
+			wait = max(wait, e.RetryAt.Sub(now))
+		}
+	}
+	return wait, wait == 0
+}
+
+// Fail records a failed login for username from ip, returning the
+// entries that were locked out by it.
+func (t *Tracker) Fail(p Policy, ip, username string) (locked []Entry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.entries) > pruneThreshold {
+		t.prune(p)
+	}
+
+	now := t.now()
+	for _, k := range []struct {
+		kind, key string
+		limit     uint
+	}{{KindIP, ip, p.IPAttempts}, {KindUser, username, p.UserAttempts}} {
+		e := t.lookup(p, k.kind, k.key)
+		if e == nil {
+			e = &Entry{Kind: k.kind, Key: k.key}
+			t.entries[entryID(k.kind, k.key)] = e
+		}
+		e.Failures++
+		e.LastFailure = now
+
+		if k.limit > 0 && e.Failures >= k.limit {
+			e.RetryAt = now.Add(p.Lockout)
+			if !e.Locked {
+				e.Locked = true
+				locked = append(locked, *e)
+			}
+			continue
+		}
+
+		backoff := p.Backoff
+		for i := uint(1); i < e.Failures && backoff < p.MaxBackoff; i++ {
+			backoff *= 2
+		}
+		e.RetryAt = now.Add(min(backoff, p.MaxBackoff))
+	}
+	return locked
+}
+
+// Succeed forgets the failed logins of username. Those of the IP
+// address aren't forgotten, since a client spraying passwords may
+// hold valid credentials for another account.
+func (t *Tracker) Succeed(username string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.entries, entryID(KindUser, username))
+}
+
+// Clear forgets the failed logins of the username or IP address
+// identified by kind and key, returning false when none are tracked.
+func (t *Tracker) Clear(kind, key string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	id := entryID(kind, key)
+	_, ok := t.entries[id]
+	delete(t.entries, id)
+	return ok
+}
+
+// List returns copies of the tracked entries, ordered by the time of
+// their last failure.
+func (t *Tracker) List(p Policy) []Entry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.prune(p)
+	entries := make([]Entry, 0, len(t.entries))
+	for _, e := range t.entries {
+		entries = append(entries, *e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].LastFailure.Before(entries[j].LastFailure) })
+	return entries
+}
+
+// lookup returns the entry identified by kind and key, deleting it
+// when stale. t.mu must be held.
+func (t *Tracker) lookup(p Policy, kind, key string) *Entry {
+	id := entryID(kind, key)
+	e := t.entries[id]
+	if e != nil && t.stale(p, e) {
+		delete(t.entries, id)
+		return nil
+	}
+	return e
+}
+
+// prune deletes stale entries. t.mu must be held.
+func (t *Tracker) prune(p Policy) {
+	for id, e := range t.entries {
+		if t.stale(p, e) {
+			delete(t.entries, id)
+		}
+	}
+}
+
+// stale determines if the failures of e should be forgotten.
+func (t *Tracker) stale(p Policy, e *Entry) bool {
+	now := t.now()
+	return !now.Before(e.RetryAt) && now.Sub(e.LastFailure) >= p.Lockout
+}
+
+func entryID(kind, key string) string {
+	return kind + ":" + key
+}
@@ -0,0 +1,99 @@
+package lockout
+
+import (
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{
+	UserAttempts: 3,
+	IPAttempts:   5,
+	Backoff:      time.Second,
+	MaxBackoff:   4 * time.Second,
+	Lockout:      time.Minute,
+}
+
+// testTracker returns a Tracker along with a function that advances
+// its clock.
+func testTracker() (*Tracker, func(time.Duration)) {
+	now := time.Unix(1700000000, 0)
+	t := NewTracker()
+	t.now = func() time.Time { return now }
+	return t, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestTracker_Backoff(t *testing.T) {
+	tr, advance := testTracker()
+
+	tr.Fail(testPolicy, "10.0.0.1", "op")
+	if wait, ok := tr.Check(testPolicy, "10.0.0.1", "op"); ok || wait != time.Second {
+		t.Fatalf("expected a one second backoff, got %v", wait)
+	}
+	// The username backs off regardless of the client's address
+	if _, ok := tr.Check(testPolicy, "10.0.0.2", "op"); ok {
+		t.Fatalf("username isn't backing off")
+	}
+	advance(time.Second)
+	if _, ok := tr.Check(testPolicy, "10.0.0.1", "op"); !ok {
+		t.Fatalf("backoff didn't elapse")
+	}
+
+	tr.Fail(testPolicy, "10.0.0.1", "op")
+	if wait, _ := tr.Check(testPolicy, "10.0.0.1", "op"); wait != 2*time.Second {
+		t.Fatalf("expected backoff to double, got %v", wait)
+	}
+
+	tr.Succeed("op")
+	if wait, _ := tr.Check(testPolicy, "10.0.0.3", "op"); wait != 0 {
+		t.Fatalf("username still backing off after success")
+	}
+	if wait, _ := tr.Check(testPolicy, "10.0.0.1", "other"); wait != 2*time.Second {
+		t.Fatalf("address backoff was cleared by success")
+	}
+}
+
+func TestTracker_Lockout(t *testing.T) {
+	tr, advance := testTracker()
+
+	var locked []Entry
+	for i := 0; i < 3; i++ {
+		locked = tr.Fail(testPolicy, "10.0.0.1", "op")
+		advance(5 * time.Second)
+	}
+	if len(locked) != 1 || locked[0].Kind != KindUser || !locked[0].Locked {
+		t.Fatalf("expected the username to be locked out: %+v", locked)
+	}
+	if wait, ok := tr.Check(testPolicy, "10.0.0.9", "op"); ok || wait != time.Minute-5*time.Second {
+		t.Fatalf("expected the lockout to remain, got %v", wait)
+	}
+
+	if !tr.Clear(KindUser, "op") {
+		t.Fatalf("failed to clear lockout")
+	} else if _, ok := tr.Check(testPolicy, "10.0.0.9", "op"); !ok {
+		t.Fatalf("lockout remained after being cleared")
+	}
+
+	// Failures are forgotten once the lockout duration elapses
+	advance(time.Minute)
+	if entries := tr.List(testPolicy); len(entries) != 0 {
+		t.Fatalf("expected stale entries to be pruned: %+v", entries)
+	}
+}
+
+func TestTracker_IPLockout(t *testing.T) {
+	tr, _ := testTracker()
+
+	var locked []Entry
+	for _, user := range []string{"a", "b", "c", "d", "e"} {
+		locked = append(locked, tr.Fail(testPolicy, "10.0.0.1", user)...)
+	}
+	if len(locked) != 1 || locked[0].Kind != KindIP || locked[0].Key != "10.0.0.1" {
+		t.Fatalf("expected the address to be locked out: %+v", locked)
+	}
+	if _, ok := tr.Check(testPolicy, "10.0.0.1", "f"); ok {
+		t.Fatalf("locked out address was allowed to attempt a login")
+	}
+	if _, ok := tr.Check(testPolicy, "10.0.0.2", "f"); !ok {
+		t.Fatalf("other address was refused")
+	}
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+    "github.com/blackhillsinfosec/skyhook/config"
+    "github.com/gin-gonic/gin"
+    "net/http"
+)
+
+// Compression returns a middleware that negotiates compression of
+// file chunks for a single request.
+//
+// When the header named by opts is set to an enabled algorithm,
+// the algorithm is echoed in the response header and applied to
+// the ObfResponseWriter and ByteReadCloser installed by ObfResponse
+// and DeobfReqBody, so this middleware must follow them. Requests
+// for an algorithm that isn't enabled are aborted, since an upload
+// chunk compressed with it can't be read.
+func Compression(opts *config.FileServerCompressionOptions) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        algo := c.Request.Header.Get(opts.Name)
+        if algo == "" {
+            return
+        } else if !opts.Enabled(algo) {
+            c.AbortWithStatus(http.StatusBadRequest)
+            return
+        }
+
+        if w, ok := c.Writer.(ObfResponseWriter); ok {
+            w.compression = algo
+            c.Writer = w
+        }
+        if b, ok := c.Request.Body.(ByteReadCloser); ok {
+            b.Compression = algo
+            c.Request.Body = b
+        }
+        c.Header(opts.Name, algo)
+    }
+}
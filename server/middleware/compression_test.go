@@ -0,0 +1,91 @@
+package middleware
+
+import (
+    "bytes"
+    "crypto/rand"
+    obfuscate "github.com/blackhillsinfosec/skyhook-obfuscation"
+    "github.com/blackhillsinfosec/skyhook/config"
+    "github.com/blackhillsinfosec/skyhook/server/obf-stream"
+    "github.com/gin-gonic/gin"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+)
+
+func TestCompression_Download(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    chain := &[]obfuscate.Obfuscator{&obfuscate.XOR{Key: "k"}, &obfuscate.Base64{Rounds: 1}}
+    opts := &config.FileServerCompressionOptions{
+        Name:       "Transfer-Coding",
+        Algorithms: []string{config.CompressionGzip, config.CompressionZstd},
+    }
+    content := make([]byte, 64*1024)
+    if _, err := rand.Read(content[:1024]); err != nil {
+        t.Fatal(err)
+    }
+
+    // Chunks are served by http.ServeContent, as they are by
+    // http.FileServer
+    r := gin.New()
+    r.GET("/file", ObfResponse(NewObfChain(chain), true), Compression(opts), func(c *gin.Context) {
+        http.ServeContent(c.Writer, c.Request, "file", time.Time{}, bytes.NewReader(content))
+    })
+
+    for _, algo := range opts.Algorithms {
+        req := httptest.NewRequest(http.MethodGet, "/file", nil)
+        req.Header.Set("Range", "bytes=1000-40999")
+        req.Header.Set(opts.Name, algo)
+        rec := httptest.NewRecorder()
+        r.ServeHTTP(rec, req)
+        if rec.Code != http.StatusPartialContent {
+            t.Fatalf("%s: chunk answered with %d", algo, rec.Code)
+        } else if rec.Header().Get(opts.Name) != algo {
+            t.Errorf("%s: algorithm wasn't echoed", algo)
+        }
+
+        // The chunk decompresses to exactly the requested range
+        dr, err := obf_stream.NewDeobfReader(rec.Body, *chain)
+        if err != nil {
+            t.Fatal(err)
+        }
+        d, err := obf_stream.NewDecompressor(dr, algo)
+        if err != nil {
+            t.Fatal(err)
+        }
+        got, err := io.ReadAll(d)
+        d.Close()
+        if err != nil {
+            t.Fatalf("%s: %v", algo, err)
+        } else if !bytes.Equal(got, content[1000:41000]) {
+            t.Errorf("%s: chunk differs from the requested range (%d bytes)", algo, len(got))
+        }
+    }
+}
+
+func TestCompression_Disabled(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    opts := &config.FileServerCompressionOptions{Name: "Transfer-Coding", Algorithms: []string{config.CompressionGzip}}
+    r := gin.New()
+    r.POST("/chunk", Compression(opts), func(c *gin.Context) {
+        c.Status(http.StatusOK)
+    })
+
+    for algo, status := range map[string]int{
+        "":                     http.StatusOK,
+        config.CompressionGzip: http.StatusOK,
+        config.CompressionZstd: http.StatusBadRequest,
+        "br":                   http.StatusBadRequest,
+    } {
+        req := httptest.NewRequest(http.MethodPost, "/chunk", nil)
+        req.Header.Set(opts.Name, algo)
+        rec := httptest.NewRecorder()
+        r.ServeHTTP(rec, req)
+        if rec.Code != status {
+            t.Errorf("%q: got %d, want %d", algo, rec.Code, status)
+        } else if status != http.StatusOK && rec.Header().Get(opts.Name) != "" {
+            t.Errorf("%q: rejected algorithm was echoed", algo)
+        }
+    }
+}
@@ -2,6 +2,7 @@ package middleware
 
 import (
     obfuscate "github.com/blackhillsinfosec/skyhook-obfuscation"
+    "github.com/blackhillsinfosec/skyhook/server/obf-stream"
     "github.com/gin-gonic/gin"
     "io"
 )
@@ -9,14 +10,34 @@ import (
 type ByteReadCloser struct {
     Src   io.ReadCloser
     Chain *[]obfuscate.Obfuscator
+    // Compression is the algorithm used to compress the body prior
+    // to obfuscation, as negotiated by the Compression middleware.
+    // The body is uncompressed when empty.
+    Compression string
 }
 
+// Deobfuscator returns an io.ReadCloser that deobfuscates and
+// decompresses the body as it's read, buffering only a bounded
+// amount of it in memory. Closing it doesn't close Src.
+func (b ByteReadCloser) Deobfuscator() (io.ReadCloser, error) {
+    r, err := obf_stream.NewDeobfReader(b.Src, *b.Chain)
+    if err != nil {
+        return nil, err
+    } else if b.Compression == "" {
+        return io.NopCloser(r), nil
+    }
+    return obf_stream.NewDecompressor(r, b.Compression)
+}
+
+// Deobfuscated reads and deobfuscates the entire body. Use
+// Deobfuscator for large bodies, such as file chunks.
 func (b ByteReadCloser) Deobfuscated() ([]byte, error) {
-    data, err := io.ReadAll(b.Src)
-    if err == nil {
-        data, err = obfuscate.Deobfuscate(data, *b.Chain)
+    r, err := b.Deobfuscator()
+    if err != nil {
+        return nil, err
     }
-    return data, err
+    defer r.Close()
+    return io.ReadAll(r)
 }
 
 func (b ByteReadCloser) Read(d []byte) (int, error) {
@@ -27,11 +48,11 @@ func (b ByteReadCloser) Close() error {
     return b.Src.Close()
 }
 
-func DeobfReqBody(chain *[]obfuscate.Obfuscator) gin.HandlerFunc {
+func DeobfReqBody(chain *ObfChain) gin.HandlerFunc {
     return func(c *gin.Context) {
         c.Request.Body = ByteReadCloser{
             Src:   c.Request.Body,
-            Chain: chain,
+            Chain: CtxObfChain(c, chain),
         }
     }
 }
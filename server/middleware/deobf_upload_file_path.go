@@ -1,22 +1,73 @@
 package middleware
 
 import (
+    "errors"
     "fmt"
     obfuscate "github.com/blackhillsinfosec/skyhook-obfuscation"
     structs "github.com/blackhillsinfosec/skyhook/api_structs"
+    "github.com/blackhillsinfosec/skyhook/config"
     "github.com/blackhillsinfosec/skyhook/server/inspector"
     "github.com/gin-gonic/gin"
     "net/http"
+    "path"
+    "strings"
 )
 
+// ErrRelativePath is returned by JailPath when a web path doesn't
+// begin with a slash.
+var ErrRelativePath = errors.New("web paths must begin with a slash")
+
+// JailPath jails webPath, an absolute web path supplied by a user,
+// to the root directory of the credential assigned by
+// UserCredential. The result is returned both relative to webroot
+// and as an absolute path sanitized by inspector.ToAbs.
+func JailPath(c *gin.Context, webroot, webPath string) (rel, abs string, err error) {
+    if !strings.HasPrefix(webPath, "/") {
+        return rel, abs, ErrRelativePath
+    }
+    userRoot := "/"
+    if cred := CtxCredential(c); cred != nil {
+        userRoot = cred.WebPath()
+    }
+    rel = path.Join(userRoot, path.Clean(webPath))
+    abs, err = inspector.ToAbs(webroot, rel)
+    return rel, abs, err
+}
+
 // DeobfUploadFilePath extracts and deobfuscates the filePath
-// route variable and assigns two variables to gin.Context:
+// route variable and assigns three variables to gin.Context:
 //
 // 1. relFilePath - Relative file path to the target upload file.
 // 2. absFilePath - Absolute file path to the target upload file.
-func DeobfUploadFilePath(webroot *string, paramName string, chain *[]obfuscate.Obfuscator) gin.HandlerFunc {
+// 3. userRootPath - Web path to the user's root directory.
+//
+// When UserCredential has assigned a credential, relFilePath is
+// jailed to the user's root directory and the request is rejected
+// unless the user is permitted to upload, or to delete for DELETE
+// requests. relFilePath remains relative to webroot so that uploads
+// from different users never collide.
+func DeobfUploadFilePath(webroot *string, paramName string, chain *ObfChain) gin.HandlerFunc {
     return func(c *gin.Context) {
 
+        //=======================
+        // ENFORCE THE USER'S JAIL
+        //=======================
+
+        userRoot, perms := "/", config.AllPermissions()
+        if cred := CtxCredential(c); cred != nil {
+            userRoot, perms = cred.WebPath(), cred.Perms()
+        }
+
+        if (c.Request.Method == http.MethodDelete && !perms.Delete) ||
+            (c.Request.Method != http.MethodDelete && !perms.Upload) {
+            c.AbortWithStatusJSON(http.StatusForbidden, structs.BaseResponse{
+                Success: false,
+                Message: "Permission denied.",
+            })
+            return
+        }
+        c.Set("userRootPath", userRoot)
+
         //=================
         // HANDLE FILE PATH
         //=================
@@ -43,37 +94,29 @@ func DeobfUploadFilePath(webroot *string, paramName string, chain *[]obfuscate.O
         // DEOBFUSCATE FILE PATH
         //======================
 
-        if pathBytes, err := obfuscate.Deobfuscate([]byte(pathString), *chain); err == nil {
+        if pathBytes, err := obfuscate.Deobfuscate([]byte(pathString), *CtxObfChain(c, chain)); err == nil {
 
-            //================
-            // SET relFilePath
-            //================
+            //==================
+            // JAIL THE FILE PATH
+            //==================
 
-            pathString = string(pathBytes)
-
-            if pathString[0:1] != "/" {
-                // Require a leading slash in the registration path, forming
-                // an absolute "web path" to the resource.
+            // Require a leading slash in the registration path, forming
+            // an absolute "web path" to the resource.
+            rel, abs, err := JailPath(c, *webroot, string(pathBytes))
+            if err == ErrRelativePath {
                 c.AbortWithStatusJSON(http.StatusNotAcceptable, structs.BaseResponse{
                     Success: false,
-                    Message: fmt.Sprintf("Upload registration paths must begin with a slash, i.e., \"/%s\"", pathString),
+                    Message: fmt.Sprintf("Upload registration paths must begin with a slash, i.e., \"/%s\"", pathBytes),
                 })
                 return
-            }
-
-            c.Set("relFilePath", pathString)
-
-            //================
-            // SET absFilePath
-            //================
-
-            if abs, err := inspector.ToAbs(*webroot, pathString); err != nil {
+            } else if err != nil {
                 c.AbortWithStatus(http.StatusNotFound)
                 return
-            } else {
-                c.Set("absFilePath", abs)
             }
 
+            c.Set("relFilePath", rel)
+            c.Set("absFilePath", abs)
+
         } else {
 
             c.AbortWithStatus(http.StatusNotFound)
@@ -1,11 +1,20 @@
 package middleware
 
 import (
+    "fmt"
     jwt "github.com/appleboy/gin-jwt/v2"
     structs "github.com/blackhillsinfosec/skyhook/api_structs"
+    "github.com/blackhillsinfosec/skyhook/audit"
     "github.com/blackhillsinfosec/skyhook/config"
+    "github.com/blackhillsinfosec/skyhook/log"
+    "github.com/blackhillsinfosec/skyhook/server/lockout"
+    "github.com/blackhillsinfosec/skyhook/server/session"
     "github.com/gin-gonic/gin"
+    "math"
     "net/http"
+    "strconv"
+    "sync"
+    "time"
 )
 
 // JwtIsUnauthorized handles JwtIsUnauthorized requests.
@@ -39,26 +48,117 @@ func JwtExtractCtxClaims(usernameField, adminField string, c *gin.Context) inter
     }
 }
 
-func JwtLoginHandler(users *[]config.Credential, adminRequired bool) func(c *gin.Context) (interface{}, error) {
+// JwtLoginHandler returns an authenticator that checks the login
+// payload against the users of conf. A valid TOTP code is required
+// from users that have enrolled a TOTP secret, and each code is
+// accepted only once by the returned authenticator.
+//
+// Failed logins are throttled by lockouts per the lockout options of
+// conf. Throttled attempts are refused without checking credentials.
+func JwtLoginHandler(conf *config.SkyhookConfig, lockouts *lockout.Tracker, adminRequired bool) func(c *gin.Context) (interface{}, error) {
+    used := totpCounters{last: make(map[string]uint64)}
     return func(c *gin.Context) (interface{}, error) {
         p := structs.LoginPayload{}
         if err := c.BindJSON(&p); err != nil {
             c.Status(http.StatusUnauthorized)
             return nil, nil
         }
-        for _, cred := range *users {
-            if cred.Username == p.Username && cred.Password == p.Password {
-                if !adminRequired || (adminRequired && cred.IsAdmin) {
-                    return &cred, nil
+        r := audit.Record{
+            Event:      audit.EventLoginFailed,
+            Server:     "file",
+            User:       p.Username,
+            RemoteAddr: c.ClientIP(),
+            Status:     http.StatusUnauthorized,
+        }
+        if adminRequired {
+            r.Server = "admin"
+        }
+
+        policy := LockoutPolicy(&conf.Auth.Lockout)
+        if wait, ok := lockouts.Check(policy, r.RemoteAddr, p.Username); !ok {
+            secs := int(math.Ceil(wait.Seconds()))
+            c.Header("Retry-After", strconv.Itoa(secs))
+            r.Message = fmt.Sprintf("throttled, retry in %ds", secs)
+            audit.Log(r)
+            return nil, jwt.ErrFailedAuthentication
+        }
+
+        fail := func(message string) (interface{}, error) {
+            r.Message = message
+            audit.Log(r)
+            for _, e := range lockouts.Fail(policy, r.RemoteAddr, p.Username) {
+                log.WARN.Printf("Locked out %s %s after %d failed logins", e.Kind, e.Key, e.Failures)
+                audit.Log(audit.Record{
+                    Event:      audit.EventLockout,
+                    Server:     r.Server,
+                    User:       p.Username,
+                    RemoteAddr: r.RemoteAddr,
+                    Message: fmt.Sprintf("%s %s locked out after %d failures until %s",
+                        e.Kind, e.Key, e.Failures, e.RetryAt.Format(time.RFC3339)),
+                })
+            }
+            return nil, jwt.ErrFailedAuthentication
+        }
+
+        for _, cred := range conf.Users {
+            if cred.Username == p.Username {
+                if !cred.CheckPassword(p.Password) || (adminRequired && !cred.IsAdmin) {
+                    return fail("")
                 }
+                if cred.HasTotp() {
+                    counter, ok := config.VerifyTotp(cred.TotpSecret, p.Totp, time.Now(), conf.Auth.Totp.Steps())
+                    if !ok || !used.accept(cred.Username, counter) {
+                        return fail("invalid totp code")
+                    }
+                }
+                lockouts.Succeed(cred.Username)
+                r.Event, r.Status = audit.EventLogin, http.StatusOK
+                audit.Log(r)
+                return &cred, nil
             }
         }
-        return nil, jwt.ErrFailedAuthentication
+        // Equalize response time for unknown usernames
+        config.CheckDummyPassword(p.Password)
+        return fail("unknown username")
+    }
+}
+
+// LockoutPolicy converts o into a lockout.Policy.
+func LockoutPolicy(o *config.LockoutOptions) lockout.Policy {
+    return lockout.Policy{
+        UserAttempts: o.UserAttempts,
+        IPAttempts:   o.IpAttempts,
+        Backoff:      time.Duration(o.Backoff) * time.Second,
+        MaxBackoff:   time.Duration(o.MaxBackoff) * time.Second,
+        Lockout:      time.Duration(o.Duration) * time.Minute,
     }
 }
 
+// totpCounters tracks the time step counter of the last TOTP code
+// accepted for each user, preventing codes from being replayed.
+type totpCounters struct {
+    mu   sync.Mutex
+    last map[string]uint64
+}
+
+// accept records counter for username, returning false when it
+// isn't later than the last counter accepted.
+func (t *totpCounters) accept(username string, counter uint64) bool {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    if last, ok := t.last[username]; ok && counter <= last {
+        return false
+    }
+    t.last[username] = counter
+    return true
+}
+
 // JwtPayloadFunc returns a function that generates the JWT payload.
-func JwtPayloadFunc(conf *config.SkyhookConfig) func(data interface{}) jwt.MapClaims {
+//
+// A session is started in sessions for each token, identified by
+// the session.ClaimKey claim. server is the name of the server
+// issuing the token, i.e., "file" or "admin".
+func JwtPayloadFunc(conf *config.SkyhookConfig, sessions *session.Store, server string) func(data interface{}) jwt.MapClaims {
     return func(data interface{}) jwt.MapClaims {
 
         //==========================================
@@ -67,13 +167,16 @@ func JwtPayloadFunc(conf *config.SkyhookConfig) func(data interface{}) jwt.MapCl
 
         if v, ok := data.(*config.Credential); ok {
 
-            if oc, err := structs.NewOperatingConfigData(*conf).JsonCryptMarshal(v.Token); err != nil {
+            if oc, err := structs.NewOperatingConfigData(*conf, *v).JsonCryptMarshal(v.Token); err != nil {
                 panic("failed to generate JWT response data while authenticating user")
+            } else if id, err := sessions.Start(v.Username, server, conf.Auth.Jwt.SessionLifetime()); err != nil {
+                panic("failed to start session while authenticating user")
             } else {
                 return jwt.MapClaims{
                     conf.Auth.Jwt.FieldKeys.Username: v.Username,
                     conf.Auth.Jwt.FieldKeys.Admin:    v.IsAdmin,
                     conf.Auth.Jwt.FieldKeys.Config:   oc,
+                    session.ClaimKey:                 id,
                 }
             }
         }
@@ -82,3 +185,42 @@ func JwtPayloadFunc(conf *config.SkyhookConfig) func(data interface{}) jwt.MapCl
 
     }
 }
+
+// JwtSessionAuthorizator returns an authorizator that rejects tokens
+// of sessions that have been revoked or have ended before deferring
+// to next.
+func JwtSessionAuthorizator(sessions *session.Store, next func(data interface{}, c *gin.Context) bool) func(data interface{}, c *gin.Context) bool {
+    return func(data interface{}, c *gin.Context) bool {
+        id, _ := jwt.ExtractClaims(c)[session.ClaimKey].(string)
+        return sessions.Touch(id, c.ClientIP()) && next(data, c)
+    }
+}
+
+// JwtRefreshSession returns a handler that renews the session of the
+// token being refreshed before passing the request to next, which is
+// expected to be the RefreshHandler of auth. Tokens of revoked
+// sessions can't be refreshed.
+func JwtRefreshSession(auth *jwt.GinJWTMiddleware, sessions *session.Store, lifetime time.Duration, next gin.HandlerFunc) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        if claims, err := auth.CheckIfTokenExpire(c); err == nil {
+            if id, _ := claims[session.ClaimKey].(string); sessions.Renew(id, lifetime) {
+                next(c)
+                return
+            }
+        }
+        auth.Unauthorized(c, http.StatusUnauthorized, "")
+    }
+}
+
+// JwtRevokeSession returns a handler that ends the session of the
+// request's token before passing the request to next, which is
+// expected to be the LogoutHandler of auth.
+func JwtRevokeSession(auth *jwt.GinJWTMiddleware, sessions *session.Store, next gin.HandlerFunc) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        if claims, err := auth.GetClaimsFromJWT(c); err == nil {
+            id, _ := claims[session.ClaimKey].(string)
+            sessions.Revoke(id)
+        }
+        next(c)
+    }
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+    obfuscate "github.com/blackhillsinfosec/skyhook-obfuscation"
+    "github.com/gin-gonic/gin"
+    "strings"
+    "sync/atomic"
+    "unicode/utf8"
+)
+
+// ObfChain holds an obfuscation chain that's replaced while requests
+// are being served, e.g., the chain of the default profile, which is
+// shared by the file and admin servers.
+//
+// Stored chains are never modified. Replacing the chain stores a new
+// one, such that requests continue to use the chain they loaded.
+type ObfChain struct {
+    chain atomic.Pointer[[]obfuscate.Obfuscator]
+}
+
+// NewObfChain returns an ObfChain holding chain.
+func NewObfChain(chain *[]obfuscate.Obfuscator) *ObfChain {
+    oc := &ObfChain{}
+    oc.Store(chain)
+    return oc
+}
+
+// Load returns the current chain.
+func (oc *ObfChain) Load() *[]obfuscate.Obfuscator {
+    return oc.chain.Load()
+}
+
+// Store replaces the current chain with chain, which mustn't be
+// modified afterward.
+func (oc *ObfChain) Store(chain *[]obfuscate.Obfuscator) {
+    oc.chain.Store(chain)
+}
+
+// ObfProfile returns a middleware that assigns the obfuscation
+// chain of the authenticated user's profile to the "obfChain"
+// variable of gin.Context. resolve returns the chains accepted for
+// a profile name, the current chain first, followed by any chain
+// retired by a rotation that's still within its grace period.
+//
+// When multiple chains are accepted, the first one that
+// deobfuscates the path in the route parameter named by paramName
+// to an absolute path is assigned, allowing clients holding the
+// previous keys to finish their transfers. Chains are replaced
+// rather than modified, so a rotation doesn't affect in-flight
+// requests.
+//
+// It must follow UserCredential. ObfResponse, DeobfReqBody and
+// DeobfUploadFilePath use the assigned chain in place of the one
+// they're initialized with.
+func ObfProfile(resolve func(profile string) []*[]obfuscate.Obfuscator, paramName string) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        cred := CtxCredential(c)
+        if cred == nil {
+            return
+        }
+
+        chains := resolve(cred.Profile)
+        chain := chains[0]
+        if p := strings.TrimPrefix(c.Param(paramName), "/"); p != "" && len(chains) > 1 {
+            for _, ch := range chains {
+                if pathDeobfuscates(p, *ch) {
+                    chain = ch
+                    break
+                }
+            }
+        }
+
+        c.Set("obfChain", chain)
+    }
+}
+
+// pathDeobfuscates determines if p deobfuscates to an absolute
+// path using chain.
+//
+// Block ciphers panic when given input that isn't a multiple of
+// their block size, which the wrong keys may well produce.
+func pathDeobfuscates(p string, chain []obfuscate.Obfuscator) (ok bool) {
+    defer func() {
+        if recover() != nil {
+            ok = false
+        }
+    }()
+    dec, err := obfuscate.Deobfuscate([]byte(p), chain)
+    return err == nil && len(dec) > 0 && dec[0] == '/' && utf8.Valid(dec)
+}
+
+// CtxObfChain returns the chain assigned to c by ObfProfile, or the
+// current chain of def when no chain has been assigned.
+func CtxObfChain(c *gin.Context, def *ObfChain) *[]obfuscate.Obfuscator {
+    if v, ok := c.Get("obfChain"); ok {
+        return v.(*[]obfuscate.Obfuscator)
+    }
+    return def.Load()
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+    obfuscate "github.com/blackhillsinfosec/skyhook-obfuscation"
+    "github.com/blackhillsinfosec/skyhook/config"
+    "github.com/gin-gonic/gin"
+    "net/http/httptest"
+    "reflect"
+    "testing"
+)
+
+func TestObfProfile(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    def := &[]obfuscate.Obfuscator{&obfuscate.XOR{Key: "default"}}
+    red := &[]obfuscate.Obfuscator{&obfuscate.XOR{Key: "red"}}
+    mw := ObfProfile(func(profile string) []*[]obfuscate.Obfuscator {
+        if profile == "red" {
+            return []*[]obfuscate.Obfuscator{red}
+        }
+        return []*[]obfuscate.Obfuscator{def}
+    }, "filepath")
+
+    // Unauthenticated requests use the chain of each middleware
+    c, _ := gin.CreateTestContext(httptest.NewRecorder())
+    mw(c)
+    if CtxObfChain(c, NewObfChain(def)) != def {
+        t.Error("chain was assigned without a credential")
+    }
+
+    for profile, want := range map[string]*[]obfuscate.Obfuscator{"": def, "red": red} {
+        c, _ = gin.CreateTestContext(httptest.NewRecorder())
+        c.Set("credential", &config.Credential{Username: "op", Profile: profile})
+        mw(c)
+
+        if got := CtxObfChain(c, nil); got != want {
+            t.Errorf("%q: unexpected chain assigned", profile)
+        }
+    }
+}
+
+func TestObfProfile_Retired(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    cur := &[]obfuscate.Obfuscator{&obfuscate.XOR{Key: "current"}, &obfuscate.Base64{Rounds: 1}}
+    old := &[]obfuscate.Obfuscator{&obfuscate.XOR{Key: "retired"}, &obfuscate.Base64{Rounds: 1}}
+    mw := ObfProfile(func(string) []*[]obfuscate.Obfuscator {
+        return []*[]obfuscate.Obfuscator{cur, old}
+    }, "filepath")
+
+    obf := func(chain *[]obfuscate.Obfuscator) string {
+        b, err := obfuscate.Obfuscate([]byte("/loot/file"), *chain)
+        if err != nil {
+            t.Fatal(err)
+        }
+        return string(b)
+    }
+
+    // The chain that deobfuscates the path is assigned, falling
+    // back to the current chain
+    for param, want := range map[string]*[]obfuscate.Obfuscator{
+        "/" + obf(cur): cur,
+        "/" + obf(old): old,
+        "/garbage":     cur,
+        "":             cur,
+    } {
+        c, _ := gin.CreateTestContext(httptest.NewRecorder())
+        c.Params = gin.Params{{Key: "filepath", Value: param}}
+        c.Set("credential", &config.Credential{Username: "op"})
+        mw(c)
+        if got := CtxObfChain(c, nil); got == nil || !reflect.DeepEqual(*got, *want) {
+            t.Errorf("%q: unexpected chain assigned", param)
+        }
+    }
+}
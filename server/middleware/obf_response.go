@@ -2,9 +2,11 @@ package middleware
 
 import (
     "bufio"
-    "bytes"
+    "errors"
+    "fmt"
     obfuscate "github.com/blackhillsinfosec/skyhook-obfuscation"
     "github.com/blackhillsinfosec/skyhook/log"
+    "github.com/blackhillsinfosec/skyhook/server/obf-stream"
     "github.com/gin-gonic/gin"
     "golang.org/x/exp/slices"
     "io"
@@ -15,28 +17,30 @@ import (
 
 // readerOnly implements io.Reader and no additional methods.
 //
-// This is useful because bytes.Reader implements io.WriterTo,
-// which hijacks the flow of execution in io.copyBuffer.
+// This is useful because readers such as bytes.Reader and os.File
+// implement io.WriterTo, which hijacks the flow of execution in
+// io.copyBuffer.
 //
 // This is most relevant to ObfResponseWriter.ReadFrom.
 type readerOnly struct {
-    b *bytes.Reader
+    r io.Reader
 }
 
 // Read satisfies io.Reader.
 func (r readerOnly) Read(b []byte) (int, error) {
-    return r.b.Read(b)
+    return r.r.Read(b)
 }
 
 // ObfResponse returns a middleware that obfuscates
-// all response data using chain.
+// all response data using chain, or the chain of the
+// user's obfuscation profile when assigned by ObfProfile.
 //
 // streamer determines if multiple writes to the writer
 // will occur, such as when using http.FileServer to
 // serve files directly from the filesystem.
-func ObfResponse(chain *[]obfuscate.Obfuscator, streamer bool) gin.HandlerFunc {
+func ObfResponse(chain *ObfChain, streamer bool) gin.HandlerFunc {
     return func(c *gin.Context) {
-        c.Writer = NewObfResponseWriter(c.Writer, chain, streamer)
+        c.Writer = NewObfResponseWriter(c.Writer, CtxObfChain(c, chain), streamer)
     }
 }
 
@@ -57,6 +61,10 @@ type ObfResponseWriter struct {
     w        gin.ResponseWriter
     chain    *[]obfuscate.Obfuscator
     streamer bool
+    // compression is the algorithm applied to content prior to
+    // obfuscation by ReadFrom, as negotiated by the Compression
+    // middleware.
+    compression string
 }
 
 // Write proxies the Write call to gin.ResponseWriter. When an
@@ -64,7 +72,7 @@ type ObfResponseWriter struct {
 // be seamlessly obfuscated using the configured obfuscation chain
 // prior to being written to the response.
 func (tw ObfResponseWriter) Write(b []byte) (int, error) {
-    if !tw.streamer && slices.Contains([]int{200, 206, 406, 409}, tw.Status()) {
+    if !tw.streamer && slices.Contains([]int{200, 206, 403, 406, 409, 413}, tw.Status()) {
         enc, _ := obfuscate.Obfuscate(b, *tw.chain)
         tw.Header().Set("Content-Length", strconv.FormatInt(int64(len(enc)), 10))
         tw.Header().Set("Content-Type", "text/plain")
@@ -75,51 +83,81 @@ func (tw ObfResponseWriter) Write(b []byte) (int, error) {
 
 // ReadFrom is implemented to intercept calls from io.CopyN, a
 // function used by the net.http module when serving files.
-// Intercepting at this point allows us to read in the chunk from
-// the file and obfuscate it prior to writing it to the response.
+// Intercepting at this point allows us to obfuscate the file
+// content as it's copied to the response.
+//
+// Content is streamed through obf_stream.NewWriter, so only a
+// bounded portion of the chunk is held in memory regardless of
+// its size. When compression has been negotiated, the content is
+// compressed prior to obfuscation and no Content-Length is sent.
 //
 // Additional Notes:
 //
 // io.CopyN is called by http.serveContent when serving file content,
 // which converts the source file to an io.LimitedReader that
-// will read up to only N bytes (per the Range header).
+// will read up to only N bytes (per the Range header). This allows
+// the Content-Length of the obfuscated chunk to be calculated in
+// advance.
 func (tw ObfResponseWriter) ReadFrom(r io.Reader) (n int64, err error) {
 
+    var want int64 = -1
     if l, ok := r.(*io.LimitedReader); ok {
+        want = l.N
+    }
 
-        // Read in the chunk content
-        buff := make([]byte, l.N)
-        _, err = l.Read(buff)
-
-        // Obfuscate the content
-        buff, err = obfuscate.Obfuscate(buff, *tw.chain)
-        if err != nil {
-            log.ERR.Printf("Download Chunk Error: Failed to obfuscate data > %v", err)
-            return n, err
+    // Set proper content length header
+    // - The length set by http.serveContent is that of the file chunk
+    // - The length of compressed content can't be known in advance
+    tw.Header().Del("Content-Length")
+    if want >= 0 && tw.compression == "" {
+        if oLen, ok := obf_stream.ObfuscatedLen(want, *tw.chain); ok {
+            tw.Header().Set("Content-Length", strconv.FormatInt(oLen, 10))
         }
+    }
+    tw.Header().Set("Content-Type", "text/plain")
 
-        // Set proper content length header
-        tw.Header().Set("Content-Length", strconv.FormatInt(int64(len(buff)), 10))
-        tw.Header().Set("Content-Type", "text/plain")
-
-        // We use a readerOnly to ensure that no additional methods
-        // interfere with io.copyBuffer (called by io.CopyN), which
-        // will pass the response writer to any reader that implements
-        // io.WriterTo.
-        reader := readerOnly{bytes.NewReader(buff)}
-        _, err = io.CopyBuffer(tw.w, reader, nil)
+    ow, err := obf_stream.NewWriter(tw.w, *tw.chain)
+    if err != nil {
+        log.ERR.Printf("Download Chunk Error: Failed to obfuscate data > %v", err)
+        return n, err
+    }
 
-        if err != nil {
-            log.ERR.Printf("Download Chunk Error: Failed to copy obfuscated data to the response > %v", err)
+    // Content is compressed before it's obfuscated
+    var w io.WriteCloser = ow
+    if tw.compression != "" {
+        if w, err = obf_stream.NewCompressor(ow, tw.compression); err != nil {
+            log.ERR.Printf("Download Chunk Error: Failed to compress data > %v", err)
+            return n, err
         }
+    }
 
-        return l.N, err
-
-    } else {
+    // We use a readerOnly to ensure that no additional methods
+    // interfere with io.copyBuffer, which would otherwise pass the
+    // obfuscating writer to any reader that implements io.WriterTo.
+    if n, err = io.CopyBuffer(w, readerOnly{r}, nil); err != nil {
+        log.ERR.Printf("Download Chunk Error: Failed to copy obfuscated data to the response > %v", err)
+        return n, err
+    }
 
-        panic("l must be an *io.LimitedReader")
+    // A short source would leave the response shorter than the
+    // advertised Content-Length.
+    if want >= 0 && n != want {
+        err = errors.New(fmt.Sprintf("read %d of %d bytes from the file", n, want))
+        log.ERR.Printf("Download Chunk Error: Failed to read chunk > %v", err)
+        return n, err
+    }
 
+    if w != ow {
+        if err = w.Close(); err != nil {
+            log.ERR.Printf("Download Chunk Error: Failed to compress data > %v", err)
+            return n, err
+        }
     }
+    if err = ow.Close(); err != nil {
+        log.ERR.Printf("Download Chunk Error: Failed to copy obfuscated data to the response > %v", err)
+    }
+
+    return n, err
 }
 
 // Hijack proxies the method call to a gin.ResponseWriter.
@@ -129,7 +167,6 @@ func (tw ObfResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 
 // Flush proxies the method call to a gin.ResponseWriter.
 func (tw ObfResponseWriter) Flush() {
-    println("flushed")
     tw.w.Flush()
 }
 
@@ -3,6 +3,7 @@ package middleware
 import (
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"math"
 	"net/http"
 	"net/textproto"
 	"strconv"
@@ -22,7 +23,15 @@ func UpdateRangeHeader(headerName, rangePrefix *string) gin.HandlerFunc {
 	}
 }
 
-func RangeHeader(headerName, rangePrefix *string, required bool) gin.HandlerFunc {
+// RangeHeader returns a middleware that parses the single range of
+// the header named by headerName into the "rangeStart" and
+// "rangeEnd" variables of gin.Context, the latter of which is always
+// exclusive.
+//
+// When inclusive, the end of the range in the header is the last
+// byte of the range, as with ranges served by http.FileServer.
+// Otherwise, it's one past the last byte, as with upload chunks.
+func RangeHeader(headerName, rangePrefix *string, required, inclusive bool) gin.HandlerFunc {
 
 	return func(c *gin.Context) {
 
@@ -78,6 +87,14 @@ func RangeHeader(headerName, rangePrefix *string, required bool) gin.HandlerFunc
 				return
 			}
 
+			if inclusive {
+				if eI == math.MaxUint64 {
+					c.AbortWithStatus(http.StatusRequestedRangeNotSatisfiable)
+					return
+				}
+				eI++
+			}
+
 			// Ensure there's an actual range
 			if sI >= eI {
 				c.AbortWithStatus(http.StatusRequestedRangeNotSatisfiable)
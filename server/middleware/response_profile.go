@@ -0,0 +1,182 @@
+package middleware
+
+import (
+    "github.com/blackhillsinfosec/skyhook/config"
+    "github.com/gin-gonic/gin"
+    "net/http"
+    "strconv"
+    "strings"
+)
+
+const responseProfileKey = "responseProfileWriter"
+
+// ResponseProfile returns a middleware that shapes each response
+// per profile. routes maps the names in config.ResponseRoutes to
+// their paths, which determine the content type of responses.
+//
+// It must precede all other middleware, such that ObfResponseWriter
+// continues to observe the status codes of outcomes rather than
+// those they're remapped to.
+func ResponseProfile(profile *config.ResponseProfile, routes map[string]string) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        w := &ResponseProfileWriter{ResponseWriter: c.Writer, c: c, profile: profile, routes: routes}
+        c.Writer = w
+        c.Set(responseProfileKey, w)
+        c.Next()
+
+        if w.outcome != nil {
+            w.writeOutcome()
+        } else if !w.Written() {
+            w.apply()
+        }
+    }
+}
+
+// SkipResponseProfile leaves the response of c untouched by the
+// ResponseProfile middleware, e.g., because it's served by the
+// decoy.
+func SkipResponseProfile(c *gin.Context) {
+    if w, ok := c.Get(responseProfileKey); ok {
+        w.(*ResponseProfileWriter).skip = true
+        w.(*ResponseProfileWriter).outcome = nil
+    }
+}
+
+// ResponseProfileWriter applies a config.ResponseProfile to the
+// response of a gin.ResponseWriter. Headers are applied just before
+// they're written, once handlers have set theirs. The Server header
+// and content types of the profile replace those set by handlers and
+// its cookies are added to theirs, while its static headers are only
+// added when handlers haven't set them, e.g., Cache-Control.
+//
+// Status reports the status code set by handlers, while the status
+// code it's remapped to is sent.
+type ResponseProfileWriter struct {
+    gin.ResponseWriter
+    c       *gin.Context
+    profile *config.ResponseProfile
+    routes  map[string]string
+    // status is the status code set by handlers.
+    status int
+    // outcome replaces the body of the response when not nil.
+    outcome *config.ResponseOutcome
+    // replaced indicates that the body of outcome was written.
+    replaced bool
+    applied  bool
+    skip     bool
+}
+
+// WriteHeader sends the status code that s is remapped to, if any.
+func (w *ResponseProfileWriter) WriteHeader(s int) {
+    if s > 0 && !w.Written() {
+        w.status = s
+        if o, ok := w.profile.Outcome(s); ok && !w.skip {
+            if o.Status != 0 {
+                s = o.Status
+            }
+            if o.Body != "" {
+                w.outcome = &o
+            } else {
+                w.outcome = nil
+            }
+        } else {
+            w.outcome = nil
+        }
+    }
+    w.ResponseWriter.WriteHeader(s)
+}
+
+// Status returns the status code set by handlers.
+func (w *ResponseProfileWriter) Status() int {
+    if w.status != 0 {
+        return w.status
+    }
+    return w.ResponseWriter.Status()
+}
+
+// Write discards b when the body is replaced by an outcome.
+func (w *ResponseProfileWriter) Write(b []byte) (int, error) {
+    if w.outcome != nil {
+        w.writeOutcome()
+        return len(b), nil
+    }
+    w.apply()
+    return w.ResponseWriter.Write(b)
+}
+
+// WriteString discards s when the body is replaced by an outcome.
+func (w *ResponseProfileWriter) WriteString(s string) (int, error) {
+    return w.Write([]byte(s))
+}
+
+// WriteHeaderNow applies the profile prior to writing the headers.
+func (w *ResponseProfileWriter) WriteHeaderNow() {
+    w.apply()
+    w.ResponseWriter.WriteHeaderNow()
+}
+
+// Flush applies the profile prior to flushing the response.
+func (w *ResponseProfileWriter) Flush() {
+    w.apply()
+    w.ResponseWriter.Flush()
+}
+
+// writeOutcome writes the body of the outcome once.
+func (w *ResponseProfileWriter) writeOutcome() {
+    if w.replaced {
+        return
+    }
+    w.replaced = true
+    w.apply()
+    w.ResponseWriter.Write([]byte(w.outcome.Body))
+}
+
+// apply sets the headers of the profile, unless they've already
+// been written.
+func (w *ResponseProfileWriter) apply() {
+    if w.applied || w.skip || w.Written() {
+        return
+    }
+    w.applied = true
+
+    h := w.Header()
+    if w.profile.Server != "" {
+        h.Set("Server", w.profile.Server)
+    }
+    for k, v := range w.profile.Headers {
+        if h.Get(k) == "" {
+            h.Set(k, v)
+        }
+    }
+    for _, c := range w.profile.Cookies {
+        h.Add("Set-Cookie", c.Cookie().String())
+    }
+
+    if w.outcome != nil {
+        ct := w.outcome.ContentType
+        if ct == "" {
+            ct = http.DetectContentType([]byte(w.outcome.Body))
+        }
+        h.Set("Content-Type", ct)
+        h.Set("Content-Length", strconv.Itoa(len(w.outcome.Body)))
+        h.Del("Content-Encoding")
+    } else if ct, ok := w.profile.ContentTypes[w.route()]; ok {
+        h.Set("Content-Type", ct)
+    }
+}
+
+// route returns the name of the route that matched the request,
+// preferring the longest path.
+func (w *ResponseProfileWriter) route() (name string) {
+    full, longest := w.c.FullPath(), 0
+    if full == "" {
+        return ""
+    }
+    for n, p := range w.routes {
+        p = strings.TrimRight(p, "/")
+        if (full == p || strings.HasPrefix(full, p+"/")) && len(p) > longest {
+            name, longest = n, len(p)
+        }
+    }
+    return name
+}
@@ -0,0 +1,123 @@
+package middleware
+
+import (
+    "github.com/blackhillsinfosec/skyhook/config"
+    "github.com/gin-gonic/gin"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+func TestResponseProfile(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    profile := &config.ResponseProfile{
+        Server:       "nginx/1.24.0",
+        Headers:      map[string]string{"X-Frame-Options": "DENY", "Cache-Control": "no-store"},
+        Cookies:      []config.ResponseCookie{{Name: "PHPSESSID", Value: "abc", Path: "/"}},
+        ContentTypes: map[string]string{"download": "application/octet-stream"},
+        Outcomes: map[string]config.ResponseOutcome{
+            config.OutcomeNotFound:     {Status: http.StatusForbidden, Body: "<h1>Forbidden</h1>", ContentType: "text/html"},
+            config.OutcomeConflict:     {Status: http.StatusBadRequest},
+            config.OutcomeForbidden:    {Status: http.StatusUnauthorized},
+            config.OutcomeUnauthorized: {Status: http.StatusTeapot},
+        },
+    }
+
+    var seen int
+    r := gin.New()
+    r.Use(ResponseProfile(profile, map[string]string{"download": "/files/"}))
+    r.GET("/files/*filepath", func(c *gin.Context) {
+        c.Header("Cache-Control", "private")
+        c.String(http.StatusOK, "chunk")
+    })
+    r.GET("/conflict", func(c *gin.Context) {
+        c.Status(http.StatusConflict)
+        seen = c.Writer.Status()
+        c.String(http.StatusConflict, "exists")
+    })
+    r.GET("/decoy", func(c *gin.Context) {
+        SkipResponseProfile(c)
+        c.String(http.StatusNotFound, "decoy")
+    })
+    r.NoRoute(func(c *gin.Context) { c.JSON(http.StatusNotFound, gin.H{}) })
+
+    for path, want := range map[string]struct {
+        status      int
+        body        string
+        contentType string
+    }{
+        "/files/a":  {http.StatusOK, "chunk", "application/octet-stream"},
+        "/conflict": {http.StatusBadRequest, "exists", "text/plain; charset=utf-8"},
+        "/missing":  {http.StatusForbidden, "<h1>Forbidden</h1>", "text/html"},
+        "/decoy":    {http.StatusNotFound, "decoy", "text/plain; charset=utf-8"},
+    } {
+        rec := httptest.NewRecorder()
+        r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+        if rec.Code != want.status || rec.Body.String() != want.body || rec.Header().Get("Content-Type") != want.contentType {
+            t.Errorf("%s: got %d %q (%s), want %d %q (%s)", path, rec.Code, rec.Body.String(),
+                rec.Header().Get("Content-Type"), want.status, want.body, want.contentType)
+        }
+
+        server, cookie := rec.Header().Get("Server"), rec.Header().Get("Set-Cookie")
+        if path == "/decoy" {
+            if server != "" || cookie != "" {
+                t.Errorf("%s: profile was applied to the decoy", path)
+            }
+        } else if server != "nginx/1.24.0" || cookie != "PHPSESSID=abc; Path=/" || rec.Header().Get("X-Frame-Options") != "DENY" {
+            t.Errorf("%s: profile headers are missing: %v", path, rec.Header())
+        }
+    }
+
+    if seen != http.StatusConflict {
+        t.Errorf("handlers observed status code %d", seen)
+    }
+
+    rec := httptest.NewRecorder()
+    r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/files/a", nil))
+    if rec.Header().Get("Cache-Control") != "private" {
+        t.Errorf("profile header replaced the header of the handler")
+    }
+
+    codes := profile.StatusCodes()
+    if len(codes) != 4 || codes[http.StatusForbidden] != http.StatusNotFound || codes[http.StatusBadRequest] != http.StatusConflict {
+        t.Errorf("unexpected status code mapping: %v", codes)
+    }
+}
+
+func TestResponseProfile_Headers(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    profile := &config.ResponseProfile{
+        Server:       "Apache",
+        Headers:      map[string]string{"Cache-Control": "no-cache", "X-Frame-Options": "SAMEORIGIN"},
+        Cookies:      []config.ResponseCookie{{Name: "sid", Value: "1"}},
+        ContentTypes: map[string]string{"download": "application/octet-stream"},
+    }
+
+    r := gin.New()
+    r.Use(ResponseProfile(profile, map[string]string{"download": "/files"}))
+    r.GET("/files", func(c *gin.Context) {
+        c.Header("Server", "Skyhook")
+        c.Header("Cache-Control", "private")
+        c.Header("Content-Type", "text/plain")
+        http.SetCookie(c.Writer, &http.Cookie{Name: "handler", Value: "2"})
+        c.Status(http.StatusOK)
+        c.Writer.Write([]byte("chunk"))
+    })
+
+    rec := httptest.NewRecorder()
+    r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/files", nil))
+    h := rec.Header()
+
+    // The profile replaces the Server header and content type
+    if h.Get("Server") != "Apache" || h.Get("Content-Type") != "application/octet-stream" {
+        t.Errorf("profile didn't replace headers of the handler: %v", h)
+    }
+    // Static headers never replace those of the handler
+    if h.Get("Cache-Control") != "private" || h.Get("X-Frame-Options") != "SAMEORIGIN" {
+        t.Errorf("static headers weren't added without replacing those of the handler: %v", h)
+    }
+    // Cookies are added to those of the handler
+    if cookies := h.Values("Set-Cookie"); len(cookies) != 2 {
+        t.Errorf("expected the cookies of both the handler and profile: %v", cookies)
+    }
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+    jwt "github.com/appleboy/gin-jwt/v2"
+    "github.com/blackhillsinfosec/skyhook/config"
+    "github.com/gin-gonic/gin"
+    "net/http"
+)
+
+// UserCredential looks up the configured credential of the
+// authenticated user and assigns it to the "credential" variable
+// of gin.Context, ensuring that downstream handlers enforce the
+// user's current root directory and permissions.
+//
+// Requests from users that no longer exist are rejected.
+func UserCredential(users *[]config.Credential, usernameField *string) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        username, _ := jwt.ExtractClaims(c)[*usernameField].(string)
+        for _, cred := range *users {
+            if cred.Username == username {
+                cred := cred
+                c.Set("credential", &cred)
+                return
+            }
+        }
+        c.AbortWithStatus(http.StatusUnauthorized)
+    }
+}
+
+// CtxCredential returns the credential assigned to c by
+// UserCredential. Nil is returned when no credential has
+// been assigned.
+func CtxCredential(c *gin.Context) *config.Credential {
+    if v, ok := c.Get("credential"); ok {
+        return v.(*config.Credential)
+    }
+    return nil
+}
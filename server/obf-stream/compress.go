@@ -0,0 +1,44 @@
+package obf_stream
+
+import (
+    "compress/gzip"
+    "errors"
+    "fmt"
+    "github.com/blackhillsinfosec/skyhook/config"
+    "github.com/klauspost/compress/zstd"
+    "io"
+)
+
+// NewCompressor returns an io.WriteCloser that compresses data
+// written to it with algo, writing the result to dst. Close must be
+// called to flush the compressed stream; it doesn't close dst.
+//
+// algo must be config.CompressionGzip or config.CompressionZstd.
+func NewCompressor(dst io.Writer, algo string) (io.WriteCloser, error) {
+    switch algo {
+    case config.CompressionGzip:
+        return gzip.NewWriter(dst), nil
+    case config.CompressionZstd:
+        return zstd.NewWriter(dst, zstd.WithEncoderConcurrency(1))
+    }
+    return nil, errors.New(fmt.Sprintf("unsupported compression algorithm: %s", algo))
+}
+
+// NewDecompressor returns an io.ReadCloser that decompresses data
+// read from src with algo. Close releases resources held by the
+// decompressor; it doesn't close src.
+//
+// algo must be config.CompressionGzip or config.CompressionZstd.
+func NewDecompressor(src io.Reader, algo string) (io.ReadCloser, error) {
+    switch algo {
+    case config.CompressionGzip:
+        return gzip.NewReader(src)
+    case config.CompressionZstd:
+        d, err := zstd.NewReader(src, zstd.WithDecoderConcurrency(1))
+        if err != nil {
+            return nil, err
+        }
+        return d.IOReadCloser(), nil
+    }
+    return nil, errors.New(fmt.Sprintf("unsupported compression algorithm: %s", algo))
+}
@@ -0,0 +1,61 @@
+package obf_stream
+
+import (
+    "bytes"
+    "fmt"
+    "github.com/blackhillsinfosec/skyhook/config"
+    "io"
+    "testing"
+)
+
+func TestNewCompressor(t *testing.T) {
+    chain := testChains["mixed"]
+    for _, algo := range []string{config.CompressionGzip, config.CompressionZstd} {
+        for _, size := range testSizes {
+            t.Run(fmt.Sprintf("%s/%d", algo, size), func(t *testing.T) {
+
+                // Content is compressed before it's obfuscated
+                data := bytes.Repeat(randBytes(t, 64), size/64+1)[:size]
+                out := bytes.Buffer{}
+                ow, err := NewWriter(&out, chain)
+                if err != nil {
+                    t.Fatal(err)
+                }
+                w, err := NewCompressor(ow, algo)
+                if err != nil {
+                    t.Fatal(err)
+                } else if _, err = w.Write(data); err != nil {
+                    t.Fatal(err)
+                } else if err = w.Close(); err != nil {
+                    t.Fatal(err)
+                } else if err = ow.Close(); err != nil {
+                    t.Fatal(err)
+                }
+
+                dr, err := NewDeobfReader(&out, chain)
+                if err != nil {
+                    t.Fatal(err)
+                }
+                r, err := NewDecompressor(dr, algo)
+                if err != nil {
+                    t.Fatal(err)
+                }
+                defer r.Close()
+                if got, err := io.ReadAll(r); err != nil {
+                    t.Fatal(err)
+                } else if !bytes.Equal(got, data) {
+                    t.Fatalf("decompressed output differs from input (%d vs %d bytes)", len(got), len(data))
+                }
+            })
+        }
+    }
+}
+
+func TestNewCompressor_Unsupported(t *testing.T) {
+    if _, err := NewCompressor(io.Discard, "br"); err == nil {
+        t.Error("compressor was returned for an unsupported algorithm")
+    }
+    if _, err := NewDecompressor(bytes.NewReader(nil), "br"); err == nil {
+        t.Error("decompressor was returned for an unsupported algorithm")
+    }
+}
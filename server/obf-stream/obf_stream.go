@@ -0,0 +1,316 @@
+// Package obf_stream obfuscates and deobfuscates streams of data
+// using bounded buffers, producing output identical to calling
+// obfuscate.Obfuscate and obfuscate.Deobfuscate on the entire
+// stream.
+//
+// Each obfuscator in a chain is applied to fixed-size segments of
+// its input. Segment sizes are aligned such that processing each
+// segment independently is equivalent to processing the whole:
+//
+// - XOR segments are multiples of the key length.
+// - Block cipher segments are multiples of the block size. The
+//   padding block appended to each non-final segment is discarded
+//   when obfuscating, and a padding block is appended to each
+//   non-final segment before deobfuscating so that only it is
+//   removed.
+// - Base64 segments are multiples of 3 (encoding) or 4 (decoding)
+//   for each round.
+//
+// Unknown obfuscators are applied to their entire input, which is
+// buffered in memory.
+package obf_stream
+
+import (
+    "bytes"
+    "errors"
+    obfuscate "github.com/blackhillsinfosec/skyhook-obfuscation"
+    "io"
+)
+
+const (
+    // SegmentSize is the approximate number of bytes buffered by
+    // each obfuscator in a chain.
+    SegmentSize = 64 * 1024
+)
+
+// stage applies a single obfuscation or deobfuscation step.
+type stage struct {
+    // size is the length of non-final segments. The entire input
+    // is buffered when zero.
+    size int
+    // segment processes a non-final segment.
+    segment func([]byte) ([]byte, error)
+    // final processes the remaining input.
+    final func([]byte) ([]byte, error)
+}
+
+// align rounds SegmentSize down to a multiple of n.
+func align(n int) int {
+    if n < 1 {
+        n = 1
+    }
+    if n >= SegmentSize {
+        return n
+    }
+    return SegmentSize - SegmentSize%n
+}
+
+// pow returns b raised to the e.
+func pow(b, e int) int {
+    r := 1
+    for ; e > 0; e-- {
+        r *= b
+    }
+    return r
+}
+
+// blockSize probes o for the size of its padding block. Block
+// ciphers in the obfuscation library always append padding, so
+// obfuscating zero bytes produces exactly one block.
+func blockSize(o obfuscate.Obfuscator) (pad []byte, err error) {
+    if pad, err = o.Obfuscate(nil); err == nil && len(pad) == 0 {
+        err = errors.New("obfuscator produced no padding block")
+    }
+    return pad, err
+}
+
+// obfStage returns a stage that obfuscates with o.
+func obfStage(o obfuscate.Obfuscator) (s stage, err error) {
+    s = stage{segment: o.Obfuscate, final: o.Obfuscate}
+    switch v := o.(type) {
+    case *obfuscate.XOR:
+        s.size = align(len(v.Key))
+    case *obfuscate.Base64:
+        s.size = align(pow(3, int(v.Rounds)))
+    case *obfuscate.AES, *obfuscate.Blowfish, *obfuscate.Twofish:
+        var pad []byte
+        if pad, err = blockSize(o); err != nil {
+            return s, err
+        }
+        s.size = align(len(pad))
+        s.segment = func(b []byte) (out []byte, err error) {
+            if out, err = o.Obfuscate(b); err == nil {
+                out = out[:len(out)-len(pad)]
+            }
+            return out, err
+        }
+    }
+    return s, nil
+}
+
+// deobfStage returns a stage that deobfuscates with o.
+func deobfStage(o obfuscate.Obfuscator) (s stage, err error) {
+    s = stage{segment: o.Deobfuscate, final: o.Deobfuscate}
+    switch v := o.(type) {
+    case *obfuscate.XOR:
+        s.size = align(len(v.Key))
+    case *obfuscate.Base64:
+        s.size = align(pow(4, int(v.Rounds)))
+    case *obfuscate.AES, *obfuscate.Blowfish, *obfuscate.Twofish:
+        var pad []byte
+        if pad, err = blockSize(o); err != nil {
+            return s, err
+        }
+        s.size = align(len(pad))
+        s.segment = func(b []byte) ([]byte, error) {
+            return o.Deobfuscate(append(append(make([]byte, 0, len(b)+len(pad)), b...), pad...))
+        }
+    }
+    return s, nil
+}
+
+// base64Stage returns the stage that encodes or decodes the final
+// Base64 layer applied by obfuscate.Obfuscate.
+func base64Stage(encode bool) stage {
+    if encode {
+        enc := func(b []byte) ([]byte, error) { return obfuscate.Base64Encode(b), nil }
+        return stage{size: align(3), segment: enc, final: enc}
+    }
+    return stage{size: align(4), segment: obfuscate.Base64Decode, final: obfuscate.Base64Decode}
+}
+
+//========
+// WRITERS
+//========
+
+// stageWriter buffers input for a stage, writing processed segments
+// to next.
+type stageWriter struct {
+    stage
+    next io.Writer
+    buf  []byte
+}
+
+// Write buffers p, processing each complete segment. One byte beyond
+// a segment is always retained so that the final segment processed
+// by Close is never empty, which block ciphers require to detect
+// their padding.
+func (s *stageWriter) Write(p []byte) (n int, err error) {
+    if s.size == 0 {
+        s.buf = append(s.buf, p...)
+        return len(p), nil
+    }
+    for len(p) > 0 {
+        i := s.size + 1 - len(s.buf)
+        if i > len(p) {
+            i = len(p)
+        }
+        s.buf = append(s.buf, p[:i]...)
+        p = p[i:]
+        n += i
+
+        if len(s.buf) > s.size {
+            var out []byte
+            // Capacity is limited because block ciphers append their
+            // padding to the input, which would overwrite the byte
+            // that follows the segment.
+            if out, err = s.segment(s.buf[:s.size:s.size]); err != nil {
+                return n, err
+            } else if _, err = s.next.Write(out); err != nil {
+                return n, err
+            }
+            s.buf = append(s.buf[:0], s.buf[s.size:]...)
+        }
+    }
+    return n, nil
+}
+
+// Close processes the final segment and closes next when it's
+// another stageWriter.
+func (s *stageWriter) Close() (err error) {
+    var out []byte
+    if out, err = s.final(s.buf); err != nil {
+        return err
+    }
+    s.buf = nil
+    if _, err = s.next.Write(out); err != nil {
+        return err
+    }
+    if c, ok := s.next.(*stageWriter); ok {
+        return c.Close()
+    }
+    return nil
+}
+
+// newPipeline links stages such that the output of each is written
+// to the next, with the last writing to dst.
+func newPipeline(stages []stage, dst io.Writer) io.WriteCloser {
+    var w io.Writer = dst
+    for i := len(stages) - 1; i >= 0; i-- {
+        w = &stageWriter{stage: stages[i], next: w}
+    }
+    return w.(*stageWriter)
+}
+
+// NewWriter returns an io.WriteCloser that obfuscates data written
+// to it with chain, writing the result to dst. Close must be called
+// to write the final segment; it doesn't close dst.
+func NewWriter(dst io.Writer, chain []obfuscate.Obfuscator) (io.WriteCloser, error) {
+    var stages []stage
+    for _, o := range chain {
+        s, err := obfStage(o)
+        if err != nil {
+            return nil, err
+        }
+        stages = append(stages, s)
+    }
+    return newPipeline(append(stages, base64Stage(true)), dst), nil
+}
+
+// NewDeobfWriter returns an io.WriteCloser that deobfuscates data
+// written to it with chain, writing the result to dst. Close must be
+// called to write the final segment; it doesn't close dst.
+func NewDeobfWriter(dst io.Writer, chain []obfuscate.Obfuscator) (io.WriteCloser, error) {
+    stages := []stage{base64Stage(false)}
+    for i := len(chain) - 1; i >= 0; i-- {
+        s, err := deobfStage(chain[i])
+        if err != nil {
+            return nil, err
+        }
+        stages = append(stages, s)
+    }
+    return newPipeline(stages, dst), nil
+}
+
+//========
+// READERS
+//========
+
+// pipeReader reads from src through a pipeline, buffering only the
+// output of the most recent read.
+type pipeReader struct {
+    src  io.Reader
+    w    io.WriteCloser
+    out  bytes.Buffer
+    buf  []byte
+    done bool
+}
+
+// Read satisfies io.Reader.
+func (r *pipeReader) Read(p []byte) (n int, err error) {
+    for r.out.Len() == 0 && !r.done {
+        var rn int
+        rn, err = r.src.Read(r.buf)
+        if rn > 0 {
+            if _, wErr := r.w.Write(r.buf[:rn]); wErr != nil {
+                return 0, wErr
+            }
+        }
+        if err == io.EOF {
+            r.done = true
+            if err = r.w.Close(); err != nil {
+                return 0, err
+            }
+        } else if err != nil {
+            return 0, err
+        }
+    }
+    if r.out.Len() == 0 {
+        return 0, io.EOF
+    }
+    return r.out.Read(p)
+}
+
+// NewDeobfReader returns an io.Reader that deobfuscates data read
+// from src with chain.
+func NewDeobfReader(src io.Reader, chain []obfuscate.Obfuscator) (io.Reader, error) {
+    r := &pipeReader{src: src, buf: make([]byte, 32*1024)}
+    var err error
+    if r.w, err = NewDeobfWriter(&r.out, chain); err != nil {
+        return nil, err
+    }
+    return r, nil
+}
+
+//=======
+// LENGTH
+//=======
+
+// ObfuscatedLen returns the length of n bytes once obfuscated with
+// chain. False is returned when chain contains an obfuscator whose
+// output length can't be determined in advance.
+func ObfuscatedLen(n int64, chain []obfuscate.Obfuscator) (int64, bool) {
+    b64 := func(n int64) int64 { return (n + 2) / 3 * 4 }
+    for _, o := range chain {
+        switch v := o.(type) {
+        case *obfuscate.XOR:
+        case *obfuscate.Base64:
+            if v.Rounds == 0 {
+                n = 0
+            }
+            for r := v.Rounds; r > 0; r-- {
+                n = b64(n)
+            }
+        case *obfuscate.AES, *obfuscate.Blowfish, *obfuscate.Twofish:
+            pad, err := blockSize(o)
+            if err != nil {
+                return 0, false
+            }
+            bs := int64(len(pad))
+            n = (n/bs + 1) * bs
+        default:
+            return 0, false
+        }
+    }
+    return b64(n), true
+}
@@ -0,0 +1,225 @@
+package obf_stream
+
+import (
+    "bytes"
+    "crypto/rand"
+    "fmt"
+    obfuscate "github.com/blackhillsinfosec/skyhook-obfuscation"
+    "io"
+    "runtime"
+    "runtime/metrics"
+    "sync"
+    "testing"
+    "testing/iotest"
+    "time"
+)
+
+var (
+    testChains = map[string][]obfuscate.Obfuscator{
+        "empty":    {},
+        "xor":      {&obfuscate.XOR{Key: "abcdefg"}},
+        "aes":      {&obfuscate.AES{Key: "secretkey"}},
+        "blowfish": {&obfuscate.Blowfish{Key: "secretkey", Salt: "salt"}},
+        "twofish":  {&obfuscate.Twofish{Key: "secretkey"}},
+        "base64":   {&obfuscate.Base64{Rounds: 2}},
+        "mixed": {
+            &obfuscate.XOR{Key: "abc"},
+            &obfuscate.AES{Key: "secretkey"},
+            &obfuscate.Base64{Rounds: 1},
+            &obfuscate.Blowfish{Key: "otherkey"},
+            &obfuscate.XOR{Key: "0123456789"},
+        },
+    }
+
+    // testSizes straddle segment and block boundaries.
+    testSizes = []int{0, 1, 15, 16, 17, SegmentSize - 1, SegmentSize, SegmentSize + 1, 3*SegmentSize + 7}
+)
+
+func randBytes(t testing.TB, n int) []byte {
+    b := make([]byte, n)
+    if _, err := rand.Read(b); err != nil {
+        t.Fatal(err)
+    }
+    return b
+}
+
+// obfuscateStream obfuscates data in writes of varying sizes.
+func obfuscateStream(t testing.TB, data []byte, chain []obfuscate.Obfuscator) []byte {
+    out := bytes.Buffer{}
+    w, err := NewWriter(&out, chain)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for i, n := 0, 1; i < len(data); n = n*7%4093 + 1 {
+        if i+n > len(data) {
+            n = len(data) - i
+        }
+        if _, err = w.Write(data[i : i+n]); err != nil {
+            t.Fatal(err)
+        }
+        i += n
+    }
+    if err = w.Close(); err != nil {
+        t.Fatal(err)
+    }
+    return out.Bytes()
+}
+
+func TestNewWriter(t *testing.T) {
+    for name, chain := range testChains {
+        for _, size := range testSizes {
+            t.Run(fmt.Sprintf("%s/%d", name, size), func(t *testing.T) {
+                data := randBytes(t, size)
+                want, err := obfuscate.Obfuscate(data, chain)
+                if err != nil {
+                    t.Fatal(err)
+                }
+                if got := obfuscateStream(t, data, chain); !bytes.Equal(got, want) {
+                    t.Fatalf("streamed output differs from obfuscate.Obfuscate (%d vs %d bytes)", len(got), len(want))
+                }
+                if n, ok := ObfuscatedLen(int64(size), chain); !ok || n != int64(len(want)) {
+                    t.Fatalf("ObfuscatedLen returned %d, expected %d", n, len(want))
+                }
+            })
+        }
+    }
+}
+
+func TestNewDeobfReader(t *testing.T) {
+    for name, chain := range testChains {
+        for _, size := range testSizes {
+            t.Run(fmt.Sprintf("%s/%d", name, size), func(t *testing.T) {
+                data := randBytes(t, size)
+                enc, _ := obfuscate.Obfuscate(data, chain)
+
+                // One byte reads exercise short reads from the source
+                r, err := NewDeobfReader(iotest.OneByteReader(bytes.NewReader(enc)), chain)
+                if err != nil {
+                    t.Fatal(err)
+                }
+                got, err := io.ReadAll(iotest.HalfReader(r))
+                if err != nil {
+                    t.Fatal(err)
+                } else if !bytes.Equal(got, data) {
+                    t.Fatalf("deobfuscated output differs from input (%d vs %d bytes)", len(got), len(data))
+                }
+            })
+        }
+    }
+}
+
+func TestNewDeobfReader_Invalid(t *testing.T) {
+    r, err := NewDeobfReader(bytes.NewReader([]byte("not base64!")), testChains["xor"])
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err = io.ReadAll(r); err == nil {
+        t.Fatal("expected an error for invalid Base64 input")
+    }
+}
+
+//===========
+// BENCHMARKS
+//===========
+
+// Benchmarks compare obfuscating a chunk the way the file server
+// used to, buffering the entire chunk, to streaming it. Each op runs
+// benchTransfers concurrent transfers, and the growth of the live
+// heap while they run is reported per transfer as peak-B/transfer.
+// B/op counts all allocations, most of which are short-lived
+// allocations made by the obfuscators themselves.
+//
+//  go test -run xxx -bench . -benchmem ./server/obf-stream/
+
+const (
+    benchChunkSize = 8 * 1024 * 1024
+    benchTransfers = 4
+)
+
+var benchChain = testChains["mixed"]
+
+func BenchmarkObfuscate_Buffered(b *testing.B) {
+    data := randBytes(b, benchChunkSize)
+    benchTransfer(b, func() {
+        r := io.LimitReader(bytes.NewReader(data), benchChunkSize)
+        buff := make([]byte, benchChunkSize)
+        io.ReadFull(r, buff)
+        out, _ := obfuscate.Obfuscate(buff, benchChain)
+        io.Copy(io.Discard, bytes.NewReader(out))
+    })
+}
+
+func BenchmarkObfuscate_Streamed(b *testing.B) {
+    data := randBytes(b, benchChunkSize)
+    benchTransfer(b, func() {
+        w, _ := NewWriter(io.Discard, benchChain)
+        io.Copy(w, io.LimitReader(bytes.NewReader(data), benchChunkSize))
+        w.Close()
+    })
+}
+
+func BenchmarkDeobfuscate_Buffered(b *testing.B) {
+    enc, _ := obfuscate.Obfuscate(randBytes(b, benchChunkSize), benchChain)
+    benchTransfer(b, func() {
+        data, _ := io.ReadAll(bytes.NewReader(enc))
+        obfuscate.Deobfuscate(data, benchChain)
+    })
+}
+
+func BenchmarkDeobfuscate_Streamed(b *testing.B) {
+    enc, _ := obfuscate.Obfuscate(randBytes(b, benchChunkSize), benchChain)
+    benchTransfer(b, func() {
+        r, _ := NewDeobfReader(bytes.NewReader(enc), benchChain)
+        io.Copy(io.Discard, r)
+    })
+}
+
+// benchTransfer runs benchTransfers concurrent calls to transfer
+// for each op, reporting the peak growth of the live heap.
+func benchTransfer(b *testing.B, transfer func()) {
+    b.SetBytes(benchChunkSize * benchTransfers)
+    b.ReportAllocs()
+    var peak uint64
+    for i := 0; i < b.N; i++ {
+        runtime.GC()
+        base := heapObjects()
+        stop, sampled := make(chan struct{}), make(chan uint64)
+        go func() {
+            var max uint64
+            for {
+                if h := heapObjects(); h > max {
+                    max = h
+                }
+                select {
+                case <-stop:
+                    sampled <- max
+                    return
+                case <-time.After(100 * time.Microsecond):
+                }
+            }
+        }()
+
+        wg := sync.WaitGroup{}
+        for t := 0; t < benchTransfers; t++ {
+            wg.Add(1)
+            go func() {
+                defer wg.Done()
+                transfer()
+            }()
+        }
+        wg.Wait()
+        close(stop)
+        if max := <-sampled; max > base && max-base > peak {
+            peak = max - base
+        }
+    }
+    b.ReportMetric(float64(peak)/benchTransfers, "peak-B/transfer")
+}
+
+// heapObjects returns the bytes occupied by heap objects, including
+// those that are unreachable but not yet collected.
+func heapObjects() uint64 {
+    s := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+    metrics.Read(s)
+    return s[0].Value.Uint64()
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+    "errors"
+    "fmt"
+    obfuscate "github.com/blackhillsinfosec/skyhook-obfuscation"
+    "github.com/blackhillsinfosec/skyhook/config"
+    "strings"
+    "sync"
+    "time"
+)
+
+// ObfProfiles holds the parsed obfuscation chain of each named
+// obfuscation profile. It's shared by the file and admin servers,
+// allowing the admin server to change the chain of one profile
+// without affecting users assigned to others.
+//
+// The current default profile isn't included; it's always the
+// ObfuscatorChain of each server. Chains replaced by rotation or
+// by an admin, including those of the default profile, are retained
+// until their grace period ends.
+type ObfProfiles struct {
+    mu      sync.RWMutex
+    chains  map[string]*[]obfuscate.Obfuscator
+    retired map[string]retiredChain
+}
+
+// retiredChain is a replaced chain that remains accepted until
+// a deadline.
+type retiredChain struct {
+    chain *[]obfuscate.Obfuscator
+    until time.Time
+}
+
+// NewObfProfiles parses the obfuscators of each profile.
+func NewObfProfiles(profiles []config.ObfuscationProfile) (*ObfProfiles, error) {
+    p := &ObfProfiles{
+        chains:  make(map[string]*[]obfuscate.Obfuscator),
+        retired: make(map[string]retiredChain),
+    }
+    for _, prof := range profiles {
+        prof := prof
+        chain, failures := obfuscate.ParseObfuscators(&prof.Obfuscators)
+        if len(failures) > 0 {
+            return nil, errors.New(fmt.Sprintf("failed to parse obfuscator(s) of profile %s: %s",
+                prof.Name, strings.Join(failures, ", ")))
+        }
+        p.chains[prof.Name] = chain
+    }
+    return p, nil
+}
+
+// Get returns the chain of the named profile.
+func (p *ObfProfiles) Get(name string) (*[]obfuscate.Obfuscator, bool) {
+    if p == nil {
+        return nil, false
+    }
+    p.mu.RLock()
+    defer p.mu.RUnlock()
+    chain, ok := p.chains[name]
+    return chain, ok
+}
+
+// Set replaces the chain of the named profile, creating it when
+// necessary. Requests already being served continue to use the
+// previous chain.
+func (p *ObfProfiles) Set(name string, chain *[]obfuscate.Obfuscator) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    p.chains[name] = chain
+}
+
+// Delete removes the named profile.
+func (p *ObfProfiles) Delete(name string) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    delete(p.chains, name)
+    delete(p.retired, name)
+}
+
+// Retire keeps chain, the replaced chain of the named profile,
+// accepted for grace. Any chain retired earlier is discarded.
+func (p *ObfProfiles) Retire(name string, chain *[]obfuscate.Obfuscator, grace time.Duration) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    p.retired[name] = retiredChain{chain: chain, until: time.Now().Add(grace)}
+}
+
+// Retired returns the replaced chain of the named profile while
+// its grace period is active.
+func (p *ObfProfiles) Retired(name string) (*[]obfuscate.Obfuscator, bool) {
+    if p == nil {
+        return nil, false
+    }
+    p.mu.RLock()
+    defer p.mu.RUnlock()
+    r, ok := p.retired[name]
+    if !ok || time.Now().After(r.until) {
+        return nil, false
+    }
+    return r.chain, true
+}
+
+// Inherit copies the retired chains of prev whose grace periods are
+// active, such that they survive a config reload.
+func (p *ObfProfiles) Inherit(prev *ObfProfiles) {
+    if prev == nil || prev == p {
+        return
+    }
+    prev.mu.RLock()
+    defer prev.mu.RUnlock()
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    for name, r := range prev.retired {
+        if _, ok := p.retired[name]; !ok && time.Now().Before(r.until) {
+            p.retired[name] = r
+        }
+    }
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+    obfuscate "github.com/blackhillsinfosec/skyhook-obfuscation"
+    "github.com/blackhillsinfosec/skyhook/config"
+    mw "github.com/blackhillsinfosec/skyhook/server/middleware"
+    "testing"
+)
+
+// testProfile returns an obfuscation profile using a XOR chain
+// keyed by key.
+func testProfile(name, key string) config.ObfuscationProfile {
+    return config.ObfuscationProfile{
+        Name: name,
+        Obfuscators: []obfuscate.ObfuscatorConfig{
+            {Algo: "xor", Config: map[string]interface{}{"key": key}},
+        },
+    }
+}
+
+func TestNewObfProfiles(t *testing.T) {
+    p, err := NewObfProfiles([]config.ObfuscationProfile{testProfile("red", "r"), testProfile("blue", "b")})
+    if err != nil {
+        t.Fatal(err)
+    }
+    for name, key := range map[string]string{"red": "r", "blue": "b"} {
+        if chain, ok := p.Get(name); !ok || len(*chain) != 1 || (*chain)[0].(*obfuscate.XOR).Key != key {
+            t.Errorf("%s: unexpected chain", name)
+        }
+    }
+    if _, ok := p.Get("green"); ok {
+        t.Error("unknown profile was returned")
+    }
+
+    p.Delete("red")
+    if _, ok := p.Get("red"); ok {
+        t.Error("deleted profile was returned")
+    }
+
+    bad := testProfile("bad", "k")
+    bad.Obfuscators[0].Algo = "rot13"
+    if _, err = NewObfProfiles([]config.ObfuscationProfile{bad}); err == nil {
+        t.Error("profile with an unknown obfuscator was parsed")
+    }
+
+    var nilProfiles *ObfProfiles
+    if _, ok := nilProfiles.Get("red"); ok {
+        t.Error("nil profiles returned a chain")
+    }
+}
+
+func TestSkyhookServer_ProfileChains(t *testing.T) {
+    profiles, err := NewObfProfiles([]config.ObfuscationProfile{testProfile("red", "r")})
+    if err != nil {
+        t.Fatal(err)
+    }
+    def := &[]obfuscate.Obfuscator{&obfuscate.XOR{Key: "d"}}
+    ss := &SkyhookServer{ObfuscatorChain: mw.NewObfChain(def), Profiles: profiles}
+    red, _ := profiles.Get("red")
+
+    // Users without a profile and those assigned a profile that
+    // no longer exists use the default chain
+    for name, want := range map[string]*[]obfuscate.Obfuscator{
+        "":                    def,
+        config.DefaultProfile: def,
+        "red":                 red,
+        "deleted":             def,
+    } {
+        if chains := ss.profileChains(name); len(chains) != 1 || chains[0] != want {
+            t.Errorf("%q: unexpected chains %v", name, chains)
+        }
+    }
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+    "crypto/rand"
+    "errors"
+    "fmt"
+    obfuscate "github.com/blackhillsinfosec/skyhook-obfuscation"
+    structs "github.com/blackhillsinfosec/skyhook/api_structs"
+    "github.com/blackhillsinfosec/skyhook/config"
+    "github.com/blackhillsinfosec/skyhook/log"
+    mw "github.com/blackhillsinfosec/skyhook/server/middleware"
+    "math/big"
+    "reflect"
+    "strings"
+    "time"
+)
+
+const (
+    // rotatedKeyLength is the length of keys generated by rotation,
+    // which is accepted by every supported algorithm.
+    rotatedKeyLength = 32
+    rotatedKeyChars  = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+)
+
+// randomKey returns a random alphanumeric string suitable for use
+// as an obfuscator key or salt.
+func randomKey() (string, error) {
+    b := make([]byte, rotatedKeyLength)
+    max := big.NewInt(int64(len(rotatedKeyChars)))
+    for i := range b {
+        n, err := rand.Int(rand.Reader, max)
+        if err != nil {
+            return "", err
+        }
+        b[i] = rotatedKeyChars[n.Int64()]
+    }
+    return string(b), nil
+}
+
+// RotateObfuscatorConfigs returns copies of configs with fresh keys.
+//
+// Each string field of the algorithms described by
+// structs.Obfuscators, e.g., the key of XOR and the key and salt of
+// Blowfish, receives a new random value. Other settings, such as
+// the rounds of Base64, are retained.
+func RotateObfuscatorConfigs(configs []obfuscate.ObfuscatorConfig) (rotated []obfuscate.ObfuscatorConfig, err error) {
+    for _, c := range configs {
+        proto, ok := structs.Obfuscators[strings.ToLower(c.Algo)]
+        if !ok {
+            return nil, errors.New(fmt.Sprintf("unsupported obfuscator: %s", c.Algo))
+        }
+
+        conf := make(map[string]interface{}, len(c.Config))
+        for k, v := range c.Config {
+            conf[k] = v
+        }
+
+        t := reflect.TypeOf(proto)
+        for i := 0; i < t.NumField(); i++ {
+            if f := t.Field(i); f.Type.Kind() == reflect.String {
+                if conf[strings.ToLower(f.Name)], err = randomKey(); err != nil {
+                    return nil, errors.New(fmt.Sprintf("failed to generate key: %v", err))
+                }
+            }
+        }
+
+        rotated = append(rotated, obfuscate.ObfuscatorConfig{Algo: c.Algo, Config: conf})
+    }
+    return rotated, nil
+}
+
+// RotateChains generates fresh keys for the default obfuscation
+// chain and each named profile, updating global to match.
+//
+// Replaced chains are retired in profiles, remaining accepted by
+// the file server for the grace period configured in global. chain
+// holds the default chain shared by the servers. New chains are
+// stored in place of the current ones, which are never modified,
+// so in-flight transfers are unaffected.
+//
+// Nothing is changed when generating any of the new chains fails.
+func RotateChains(global *config.SkyhookConfig, chain *mw.ObfChain, profiles *ObfProfiles) (err error) {
+
+    //=======================
+    // GENERATE THE NEW CHAINS
+    //=======================
+
+    type rotation struct {
+        configs []obfuscate.ObfuscatorConfig
+        chain   *[]obfuscate.Obfuscator
+    }
+
+    rotate := func(name string, configs []obfuscate.ObfuscatorConfig) (r rotation, err error) {
+        if r.configs, err = RotateObfuscatorConfigs(configs); err != nil {
+            return r, errors.New(fmt.Sprintf("failed to rotate profile %s: %v", name, err))
+        }
+        var failures []string
+        if r.chain, failures = obfuscate.ParseObfuscators(&r.configs); len(failures) > 0 {
+            return r, errors.New(fmt.Sprintf("failed to parse rotated obfuscator(s) of profile %s: %s",
+                name, strings.Join(failures, ", ")))
+        }
+        return r, nil
+    }
+
+    var def rotation
+    if def, err = rotate(config.DefaultProfile, global.FileServer.Obfuscators); err != nil {
+        return err
+    }
+    named := make([]rotation, len(global.FileServer.ObfuscationProfiles))
+    for i, p := range global.FileServer.ObfuscationProfiles {
+        if named[i], err = rotate(p.Name, p.Obfuscators); err != nil {
+            return err
+        }
+    }
+
+    //=================================
+    // RETIRE AND REPLACE CURRENT CHAINS
+    //=================================
+
+    grace := global.FileServer.RotationOptions.Grace()
+
+    profiles.Retire(config.DefaultProfile, chain.Load(), grace)
+    chain.Store(def.chain)
+    global.FileServer.Obfuscators = def.configs
+
+    for i := range global.FileServer.ObfuscationProfiles {
+        p := &global.FileServer.ObfuscationProfiles[i]
+        if cur, ok := profiles.Get(p.Name); ok {
+            profiles.Retire(p.Name, cur, grace)
+        }
+        profiles.Set(p.Name, named[i].chain)
+        p.Obfuscators = named[i].configs
+    }
+
+    log.WARN.Printf("Rotated obfuscation keys of %d profile(s); previous keys are accepted for %v",
+        len(named)+1, grace)
+    return nil
+}
+
+// ScheduleRotation calls rotate every interval until stop is called.
+// stop waits for any rotation in progress, after which rotate is
+// never called again.
+func ScheduleRotation(interval time.Duration, rotate func()) (stop func()) {
+    t := time.NewTicker(interval)
+    done, exited := make(chan struct{}), make(chan struct{})
+    go func() {
+        defer close(exited)
+        for {
+            select {
+            case <-t.C:
+                // A tick and stop may be ready at once
+                select {
+                case <-done:
+                    return
+                default:
+                    rotate()
+                }
+            case <-done:
+                return
+            }
+        }
+    }()
+    return func() {
+        t.Stop()
+        close(done)
+        <-exited
+    }
+}
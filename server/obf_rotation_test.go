@@ -0,0 +1,238 @@
+package server
+
+import (
+    obfuscate "github.com/blackhillsinfosec/skyhook-obfuscation"
+    "github.com/blackhillsinfosec/skyhook/config"
+    mw "github.com/blackhillsinfosec/skyhook/server/middleware"
+    "github.com/gin-gonic/gin"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "reflect"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+func TestRotateObfuscatorConfigs(t *testing.T) {
+    configs := []obfuscate.ObfuscatorConfig{
+        {Algo: "xor", Config: map[string]interface{}{"key": "k"}},
+        {Algo: "base64", Config: map[string]interface{}{"rounds": 3}},
+        {Algo: "blowfish", Config: map[string]interface{}{"key": "k", "salt": "s"}},
+    }
+    rotated, err := RotateObfuscatorConfigs(configs)
+    if err != nil {
+        t.Fatal(err)
+    } else if len(rotated) != len(configs) {
+        t.Fatalf("expected %d configs, got %d", len(configs), len(rotated))
+    }
+
+    // Keys and salts are replaced, while other settings are retained
+    if k := rotated[0].Config["key"].(string); k == "k" || len(k) != rotatedKeyLength {
+        t.Errorf("XOR key wasn't rotated: %s", k)
+    }
+    if rotated[1].Config["rounds"] != 3 {
+        t.Errorf("Base64 rounds weren't retained: %v", rotated[1].Config)
+    }
+    if rotated[2].Config["key"] == "k" || rotated[2].Config["salt"] == "s" {
+        t.Errorf("Blowfish key and salt weren't rotated: %v", rotated[2].Config)
+    }
+
+    // The rotated configs are parsed into a working chain
+    chain, failures := obfuscate.ParseObfuscators(&rotated)
+    if len(failures) > 0 {
+        t.Fatal(failures)
+    }
+    if enc, err := obfuscate.Obfuscate([]byte("/file"), *chain); err != nil {
+        t.Fatal(err)
+    } else if dec, err := obfuscate.Deobfuscate(enc, *chain); err != nil || string(dec) != "/file" {
+        t.Errorf("rotated chain doesn't round trip: %q, %v", dec, err)
+    }
+
+    if configs[0].Config["key"] != "k" {
+        t.Error("original config was modified")
+    }
+    if _, err = RotateObfuscatorConfigs([]obfuscate.ObfuscatorConfig{{Algo: "rot13"}}); err == nil {
+        t.Error("unsupported obfuscator was rotated")
+    }
+}
+
+func TestRotateChains(t *testing.T) {
+    global := &config.SkyhookConfig{}
+    global.FileServer.Obfuscators = testProfile(config.DefaultProfile, "d").Obfuscators
+    global.FileServer.ObfuscationProfiles = []config.ObfuscationProfile{testProfile("red", "r")}
+    global.FileServer.RotationOptions.GracePeriod = 30
+
+    prevDef, _ := obfuscate.ParseObfuscators(&global.FileServer.Obfuscators)
+    profiles, err := NewObfProfiles(global.FileServer.ObfuscationProfiles)
+    if err != nil {
+        t.Fatal(err)
+    }
+    chain := mw.NewObfChain(prevDef)
+    ss := &SkyhookServer{ObfuscatorChain: chain, Profiles: profiles}
+    want := append([]obfuscate.Obfuscator(nil), *prevDef...)
+    prevRed, _ := profiles.Get("red")
+
+    if err = RotateChains(global, chain, profiles); err != nil {
+        t.Fatal(err)
+    }
+
+    // The config and chains are replaced, with the previous chains
+    // accepted during the grace period
+    if global.FileServer.Obfuscators[0].Config["key"] == "d" || global.FileServer.ObfuscationProfiles[0].Obfuscators[0].Config["key"] == "r" {
+        t.Error("config wasn't updated with the rotated keys")
+    }
+    if chains := ss.profileChains(""); len(chains) != 2 || chains[0] != chain.Load() || chains[1] != prevDef {
+        t.Errorf("unexpected default chains after rotation: %v", chains)
+    } else if chains[0] == prevDef {
+        t.Error("default chain wasn't replaced")
+    }
+
+    // Replaced chains are never modified, such that requests using
+    // them are unaffected
+    if !reflect.DeepEqual(*prevDef, want) {
+        t.Error("previous default chain was modified")
+    }
+    if chains := ss.profileChains("red"); len(chains) != 2 || chains[0] == prevRed || chains[1] != prevRed {
+        t.Errorf("unexpected red chains after rotation: %v", chains)
+    }
+
+    // Nothing changes when any profile fails to rotate
+    global.FileServer.ObfuscationProfiles = append(global.FileServer.ObfuscationProfiles,
+        config.ObfuscationProfile{Name: "bad", Obfuscators: []obfuscate.ObfuscatorConfig{{Algo: "rot13"}}})
+    cur := chain.Load()
+    key := global.FileServer.Obfuscators[0].Config["key"]
+    if err = RotateChains(global, chain, profiles); err == nil {
+        t.Error("rotation of an unsupported obfuscator succeeded")
+    } else if chain.Load() != cur || global.FileServer.Obfuscators[0].Config["key"] != key {
+        t.Error("failed rotation changed the default chain")
+    }
+}
+
+// TestRotateChains_Serving rotates the keys while requests are being
+// served, which the race detector checks for unsynchronized access
+// to the chains.
+func TestRotateChains_Serving(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    global := &config.SkyhookConfig{}
+    global.FileServer.Obfuscators = []obfuscate.ObfuscatorConfig{
+        {Algo: "xor", Config: map[string]interface{}{"key": "d"}},
+        {Algo: "base64", Config: map[string]interface{}{"rounds": 1}},
+    }
+    global.FileServer.RotationOptions.GracePeriod = 30
+
+    def, _ := obfuscate.ParseObfuscators(&global.FileServer.Obfuscators)
+    profiles, _ := NewObfProfiles(nil)
+    ss := &SkyhookServer{ObfuscatorChain: mw.NewObfChain(def), Profiles: profiles}
+
+    // Each request echoes its deobfuscated path, obfuscated with the
+    // chain it was assigned
+    r := gin.New()
+    r.GET("/files/*filepath", func(c *gin.Context) {
+        c.Set("credential", &config.Credential{Username: "op"})
+    }, mw.ObfProfile(ss.profileChains, "filepath"), mw.ObfResponse(ss.ObfuscatorChain, false), func(c *gin.Context) {
+        dec, err := obfuscate.Deobfuscate([]byte(strings.TrimPrefix(c.Param("filepath"), "/")), *mw.CtxObfChain(c, ss.ObfuscatorChain))
+        if err != nil {
+            c.Status(http.StatusNotFound)
+            return
+        }
+        c.String(http.StatusOK, string(dec))
+    })
+
+    get := func() (ok bool) {
+        chain := ss.ObfuscatorChain.Load()
+        enc, err := obfuscate.Obfuscate([]byte("/loot/file"), *chain)
+        if err != nil {
+            t.Error(err)
+            return false
+        }
+        rec := httptest.NewRecorder()
+        r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/files/"+url.PathEscape(string(enc)), nil))
+        dec, err := obfuscate.Deobfuscate(rec.Body.Bytes(), *chain)
+        return rec.Code == http.StatusOK && err == nil && string(dec) == "/loot/file"
+    }
+
+    // Clients fall behind when keys are rotated more than once
+    // during a request, so only some requests must succeed
+    done := make(chan struct{})
+    var wg sync.WaitGroup
+    var served atomic.Int32
+    for i := 0; i < 4; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for {
+                select {
+                case <-done:
+                    return
+                default:
+                    if get() {
+                        served.Add(1)
+                    }
+                }
+            }
+        }()
+    }
+    for i := 0; i < 50; i++ {
+        if err := RotateChains(global, ss.ObfuscatorChain, profiles); err != nil {
+            t.Error(err)
+        }
+        time.Sleep(time.Millisecond)
+    }
+    close(done)
+    wg.Wait()
+
+    if served.Load() == 0 {
+        t.Error("no request was served during rotation")
+    }
+    if !get() {
+        t.Error("request wasn't served after rotation")
+    }
+}
+
+func TestObfProfiles_Retired(t *testing.T) {
+    p, _ := NewObfProfiles(nil)
+    old := &[]obfuscate.Obfuscator{&obfuscate.XOR{Key: "old"}}
+
+    p.Retire("red", old, time.Hour)
+    if chain, ok := p.Retired("red"); !ok || chain != old {
+        t.Error("retired chain isn't accepted during the grace period")
+    }
+    p.Retire("blue", old, -time.Second)
+    if _, ok := p.Retired("blue"); ok {
+        t.Error("retired chain is accepted after the grace period")
+    }
+
+    // Retired chains survive reloads until their grace period ends
+    next, _ := NewObfProfiles(nil)
+    next.Inherit(p)
+    if _, ok := next.Retired("red"); !ok {
+        t.Error("active retired chain wasn't inherited")
+    }
+    if _, ok := next.Retired("blue"); ok {
+        t.Error("expired retired chain was inherited")
+    }
+
+    p.Delete("red")
+    if _, ok := p.Retired("red"); ok {
+        t.Error("retired chain of a deleted profile is accepted")
+    }
+}
+
+func TestScheduleRotation(t *testing.T) {
+    var n atomic.Int32
+    stop := ScheduleRotation(10*time.Millisecond, func() { n.Add(1) })
+    time.Sleep(100 * time.Millisecond)
+    stop()
+
+    after := n.Load()
+    if after == 0 {
+        t.Fatal("rotation wasn't scheduled")
+    }
+    time.Sleep(50 * time.Millisecond)
+    if n.Load() != after {
+        t.Error("rotation continued after being stopped")
+    }
+}
@@ -8,17 +8,24 @@ import (
     jwt "github.com/appleboy/gin-jwt/v2"
     obfs "github.com/blackhillsinfosec/skyhook-obfuscation"
     structs "github.com/blackhillsinfosec/skyhook/api_structs"
+    "github.com/blackhillsinfosec/skyhook/audit"
     "github.com/blackhillsinfosec/skyhook/config"
     "github.com/blackhillsinfosec/skyhook/log"
     mw "github.com/blackhillsinfosec/skyhook/server/middleware"
+    "github.com/blackhillsinfosec/skyhook/server/lockout"
+    "github.com/blackhillsinfosec/skyhook/server/session"
+    "github.com/blackhillsinfosec/skyhook/server/share"
+    "github.com/blackhillsinfosec/skyhook/server/upload"
     fsUtil "github.com/blackhillsinfosec/skyhook/util/fs"
     "github.com/gin-contrib/cors"
     "github.com/gin-gonic/gin"
+    "golang.org/x/crypto/acme/autocert"
     "golang.org/x/exp/slices"
     "gopkg.in/yaml.v3"
     "net/http"
     "os"
     "path"
+    "strconv"
     "strings"
     "sync"
     "time"
@@ -41,7 +48,12 @@ type AdminServer struct {
     Config          *config.AdminServerOptions
     Tls             *config.ManualTlsOptions
     Users           *[]config.Credential
-    ObfuscatorChain *[]obfs.Obfuscator
+    // ObfuscatorChain holds the chain of the default obfuscation
+    // profile and is shared with the file server.
+    ObfuscatorChain *mw.ObfChain
+    // Profiles holds the chains of named obfuscation profiles and
+    // is shared with the file server.
+    Profiles *ObfProfiles
     // Kill is a channel used to tell AdminServer that it
     // should die.
     Kill chan uint8
@@ -55,9 +67,30 @@ type AdminServer struct {
     // used during RW operations to the config file.
     Global               *config.SkyhookConfig
     EncryptedJsGenerator func() []byte
+    // CertManager provides certificates when Tls is in ACME
+    // mode. Tls.CertPath and Tls.KeyPath are used when nil.
+    CertManager *autocert.Manager
+    // UploadManager is shared with the file server, allowing
+    // uploads to be monitored and controlled.
+    UploadManager *upload.Manager
+    // Shares holds the share tokens redeemed by the file server.
+    Shares *share.Tokens
+    // Sessions tracks the tokens issued by both servers, allowing
+    // them to be listed and revoked.
+    Sessions *session.Store
+    // Lockouts throttles failed logins to both servers, allowing
+    // lockouts to be listed and cleared.
+    Lockouts *lockout.Tracker
+    // obfsMu serializes changes to obfuscation chains made by
+    // handlers and scheduled rotation.
+    obfsMu sync.Mutex
+
+    httpServer *http.Server
 }
 
-// Run runs the admin server.
+// Run runs the admin server, blocking until a value is sent to Kill.
+// Shutdown must be called afterwards to drain in-flight requests,
+// allowing the file server to be drained within the same deadline.
 func (as *AdminServer) Run() (err error) {
 
     eng := gin.Default()
@@ -68,20 +101,20 @@ func (as *AdminServer) Run() (err error) {
     // Reference: https://github.com/appleboy/gin-jwt
     var authMiddleWare *jwt.GinJWTMiddleware
     if authMiddleWare, err = jwt.New(&jwt.GinJWTMiddleware{
-        Timeout:       7 * (24 * time.Hour),
-        MaxRefresh:    7 * (24 * time.Hour),
+        Timeout:       as.Global.Auth.Jwt.Lifetime(),
+        MaxRefresh:    as.Global.Auth.Jwt.RefreshWindow(),
         IdentityKey:   as.Global.Auth.Jwt.FieldKeys.Username,
         Realm:         as.Global.Auth.Jwt.Realm,
         Key:           []byte(as.Global.Auth.Jwt.SigningKey),
         TokenLookup:   fmt.Sprintf("header: %s", as.Global.Auth.Header.Name),
         TokenHeadName: as.Global.Auth.Header.Scheme,
-        Authorizator:  mw.JwtIsCredAdmin,
+        Authorizator:  mw.JwtSessionAuthorizator(as.Sessions, mw.JwtIsCredAdmin),
         Unauthorized:  mw.JwtIsUnauthorized,
-        Authenticator: mw.JwtLoginHandler(&as.Global.Users, true),
+        Authenticator: mw.JwtLoginHandler(as.Global, as.Lockouts, true),
         IdentityHandler: mw.JwtIdentityHandler(
             &as.Global.Auth.Jwt.FieldKeys.Username,
             &as.Global.Auth.Jwt.FieldKeys.Admin),
-        PayloadFunc: mw.JwtPayloadFunc(as.Global)}); err != nil {
+        PayloadFunc: mw.JwtPayloadFunc(as.Global, as.Sessions, "admin")}); err != nil {
 
         log.ERR.Printf("Failed to initialize JWT auth: %v", err)
         return err
@@ -97,22 +130,21 @@ func (as *AdminServer) Run() (err error) {
     // CONFIGURE CORS
     //===============
 
-    var corsFqdns []string
-    corsFqdns = append(corsFqdns, "https://"+as.Config.Socket())
-    corsFqdns = append(corsFqdns, as.Config.AddtlCorsUrls...)
-    cors := cors.New(cors.Config{
-        //AllowAllOrigins: true,
-        AllowWildcard:    true,
-        AllowOrigins:     corsFqdns,
-        AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "PATCH"},
-        AllowHeaders:     []string{"*"},
-        ExposeHeaders:    []string{"Content-Length"},
-        AllowCredentials: true,
-        MaxAge:           12 * time.Hour,
-    })
-    eng.Use(cors)
+    if corsFqdns := corsOrigins(&as.Config.ServerOptions); len(corsFqdns) > 0 {
+        cors := cors.New(cors.Config{
+            //AllowAllOrigins: true,
+            AllowWildcard:    true,
+            AllowOrigins:     corsFqdns,
+            AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "PATCH"},
+            AllowHeaders:     []string{"*"},
+            ExposeHeaders:    []string{"Content-Length"},
+            AllowCredentials: true,
+            MaxAge:           12 * time.Hour,
+        })
+        eng.Use(cors)
+    }
 
-    if err = eng.SetTrustedProxies(nil); err != nil {
+    if err = eng.SetTrustedProxies(as.Config.TrustedProxies); err != nil {
         log.ERR.Printf("Failed set trusted proxies on admin server: %v", err)
         panic(err)
     }
@@ -140,8 +172,11 @@ func (as *AdminServer) Run() (err error) {
 
     eng.GET("/ping", as.PingHandler)
     eng.POST("/login", authMiddleWare.LoginHandler)
-    eng.GET("/login", authMiddleWare.RefreshHandler)
-    eng.POST("/logout", authMiddleWare.LogoutHandler)
+    eng.GET("/login", mw.JwtRefreshSession(authMiddleWare, as.Sessions,
+        as.Global.Auth.Jwt.SessionLifetime(), authMiddleWare.RefreshHandler))
+    eng.POST("/logout", auditLogout("admin", authMiddleWare,
+        &as.Global.Auth.Jwt.FieldKeys.Username,
+        mw.JwtRevokeSession(authMiddleWare, as.Sessions, authMiddleWare.LogoutHandler)))
 
     //=====================
     // AUTHENTICATED ROUTES
@@ -155,43 +190,79 @@ func (as *AdminServer) Run() (err error) {
 
         auth.GET("/users", as.GetUsers)
         auth.PUT("/users", as.SaveUsers)
+        auth.POST("/users/:username/totp", as.EnrollTotp)
+        auth.DELETE("/users/:username/totp", as.DisableTotp)
 
         auth.GET("/obfs", as.ListObfuscators)
         auth.GET("/obfs/config", as.GetObfuscators)
         auth.PUT("/obfs/config", as.SaveObfuscators)
+        auth.GET("/obfs/profiles", as.GetObfuscationProfiles)
+        auth.PUT("/obfs/profiles/:name", as.SaveObfuscationProfile)
+        auth.DELETE("/obfs/profiles/:name", as.DeleteObfuscationProfile)
+        auth.POST("/obfs/rotate", as.RotateObfuscatorsHandler)
 
         auth.GET("/advanced", as.GetAdvancedConfig)
         auth.GET("/landing", as.GetFileServerLandingUri)
         auth.GET("/js", as.GetEncryptedJs)
+
+        auth.GET("/audit", as.GetAuditLog)
+
+        auth.GET("/uploads", as.ListUploads)
+        auth.PATCH("/uploads", as.ExtendUpload)
+        auth.DELETE("/uploads", as.CancelUpload)
+
+        auth.GET("/shares", as.ListShares)
+        auth.POST("/shares", as.CreateShare)
+        auth.DELETE("/shares/:token", as.RevokeShare)
+
+        auth.GET("/sessions", as.ListSessions)
+        auth.DELETE("/sessions/:id", as.RevokeSession)
+
+        auth.GET("/lockouts", as.ListLockouts)
+        auth.DELETE("/lockouts/:kind/:key", as.ClearLockout)
     }
 
     //=================
     // START THE SERVER
     //=================
 
-    srv := http.Server{
+    as.httpServer = &http.Server{
         Addr:    as.Config.Socket(),
         Handler: eng,
     }
 
+    lErr := make(chan error, 1)
     go func() {
-        err = srv.ListenAndServeTLS(as.Tls.CertPath, as.Tls.KeyPath)
-        if err != nil {
+        if err := listenAndServe(as.httpServer, &as.Config.ServerOptions, as.Tls, &as.Global.TlsProfile, as.CertManager); err != http.ErrServerClosed {
+            lErr <- err
             as.Kill <- 2
         }
     }()
 
-    out := <-as.Kill
-    if out != 2 {
-        _, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-        defer func() {
-            cancel()
-        }()
-        log.WARN.Printf("Shutting down admin server")
-    } else if err != nil {
+    //===================================
+    // BLOCK UNTIL A SHUTDOWN IS REQUESTED
+    //===================================
+    // Any value other than 2 requests a graceful shutdown.
+
+    if out := <-as.Kill; out == 2 {
+        err = <-lErr
         log.ERR.Printf("Failed to start admin server: %v", err)
+        return err
     }
+    return nil
+}
 
+// Shutdown gracefully shuts down the admin server, giving in-flight
+// requests until ctx is done to complete.
+func (as *AdminServer) Shutdown(ctx context.Context) (err error) {
+    if as.httpServer == nil {
+        return nil
+    }
+    log.WARN.Printf("Shutting down admin server")
+    if err = as.httpServer.Shutdown(ctx); err != nil {
+        log.WARN.Printf("Failed to drain admin server requests before the deadline: %v", err)
+        as.httpServer.Close()
+    }
     return err
 }
 
@@ -200,6 +271,7 @@ func (as *AdminServer) GetLinks(c *gin.Context) {
     allLinks := structs.LinksResponse{}
 
     fs := as.Global.FileServer
+    shares := as.Shares.List()
 
     for _, fqdn := range fs.LinkFqdns {
 
@@ -216,6 +288,13 @@ func (as *AdminServer) GetLinks(c *gin.Context) {
         links.Encrypted.Html = fmt.Sprintf("%s%s#%s", base, fs.Routes.EncryptedLoader.Html, fs.EncryptedLoader.Key)
         links.Encrypted.AutoloadHtml = fmt.Sprintf("%s%s#%s", base, fs.Routes.EncryptedLoader.AutoHtml, fs.EncryptedLoader.Key)
 
+        links.Shares = make(map[string]string)
+        for _, sh := range shares {
+            if l, ok := as.shareLinks(sh)[fqdn]; ok {
+                links.Shares[sh.Token] = l
+            }
+        }
+
         allLinks[fqdn] = links
     }
 
@@ -233,6 +312,12 @@ func (as *AdminServer) GetEncryptedJs(c *gin.Context) {
     })
 }
 
+// FlushConfig backs up the config file and then writes the current
+// config to disk.
+func (as *AdminServer) FlushConfig() error {
+    return as.writeGlobalConfig(true)
+}
+
 func (as *AdminServer) writeGlobalConfig(backup bool) (err error) {
     as.ConfigFileMu.Lock()
     defer as.ConfigFileMu.Unlock()
@@ -314,9 +399,22 @@ func (as *AdminServer) WriteGlobalConfigFile(c *gin.Context) {
 // Responses:
 // - CredListResponse.
 func (as *AdminServer) GetUsers(c *gin.Context) {
+
+    // Never return passwords, even legacy cleartext ones
+    users := make([]config.Credential, len(*as.Users))
+    totpUsers := []string{}
+    for i, cred := range *as.Users {
+        if cred.HasTotp() {
+            totpUsers = append(totpUsers, cred.Username)
+        }
+        cred.Password = ""
+        users[i] = cred
+    }
+
     c.JSON(http.StatusOK, structs.CredListResponse{
         BaseResponse: structs.BaseSuccessResponse(),
-        CredList:     structs.CredList{Users: *as.Users},
+        CredList:     structs.CredList{Users: users},
+        TotpUsers:    totpUsers,
         //ConfigUri:    as.Global.FileServer.Routes.Api.Config,
     })
 }
@@ -385,11 +483,51 @@ func (as *AdminServer) SaveUsers(c *gin.Context) {
         return
     }
 
+    //==================
+    // HASH NEW PASSWORDS
+    //==================
+    // A password is supplied only when it's being changed. Otherwise,
+    // the current password of the user is retained.
+
+    // Legacy cleartext passwords are hashed along the way. TOTP
+    // secrets are managed through their own routes and retained.
+    for i := range payload.Users {
+        cred := &payload.Users[i]
+        cur, exists := as.Global.GetUser(cred.Username)
+        cred.PasswordHash, cred.TotpSecret = "", cur.TotpSecret
+        if cred.Password == "" {
+            if exists {
+                cred.Password = cur.Password
+                cred.PasswordHash = cur.PasswordHash
+            } else {
+                c.JSON(http.StatusBadRequest, structs.BaseResponse{
+                    Message: fmt.Sprintf("A password is required for new user %s", cred.Username)})
+                return
+            }
+        }
+        if _, err := cred.MigratePassword(); err != nil {
+            log.ERR.Printf("Failed to hash password: %v", err)
+            c.JSON(http.StatusInternalServerError, structs.BaseResponse{Message: "Failed to hash password."})
+            return
+        }
+    }
+
+    //===============================
+    // CHECK OBFUSCATION PROFILE NAMES
+    //===============================
+
+    if err := as.Global.CheckProfiles(payload.Users); err != nil {
+        c.JSON(http.StatusBadRequest, structs.BaseResponse{Message: err.Error()})
+        return
+    }
+
     //==============================================
     // CHECKS PASSED -- UPDATE CURRENT LIST OF USERS
     //==============================================
 
+    prev := *as.Users
     *as.Users = payload.Users
+    revokeStaleSessions(as.Sessions, prev, payload.Users)
 
     go func() {
         as.writeGlobalConfig(false)
@@ -425,7 +563,7 @@ func (as *AdminServer) GetObfuscators(c *gin.Context) {
     // INTROSPECT THE OBFUSCATOR CHAIN INTO A JSON OBJECT
     //===================================================
 
-    obfs := obfs.UnparseObfuscators(as.ObfuscatorChain)
+    obfs := obfs.UnparseObfuscators(as.ObfuscatorChain.Load())
 
     c.JSON(http.StatusOK, structs.GetObfuscatorsResponse{
         BaseResponse: structs.BaseResponse{
@@ -502,8 +640,11 @@ func (as *AdminServer) SaveObfuscators(c *gin.Context) {
         // SET NEW OBFUSCATOR CHAIN
         //=========================
 
+        as.obfsMu.Lock()
+        as.Profiles.Retire(config.DefaultProfile, as.ObfuscatorChain.Load(), as.Global.FileServer.RotationOptions.Grace())
         as.Global.FileServer.Obfuscators = p.Obfuscators
-        *as.ObfuscatorChain = *latest
+        as.ObfuscatorChain.Store(latest)
+        as.obfsMu.Unlock()
 
     }
 
@@ -523,6 +664,162 @@ func (as *AdminServer) SaveObfuscators(c *gin.Context) {
 
 }
 
+// GetObfuscationProfiles returns all named obfuscation profiles.
+// The default profile is managed via GetObfuscators and
+// SaveObfuscators.
+//
+// Responses:
+//
+// - ObfuscationProfilesResponse
+func (as *AdminServer) GetObfuscationProfiles(c *gin.Context) {
+    c.JSON(http.StatusOK, structs.ObfuscationProfilesResponse{
+        BaseResponse: structs.BaseResponse{
+            Success: true,
+            Message: "Listing obfuscation profiles.",
+        },
+        Profiles: as.Global.FileServer.ObfuscationProfiles,
+    })
+}
+
+// SaveObfuscationProfile creates or replaces the obfuscation
+// profile identified by the name route parameter. Only users
+// assigned to the profile are affected.
+//
+// Responses:
+//
+// - Upon success, SaveObfuscatorsResponse.
+// - Upon error, structs.BaseResponse.
+func (as *AdminServer) SaveObfuscationProfile(c *gin.Context) {
+
+    name := c.Param("name")
+    if name == config.DefaultProfile {
+        c.JSON(http.StatusBadRequest, structs.BaseResponse{
+            Message: "Use /admin/obfs/config to manage the default obfuscation profile."})
+        return
+    }
+
+    p := structs.ObfuscatorsPayload{}
+    if err := c.BindJSON(&p); err != nil {
+        msg := fmt.Sprintf("Failed to parse JSON payload while saving obfuscation profile: %v", err)
+        log.INFO.Print(msg)
+        c.JSON(http.StatusBadRequest, structs.BaseResponse{Message: msg})
+        return
+    }
+
+    latest, failures := obfs.ParseObfuscators(&p.Obfuscators)
+    if len(failures) > 0 {
+        msg := fmt.Sprintf("Failed to parse obfuscators: %s", strings.Join(failures, ", "))
+        log.ERR.Print(msg)
+        c.JSON(http.StatusBadRequest, structs.BaseResponse{Message: msg})
+        return
+    }
+
+    //===========================
+    // SET THE PROFILE'S NEW CHAIN
+    //===========================
+
+    as.obfsMu.Lock()
+    profiles := &as.Global.FileServer.ObfuscationProfiles
+    prof := config.ObfuscationProfile{Name: name, Obfuscators: p.Obfuscators}
+    if i := slices.IndexFunc(*profiles, func(p config.ObfuscationProfile) bool { return p.Name == name }); i < 0 {
+        *profiles = append(*profiles, prof)
+    } else {
+        (*profiles)[i] = prof
+    }
+    if prev, ok := as.Profiles.Get(name); ok {
+        as.Profiles.Retire(name, prev, as.Global.FileServer.RotationOptions.Grace())
+    }
+    as.Profiles.Set(name, latest)
+    as.obfsMu.Unlock()
+
+    msg := fmt.Sprintf("Set the obfuscation chain of profile %s", name)
+    log.WARN.Print(msg)
+
+    go func() {
+        as.writeGlobalConfig(false)
+    }()
+
+    c.JSON(http.StatusOK, structs.SaveObfuscatorsResponse{
+        BaseResponse: structs.BaseResponse{
+            Success: true,
+            Message: msg,
+        },
+        ObfuscatorsPayload: structs.ObfuscatorsPayload{
+            Obfuscators: *obfs.UnparseObfuscators(latest),
+        },
+    })
+}
+
+// DeleteObfuscationProfile deletes the obfuscation profile
+// identified by the name route parameter. Profiles assigned to
+// users can't be deleted.
+//
+// Responses:
+//
+// - structs.BaseResponse
+func (as *AdminServer) DeleteObfuscationProfile(c *gin.Context) {
+
+    name := c.Param("name")
+    as.obfsMu.Lock()
+    defer as.obfsMu.Unlock()
+    profiles := &as.Global.FileServer.ObfuscationProfiles
+    i := slices.IndexFunc(*profiles, func(p config.ObfuscationProfile) bool { return p.Name == name })
+    if i < 0 {
+        c.JSON(http.StatusNotFound, structs.BaseResponse{Message: "Unknown obfuscation profile."})
+        return
+    }
+
+    for _, cred := range *as.Users {
+        if cred.Profile == name {
+            c.JSON(http.StatusBadRequest, structs.BaseResponse{
+                Message: fmt.Sprintf("Obfuscation profile is assigned to user %s", cred.Username)})
+            return
+        }
+    }
+
+    *profiles = slices.Delete(*profiles, i, i+1)
+    as.Profiles.Delete(name)
+    log.WARN.Printf("Deleted obfuscation profile %s", name)
+
+    go func() {
+        as.writeGlobalConfig(false)
+    }()
+    c.JSON(http.StatusOK, structs.BaseSuccessResponse())
+}
+
+// RotateObfuscators generates fresh keys for the default chain and
+// each obfuscation profile via RotateChains and writes them to the
+// config file. Replaced chains remain accepted by the file server
+// for the configured grace period.
+func (as *AdminServer) RotateObfuscators() error {
+    as.obfsMu.Lock()
+    err := RotateChains(as.Global, as.ObfuscatorChain, as.Profiles)
+    as.obfsMu.Unlock()
+    if err != nil {
+        return err
+    }
+    return as.writeGlobalConfig(false)
+}
+
+// RotateObfuscatorsHandler rotates the obfuscation keys on demand.
+//
+// Responses:
+//
+// - structs.BaseResponse
+func (as *AdminServer) RotateObfuscatorsHandler(c *gin.Context) {
+    if err := as.RotateObfuscators(); err != nil {
+        msg := fmt.Sprintf("Failed to rotate obfuscation keys: %v", err)
+        log.ERR.Print(msg)
+        c.JSON(http.StatusInternalServerError, structs.BaseResponse{Message: msg})
+        return
+    }
+    c.JSON(http.StatusOK, structs.BaseResponse{
+        Success: true,
+        Message: fmt.Sprintf("Rotated obfuscation keys; previous keys are accepted for %v",
+            as.Global.FileServer.RotationOptions.Grace()),
+    })
+}
+
 func (as *AdminServer) GetAdvancedConfig(c *gin.Context) {
     c.JSON(http.StatusOK, structs.AdvancedConfigResponse{
         BaseResponse: structs.BaseResponse{
@@ -530,11 +827,75 @@ func (as *AdminServer) GetAdvancedConfig(c *gin.Context) {
             Message: "Current advanced configurations returned.",
         },
         ApiRoutes:   as.Global.FileServer.Routes.Api,
-        Obfuscators: *obfs.UnparseObfuscators(as.ObfuscatorChain),
+        Obfuscators: *obfs.UnparseObfuscators(as.ObfuscatorChain.Load()),
         AuthConfig: config.SafeAuthOptions{
-            Header: as.Global.Auth.Header,
-            Jwt:    as.Global.Auth.Jwt.SafeJwtOptions,
+            Header:  as.Global.Auth.Header,
+            Jwt:     as.Global.Auth.Jwt.SafeJwtOptions,
+            Totp:    as.Global.Auth.Totp,
+            Lockout: as.Global.Auth.Lockout,
+        },
+    })
+}
+
+// GetAuditLog queries the audit log. The following query parameters
+// filter the returned records:
+//
+// - event - Event type, e.g., "download_chunk".
+// - user - Username.
+// - path - Path to a file, relative to the webroot.
+// - since/until - RFC3339 timestamps bounding the records.
+// - limit - Maximum number of records to return, defaulting to 1000.
+//   The most recent records are returned.
+//
+// Responses:
+//
+// - AuditLogResponse
+func (as *AdminServer) GetAuditLog(c *gin.Context) {
+
+    //==========================
+    // PARSE THE QUERY PARAMETERS
+    //==========================
+
+    q := audit.Query{
+        Event: audit.Event(c.Query("event")),
+        User:  c.Query("user"),
+        Path:  c.Query("path"),
+        Limit: 1000,
+    }
+
+    var err error
+    if v := c.Query("limit"); v != "" {
+        if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit < 0 {
+            c.JSON(http.StatusBadRequest, structs.BaseResponse{Message: "Invalid limit."})
+            return
+        }
+    }
+    for param, t := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+        if v := c.Query(param); v != "" {
+            if *t, err = time.Parse(time.RFC3339, v); err != nil {
+                c.JSON(http.StatusBadRequest, structs.BaseResponse{
+                    Message: fmt.Sprintf("Invalid %s timestamp; RFC3339 is required.", param)})
+                return
+            }
+        }
+    }
+
+    //===================
+    // QUERY THE AUDIT LOG
+    //===================
+
+    records, err := audit.Search(q)
+    if err != nil {
+        c.JSON(http.StatusNotFound, structs.BaseResponse{Message: err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, structs.AuditLogResponse{
+        BaseResponse: structs.BaseResponse{
+            Success: true,
+            Message: fmt.Sprintf("Returning %d audit record(s).", len(records)),
         },
+        Records: records,
     })
 }
 
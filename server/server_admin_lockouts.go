@@ -0,0 +1,50 @@
+package server
+
+import (
+    "fmt"
+    structs "github.com/blackhillsinfosec/skyhook/api_structs"
+    "github.com/blackhillsinfosec/skyhook/audit"
+    "github.com/blackhillsinfosec/skyhook/log"
+    mw "github.com/blackhillsinfosec/skyhook/server/middleware"
+    "github.com/gin-gonic/gin"
+    "net/http"
+)
+
+// ListLockouts returns the usernames and client IP addresses with
+// recent failed logins to either server, including those that are
+// locked out.
+//
+// Responses:
+//
+// - LockoutsResponse
+func (as *AdminServer) ListLockouts(c *gin.Context) {
+    entries := as.Lockouts.List(mw.LockoutPolicy(&as.Global.Auth.Lockout))
+    c.JSON(http.StatusOK, structs.LockoutsResponse{
+        BaseResponse: structs.BaseResponse{
+            Success: true,
+            Message: fmt.Sprintf("Listing %d throttled username(s) and address(es).", len(entries)),
+        },
+        Lockouts: entries,
+    })
+}
+
+// ClearLockout forgets the failed logins of the username or IP
+// address identified by the kind ("user" or "ip") and key route
+// parameters, lifting any lockout.
+//
+// Responses:
+//
+// - structs.BaseResponse
+func (as *AdminServer) ClearLockout(c *gin.Context) {
+    kind, key := c.Param("kind"), c.Param("key")
+    if !as.Lockouts.Clear(kind, key) {
+        c.JSON(http.StatusNotFound, structs.BaseResponse{Message: "Unknown lockout."})
+        return
+    }
+
+    log.WARN.Printf("Cleared lockout of %s %s", kind, key)
+    r := newAuditRecord(c, "admin", audit.EventLockoutClear, as.Global.Auth.Jwt.FieldKeys.Username)
+    r.Message = fmt.Sprintf("lockout of %s %s cleared by administrator", kind, key)
+    audit.Log(r)
+    c.JSON(http.StatusOK, structs.BaseSuccessResponse())
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+    "fmt"
+    structs "github.com/blackhillsinfosec/skyhook/api_structs"
+    "github.com/blackhillsinfosec/skyhook/audit"
+    "github.com/blackhillsinfosec/skyhook/config"
+    "github.com/blackhillsinfosec/skyhook/log"
+    "github.com/blackhillsinfosec/skyhook/server/session"
+    "github.com/gin-gonic/gin"
+    "net/http"
+)
+
+// ListSessions returns the active sessions of both servers.
+//
+// Responses:
+//
+// - SessionsResponse
+func (as *AdminServer) ListSessions(c *gin.Context) {
+    sessions := as.Sessions.List()
+    c.JSON(http.StatusOK, structs.SessionsResponse{
+        BaseResponse: structs.BaseResponse{
+            Success: true,
+            Message: fmt.Sprintf("Listing %d session(s).", len(sessions)),
+        },
+        Sessions: sessions,
+    })
+}
+
+// RevokeSession ends the session identified by the id route
+// parameter, rejecting its token and any refreshed from it.
+//
+// Responses:
+//
+// - structs.BaseResponse
+func (as *AdminServer) RevokeSession(c *gin.Context) {
+    id := c.Param("id")
+    if !as.Sessions.Revoke(id) {
+        c.JSON(http.StatusNotFound, structs.BaseResponse{Message: "Unknown session."})
+        return
+    }
+
+    log.WARN.Printf("Revoked session %s", id)
+    r := newAuditRecord(c, "admin", audit.EventSessionRevoke, as.Global.Auth.Jwt.FieldKeys.Username)
+    r.Message = fmt.Sprintf("session %s revoked by administrator", id)
+    audit.Log(r)
+    c.JSON(http.StatusOK, structs.BaseSuccessResponse())
+}
+
+// revokeStaleSessions ends the sessions of users in prev that have
+// been removed from next, or whose password or admin access changed.
+func revokeStaleSessions(sessions *session.Store, prev, next []config.Credential) {
+    if sessions == nil {
+        return
+    }
+
+    current := make(map[string]config.Credential, len(next))
+    for _, cred := range next {
+        current[cred.Username] = cred
+    }
+
+    for _, old := range prev {
+        var reason string
+        if cred, ok := current[old.Username]; !ok {
+            reason = "user removed"
+        } else if passwordChanged(old, cred) {
+            reason = "password changed"
+        } else if cred.IsAdmin != old.IsAdmin {
+            reason = "admin access changed"
+        } else {
+            continue
+        }
+
+        if n := sessions.RevokeUser(old.Username); n > 0 {
+            log.WARN.Printf("Revoked %d session(s) of %s: %s", n, old.Username, reason)
+            audit.Log(audit.Record{
+                Event:   audit.EventSessionRevoke,
+                User:    old.Username,
+                Message: fmt.Sprintf("%d session(s) revoked: %s", n, reason),
+            })
+        }
+    }
+}
+
+// passwordChanged determines if next has a different password than
+// prev. Hashing a legacy cleartext password isn't a change.
+func passwordChanged(prev, next config.Credential) bool {
+    if prev.PasswordHash == "" && prev.Password != "" && next.Password == "" {
+        return !next.CheckPassword(prev.Password)
+    }
+    return prev.PasswordHash != next.PasswordHash || prev.Password != next.Password
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+    "fmt"
+    obfuscate "github.com/blackhillsinfosec/skyhook-obfuscation"
+    structs "github.com/blackhillsinfosec/skyhook/api_structs"
+    "github.com/blackhillsinfosec/skyhook/audit"
+    "github.com/blackhillsinfosec/skyhook/log"
+    "github.com/blackhillsinfosec/skyhook/server/inspector"
+    "github.com/blackhillsinfosec/skyhook/server/share"
+    "github.com/gin-gonic/gin"
+    "net/http"
+    "net/url"
+    "os"
+    "path"
+    "strings"
+    "time"
+)
+
+// ListShares returns the unexpired share tokens along with links
+// to their files.
+//
+// Responses:
+//
+// - SharesResponse
+func (as *AdminServer) ListShares(c *gin.Context) {
+    shares := as.Shares.List()
+    resp := structs.SharesResponse{
+        BaseResponse: structs.BaseResponse{
+            Success: true,
+            Message: fmt.Sprintf("Listing %d share(s).", len(shares)),
+        },
+        Shares: make([]structs.ShareLinks, 0, len(shares)),
+    }
+    for _, sh := range shares {
+        resp.Shares = append(resp.Shares, structs.ShareLinks{Share: sh, Links: as.shareLinks(sh)})
+    }
+    c.JSON(http.StatusOK, resp)
+}
+
+// CreateShare mints a share token for a file in the webroot as
+// described by the ShareRequest payload.
+//
+// Responses:
+//
+// - Upon success, ShareResponse.
+// - Upon error, structs.BaseResponse.
+func (as *AdminServer) CreateShare(c *gin.Context) {
+    req := structs.ShareRequest{}
+    if err := c.BindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, structs.BaseResponse{
+            Message: fmt.Sprintf("Failed to parse JSON payload: %v", err)})
+        return
+    } else if req.Hours == 0 {
+        c.JSON(http.StatusBadRequest, structs.BaseResponse{Message: "Hours must be greater than zero."})
+        return
+    }
+
+    // Only regular files can be shared
+    req.Path = path.Clean("/" + req.Path)
+    abs, err := inspector.ToAbs(as.Global.FileServer.RootDir, req.Path)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, structs.BaseResponse{Message: err.Error()})
+        return
+    } else if stat, err := os.Stat(abs); err != nil || !stat.Mode().IsRegular() {
+        c.JSON(http.StatusNotFound, structs.BaseResponse{Message: "Path isn't a file within the webroot."})
+        return
+    }
+
+    sh, err := as.Shares.Mint(req.Path, time.Duration(req.Hours)*time.Hour, req.SingleUse, req.MaxBytes)
+    if err != nil {
+        log.ERR.Printf("Failed to mint share token: %v", err)
+        c.JSON(http.StatusInternalServerError, structs.BaseResponse{Message: "Failed to mint share token."})
+        return
+    }
+
+    log.WARN.Printf("Shared %s until %v", sh.Path, sh.Expiration)
+    as.auditShare(c, audit.EventShareCreate, sh)
+    c.JSON(http.StatusOK, structs.ShareResponse{
+        BaseResponse: structs.BaseResponse{
+            Success: true,
+            Message: fmt.Sprintf("Share expires at %s.", sh.Expiration.Format(time.RFC3339)),
+        },
+        Share: structs.ShareLinks{Share: sh, Links: as.shareLinks(sh)},
+    })
+}
+
+// RevokeShare revokes the share token identified by the token route
+// parameter.
+//
+// Responses:
+//
+// - structs.BaseResponse
+func (as *AdminServer) RevokeShare(c *gin.Context) {
+    sh, ok := as.Shares.Get(c.Param("token"))
+    if !ok || !as.Shares.Revoke(sh.Token) {
+        c.JSON(http.StatusNotFound, structs.BaseResponse{Message: "Unknown share token."})
+        return
+    }
+    log.WARN.Printf("Revoked share of %s", sh.Path)
+    as.auditShare(c, audit.EventShareRevoke, sh)
+    c.JSON(http.StatusOK, structs.BaseSuccessResponse())
+}
+
+// shareLinks returns a link to the file of sh for each entry in
+// LinkFqdns, keyed by FQDN. The path of the file is obfuscated with
+// the current default chain.
+func (as *AdminServer) shareLinks(sh share.Share) map[string]string {
+    obfPath, err := obfuscate.Obfuscate([]byte(sh.Path), *as.ObfuscatorChain.Load())
+    if err != nil {
+        log.ERR.Printf("Failed to obfuscate the path of a share: %v", err)
+        return nil
+    }
+
+    route := strings.TrimRight(as.Global.FileServer.Routes.Api.Share, "/")
+    links := make(map[string]string, len(as.Global.FileServer.LinkFqdns))
+    for _, fqdn := range as.Global.FileServer.LinkFqdns {
+        links[fqdn] = fmt.Sprintf("https://%s%s/%s/%s", fqdn, route, sh.Token, url.PathEscape(string(obfPath)))
+    }
+    return links
+}
+
+// auditShare records event for sh to the audit log. Only a prefix
+// of the token is recorded.
+func (as *AdminServer) auditShare(c *gin.Context, event audit.Event, sh share.Share) {
+    r := newAuditRecord(c, "admin", event, as.Global.Auth.Jwt.FieldKeys.Username)
+    r.Path = sh.Path
+    r.Message = fmt.Sprintf("share token %s, expires %s, single use %t, max bytes %d",
+        sh.Token[:min(len(sh.Token), 8)], sh.Expiration.Format(time.RFC3339), sh.SingleUse, sh.MaxBytes)
+    audit.Log(r)
+}
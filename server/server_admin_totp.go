@@ -0,0 +1,97 @@
+package server
+
+import (
+    "fmt"
+    structs "github.com/blackhillsinfosec/skyhook/api_structs"
+    "github.com/blackhillsinfosec/skyhook/audit"
+    "github.com/blackhillsinfosec/skyhook/config"
+    "github.com/blackhillsinfosec/skyhook/log"
+    "github.com/gin-gonic/gin"
+    "net/http"
+)
+
+// EnrollTotp generates a TOTP secret for the user identified by the
+// username route parameter, replacing any current secret. Both login
+// routes require a TOTP code from the user thereafter.
+//
+// The secret is returned only once, along with its provisioning URI.
+//
+// Responses:
+//
+// - Upon success, TotpEnrollResponse.
+// - Upon error, structs.BaseResponse.
+func (as *AdminServer) EnrollTotp(c *gin.Context) {
+    cred := as.findUser(c.Param("username"))
+    if cred == nil {
+        c.JSON(http.StatusNotFound, structs.BaseResponse{Message: "Unknown user."})
+        return
+    }
+
+    secret, err := config.GenerateTotpSecret()
+    if err != nil {
+        log.ERR.Printf("Failed to generate TOTP secret: %v", err)
+        c.JSON(http.StatusInternalServerError, structs.BaseResponse{Message: "Failed to generate TOTP secret."})
+        return
+    }
+    cred.TotpSecret = secret
+
+    go func() {
+        as.writeGlobalConfig(false)
+    }()
+
+    log.WARN.Printf("Enrolled TOTP secret for %s", cred.Username)
+    as.auditTotp(c, audit.EventTotpEnroll, cred.Username)
+    c.JSON(http.StatusOK, structs.TotpEnrollResponse{
+        BaseResponse: structs.BaseResponse{
+            Success: true,
+            Message: fmt.Sprintf("TOTP enrolled for %s.", cred.Username),
+        },
+        Secret: secret,
+        Uri:    config.TotpUri(as.Global.Auth.Totp.Issuer, cred.Username, secret),
+    })
+}
+
+// DisableTotp removes the TOTP secret of the user identified by the
+// username route parameter.
+//
+// Responses:
+//
+// - structs.BaseResponse
+func (as *AdminServer) DisableTotp(c *gin.Context) {
+    cred := as.findUser(c.Param("username"))
+    if cred == nil {
+        c.JSON(http.StatusNotFound, structs.BaseResponse{Message: "Unknown user."})
+        return
+    } else if !cred.HasTotp() {
+        c.JSON(http.StatusBadRequest, structs.BaseResponse{Message: "User hasn't enrolled TOTP."})
+        return
+    }
+    cred.TotpSecret = ""
+
+    go func() {
+        as.writeGlobalConfig(false)
+    }()
+
+    log.WARN.Printf("Disabled TOTP for %s", cred.Username)
+    as.auditTotp(c, audit.EventTotpDisable, cred.Username)
+    c.JSON(http.StatusOK, structs.BaseSuccessResponse())
+}
+
+// findUser returns a pointer to the credential of username within
+// the current list of users, or nil when it doesn't exist.
+func (as *AdminServer) findUser(username string) *config.Credential {
+    for i := range *as.Users {
+        if (*as.Users)[i].Username == username {
+            return &(*as.Users)[i]
+        }
+    }
+    return nil
+}
+
+// auditTotp records event for the TOTP secret of username to the
+// audit log.
+func (as *AdminServer) auditTotp(c *gin.Context, event audit.Event, username string) {
+    r := newAuditRecord(c, "admin", event, as.Global.Auth.Jwt.FieldKeys.Username)
+    r.Message = "totp of " + username
+    audit.Log(r)
+}
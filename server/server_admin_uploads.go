@@ -0,0 +1,127 @@
+package server
+
+import (
+    "fmt"
+    structs "github.com/blackhillsinfosec/skyhook/api_structs"
+    "github.com/blackhillsinfosec/skyhook/audit"
+    "github.com/blackhillsinfosec/skyhook/log"
+    "github.com/blackhillsinfosec/skyhook/server/upload"
+    "github.com/gin-gonic/gin"
+    "net/http"
+    "path"
+    "sort"
+    "time"
+)
+
+// ListUploads returns every upload registered with the file server,
+// sorted by path, along with the number of bytes received.
+//
+// Responses:
+//
+// - AdminUploadsResponse
+func (as *AdminServer) ListUploads(c *gin.Context) {
+    ups := as.UploadManager.ListAll()
+    sort.Slice(ups, func(i, j int) bool { return ups[i].RelPath < ups[j].RelPath })
+
+    resp := structs.AdminUploadsResponse{
+        BaseResponse: structs.BaseResponse{
+            Success: true,
+            Message: fmt.Sprintf("Listing %d upload(s).", len(ups)),
+        },
+        Uploads: make([]structs.AdminUpload, 0, len(ups)),
+    }
+    for _, up := range ups {
+        resp.Uploads = append(resp.Uploads, newAdminUpload(up))
+    }
+    c.JSON(http.StatusOK, resp)
+}
+
+// ExtendUpload postpones the expiration of an upload by the number
+// of hours in the AdminUploadRequest payload.
+//
+// Responses:
+//
+// - Upon success, AdminUploadResponse.
+// - Upon error, structs.BaseResponse.
+func (as *AdminServer) ExtendUpload(c *gin.Context) {
+    req, ok := bindAdminUploadRequest(c)
+    if !ok {
+        return
+    } else if req.Hours == 0 {
+        c.JSON(http.StatusBadRequest, structs.BaseResponse{Message: "Hours must be greater than zero."})
+        return
+    }
+
+    up, err := as.UploadManager.Extend(req.Path, time.Duration(req.Hours)*time.Hour)
+    if err == upload.ErrUnknownUpload {
+        c.JSON(http.StatusNotFound, structs.BaseResponse{Message: "Unknown upload."})
+        return
+    } else if err != nil {
+        log.ERR.Printf("Failed to extend upload %s: %v", req.Path, err)
+        c.JSON(http.StatusInternalServerError, structs.BaseResponse{Message: err.Error()})
+        return
+    }
+
+    as.auditUpload(c, audit.EventUploadExtend, req.Path,
+        fmt.Sprintf("expiration extended to %s", up.Expiration.Format(time.RFC3339)))
+    c.JSON(http.StatusOK, structs.AdminUploadResponse{
+        BaseResponse: structs.BaseResponse{
+            Success: true,
+            Message: fmt.Sprintf("Upload expires at %s.", up.Expiration.Format(time.RFC3339)),
+        },
+        Upload: newAdminUpload(up),
+    })
+}
+
+// CancelUpload force-cancels an upload on behalf of its owner,
+// removing any chunks written to disk.
+//
+// Responses:
+//
+// - structs.BaseResponse
+func (as *AdminServer) CancelUpload(c *gin.Context) {
+    req, ok := bindAdminUploadRequest(c)
+    if !ok {
+        return
+    }
+
+    if err := as.UploadManager.CancelUpload(req.Path); err == upload.ErrUnknownUpload {
+        c.JSON(http.StatusNotFound, structs.BaseResponse{Message: "Unknown upload."})
+        return
+    } else if err != nil {
+        log.ERR.Printf("Failed to cancel upload %s: %v", req.Path, err)
+        c.JSON(http.StatusInternalServerError, structs.BaseResponse{Message: err.Error()})
+        return
+    }
+
+    log.WARN.Printf("Upload %s canceled by an administrator", req.Path)
+    as.auditUpload(c, audit.EventUploadCancel, req.Path, "canceled by administrator")
+    c.JSON(http.StatusOK, structs.BaseResponse{Success: true, Message: "Upload canceled."})
+}
+
+// bindAdminUploadRequest parses the AdminUploadRequest payload of c,
+// cleaning its path. A response is sent when parsing fails.
+func bindAdminUploadRequest(c *gin.Context) (req structs.AdminUploadRequest, ok bool) {
+    if err := c.BindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, structs.BaseResponse{
+            Message: fmt.Sprintf("Failed to parse JSON payload: %v", err)})
+        return req, false
+    } else if req.Path == "" {
+        c.JSON(http.StatusBadRequest, structs.BaseResponse{Message: "An upload path is required."})
+        return req, false
+    }
+    req.Path = path.Clean("/" + req.Path)
+    return req, true
+}
+
+// auditUpload records event for the upload at rel to the audit log.
+func (as *AdminServer) auditUpload(c *gin.Context, event audit.Event, rel, msg string) {
+    r := newAuditRecord(c, "admin", event, as.Global.Auth.Jwt.FieldKeys.Username)
+    r.Path, r.Message = rel, msg
+    audit.Log(r)
+}
+
+// newAdminUpload describes the progress of up to administrators.
+func newAdminUpload(up upload.Upload) structs.AdminUpload {
+    return structs.AdminUpload{Upload: up, BytesReceived: up.BytesReceived()}
+}
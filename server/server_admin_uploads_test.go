@@ -0,0 +1,121 @@
+package server
+
+import (
+    "bytes"
+    "encoding/json"
+    structs "github.com/blackhillsinfosec/skyhook/api_structs"
+    "github.com/blackhillsinfosec/skyhook/config"
+    "github.com/blackhillsinfosec/skyhook/server/upload"
+    "github.com/gin-gonic/gin"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+// adminUploadsEngine returns an engine serving the upload routes of
+// an admin server sharing the upload manager of ss, and a function
+// sending requests to it that unmarshals responses into dst.
+func adminUploadsEngine(t *testing.T, ss *SkyhookServer) func(method, body string, dst interface{}) int {
+    gin.SetMode(gin.TestMode)
+    as := &AdminServer{Global: &config.SkyhookConfig{}, UploadManager: ss.UploadManager}
+    r := gin.New()
+    r.GET("/uploads", as.ListUploads)
+    r.PATCH("/uploads", as.ExtendUpload)
+    r.DELETE("/uploads", as.CancelUpload)
+
+    return func(method, body string, dst interface{}) int {
+        rec := httptest.NewRecorder()
+        r.ServeHTTP(rec, httptest.NewRequest(method, "/uploads", bytes.NewReader([]byte(body))))
+        if dst != nil {
+            if err := json.Unmarshal(rec.Body.Bytes(), dst); err != nil {
+                t.Fatal(err)
+            }
+        }
+        return rec.Code
+    }
+}
+
+func TestAdminServer_ListUploads(t *testing.T) {
+    ss := testUploadServer(t, upload.Limits{})
+    send := adminUploadsEngine(t, ss)
+    for _, rel := range []string{"/b", "/a"} {
+        if _, err := ss.UploadManager.Register(filepath.Join(*ss.Webroot, rel), rel, 10, *ss.Webroot, "op"); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := ss.UploadManager.SaveChunk("/a", make([]byte, 5), 0); err != nil {
+        t.Fatal(err)
+    }
+
+    resp := structs.AdminUploadsResponse{}
+    if code := send(http.MethodGet, "", &resp); code != http.StatusOK {
+        t.Fatalf("listing answered with %d", code)
+    } else if len(resp.Uploads) != 2 || resp.Uploads[0].RelPath != "/a" || resp.Uploads[1].RelPath != "/b" {
+        t.Fatalf("uploads weren't listed by path: %+v", resp.Uploads)
+    }
+
+    a := resp.Uploads[0]
+    if a.Owner != "op" || a.BytesReceived != 5 || a.Size != 10 || a.Started.IsZero() || a.LastChunk.IsZero() {
+        t.Errorf("unexpected progress of /a: %+v", a)
+    }
+    if b := resp.Uploads[1]; b.BytesReceived != 0 || !b.LastChunk.IsZero() {
+        t.Errorf("unexpected progress of /b: %+v", b)
+    }
+}
+
+func TestAdminServer_ExtendUpload(t *testing.T) {
+    ss := testUploadServer(t, upload.Limits{})
+    send := adminUploadsEngine(t, ss)
+    up, err := ss.UploadManager.Register(filepath.Join(*ss.Webroot, "a"), "/a", 0, *ss.Webroot, "op")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // Paths are cleaned before the upload is looked up
+    resp := structs.AdminUploadResponse{}
+    if code := send(http.MethodPatch, `{"path":"a","hours":2}`, &resp); code != http.StatusOK {
+        t.Fatalf("extension answered with %d", code)
+    } else if d := resp.Upload.Expiration.Sub(up.Expiration); d != 2*time.Hour {
+        t.Errorf("upload was extended by %v", d)
+    }
+    if cur, _ := ss.UploadManager.Get("/a"); !cur.Expiration.Equal(resp.Upload.Expiration) {
+        t.Error("extension wasn't applied to the registered upload")
+    }
+
+    for body, status := range map[string]int{
+        `{"path":"/a","hours":0}`:       http.StatusBadRequest,
+        `{"hours":1}`:                   http.StatusBadRequest,
+        `{"path":"/missing","hours":1}`: http.StatusNotFound,
+        `not json`:                      http.StatusBadRequest,
+    } {
+        if code := send(http.MethodPatch, body, nil); code != status {
+            t.Errorf("%s: got %d, want %d", body, code, status)
+        }
+    }
+}
+
+func TestAdminServer_CancelUpload(t *testing.T) {
+    ss := testUploadServer(t, upload.Limits{})
+    send := adminUploadsEngine(t, ss)
+    abs := filepath.Join(*ss.Webroot, "a")
+    if _, err := ss.UploadManager.Register(abs, "/a", 0, *ss.Webroot, "op"); err != nil {
+        t.Fatal(err)
+    } else if err = ss.UploadManager.SaveChunk("/a", []byte("chunk"), 0); err != nil {
+        t.Fatal(err)
+    }
+
+    if code := send(http.MethodDelete, `{"path":"/a"}`, nil); code != http.StatusOK {
+        t.Fatalf("cancellation answered with %d", code)
+    } else if ss.UploadManager.RegistrantExists("/a") {
+        t.Error("canceled upload remains registered")
+    } else if _, err := os.Stat(abs); !os.IsNotExist(err) {
+        t.Error("chunks of the canceled upload weren't removed")
+    }
+
+    if code := send(http.MethodDelete, `{"path":"/a"}`, nil); code != http.StatusNotFound {
+        t.Errorf("cancellation of an unknown upload answered with %d", code)
+    }
+}
@@ -2,21 +2,29 @@ package server
 
 import (
     "bytes"
+    "context"
     "embed"
     "encoding/json"
+    "errors"
     "fmt"
     jwt "github.com/appleboy/gin-jwt/v2"
     obfuscate "github.com/blackhillsinfosec/skyhook-obfuscation"
     structs "github.com/blackhillsinfosec/skyhook/api_structs"
+    "github.com/blackhillsinfosec/skyhook/audit"
     "github.com/blackhillsinfosec/skyhook/config"
     "github.com/blackhillsinfosec/skyhook/log"
+    "github.com/blackhillsinfosec/skyhook/server/archive"
     "github.com/blackhillsinfosec/skyhook/server/chunk-fs"
     "github.com/blackhillsinfosec/skyhook/server/inspector"
     mw "github.com/blackhillsinfosec/skyhook/server/middleware"
+    "github.com/blackhillsinfosec/skyhook/server/lockout"
+    "github.com/blackhillsinfosec/skyhook/server/session"
+    "github.com/blackhillsinfosec/skyhook/server/share"
     "github.com/blackhillsinfosec/skyhook/server/upload"
     "github.com/gin-contrib/cors"
     "github.com/gin-gonic/gin"
     "github.com/impostorkeanu/go-commoners/rando"
+    "golang.org/x/crypto/acme/autocert"
     "golang.org/x/exp/maps"
     "golang.org/x/exp/slices"
     "io"
@@ -35,12 +43,27 @@ type SkyhookServer struct {
     Config          *config.FileServerOptions
     Tls             *config.ManualTlsOptions
     Users           *[]config.Credential
-    ObfuscatorChain *[]obfuscate.Obfuscator
+    // ObfuscatorChain holds the chain of the default obfuscation
+    // profile, which is replaced by the admin server and rotations.
+    ObfuscatorChain *mw.ObfChain
+    // Profiles holds the chains of named obfuscation profiles, which
+    // are selected by the profile assigned to each user.
+    Profiles        *ObfProfiles
     Webroot         *string
     UploadManager   *upload.Manager
-    WebrootFS       http.FileSystem
-    FileServer      http.Handler
+    // Shares holds the share tokens minted by the admin server.
+    // The share route is disabled when nil.
+    Shares          *share.Tokens
+    // Sessions tracks the tokens issued to users, allowing them to
+    // be revoked. It's shared with the admin server.
+    Sessions        *session.Store
+    // Lockouts throttles failed logins. It's shared with the admin
+    // server.
+    Lockouts        *lockout.Tracker
     Global          *config.SkyhookConfig
+    // CertManager provides certificates when Tls is in ACME
+    // mode. Tls.CertPath and Tls.KeyPath are used when nil.
+    CertManager *autocert.Manager
 
     LandingFiles          landingFiles
     LandingFileEncryption *config.LandingFileEncryptionOptions
@@ -49,20 +72,100 @@ type SkyhookServer struct {
     indexContent         []byte
     manifestContent      []byte
     assetManifestContent []byte
+
+    httpServer *http.Server
+    handler    *swapHandler
+    // archives pauses the generators of directory archives between
+    // chunk requests.
+    archives *archive.Streams
+    // decoy serves the cover site configured by DecoyOptions. It's
+    // nil when the decoy is disabled.
+    decoy http.Handler
 }
 
 func (ss *SkyhookServer) Run(detach bool) (err error) {
+
+    // The engine is built on a copy of ss, such that its handlers
+    // aren't affected by reloads replacing the fields of ss.
+    var r *gin.Engine
+    next := *ss
+    if r, err = next.buildEngine(); err != nil {
+        return err
+    }
+    *ss = next
+    ss.handler = newSwapHandler(r.Handler())
+
+    //============================
+    // MONITOR FOR EXPIRED UPLOADS
+    //============================
+
+    go func() {
+        log.INFO.Print("Starting upload expiration scanner")
+        ss.UploadManager.ScanExpired(time.Minute, nil)
+    }()
+
+    //===============
+    // RUN THE SERVER
+    //===============
+
+    ss.httpServer = &http.Server{
+        Addr:              ss.Config.Socket(),
+        Handler:           ss.handler,
+        TLSConfig:         nil,
+        ReadTimeout:       0,
+        ReadHeaderTimeout: 0,
+        WriteTimeout:      0,
+        IdleTimeout:       0,
+        MaxHeaderBytes:    0,
+        TLSNextProto:      nil,
+        ConnState:         nil,
+        ErrorLog:          log.FSERVER,
+        BaseContext:       nil,
+        ConnContext:       nil,
+    }
+
+    if detach {
+        go ss.runFileServer()
+    } else {
+        var err error
+        err = ss.runFileServer()
+        if err != nil && err != http.ErrServerClosed {
+            log.ERR.Printf("Error running file server: %v", err)
+        }
+    }
+    return nil
+}
+
+// buildEngine initializes the landing files and a gin.Engine with
+// all routes and middleware derived from the current config.
+//
+// gin panics when routes conflict, e.g., when two API routes are
+// configured with the same path. Such panics are returned as
+// errors.
+func (ss *SkyhookServer) buildEngine() (r *gin.Engine, err error) {
+    defer func() {
+        if rec := recover(); rec != nil {
+            r, err = nil, errors.New(fmt.Sprintf("failed to configure routes: %v", rec))
+        }
+    }()
+
     ss.Webroot = &ss.Config.RootDir
     ss.LandingFileEncryption = &ss.Config.EncryptedLoader
-    ss.LandingFileObf = &obfuscate.XOR{ss.LandingFileEncryption.Key}
+    ss.LandingFileObf = &obfuscate.XOR{Key: ss.LandingFileEncryption.Key}
+    if ss.archives == nil {
+        ss.archives = archive.NewStreams(archiveIdle)
+    }
 
     for realPath, fakePath := range ss.Config.Routes.LandingPage {
         jsLoaderTempUrls.Insert(realPath, fakePath)
     }
 
     // Use default Gin settings (default error and logging functionality)
-    r := gin.Default()
-    r.SetTrustedProxies(nil)
+    r = gin.Default()
+    if err = r.SetTrustedProxies(ss.Config.TrustedProxies); err != nil {
+        log.ERR.Printf("Failed to set trusted proxies on file server: %v", err)
+        return nil, err
+    }
 
     //==========================
     // MIDDLEWARE CONFIGURATIONS
@@ -72,52 +175,77 @@ func (ss *SkyhookServer) Run(detach bool) (err error) {
     // Reference: https://github.com/appleboy/gin-jwt
     var authMiddleWare *jwt.GinJWTMiddleware
     if authMiddleWare, err = jwt.New(&jwt.GinJWTMiddleware{
-        Timeout:       7 * (24 * time.Hour),
-        MaxRefresh:    7 * (24 * time.Hour),
+        Timeout:       ss.Global.Auth.Jwt.Lifetime(),
+        MaxRefresh:    ss.Global.Auth.Jwt.RefreshWindow(),
         IdentityKey:   ss.Global.Auth.Jwt.FieldKeys.Username,
         Realm:         ss.Global.Auth.Jwt.Realm,
         Key:           []byte(ss.Global.Auth.Jwt.SigningKey),
         TokenLookup:   fmt.Sprintf("header: %s", ss.Global.Auth.Header.Name),
         TokenHeadName: ss.Global.Auth.Header.Scheme,
-        Authorizator:  func(cred any, c *gin.Context) bool { return true },
-        Unauthorized:  mw.JwtIsUnauthorized,
-        Authenticator: mw.JwtLoginHandler(&ss.Global.Users, false),
+        Authorizator: mw.JwtSessionAuthorizator(ss.Sessions,
+            func(cred any, c *gin.Context) bool { return true }),
+        Unauthorized:  ss.unauthorized,
+        Authenticator: mw.JwtLoginHandler(ss.Global, ss.Lockouts, false),
         IdentityHandler: mw.JwtIdentityHandler(
             &ss.Global.Auth.Jwt.FieldKeys.Username,
             &ss.Global.Auth.Jwt.FieldKeys.Admin),
-        PayloadFunc: mw.JwtPayloadFunc(ss.Global)}); err != nil {
+        PayloadFunc: mw.JwtPayloadFunc(ss.Global, ss.Sessions, "file")}); err != nil {
 
         log.ERR.Printf("Failed to initialize JWT auth: %v", err)
-        return err
+        return nil, err
     }
 
-    if err := authMiddleWare.MiddlewareInit(); err != nil {
+    if err = authMiddleWare.MiddlewareInit(); err != nil {
         log.ERR.Printf("Failed to initialize Gin JWT middleware: %v", err)
-        return err
+        return nil, err
     }
 
-    // CORS MIDDLEWARE
-    var corsFqdns []string
-    corsFqdns = append(corsFqdns, "https://"+ss.Config.Socket())
-    corsFqdns = append(corsFqdns, ss.Config.AddtlCorsUrls...)
-    r.Use(cors.New(cors.Config{
-        //AllowWildcard:    true,
-        AllowOrigins:     corsFqdns,
-        AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "PATCH", "OPTIONS"},
-        AllowHeaders:     []string{"Content-Type", "Authorization"},
-        ExposeHeaders:    []string{"*", "Authorization", "Content-Length"},
-        AllowCredentials: true,
-        MaxAge:           12 * time.Hour,
+    // RESPONSE PROFILE MIDDLEWARE
+    // - Precedes all other middleware so that it wraps the writers
+    //   they install.
+    api := ss.Config.Routes.Api
+    r.Use(mw.ResponseProfile(&ss.Config.ResponseProfile, map[string]string{
+        "login":    "/login",
+        "logout":   api.Logout,
+        "download": api.Download,
+        "upload":   api.Upload,
+        "config":   api.OperatingConfig,
+        "manage":   api.Manage,
+        "share":    api.Share,
     }))
 
+    // CORS MIDDLEWARE
+    // - Cross-origin requests are refused when no origin is known,
+    //   e.g., for a Unix socket without additional CORS URLs.
+    if corsFqdns := corsOrigins(&ss.Config.ServerOptions); len(corsFqdns) > 0 {
+        r.Use(cors.New(cors.Config{
+            //AllowWildcard:    true,
+            AllowOrigins:     corsFqdns,
+            AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "PATCH", "OPTIONS"},
+            AllowHeaders:     []string{"Content-Type", "Authorization"},
+            ExposeHeaders:    []string{"*", "Authorization", "Content-Length"},
+            AllowCredentials: true,
+            MaxAge:           12 * time.Hour,
+        }))
+    }
+
     //=====================
     // ROUTE CONFIGURATIONS
     //=====================
 
     // Default route
-    r.NoRoute(authMiddleWare.MiddlewareFunc(), func(c *gin.Context) {
-        c.JSON(http.StatusNotFound, gin.H{})
-    })
+    // - When a decoy is configured, it answers every request that
+    //   matches no route, authenticated or not.
+    if ss.decoy, err = newDecoy(&ss.Config.DecoyOptions); err != nil {
+        log.ERR.Printf("Failed to initialize decoy: %v", err)
+        return nil, err
+    } else if ss.decoy != nil {
+        r.NoRoute(func(c *gin.Context) { ss.serveDecoy(c) })
+    } else {
+        r.NoRoute(authMiddleWare.MiddlewareFunc(), func(c *gin.Context) {
+            c.JSON(http.StatusNotFound, gin.H{})
+        })
+    }
 
     ss.initLandingFiles()
     for _, fakePath := range ss.Config.Routes.LandingPage {
@@ -137,7 +265,7 @@ func (ss *SkyhookServer) Run(detach bool) (err error) {
         if slices.Contains(maps.Values(ss.Config.Routes.LandingPage), "/index.html") {
             c.Redirect(302, "/index.html")
         } else {
-            c.Status(http.StatusNotFound)
+            ss.reject(c, http.StatusNotFound)
         }
     })
 
@@ -151,10 +279,14 @@ func (ss *SkyhookServer) Run(detach bool) (err error) {
     //
     //  Note that the routes are XOR encrypted with the user's
     //  token value.
-    r.GET("/login", authMiddleWare.RefreshHandler)
+    r.GET("/login", mw.JwtRefreshSession(authMiddleWare, ss.Sessions,
+        ss.Global.Auth.Jwt.SessionLifetime(), authMiddleWare.RefreshHandler))
     r.POST("/login", authMiddleWare.LoginHandler)
-    r.POST(ss.Config.Routes.Api.Logout, authMiddleWare.LogoutHandler)
+    r.POST(ss.Config.Routes.Api.Logout, auditLogout("file", authMiddleWare,
+        &ss.Global.Auth.Jwt.FieldKeys.Username,
+        mw.JwtRevokeSession(authMiddleWare, ss.Sessions, authMiddleWare.LogoutHandler)))
     r.GET(ss.Config.Routes.Api.OperatingConfig, authMiddleWare.MiddlewareFunc(),
+        ss.auditEvent(audit.EventConfigFetch),
         ss.GetOperatingConfig)
 
     //=============================
@@ -162,10 +294,10 @@ func (ss *SkyhookServer) Run(detach bool) (err error) {
     //=============================
 
     // SERVE OBFUSCATED FILE CHUNKS
-    // Root directory containing files to be served.
-    // - This object is responsible for deobfuscating requested file
+    // Each user is jailed to their own root directory, so the file
+    // and inspection servers are initialized for each request.
+    // - chunk_fs is responsible for deobfuscating requested file
     //   paths.
-    ss.WebrootFS = chunk_fs.New(*ss.Webroot, ss.ObfuscatorChain)
 
     filesRoute := ss.Config.Routes.Api.Download
     l := len(ss.Config.Routes.Api.Download)
@@ -173,24 +305,40 @@ func (ss *SkyhookServer) Run(detach bool) (err error) {
         filesRoute += "/"
     }
 
-    ss.FileServer = http.StripPrefix(filesRoute, http.FileServer(ss.WebrootFS))
-    inspectServer := http.StripPrefix(filesRoute, inspector.New(*ss.Webroot, ss.ObfuscatorChain))
-
     baseGroup := r.Group(filesRoute)
     baseGroup.Use(
         authMiddleWare.MiddlewareFunc(),
+        mw.UserCredential(&ss.Global.Users, &ss.Global.Auth.Jwt.FieldKeys.Username),
+        mw.ObfProfile(ss.profileChains, "filepath"),
         mw.UpdateRangeHeader(&ss.Config.RangeHeaderOptions.Name, &ss.Config.RangeHeaderOptions.RangePrefix),
         mw.ObfResponse(ss.ObfuscatorChain, true))
     {
         // GET indicates that we're looking to retrieve a chunk of a file
-        baseGroup.GET("*filepath", func(c *gin.Context) {
-            // TODO derive method of stopping requests for file chunks
-            //  on files that are registered as currently being uploaded
-            ss.FileServer.ServeHTTP(c.Writer, c.Request)
-        })
+        baseGroup.GET("*filepath",
+            ss.auditEvent(audit.EventDownloadChunk),
+            mw.Compression(&ss.Config.CompressionOptions),
+            func(c *gin.Context) {
+                // TODO derive method of stopping requests for file chunks
+                //  on files that are registered as currently being uploaded
+                cred := mw.CtxCredential(c)
+                webrootFS := chunk_fs.New(cred.Webroot(*ss.Webroot), mw.CtxObfChain(c, ss.ObfuscatorChain), cred.Perms())
+                http.StripPrefix(filesRoute, http.FileServer(webrootFS)).ServeHTTP(c.Writer, c.Request)
+            })
+        // POST indicates that we're looking to retrieve a chunk of an
+        // archive of a directory
+        baseGroup.POST("*filepath",
+            ss.auditEvent(audit.EventDownloadArchive),
+            mw.RangeHeader(&ss.Config.RangeHeaderOptions.Name, &ss.Config.RangeHeaderOptions.RangePrefix, true, true),
+            // Compression precedes DeobfReqBody such that only the
+            // response is compressed
+            mw.Compression(&ss.Config.CompressionOptions),
+            mw.DeobfReqBody(ss.ObfuscatorChain),
+            ss.DownloadArchive)
         // PATCH indicates that we're looking to inspect files
-        baseGroup.PATCH("*filepath", func(c *gin.Context) {
-            inspectServer.ServeHTTP(c.Writer, c.Request)
+        baseGroup.PATCH("*filepath", ss.auditEvent(audit.EventInspect), func(c *gin.Context) {
+            cred := mw.CtxCredential(c)
+            inspectServer := inspector.New(cred.Webroot(*ss.Webroot), mw.CtxObfChain(c, ss.ObfuscatorChain), cred.Perms())
+            http.StripPrefix(filesRoute, inspectServer).ServeHTTP(c.Writer, c.Request)
         })
     }
 
@@ -208,48 +356,139 @@ func (ss *SkyhookServer) Run(detach bool) (err error) {
     upGroup := r.Group(ss.Config.Routes.Api.Upload)
     upGroup.Use(
         authMiddleWare.MiddlewareFunc(),
+        mw.UserCredential(&ss.Global.Users, &ss.Global.Auth.Jwt.FieldKeys.Username),
+        mw.ObfProfile(ss.profileChains, "filePath"),
         mw.ObfResponse(ss.ObfuscatorChain, false),
         mw.DeobfUploadFilePath(ss.Webroot, "filePath", ss.ObfuscatorChain))
     {
         // GET indicates that we're listing all uploads
         upGroup.GET("", ss.ListUploads)
+        // GET with a path indicates that we're checking the status
+        // of an upload, i.e., which byte ranges have been received
+        upGroup.GET("/*filePath", ss.UploadStatus)
         // POST indicates that we're creating an upload
-        upGroup.PUT("/*filePath", ss.RegisterUpload)
+        upGroup.PUT("/*filePath",
+            ss.auditEvent(audit.EventUploadRegister),
+            mw.DeobfReqBody(ss.ObfuscatorChain),
+            ss.RegisterUpload)
         // PATCH indicates that an upload is finished
-        upGroup.PATCH("/*filePath", ss.UploadFinished)
+        upGroup.PATCH("/*filePath",
+            ss.auditEvent(audit.EventUploadFinish),
+            mw.DeobfReqBody(ss.ObfuscatorChain),
+            ss.UploadFinished)
         // PUT indicates that the request contains an upload chunk
         upGroup.POST("/*filePath",
-            mw.RangeHeader(&ss.Config.RangeHeaderOptions.Name, &ss.Config.RangeHeaderOptions.RangePrefix, true),
+            ss.auditEvent(audit.EventUploadChunk),
+            mw.RangeHeader(&ss.Config.RangeHeaderOptions.Name, &ss.Config.RangeHeaderOptions.RangePrefix, true, false),
             mw.DeobfReqBody(ss.ObfuscatorChain),
+            mw.Compression(&ss.Config.CompressionOptions),
             ss.ReceiveChunk)
         // DELETE indicates that the request aims to cancel an ongoing upload
         //  NOTE: this deletes any partial upload from disk
-        upGroup.DELETE("/*filePath", ss.CancelUpload)
+        upGroup.DELETE("/*filePath", ss.auditEvent(audit.EventUploadCancel), ss.CancelUpload)
     }
 
-    //============================
-    // MONITOR FOR EXPIRED UPLOADS
-    //============================
+    //=======================
+    // FILE MANAGEMENT ROUTES
+    //=======================
+    // - Paths are handled exactly as they are for uploads, such
+    //   that each request is jailed to the user's root directory.
+    // - Destinations of moves and copies are sent in the obfuscated
+    //   request body.
 
-    go func() {
-        log.INFO.Print("Starting upload expiration scanner")
-        ss.UploadManager.ScanExpired()
-    }()
+    mgGroup := r.Group(ss.Config.Routes.Api.Manage)
+    mgGroup.Use(
+        authMiddleWare.MiddlewareFunc(),
+        mw.UserCredential(&ss.Global.Users, &ss.Global.Auth.Jwt.FieldKeys.Username),
+        mw.ObfProfile(ss.profileChains, "filePath"),
+        mw.ObfResponse(ss.ObfuscatorChain, false),
+        mw.DeobfUploadFilePath(ss.Webroot, "filePath", ss.ObfuscatorChain))
+    {
+        // PUT indicates that we're creating a directory
+        mgGroup.PUT("/*filePath", ss.auditEvent(audit.EventMkdir), ss.MakeDirectory)
+        // DELETE indicates that we're deleting a file or directory
+        mgGroup.DELETE("/*filePath",
+            ss.auditEvent(audit.EventDelete),
+            mw.DeobfReqBody(ss.ObfuscatorChain),
+            ss.DeletePath)
+        // PATCH indicates that we're moving a file or directory
+        mgGroup.PATCH("/*filePath",
+            ss.auditEvent(audit.EventMove),
+            mw.DeobfReqBody(ss.ObfuscatorChain),
+            ss.MovePath)
+        // POST indicates that we're copying a file or directory
+        mgGroup.POST("/*filePath",
+            ss.auditEvent(audit.EventCopy),
+            mw.DeobfReqBody(ss.ObfuscatorChain),
+            ss.CopyPath)
+    }
 
-    //===============
-    // RUN THE SERVER
-    //===============
+    //===========
+    // SHARE ROUTE
+    //===========
+    // - Share tokens stand in for authentication, granting access
+    //   to a single file.
 
-    if detach {
-        go ss.runFileServer(r)
-    } else {
-        var err error
-        err = ss.runFileServer(r)
-        if err != nil {
-            log.ERR.Printf("Error running file server: %v", err)
+    if ss.Shares != nil {
+        r.GET(path.Join(ss.Config.Routes.Api.Share, ":token", "*filepath"),
+            ss.auditEvent(audit.EventShareDownload),
+            ss.ShareDownload)
+    }
+
+    return r, nil
+}
+
+// profileChains returns the obfuscation chains accepted for the
+// named profile: its current chain, followed by the chain it was
+// rotated from while the grace period is active. ObfuscatorChain is
+// the current chain of the default profile and profiles that no
+// longer exist.
+func (ss *SkyhookServer) profileChains(name string) (chains []*[]obfuscate.Obfuscator) {
+    if name == "" {
+        name = config.DefaultProfile
+    }
+    chains = []*[]obfuscate.Obfuscator{ss.ObfuscatorChain.Load()}
+    if name != config.DefaultProfile {
+        if chain, ok := ss.Profiles.Get(name); ok {
+            chains[0] = chain
+        } else {
+            log.WARN.Printf("Unknown obfuscation profile, using the default: %s", name)
+            name = config.DefaultProfile
         }
     }
-    return nil
+    if retired, ok := ss.Profiles.Retired(name); ok {
+        chains = append(chains, retired)
+    }
+    return chains
+}
+
+// Shutdown gracefully stops the file server.
+//
+// The listener is closed immediately, while in-flight requests, such
+// as chunk transfers, are given until ctx is done to complete. Any
+// remaining connections are then closed. The upload registrants
+// store is closed in either case; interrupted uploads can be resumed
+// after a restart.
+func (ss *SkyhookServer) Shutdown(ctx context.Context) (err error) {
+    if ss.httpServer != nil {
+        log.WARN.Println("Shutting down file server")
+        if err = ss.httpServer.Shutdown(ctx); err != nil {
+            log.WARN.Printf("Failed to drain file server requests before the deadline: %v", err)
+            ss.httpServer.Close()
+        }
+    }
+
+    if ss.UploadManager != nil {
+        log.INFO.Println("Closing upload registrants store")
+        if sErr := ss.UploadManager.Close(); sErr != nil {
+            log.ERR.Printf("Failed to close upload registrants store: %v", sErr)
+            if err == nil {
+                err = sErr
+            }
+        }
+    }
+
+    return err
 }
 
 func (ss *SkyhookServer) initLandingFiles() {
@@ -361,41 +600,84 @@ func (ss *SkyhookServer) initLandingFiles() {
     }
 }
 
-func (ss *SkyhookServer) runFileServer(e *gin.Engine) (err error) {
-    log.INFO.Printf("Listening and serving HTTPS on %s\n", ss.Config.Socket())
-
-    defer func() { log.ERR.Println(err) }()
+func (ss *SkyhookServer) runFileServer() (err error) {
+    log.INFO.Printf("Listening and serving on %s\n", ss.Config.Listener())
 
-    server := &http.Server{
-        Addr:              ss.Config.Socket(),
-        Handler:           e.Handler(),
-        TLSConfig:         nil,
-        ReadTimeout:       0,
-        ReadHeaderTimeout: 0,
-        WriteTimeout:      0,
-        IdleTimeout:       0,
-        MaxHeaderBytes:    0,
-        TLSNextProto:      nil,
-        ConnState:         nil,
-        ErrorLog:          log.FSERVER,
-        BaseContext:       nil,
-        ConnContext:       nil,
-    }
+    defer func() {
+        if err != http.ErrServerClosed {
+            log.ERR.Println(err)
+        }
+    }()
 
-    err = server.ListenAndServeTLS(ss.Tls.CertPath, ss.Tls.KeyPath)
+    err = listenAndServe(ss.httpServer, &ss.Config.ServerOptions, ss.Tls, &ss.Global.TlsProfile, ss.CertManager)
     return err
 }
 
+// UploadFinished verifies a finished upload and deregisters it.
+//
+// The request body contains an obfuscated UploadFinishedRequest,
+// against which the file is verified. The size may only be omitted
+// when it was declared at registration. Missing or corrupt content
+// and unknown sizes result in a 409 and the upload remains
+// registered.
 func (ss *SkyhookServer) UploadFinished(c *gin.Context) {
     rfp := c.MustGet("relFilePath").(string)
-    if err := ss.UploadManager.Deregister(rfp); err != nil {
+
+    //========================
+    // PARSE INTEGRITY PAYLOAD
+    //========================
+
+    req := structs.UploadFinishedRequest{}
+    if data, err := c.Request.Body.(mw.ByteReadCloser).Deobfuscated(); err != nil {
         c.AbortWithStatus(http.StatusNotFound)
         return
-    } else {
+    } else if len(data) > 0 {
+        if err = json.Unmarshal(data, &req); err != nil {
+            c.JSON(http.StatusNotAcceptable, structs.BaseResponse{Message: "Poorly formatted request payload."})
+            return
+        }
+    }
+
+    //================================
+    // VERIFY AND DEREGISTER THE UPLOAD
+    //================================
+
+    gaps, err := ss.UploadManager.Finish(rfp, req.Size, req.Sha256)
+    switch err {
+    case nil:
         c.JSON(http.StatusOK, structs.BaseResponse{
             Success: true,
             Message: "Upload deregistered.",
         })
+    case upload.ErrIncomplete, upload.ErrSizeMismatch, upload.ErrChecksumMismatch, upload.ErrSizeUnknown:
+        c.JSON(http.StatusConflict, structs.UploadFinishedResponse{
+            BaseResponse: structs.BaseResponse{
+                Success: false,
+                Message: err.Error(),
+            },
+            Gaps: gaps,
+        })
+    default:
+        c.AbortWithStatus(http.StatusNotFound)
+    }
+}
+
+// UploadStatus returns the byte ranges received for a registered
+// upload, allowing clients to resume an interrupted upload.
+func (ss *SkyhookServer) UploadStatus(c *gin.Context) {
+    rfp := c.MustGet("relFilePath").(string)
+    if up, err := ss.UploadManager.Get(rfp); err != nil {
+        c.AbortWithStatus(http.StatusNotFound)
+    } else {
+        c.JSON(http.StatusOK, structs.UploadStatusResponse{
+            BaseResponse: structs.BaseResponse{
+                Success: true,
+                Message: "Upload status returned.",
+            },
+            Path:       userRelPath(c, up.RelPath),
+            Received:   up.Received,
+            Expiration: up.Expiration,
+        })
     }
 }
 
@@ -404,7 +686,7 @@ func (ss *SkyhookServer) GetOperatingConfig(c *gin.Context) {
     if user, ok := ss.Global.GetUser(claims["id"].(string)); !ok {
         c.AbortWithStatus(http.StatusBadRequest)
     } else {
-        od := structs.NewOperatingConfigData(*ss.Global)
+        od := structs.NewOperatingConfigData(*ss.Global, user)
         if data, err := od.JsonCryptMarshal(user.Token); err != nil {
             c.AbortWithStatus(http.StatusBadRequest)
         } else {
@@ -413,16 +695,34 @@ func (ss *SkyhookServer) GetOperatingConfig(c *gin.Context) {
     }
 }
 
+// ListUploads lists the uploads registered within the user's
+// root directory.
 func (ss *SkyhookServer) ListUploads(c *gin.Context) {
+    uploads := ss.UploadManager.ListWithin(c.MustGet("userRootPath").(string))
+    for i := range uploads {
+        uploads[i].RelPath = userRelPath(c, uploads[i].RelPath)
+        uploads[i].QuotaRoot = ""
+    }
+
     c.JSON(http.StatusOK, structs.ListUploadsResponse{
         BaseResponse: structs.BaseResponse{
             Success: true,
             Message: "Listing uploads.",
         },
-        Uploads: ss.UploadManager.ListAll(),
+        Uploads: uploads,
     })
 }
 
+// userRelPath strips the user's root directory from rel, which is
+// relative to the webroot, returning the path as seen by the user.
+func userRelPath(c *gin.Context, rel string) string {
+    root := c.MustGet("userRootPath").(string)
+    if root == "/" {
+        return rel
+    }
+    return path.Join("/", strings.TrimPrefix(rel, root))
+}
+
 // CancelUpload cancels an ongoing upload. If any chunks of the file
 // have been written to disk, they will be removed.
 func (ss *SkyhookServer) CancelUpload(c *gin.Context) {
@@ -456,18 +756,49 @@ func (ss *SkyhookServer) RegisterUpload(c *gin.Context) {
         return
     }
 
+    //=================================
+    // PARSE OPTIONAL REGISTRATION BODY
+    //=================================
+    // - The declared size is checked against upload limits
+    //   before any content is received.
+
+    req := structs.RegisterUploadRequest{}
+    if data, err := c.Request.Body.(mw.ByteReadCloser).Deobfuscated(); err != nil {
+        c.AbortWithStatus(http.StatusNotFound)
+        return
+    } else if len(data) > 0 {
+        if err = json.Unmarshal(data, &req); err != nil {
+            c.JSON(http.StatusNotAcceptable, structs.BaseResponse{Message: "Poorly formatted request payload."})
+            return
+        }
+    }
+
+    quotaRoot, err := inspector.ToAbs(*ss.Webroot, c.MustGet("userRootPath").(string))
+    if err != nil {
+        c.AbortWithStatus(http.StatusNotFound)
+        return
+    }
+
     //============================
     // ATTEMPT UPLOAD REGISTRATION
     //============================
 
-    if up, err := ss.UploadManager.Register(afp, rfp); err != nil {
-        c.JSON(http.StatusNotAcceptable, structs.RegisterUploadResponse{
+    var owner string
+    if cred := mw.CtxCredential(c); cred != nil {
+        owner = cred.Username
+    }
+    if _, err = ss.UploadManager.Register(afp, rfp, req.Size, quotaRoot, owner); err != nil {
+        status := http.StatusNotAcceptable
+        if upload.IsLimitError(err) {
+            status = http.StatusRequestEntityTooLarge
+        }
+        c.JSON(status, structs.RegisterUploadResponse{
             BaseResponse: structs.BaseResponse{
                 Success: false,
                 Message: err.Error(),
             },
             RegisterUploadRequest: structs.RegisterUploadRequest{
-                Path: up.RelPath,
+                Path: userRelPath(c, rfp),
             },
         })
     } else {
@@ -477,7 +808,8 @@ func (ss *SkyhookServer) RegisterUpload(c *gin.Context) {
                 Message: "Upload registered",
             },
             RegisterUploadRequest: structs.RegisterUploadRequest{
-                Path: rfp,
+                Path: userRelPath(c, rfp),
+                Size: req.Size,
             },
             //Id: up.Id,
         })
@@ -490,16 +822,18 @@ func (ss *SkyhookServer) ReceiveChunk(c *gin.Context) {
     // Parse Range header
     rp := c.MustGet("relFilePath").(string)
     rStart := c.MustGet("rangeStart").(uint64)
-    if data, err := c.Request.Body.(mw.ByteReadCloser).Deobfuscated(); err != nil {
+    // The body is deobfuscated as it's written to disk
+    if r, err := c.Request.Body.(mw.ByteReadCloser).Deobfuscator(); err != nil {
         c.AbortWithStatus(http.StatusNotFound)
     } else {
-        if err := ss.UploadManager.SaveChunk(rp, data, rStart); err != nil {
+        defer r.Close()
+        if _, err = ss.UploadManager.SaveChunkFrom(rp, r, rStart); upload.IsLimitError(err) {
+            log.WARN.Printf("Rejected upload chunk for %s: %v", rp, err)
+            c.JSON(http.StatusRequestEntityTooLarge, structs.BaseResponse{Message: err.Error()})
+        } else if err != nil {
+            log.ERR.Printf("Upload Chunk Error: %v", err)
             c.AbortWithStatus(http.StatusNotFound)
-            return
         }
-        //go func() {
-        //    ss.UploadManager.SaveChunk(rp, data, rStart)
-        //}()
     }
 }
 
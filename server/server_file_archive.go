@@ -0,0 +1,119 @@
+package server
+
+import (
+    "encoding/json"
+    obfuscate "github.com/blackhillsinfosec/skyhook-obfuscation"
+    structs "github.com/blackhillsinfosec/skyhook/api_structs"
+    "github.com/blackhillsinfosec/skyhook/log"
+    "github.com/blackhillsinfosec/skyhook/server/archive"
+    "github.com/blackhillsinfosec/skyhook/server/inspector"
+    mw "github.com/blackhillsinfosec/skyhook/server/middleware"
+    "github.com/gin-gonic/gin"
+    "io"
+    "net/http"
+    "os"
+    "path"
+    "strings"
+    "time"
+)
+
+// archiveIdle is how long the generator of an archive is paused
+// awaiting the following chunk before it's stopped.
+const archiveIdle = time.Minute
+
+// DownloadArchive returns a chunk of an archive of the directory
+// identified by the obfuscated filepath route parameter, allowing
+// entire directory trees to be retrieved without downloading each
+// file individually.
+//
+// The request body contains an obfuscated ArchiveRequest selecting
+// the format, while the range header selects the chunk. As with file
+// chunks, the end of the range is inclusive. Fewer bytes are
+// returned for the final chunk, and a 416 is returned for ranges
+// starting at or beyond the end of the archive, the size of which
+// isn't known in advance.
+//
+// Paths are sanitized by inspector.ToAbs, and both the list and
+// download permissions are required.
+func (ss *SkyhookServer) DownloadArchive(c *gin.Context) {
+    cred := mw.CtxCredential(c)
+    if perms := cred.Perms(); !perms.List || !perms.Download {
+        c.AbortWithStatus(http.StatusForbidden)
+        return
+    }
+
+    //=================
+    // PARSE THE REQUEST
+    //=================
+
+    req := structs.ArchiveRequest{}
+    if data, err := c.Request.Body.(mw.ByteReadCloser).Deobfuscated(); err != nil {
+        c.AbortWithStatus(http.StatusNotFound)
+        return
+    } else if err = json.Unmarshal(data, &req); err != nil {
+        c.JSON(http.StatusNotAcceptable, structs.BaseResponse{Message: "Poorly formatted request payload."})
+        return
+    } else if !archive.ValidFormat(req.Format) {
+        c.JSON(http.StatusNotAcceptable, structs.BaseResponse{Message: "Unsupported archive format."})
+        return
+    }
+
+    //==========================
+    // RESOLVE THE DIRECTORY PATH
+    //==========================
+
+    chain := mw.CtxObfChain(c, ss.ObfuscatorChain)
+    dec, err := obfuscate.Deobfuscate([]byte(strings.TrimPrefix(c.Param("filepath"), "/")), *chain)
+    if err != nil {
+        c.AbortWithStatus(http.StatusNotFound)
+        return
+    }
+
+    webPath := path.Clean("/" + string(dec))
+    var abs string
+    if abs, err = inspector.ToAbs(cred.Webroot(*ss.Webroot), webPath); err != nil {
+        c.AbortWithStatus(http.StatusNotFound)
+        return
+    } else if stat, err := os.Stat(abs); err != nil || !stat.IsDir() {
+        c.AbortWithStatus(http.StatusNotFound)
+        return
+    }
+
+    // The archive extracts to a directory named after the target,
+    // which is anonymous for the user's root directory
+    name := path.Base(webPath)
+    if webPath == "/" {
+        name = "root"
+    }
+
+    //================
+    // STREAM THE CHUNK
+    //================
+
+    start, end := c.MustGet("rangeStart").(uint64), c.MustGet("rangeEnd").(uint64)
+    key := strings.Join([]string{cred.Username, abs, req.Format}, "\x00")
+
+    var s *archive.Stream
+    if s, err = ss.archives.Open(key, abs, name, req.Format, int64(start)); err == archive.ErrOutOfRange {
+        c.AbortWithStatus(http.StatusRequestedRangeNotSatisfiable)
+        return
+    } else if err != nil {
+        log.ERR.Printf("Failed to generate archive of %s: %v", abs, err)
+        c.AbortWithStatus(http.StatusInternalServerError)
+        return
+    }
+
+    // The limited reader is hidden from ObfResponseWriter.ReadFrom,
+    // which would otherwise advertise a Content-Length that the
+    // final chunk falls short of
+    c.Status(http.StatusPartialContent)
+    var n int64
+    n, err = io.Copy(c.Writer, struct{ io.Reader }{io.LimitReader(s, int64(end-start))})
+    ss.archives.Release(s, err != nil)
+    if err != nil {
+        log.ERR.Printf("Failed to send archive chunk of %s: %v", abs, err)
+    }
+
+    // Audit the range that was actually sent
+    c.Set("rangeEnd", start+uint64(n))
+}
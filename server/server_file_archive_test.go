@@ -0,0 +1,76 @@
+package server
+
+import (
+    "bytes"
+    "fmt"
+    obfuscate "github.com/blackhillsinfosec/skyhook-obfuscation"
+    "github.com/blackhillsinfosec/skyhook/config"
+    "github.com/blackhillsinfosec/skyhook/server/archive"
+    mw "github.com/blackhillsinfosec/skyhook/server/middleware"
+    "github.com/blackhillsinfosec/skyhook/server/upload"
+    "github.com/gin-gonic/gin"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+func TestSkyhookServer_DownloadArchive(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    ss, team := manageServer(t, upload.Limits{})
+    ss.archives = archive.NewStreams(time.Minute)
+    if err := os.WriteFile(filepath.Join(team, "file"), bytes.Repeat([]byte("0123456789"), 100), 0600); err != nil {
+        t.Fatal(err)
+    }
+
+    headerName, prefix := "Range", "bytes"
+    r := gin.New()
+    r.POST("/files/*filepath", func(c *gin.Context) {
+        c.Set("credential", &config.Credential{Username: "op", RootDir: "team"})
+    }, mw.RangeHeader(&headerName, &prefix, true, true), mw.DeobfReqBody(ss.ObfuscatorChain), ss.DownloadArchive)
+
+    chain := *ss.ObfuscatorChain.Load()
+    pth, _ := obfuscate.Obfuscate([]byte("/"), chain)
+    body, _ := obfuscate.Obfuscate([]byte(`{"format":"tar"}`), chain)
+    get := func(start, end int) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(http.MethodPost, "/files/"+url.PathEscape(string(pth)), bytes.NewReader(body))
+        req.Header.Set(headerName, fmt.Sprintf("%s=%d-%d", prefix, start, end))
+        rec := httptest.NewRecorder()
+        r.ServeHTTP(rec, req)
+        return rec
+    }
+
+    want := bytes.Buffer{}
+    if err := archive.Write(&want, team, "root", archive.FormatTar); err != nil {
+        t.Fatal(err)
+    }
+
+    // The end of each range is inclusive, as it is for file chunks
+    var got []byte
+    const chunkSize = 1000
+    for off := 0; ; off += chunkSize {
+        rec := get(off, off+chunkSize-1)
+        if rec.Code != http.StatusPartialContent {
+            t.Fatalf("chunk at %d answered with %d", off, rec.Code)
+        }
+        got = append(got, rec.Body.Bytes()...)
+        if rec.Body.Len() < chunkSize {
+            break
+        } else if rec.Body.Len() > chunkSize {
+            t.Fatalf("chunk at %d is %d bytes", off, rec.Body.Len())
+        }
+    }
+    if !bytes.Equal(got, want.Bytes()) {
+        t.Fatalf("chunks differ from the archive: got %d bytes, want %d", len(got), want.Len())
+    }
+
+    if rec := get(10, 10); rec.Code != http.StatusPartialContent || !bytes.Equal(rec.Body.Bytes(), want.Bytes()[10:11]) {
+        t.Errorf("single byte range answered with %d: %q", rec.Code, rec.Body.Bytes())
+    }
+    if rec := get(want.Len(), want.Len()+chunkSize); rec.Code != http.StatusRequestedRangeNotSatisfiable {
+        t.Errorf("range beyond the archive answered with %d", rec.Code)
+    }
+}
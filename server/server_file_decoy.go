@@ -0,0 +1,111 @@
+package server
+
+import (
+    "crypto/tls"
+    "errors"
+    "github.com/blackhillsinfosec/skyhook/config"
+    "github.com/blackhillsinfosec/skyhook/log"
+    mw "github.com/blackhillsinfosec/skyhook/server/middleware"
+    "github.com/gin-gonic/gin"
+    "io/fs"
+    "net/http"
+    "net/http/httputil"
+    "net/url"
+    "os"
+    "path"
+)
+
+// newDecoy returns the handler serving the cover site configured by
+// opts, or nil when the decoy is disabled.
+func newDecoy(opts *config.FileServerDecoyOptions) (http.Handler, error) {
+    switch opts.Mode {
+    case "":
+        return nil, nil
+    case config.DecoyStatic:
+        return decoyStatic{root: os.DirFS(opts.StaticDir)}, nil
+    case config.DecoyProxy:
+        upstream, err := url.Parse(opts.Upstream)
+        if err != nil {
+            return nil, err
+        }
+        proxy := httputil.NewSingleHostReverseProxy(upstream)
+        director := proxy.Director
+        proxy.Director = func(r *http.Request) {
+            director(r)
+            // Virtual hosts of the upstream expect their own name
+            r.Host = upstream.Host
+        }
+        proxy.Transport = &http.Transport{
+            Proxy:           http.ProxyFromEnvironment,
+            TLSClientConfig: &tls.Config{InsecureSkipVerify: opts.InsecureUpstream},
+        }
+        proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+            log.WARN.Printf("Failed to proxy decoy request: %v", err)
+            w.WriteHeader(http.StatusBadGateway)
+        }
+        return proxy, nil
+    }
+    return nil, errors.New("unsupported decoy mode: " + opts.Mode)
+}
+
+// decoyStatic serves the files of root. Directories are served only
+// through their index.html and missing files through 404.html, when
+// present, so the decoy never lists its content.
+type decoyStatic struct {
+    root fs.FS
+}
+
+func (d decoyStatic) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    name := path.Clean("/" + r.URL.Path)[1:]
+    if name == "" {
+        name = "."
+    }
+    if stat, err := fs.Stat(d.root, name); err == nil && stat.IsDir() {
+        name = path.Join(name, "index.html")
+    }
+
+    if stat, err := fs.Stat(d.root, name); err == nil && stat.Mode().IsRegular() {
+        http.ServeFileFS(w, r, d.root, name)
+        return
+    }
+
+    if b, err := fs.ReadFile(d.root, "404.html"); err == nil {
+        w.Header().Set("Content-Type", "text/html; charset=utf-8")
+        w.WriteHeader(http.StatusNotFound)
+        w.Write(b)
+        return
+    }
+    http.NotFound(w, r)
+}
+
+// serveDecoy answers c with the decoy, returning false when it's
+// disabled.
+func (ss *SkyhookServer) serveDecoy(c *gin.Context) bool {
+    if ss.decoy == nil {
+        return false
+    }
+    c.Abort()
+    mw.SkipResponseProfile(c)
+    for _, h := range []string{"WWW-Authenticate", "Retry-After"} {
+        c.Writer.Header().Del(h)
+    }
+    ss.decoy.ServeHTTP(c.Writer, c.Request)
+    return true
+}
+
+// reject answers c with the decoy, or status when it's disabled.
+func (ss *SkyhookServer) reject(c *gin.Context, status int) {
+    if !ss.serveDecoy(c) {
+        c.AbortWithStatus(status)
+    }
+}
+
+// unauthorized answers requests that fail JWT authentication with
+// the decoy. The body of the request may have been consumed while
+// authenticating, so the decoy receives none.
+func (ss *SkyhookServer) unauthorized(c *gin.Context, code int, message string) {
+    c.Request.Body, c.Request.ContentLength = http.NoBody, 0
+    if !ss.serveDecoy(c) {
+        mw.JwtIsUnauthorized(c, code, message)
+    }
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+    "github.com/blackhillsinfosec/skyhook/config"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func TestDecoyStatic(t *testing.T) {
+    dir := t.TempDir()
+    for name, content := range map[string]string{
+        "index.html":     "home",
+        "404.html":       "missing",
+        "assets/app.css": "css",
+        "empty/.keep":    "",
+    } {
+        abs := filepath.Join(dir, name)
+        if err := os.MkdirAll(filepath.Dir(abs), 0700); err != nil {
+            t.Fatal(err)
+        } else if err = os.WriteFile(abs, []byte(content), 0600); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    decoy, err := newDecoy(&config.FileServerDecoyOptions{Mode: config.DecoyStatic, StaticDir: dir})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    for path, want := range map[string]struct {
+        status int
+        body   string
+    }{
+        "/":                    {http.StatusOK, "home"},
+        "/assets/app.css":      {http.StatusOK, "css"},
+        "/empty/":              {http.StatusNotFound, "missing"},
+        "/nope":                {http.StatusNotFound, "missing"},
+        "/../../../etc/passwd": {http.StatusNotFound, "missing"},
+    } {
+        rec := httptest.NewRecorder()
+        decoy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+        if rec.Code != want.status || strings.TrimSpace(rec.Body.String()) != want.body {
+            t.Errorf("%s: got %d %q, want %d %q", path, rec.Code, rec.Body.String(), want.status, want.body)
+        }
+    }
+}
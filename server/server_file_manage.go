@@ -0,0 +1,408 @@
+package server
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    structs "github.com/blackhillsinfosec/skyhook/api_structs"
+    "github.com/blackhillsinfosec/skyhook/log"
+    "github.com/blackhillsinfosec/skyhook/server/inspector"
+    mw "github.com/blackhillsinfosec/skyhook/server/middleware"
+    "github.com/blackhillsinfosec/skyhook/server/upload"
+    "github.com/gin-gonic/gin"
+    "io"
+    "io/fs"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+// File management endpoints act on the path set by
+// mw.DeobfUploadFilePath, which enforces the upload permission, or
+// the delete permission for DELETE requests. Responses are
+// obfuscated by mw.ObfResponse, so errors carrying a message use
+// statuses that it obfuscates.
+
+// MakeDirectory creates the directory at the requested path,
+// including any missing parents.
+//
+// Responses:
+//
+// - structs.BaseResponse
+func (ss *SkyhookServer) MakeDirectory(c *gin.Context) {
+    rel, abs, ok := managedPath(c)
+    if !ok {
+        return
+    }
+
+    if stat, err := os.Stat(abs); err == nil {
+        msg := "Directory already exists."
+        if !stat.IsDir() {
+            msg = "A file already exists at the path."
+        }
+        c.JSON(http.StatusConflict, structs.BaseResponse{Message: msg})
+        return
+    }
+
+    if err := os.MkdirAll(abs, 0700); err != nil {
+        log.ERR.Printf("Failed to create directory %s: %v", rel, err)
+        c.JSON(http.StatusConflict, structs.BaseResponse{Message: "Failed to create directory."})
+        return
+    }
+
+    log.INFO.Printf("Created directory: %s", rel)
+    c.JSON(http.StatusOK, structs.BaseResponse{Success: true, Message: "Directory created."})
+}
+
+// DeletePath removes the file or directory at the requested path.
+// Non-empty directories are removed only when the optional request
+// body contains an obfuscated FileOperationRequest with Recursive
+// set. Content being uploaded must be canceled instead.
+//
+// Responses:
+//
+// - structs.BaseResponse
+func (ss *SkyhookServer) DeletePath(c *gin.Context) {
+    rel, abs, ok := managedPath(c)
+    if !ok {
+        return
+    }
+
+    req, ok := fileOperationRequest(c)
+    if !ok {
+        return
+    } else if rootPath(c, rel) {
+        c.JSON(http.StatusForbidden, structs.BaseResponse{Message: "The root directory can't be deleted."})
+        return
+    }
+
+    stat, err := os.Lstat(abs)
+    if err != nil {
+        c.AbortWithStatus(http.StatusNotFound)
+        return
+    } else if ss.uploadsWithin(c, rel) {
+        return
+    }
+
+    if stat.IsDir() && req.Recursive {
+        err = os.RemoveAll(abs)
+    } else {
+        err = os.Remove(abs)
+    }
+
+    if err != nil {
+        log.ERR.Printf("Failed to delete %s: %v", rel, err)
+        msg := "Failed to delete."
+        if stat.IsDir() && !req.Recursive {
+            msg = "Failed to delete; the directory may not be empty."
+        }
+        c.JSON(http.StatusConflict, structs.BaseResponse{Message: msg})
+        return
+    }
+
+    log.INFO.Printf("Deleted: %s", rel)
+    c.JSON(http.StatusOK, structs.BaseResponse{Success: true, Message: "Deleted."})
+}
+
+// MovePath moves, i.e., renames, the file or directory at the
+// requested path to the destination in the obfuscated
+// FileOperationRequest. The delete permission is also required.
+// A file being overwritten is replaced atomically.
+//
+// Responses:
+//
+// - structs.BaseResponse
+func (ss *SkyhookServer) MovePath(c *gin.Context) {
+    if !mw.CtxCredential(c).Perms().Delete {
+        c.JSON(http.StatusForbidden, structs.BaseResponse{Message: "Permission denied."})
+        return
+    }
+
+    src, dst, ok := ss.transferPaths(c, "moved")
+    if !ok {
+        return
+    }
+
+    if err := os.Rename(src.abs, dst.abs); err != nil {
+        log.ERR.Printf("Failed to move %s to %s: %v", src.rel, dst.rel, err)
+        c.JSON(http.StatusConflict, structs.BaseResponse{Message: "Failed to move."})
+        return
+    }
+
+    log.INFO.Printf("Moved %s to %s", src.rel, dst.rel)
+    c.JSON(http.StatusOK, structs.BaseResponse{Success: true, Message: "Moved."})
+}
+
+// CopyPath copies the file or directory at the requested path to
+// the destination in the obfuscated FileOperationRequest.
+// Directories are copied recursively, skipping symbolic links and
+// other irregular files. The download permission is also required.
+// A file being overwritten is replaced only once the copy succeeds.
+// Copies are subject to the upload limits, responding with a 413
+// when they're exceeded.
+//
+// Responses:
+//
+// - structs.BaseResponse
+func (ss *SkyhookServer) CopyPath(c *gin.Context) {
+    if !mw.CtxCredential(c).Perms().Download {
+        c.JSON(http.StatusForbidden, structs.BaseResponse{Message: "Permission denied."})
+        return
+    }
+
+    src, dst, ok := ss.transferPaths(c, "copied")
+    if !ok {
+        return
+    } else if !src.info.IsDir() && !src.info.Mode().IsRegular() {
+        c.JSON(http.StatusNotAcceptable, structs.BaseResponse{Message: "Only files and directories can be copied."})
+        return
+    }
+
+    //=====================
+    // ENFORCE UPLOAD LIMITS
+    //=====================
+    // - Copies are charged like uploads, such that they can't be
+    //   used to bypass the quota or exhaust the disk.
+
+    quotaRoot, err := inspector.ToAbs(*ss.Webroot, c.MustGet("userRootPath").(string))
+    if err != nil {
+        c.AbortWithStatus(http.StatusNotFound)
+        return
+    }
+
+    size, largest, err := treeSize(src.abs)
+    if err == nil {
+        err = ss.UploadManager.CheckCopy(dst.abs, quotaRoot, size, largest)
+    }
+    if upload.IsLimitError(err) {
+        log.WARN.Printf("Rejected copy of %s to %s: %v", src.rel, dst.rel, err)
+        c.JSON(http.StatusRequestEntityTooLarge, structs.BaseResponse{Message: err.Error()})
+        return
+    } else if err != nil {
+        log.ERR.Printf("Failed to measure %s for copying: %v", src.rel, err)
+        c.JSON(http.StatusConflict, structs.BaseResponse{Message: "Failed to copy."})
+        return
+    }
+
+    if err = copyPathAtomic(src.abs, dst.abs); err != nil {
+        log.ERR.Printf("Failed to copy %s to %s: %v", src.rel, dst.rel, err)
+        c.JSON(http.StatusConflict, structs.BaseResponse{Message: "Failed to copy."})
+        return
+    }
+    ss.UploadManager.Charge(quotaRoot, size)
+
+    log.INFO.Printf("Copied %s to %s", src.rel, dst.rel)
+    c.JSON(http.StatusOK, structs.BaseResponse{Success: true, Message: "Copied."})
+}
+
+//=======
+// HELPERS
+//=======
+
+// managedFile is a path relative to the webroot and its absolute
+// counterpart.
+type managedFile struct {
+    rel, abs string
+    // info describes the file when it exists, without following
+    // symbolic links.
+    info os.FileInfo
+}
+
+// managedPath returns the paths set by mw.DeobfUploadFilePath,
+// aborting with a 404 when no path was requested.
+func managedPath(c *gin.Context) (rel, abs string, ok bool) {
+    rel, abs = c.MustGet("relFilePath").(string), c.MustGet("absFilePath").(string)
+    if rel == "" {
+        c.AbortWithStatus(http.StatusNotFound)
+        return rel, abs, false
+    }
+    return rel, abs, true
+}
+
+// rootPath determines if rel is the user's root directory.
+func rootPath(c *gin.Context, rel string) bool {
+    return rel == c.MustGet("userRootPath").(string)
+}
+
+// fileOperationRequest parses the optional request body.
+func fileOperationRequest(c *gin.Context) (req structs.FileOperationRequest, ok bool) {
+    if data, err := c.Request.Body.(mw.ByteReadCloser).Deobfuscated(); err != nil {
+        c.AbortWithStatus(http.StatusNotFound)
+        return req, false
+    } else if len(data) > 0 {
+        if err = json.Unmarshal(data, &req); err != nil {
+            c.JSON(http.StatusNotAcceptable, structs.BaseResponse{Message: "Poorly formatted request payload."})
+            return req, false
+        }
+    }
+    return req, true
+}
+
+// uploadsWithin responds with a 409 when content at or beneath rel
+// is being uploaded.
+func (ss *SkyhookServer) uploadsWithin(c *gin.Context, rel string) bool {
+    if len(ss.UploadManager.ListWithin(rel)) > 0 {
+        c.JSON(http.StatusConflict, structs.BaseResponse{
+            Message: "Content is being uploaded to the path; cancel or finish the upload first."})
+        return true
+    }
+    return false
+}
+
+// transferPaths validates the source and destination of a move or
+// copy, responding to c when they're unacceptable. verb describes
+// the operation in response messages.
+//
+// The destination must not exist unless Overwrite is set, in which
+// case only a file can be replaced by another file and the delete
+// permission is required. Its parent directory must exist.
+// Directories can't be transferred into themselves. The destination
+// is left in place; it's replaced only once the transfer succeeds.
+func (ss *SkyhookServer) transferPaths(c *gin.Context, verb string) (src, dst managedFile, ok bool) {
+    var req structs.FileOperationRequest
+    if src.rel, src.abs, ok = managedPath(c); !ok {
+        return src, dst, false
+    } else if req, ok = fileOperationRequest(c); !ok {
+        return src, dst, false
+    }
+
+    //=======================
+    // RESOLVE THE DESTINATION
+    //=======================
+
+    var err error
+    if dst.rel, dst.abs, err = mw.JailPath(c, *ss.Webroot, req.Destination); err != nil {
+        c.JSON(http.StatusNotAcceptable, structs.BaseResponse{
+            Message: "Destination paths must begin with a slash."})
+        return src, dst, false
+    } else if rootPath(c, src.rel) {
+        c.JSON(http.StatusForbidden, structs.BaseResponse{
+            Message: fmt.Sprintf("The root directory can't be %s.", verb)})
+        return src, dst, false
+    } else if src.abs == dst.abs || strings.HasPrefix(dst.abs, src.abs+string(filepath.Separator)) {
+        c.JSON(http.StatusNotAcceptable, structs.BaseResponse{
+            Message: fmt.Sprintf("Content can't be %s into itself.", verb)})
+        return src, dst, false
+    }
+    c.Set("auditMessage", fmt.Sprintf("destination: %s", dst.rel))
+
+    //===================
+    // VALIDATE BOTH FILES
+    //===================
+
+    if src.info, err = os.Lstat(src.abs); err != nil {
+        c.AbortWithStatus(http.StatusNotFound)
+        return src, dst, false
+    } else if ss.uploadsWithin(c, src.rel) || ss.uploadsWithin(c, dst.rel) {
+        return src, dst, false
+    }
+
+    if parent, err := os.Stat(filepath.Dir(dst.abs)); err != nil || !parent.IsDir() {
+        c.JSON(http.StatusConflict, structs.BaseResponse{Message: "Destination directory doesn't exist."})
+        return src, dst, false
+    }
+
+    if dst.info, err = os.Lstat(dst.abs); err == nil {
+        if !req.Overwrite {
+            c.JSON(http.StatusConflict, structs.BaseResponse{Message: "Destination already exists."})
+            return src, dst, false
+        } else if dst.info.IsDir() {
+            c.JSON(http.StatusConflict, structs.BaseResponse{Message: "Directories can't be overwritten."})
+            return src, dst, false
+        } else if src.info.IsDir() {
+            c.JSON(http.StatusConflict, structs.BaseResponse{Message: "Files can't be overwritten by directories."})
+            return src, dst, false
+        } else if !mw.CtxCredential(c).Perms().Delete {
+            c.JSON(http.StatusForbidden, structs.BaseResponse{Message: "Permission denied."})
+            return src, dst, false
+        }
+    }
+
+    return src, dst, true
+}
+
+// copyPathAtomic copies the file or directory at src to a temporary
+// directory next to dst, moving the copy to dst once it's complete.
+// An existing file at dst is replaced atomically, while a failed
+// copy leaves dst untouched.
+func copyPathAtomic(src, dst string) (err error) {
+    var tmp string
+    if tmp, err = os.MkdirTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".copy-"); err != nil {
+        return err
+    }
+    defer os.RemoveAll(tmp)
+
+    staged := filepath.Join(tmp, filepath.Base(dst))
+    if err = copyPath(src, staged); err != nil {
+        return err
+    }
+    return os.Rename(staged, dst)
+}
+
+// copyPath copies the file or directory at src to dst, which must
+// not exist. Symbolic links and other irregular files beneath a
+// directory are skipped, such that they're never followed.
+func copyPath(src, dst string) error {
+    return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+        if err != nil {
+            return err
+        }
+
+        var rel string
+        if rel, err = filepath.Rel(src, p); err != nil {
+            return err
+        }
+        target := filepath.Join(dst, rel)
+
+        var fi fs.FileInfo
+        if fi, err = d.Info(); err != nil {
+            return err
+        } else if d.IsDir() {
+            return os.Mkdir(target, fi.Mode().Perm()|0700)
+        } else if !d.Type().IsRegular() {
+            return nil
+        }
+        return copyFile(p, target, fi.Mode().Perm())
+    })
+}
+
+// treeSize returns the total size of the regular files that
+// copyPath copies from src and the size of the largest one.
+func treeSize(src string) (total, largest uint64, err error) {
+    err = filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+        if err != nil || !d.Type().IsRegular() {
+            return err
+        }
+        var fi fs.FileInfo
+        if fi, err = d.Info(); err != nil {
+            return err
+        }
+        n := uint64(fi.Size())
+        total += n
+        if n > largest {
+            largest = n
+        }
+        return nil
+    })
+    return total, largest, err
+}
+
+// copyFile copies the regular file at src to a new file at dst.
+func copyFile(src, dst string, perm fs.FileMode) (err error) {
+    var in, out *os.File
+    if in, err = os.Open(src); err != nil {
+        return err
+    }
+    defer in.Close()
+
+    if out, err = os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm); err != nil {
+        return err
+    }
+    if _, err = io.Copy(out, in); err != nil {
+        out.Close()
+        os.Remove(dst)
+        return errors.New(fmt.Sprintf("failed to copy file content: %v", err))
+    }
+    return out.Close()
+}
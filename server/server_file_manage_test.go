@@ -0,0 +1,273 @@
+package server
+
+import (
+    "bytes"
+    "encoding/json"
+    obfuscate "github.com/blackhillsinfosec/skyhook-obfuscation"
+    structs "github.com/blackhillsinfosec/skyhook/api_structs"
+    "github.com/blackhillsinfosec/skyhook/config"
+    mw "github.com/blackhillsinfosec/skyhook/server/middleware"
+    "github.com/blackhillsinfosec/skyhook/server/upload"
+    "github.com/gin-gonic/gin"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+// manageEngine returns an engine serving the file management routes
+// of ss to cred, and a function sending requests to it.
+func manageEngine(t *testing.T, ss *SkyhookServer, cred *config.Credential) func(method, pth string, req *structs.FileOperationRequest) int {
+    gin.SetMode(gin.TestMode)
+    r := gin.New()
+    g := r.Group("/manage", func(c *gin.Context) {
+        c.Set("credential", cred)
+    }, mw.DeobfUploadFilePath(ss.Webroot, "filePath", ss.ObfuscatorChain))
+    g.PUT("/*filePath", ss.MakeDirectory)
+    g.DELETE("/*filePath", mw.DeobfReqBody(ss.ObfuscatorChain), ss.DeletePath)
+    g.PATCH("/*filePath", mw.DeobfReqBody(ss.ObfuscatorChain), ss.MovePath)
+    g.POST("/*filePath", mw.DeobfReqBody(ss.ObfuscatorChain), ss.CopyPath)
+
+    return func(method, pth string, req *structs.FileOperationRequest) int {
+        enc, err := obfuscate.Obfuscate([]byte(pth), *ss.ObfuscatorChain.Load())
+        if err != nil {
+            t.Fatal(err)
+        }
+        var body []byte
+        if req != nil {
+            if body, err = json.Marshal(req); err != nil {
+                t.Fatal(err)
+            } else if body, err = obfuscate.Obfuscate(body, *ss.ObfuscatorChain.Load()); err != nil {
+                t.Fatal(err)
+            }
+        }
+        rec := httptest.NewRecorder()
+        r.ServeHTTP(rec, httptest.NewRequest(method, "/manage/"+url.PathEscape(string(enc)), bytes.NewReader(body)))
+        return rec.Code
+    }
+}
+
+// manageServer returns a server restricted by limits whose webroot
+// contains the root directory of a user jailed to /team and a file
+// outside of it.
+func manageServer(t *testing.T, limits upload.Limits) (ss *SkyhookServer, team string) {
+    ss = testUploadServer(t, limits)
+    ss.ObfuscatorChain.Store(&[]obfuscate.Obfuscator{&obfuscate.XOR{Key: "k"}, &obfuscate.Base64{Rounds: 1}})
+    team = filepath.Join(*ss.Webroot, "team")
+    if err := os.Mkdir(team, 0700); err != nil {
+        t.Fatal(err)
+    } else if err = os.WriteFile(filepath.Join(*ss.Webroot, "secret"), []byte("secret"), 0600); err != nil {
+        t.Fatal(err)
+    }
+    return ss, team
+}
+
+// exists determines if pth exists without following symbolic links.
+func exists(pth string) bool {
+    _, err := os.Lstat(pth)
+    return err == nil
+}
+
+func TestSkyhookServer_ManageJail(t *testing.T) {
+    ss, team := manageServer(t, upload.Limits{})
+    send := manageEngine(t, ss, &config.Credential{Username: "op", RootDir: "team"})
+    secret := filepath.Join(*ss.Webroot, "secret")
+
+    // Paths that traverse upward remain within the user's root
+    if code := send(http.MethodPut, "/../../escaped", nil); code != http.StatusOK {
+        t.Errorf("mkdir answered with %d", code)
+    } else if !exists(filepath.Join(team, "escaped")) || exists(filepath.Join(*ss.Webroot, "..", "escaped")) {
+        t.Error("directory wasn't created within the user's root")
+    }
+    if code := send(http.MethodDelete, "/../secret", nil); code != http.StatusNotFound {
+        t.Errorf("delete outside of the root answered with %d", code)
+    }
+
+    if err := os.WriteFile(filepath.Join(team, "loot"), []byte("loot"), 0600); err != nil {
+        t.Fatal(err)
+    }
+    if code := send(http.MethodPatch, "/loot", &structs.FileOperationRequest{Destination: "/../secret", Overwrite: true}); code != http.StatusOK {
+        t.Errorf("move answered with %d", code)
+    } else if !exists(filepath.Join(team, "secret")) {
+        t.Error("file wasn't moved within the user's root")
+    }
+    if code := send(http.MethodPost, "/../../secret", &structs.FileOperationRequest{Destination: "/copy"}); code != http.StatusOK {
+        t.Errorf("copy answered with %d", code)
+    } else if b, _ := os.ReadFile(filepath.Join(team, "copy")); string(b) != "loot" {
+        t.Errorf("content outside of the root was copied: %q", b)
+    }
+
+    if b, err := os.ReadFile(secret); err != nil || string(b) != "secret" {
+        t.Error("file outside of the user's root was modified")
+    }
+
+    // Symbolic links are never followed by copies
+    if err := os.Mkdir(filepath.Join(team, "dir"), 0700); err != nil {
+        t.Fatal(err)
+    } else if err = os.Symlink(secret, filepath.Join(team, "dir", "link")); err != nil {
+        t.Fatal(err)
+    }
+    if code := send(http.MethodPost, "/dir", &structs.FileOperationRequest{Destination: "/dir2"}); code != http.StatusOK {
+        t.Errorf("directory copy answered with %d", code)
+    } else if exists(filepath.Join(team, "dir2", "link")) {
+        t.Error("symbolic link was copied")
+    }
+}
+
+func TestSkyhookServer_ManagePaths(t *testing.T) {
+    ss, team := manageServer(t, upload.Limits{})
+    send := manageEngine(t, ss, &config.Credential{Username: "op", RootDir: "team"})
+
+    if code := send(http.MethodPut, "/a/b", nil); code != http.StatusOK {
+        t.Fatalf("mkdir answered with %d", code)
+    }
+    for _, test := range []struct {
+        method string
+        pth    string
+        req    *structs.FileOperationRequest
+        status int
+    }{
+        {http.MethodPut, "/a/b", nil, http.StatusConflict},
+        {http.MethodDelete, "/", nil, http.StatusForbidden},
+        {http.MethodDelete, "/a", nil, http.StatusConflict},
+        {http.MethodPatch, "/", &structs.FileOperationRequest{Destination: "/root"}, http.StatusForbidden},
+        {http.MethodPatch, "/a", &structs.FileOperationRequest{Destination: "relative"}, http.StatusNotAcceptable},
+        {http.MethodPatch, "/a", &structs.FileOperationRequest{Destination: "/a/b/c"}, http.StatusNotAcceptable},
+        {http.MethodPatch, "/a", &structs.FileOperationRequest{Destination: "/missing/a"}, http.StatusConflict},
+        {http.MethodPatch, "/missing", &structs.FileOperationRequest{Destination: "/b"}, http.StatusNotFound},
+        {http.MethodPost, "/a", &structs.FileOperationRequest{Destination: "/a/b", Overwrite: true}, http.StatusNotAcceptable},
+        {http.MethodPatch, "/a", &structs.FileOperationRequest{Destination: "/c"}, http.StatusOK},
+        {http.MethodPost, "/c", &structs.FileOperationRequest{Destination: "/d"}, http.StatusOK},
+        {http.MethodPost, "/c", &structs.FileOperationRequest{Destination: "/d"}, http.StatusConflict},
+        {http.MethodDelete, "/c", &structs.FileOperationRequest{Recursive: true}, http.StatusOK},
+    } {
+        if code := send(test.method, test.pth, test.req); code != test.status {
+            t.Errorf("%s %s %+v: got %d, want %d", test.method, test.pth, test.req, code, test.status)
+        }
+    }
+    if exists(filepath.Join(team, "a")) || exists(filepath.Join(team, "c")) || !exists(filepath.Join(team, "d", "b")) {
+        t.Error("unexpected directory tree after the operations")
+    }
+
+    // Content being uploaded can't be moved or deleted
+    if _, err := ss.UploadManager.Register(filepath.Join(team, "d", "up"), "/team/d/up", 0, team, "op"); err != nil {
+        t.Fatal(err)
+    }
+    if code := send(http.MethodDelete, "/d", &structs.FileOperationRequest{Recursive: true}); code != http.StatusConflict {
+        t.Errorf("delete of an upload's directory answered with %d", code)
+    }
+    if code := send(http.MethodPatch, "/d", &structs.FileOperationRequest{Destination: "/e"}); code != http.StatusConflict {
+        t.Errorf("move of an upload's directory answered with %d", code)
+    }
+}
+
+func TestSkyhookServer_ManagePermissions(t *testing.T) {
+    ss, team := manageServer(t, upload.Limits{})
+    if err := os.WriteFile(filepath.Join(team, "file"), nil, 0600); err != nil {
+        t.Fatal(err)
+    }
+
+    // Moving requires the delete permission, and copying the
+    // download permission
+    send := manageEngine(t, ss, &config.Credential{Username: "op", RootDir: "team",
+        Permissions: &config.UserPermissions{Upload: true}})
+    for method, req := range map[string]*structs.FileOperationRequest{
+        http.MethodDelete: nil,
+        http.MethodPatch:  {Destination: "/moved"},
+        http.MethodPost:   {Destination: "/copied"},
+    } {
+        if code := send(method, "/file", req); code != http.StatusForbidden {
+            t.Errorf("%s without permission answered with %d", method, code)
+        }
+    }
+
+    send = manageEngine(t, ss, &config.Credential{Username: "op", RootDir: "team",
+        Permissions: &config.UserPermissions{Delete: true}})
+    if code := send(http.MethodPut, "/dir", nil); code != http.StatusForbidden {
+        t.Errorf("mkdir without the upload permission answered with %d", code)
+    }
+    if !exists(filepath.Join(team, "file")) || exists(filepath.Join(team, "dir")) {
+        t.Error("content was changed without permission")
+    }
+}
+
+func TestSkyhookServer_ManageOverwrite(t *testing.T) {
+    ss, team := manageServer(t, upload.Limits{})
+    for name, content := range map[string]string{"src": "new", "dst": "old"} {
+        if err := os.WriteFile(filepath.Join(team, name), []byte(content), 0600); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := os.Mkdir(filepath.Join(team, "dir"), 0700); err != nil {
+        t.Fatal(err)
+    }
+    overwrite := &structs.FileOperationRequest{Destination: "/dst", Overwrite: true}
+    content := func() string {
+        b, _ := os.ReadFile(filepath.Join(team, "dst"))
+        return string(b)
+    }
+
+    // Replacing a file requires the delete permission
+    send := manageEngine(t, ss, &config.Credential{Username: "op", RootDir: "team",
+        Permissions: &config.UserPermissions{Upload: true, Download: true}})
+    if code := send(http.MethodPost, "/src", overwrite); code != http.StatusForbidden {
+        t.Errorf("copy over a file without the delete permission answered with %d", code)
+    } else if content() != "old" {
+        t.Error("file was replaced without the delete permission")
+    }
+
+    send = manageEngine(t, ss, &config.Credential{Username: "op", RootDir: "team"})
+    if code := send(http.MethodPost, "/dir", overwrite); code != http.StatusConflict {
+        t.Errorf("copy of a directory over a file answered with %d", code)
+    }
+    if code := send(http.MethodPost, "/src", overwrite); code != http.StatusOK {
+        t.Errorf("copy over a file answered with %d", code)
+    } else if content() != "new" {
+        t.Errorf("file wasn't replaced by the copy: %q", content())
+    }
+
+    // Staged copies don't remain in the directory
+    if entries, err := os.ReadDir(team); err != nil {
+        t.Fatal(err)
+    } else if len(entries) != 3 {
+        t.Errorf("unexpected directory entries after copying: %v", entries)
+    }
+
+    // A failed copy leaves the destination in place
+    if err := copyPathAtomic(filepath.Join(team, "missing"), filepath.Join(team, "dst")); err == nil {
+        t.Error("copy of a missing file succeeded")
+    } else if content() != "new" {
+        t.Error("failed copy removed the destination")
+    }
+}
+
+func TestSkyhookServer_ManageCopyLimits(t *testing.T) {
+    ss, team := manageServer(t, upload.Limits{MaxFileSize: 50, UserQuota: 100})
+    send := manageEngine(t, ss, &config.Credential{Username: "op", RootDir: "team"})
+    if err := os.WriteFile(filepath.Join(team, "file"), make([]byte, 40), 0600); err != nil {
+        t.Fatal(err)
+    }
+
+    // Copied bytes are charged to the quota
+    if code := send(http.MethodPost, "/file", &structs.FileOperationRequest{Destination: "/a"}); code != http.StatusOK {
+        t.Fatalf("copy within the quota answered with %d", code)
+    }
+    if code := send(http.MethodPost, "/file", &structs.FileOperationRequest{Destination: "/b"}); code != http.StatusRequestEntityTooLarge {
+        t.Errorf("copy exceeding the quota answered with %d", code)
+    } else if exists(filepath.Join(team, "b")) {
+        t.Error("copy exceeding the quota was written")
+    }
+
+    // Files within copied directories are subject to the maximum
+    // file size
+    if err := os.MkdirAll(filepath.Join(team, "dir"), 0700); err != nil {
+        t.Fatal(err)
+    } else if err = os.WriteFile(filepath.Join(team, "dir", "big"), make([]byte, 51), 0600); err != nil {
+        t.Fatal(err)
+    }
+    if code := send(http.MethodPost, "/dir", &structs.FileOperationRequest{Destination: "/dir2"}); code != http.StatusRequestEntityTooLarge {
+        t.Errorf("copy of an oversized file answered with %d", code)
+    }
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+    obfuscate "github.com/blackhillsinfosec/skyhook-obfuscation"
+    "github.com/blackhillsinfosec/skyhook/config"
+    "github.com/blackhillsinfosec/skyhook/log"
+    mw "github.com/blackhillsinfosec/skyhook/server/middleware"
+    "net/http"
+    "reflect"
+    "sync"
+    "sync/atomic"
+)
+
+// swapHandler is an http.Handler that passes requests to a handler
+// that can be replaced while the server is running.
+//
+// Each request loads the current handler once and is served by it
+// to completion, so requests in flight during a swap finish on the
+// engine and obfuscator chain they started with while new requests
+// are served by the replacement. Swapping never waits on requests.
+type swapHandler struct {
+    // mu serializes calls to Swap.
+    mu sync.Mutex
+    h  atomic.Pointer[http.Handler]
+}
+
+// newSwapHandler returns a swapHandler passing requests to h.
+func newSwapHandler(h http.Handler) *swapHandler {
+    s := &swapHandler{}
+    s.h.Store(&h)
+    return s
+}
+
+func (s *swapHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    (*s.h.Load()).ServeHTTP(w, r)
+}
+
+// Swap replaces the current handler with the one returned by f.
+// The current handler is kept when f returns an error.
+func (s *swapHandler) Swap(f func() (http.Handler, error)) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    h, err := f()
+    if err == nil {
+        s.h.Store(&h)
+    }
+    return err
+}
+
+// ReloadChanges describes the settings that changed during a call
+// to SkyhookServer.Reload.
+type ReloadChanges struct {
+    // Live are settings that took effect immediately.
+    Live []string
+    // Restart are settings that take effect only after the
+    // server is restarted.
+    Restart []string
+}
+
+// Log writes the changes to the log.
+func (rc ReloadChanges) Log() {
+    if len(rc.Live) == 0 && len(rc.Restart) == 0 {
+        log.INFO.Println("No configuration changes detected")
+        return
+    }
+    for _, s := range rc.Live {
+        log.INFO.Printf("Applied configuration change: %s", s)
+    }
+    for _, s := range rc.Restart {
+        log.WARN.Printf("Configuration change requires a restart: %s", s)
+    }
+}
+
+// Reload applies global, chain and profiles to a running file
+// server.
+//
+// Routes, middleware and landing files are rebuilt from the new
+// config on a copy of ss, which is swapped in once built. Requests
+// already in flight are unaffected, since the handlers of the
+// previous engine are bound to the previous copy. The previous config
+// is preserved when the new one can't be applied, e.g., due to
+// conflicting routes.
+//
+// Settings captured by the listener or the upload manager, such as
+// the listening socket and TLS files, are reported in the returned
+// ReloadChanges but take effect only after a restart.
+func (ss *SkyhookServer) Reload(global *config.SkyhookConfig, chain *[]obfuscate.Obfuscator, profiles *ObfProfiles) (changes ReloadChanges, err error) {
+    err = ss.handler.Swap(func() (http.Handler, error) {
+        changes = diffConfig(ss.Global, global)
+
+        next := *ss
+        next.Global = global
+        next.Config = &global.FileServer
+        next.Tls = &global.Tls
+        next.Users = &global.Users
+        next.ObfuscatorChain = mw.NewObfChain(chain)
+        profiles.Inherit(ss.Profiles)
+        next.Profiles = profiles
+
+        r, err := next.buildEngine()
+        if err != nil {
+            for realPath, fakePath := range ss.Config.Routes.LandingPage {
+                jsLoaderTempUrls.Insert(realPath, fakePath)
+            }
+            return nil, err
+        }
+        revokeStaleSessions(ss.Sessions, ss.Global.Users, global.Users)
+        *ss = next
+        return r.Handler(), nil
+    })
+    return changes, err
+}
+
+// diffConfig compares the sections of two configs that are relevant
+// to the file server, sorting the names of changed sections by
+// whether they can be applied without a restart.
+func diffConfig(prev, next *config.SkyhookConfig) (changes ReloadChanges) {
+    pf, nf := &prev.FileServer, &next.FileServer
+    for _, s := range []struct {
+        name       string
+        prev, next any
+        restart    bool
+    }{
+        {"file_server_config|interface", pf.Interface, nf.Interface, true},
+        {"file_server_config|port", pf.Port, nf.Port, true},
+        {"file_server_config|transport", pf.Transport, nf.Transport, true},
+        {"file_server_config|unix_socket", pf.UnixSocket, nf.UnixSocket, true},
+        {"file_server_config|upload_options", pf.UploadOptions, nf.UploadOptions, true},
+        {"file_server_config|rotation_options", pf.RotationOptions, nf.RotationOptions, true},
+        {"tls_config", prev.Tls, next.Tls, true},
+        {"tls_profile", prev.TlsProfile, next.TlsProfile, true},
+        {"audit_config", prev.Audit, next.Audit, true},
+        {"file_server_config|additional_cors_urls", pf.AddtlCorsUrls, nf.AddtlCorsUrls, false},
+        {"file_server_config|trusted_proxies", pf.TrustedProxies, nf.TrustedProxies, false},
+        {"file_server_config|root_directory", pf.RootDir, nf.RootDir, false},
+        {"file_server_config|obfuscators", pf.Obfuscators, nf.Obfuscators, false},
+        {"file_server_config|obfuscation_profiles", pf.ObfuscationProfiles, nf.ObfuscationProfiles, false},
+        {"file_server_config|routes", pf.Routes, nf.Routes, false},
+        {"file_server_config|encrypted_loader", pf.EncryptedLoader, nf.EncryptedLoader, false},
+        {"file_server_config|link_fqdns", pf.LinkFqdns, nf.LinkFqdns, false},
+        {"file_server_config|range_header_options", pf.RangeHeaderOptions, nf.RangeHeaderOptions, false},
+        {"file_server_config|compression_options", pf.CompressionOptions, nf.CompressionOptions, false},
+        {"file_server_config|decoy", pf.DecoyOptions, nf.DecoyOptions, false},
+        {"file_server_config|response_profile", pf.ResponseProfile, nf.ResponseProfile, false},
+        {"users", prev.Users, next.Users, false},
+        {"auth_config", prev.Auth, next.Auth, false},
+        {"shutdown_config", prev.Shutdown, next.Shutdown, false},
+    } {
+        if reflect.DeepEqual(s.prev, s.next) {
+            continue
+        } else if s.restart {
+            changes.Restart = append(changes.Restart, s.name)
+        } else {
+            changes.Live = append(changes.Live, s.name)
+        }
+    }
+    return changes
+}
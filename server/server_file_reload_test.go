@@ -0,0 +1,92 @@
+package server
+
+import (
+    "github.com/blackhillsinfosec/skyhook/config"
+    "golang.org/x/exp/slices"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+)
+
+func TestSwapHandler(t *testing.T) {
+    started, release := make(chan struct{}), make(chan struct{})
+    s := newSwapHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        close(started)
+        <-release
+        w.Write([]byte("old"))
+    }))
+
+    slow := httptest.NewRecorder()
+    done := make(chan struct{})
+    go func() {
+        s.ServeHTTP(slow, httptest.NewRequest(http.MethodGet, "/", nil))
+        close(done)
+    }()
+    <-started
+
+    // Neither the swap nor new requests wait on the slow request
+    swapped := make(chan error)
+    go func() {
+        swapped <- s.Swap(func() (http.Handler, error) {
+            return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                w.Write([]byte("new"))
+            }), nil
+        })
+    }()
+    select {
+    case err := <-swapped:
+        if err != nil {
+            t.Fatal(err)
+        }
+    case <-time.After(5 * time.Second):
+        t.Fatal("swap waited on an in-flight request")
+    }
+
+    rec := httptest.NewRecorder()
+    s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+    if rec.Body.String() != "new" {
+        t.Errorf("request after swap was served by %q", rec.Body.String())
+    }
+
+    close(release)
+    <-done
+    if slow.Body.String() != "old" {
+        t.Errorf("in-flight request was served by %q", slow.Body.String())
+    }
+}
+
+func TestDiffConfig(t *testing.T) {
+    prev := &config.SkyhookConfig{}
+    next := &config.SkyhookConfig{}
+    next.FileServer.Transport = config.TransportUnix
+    next.FileServer.UnixSocket = "/run/skyhook.sock"
+    next.FileServer.TrustedProxies = []string{"127.0.0.1"}
+    next.TlsProfile.Preset = config.TlsPresetApache
+    next.FileServer.DecoyOptions.Mode = config.DecoyStatic
+    next.FileServer.ResponseProfile.Server = "nginx"
+
+    changes := diffConfig(prev, next)
+    for _, name := range []string{
+        "file_server_config|transport",
+        "file_server_config|unix_socket",
+        "tls_profile",
+    } {
+        if !slices.Contains(changes.Restart, name) {
+            t.Errorf("%s isn't reported as requiring a restart: %+v", name, changes)
+        }
+    }
+    for _, name := range []string{
+        "file_server_config|trusted_proxies",
+        "file_server_config|decoy",
+        "file_server_config|response_profile",
+    } {
+        if !slices.Contains(changes.Live, name) {
+            t.Errorf("%s isn't reported as applied: %+v", name, changes)
+        }
+    }
+
+    if changes = diffConfig(next, next); len(changes.Live) > 0 || len(changes.Restart) > 0 {
+        t.Errorf("identical configs reported changes: %+v", changes)
+    }
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+    obfuscate "github.com/blackhillsinfosec/skyhook-obfuscation"
+    "github.com/blackhillsinfosec/skyhook/config"
+    "github.com/blackhillsinfosec/skyhook/log"
+    "github.com/blackhillsinfosec/skyhook/server/inspector"
+    mw "github.com/blackhillsinfosec/skyhook/server/middleware"
+    "github.com/gin-gonic/gin"
+    "net/http"
+    "os"
+    "path"
+    "strings"
+)
+
+// ShareDownload serves the file of a share token without requiring
+// authentication. The token must be followed by the path of the
+// shared file, obfuscated with the default chain, and the file is
+// obfuscated with the same chain as it's served.
+//
+// Range requests aren't supported; the entire file is served and
+// charged against the byte limit of the share. All failures result
+// in a 404 response, or the decoy when one is configured.
+func (ss *SkyhookServer) ShareDownload(c *gin.Context) {
+    token := c.Param("token")
+    c.Set("auditMessage", "share token "+token[:min(len(token), 8)])
+
+    sh, ok := ss.Shares.Get(token)
+    if !ok {
+        ss.reject(c, http.StatusNotFound)
+        return
+    }
+
+    //=========================
+    // MATCH THE OBFUSCATED PATH
+    //=========================
+    // - Chains retired by rotation are accepted during their grace
+    //   period, so links remain usable after keys are rotated.
+
+    var chain *[]obfuscate.Obfuscator
+    obfPath := strings.TrimPrefix(c.Param("filepath"), "/")
+    for _, ch := range ss.profileChains(config.DefaultProfile) {
+        if dec, err := obfuscate.Deobfuscate([]byte(obfPath), *ch); err == nil && path.Clean("/"+string(dec)) == sh.Path {
+            chain = ch
+            break
+        }
+    }
+    if chain == nil {
+        ss.reject(c, http.StatusNotFound)
+        return
+    }
+
+    //==============
+    // SERVE THE FILE
+    //==============
+
+    abs, err := inspector.ToAbs(*ss.Webroot, sh.Path)
+    if err != nil {
+        ss.reject(c, http.StatusNotFound)
+        return
+    }
+    f, err := os.Open(abs)
+    if err != nil {
+        ss.reject(c, http.StatusNotFound)
+        return
+    }
+    defer f.Close()
+
+    stat, err := f.Stat()
+    if err != nil || !stat.Mode().IsRegular() {
+        ss.reject(c, http.StatusNotFound)
+        return
+    }
+
+    if _, err = ss.Shares.Redeem(token, uint64(stat.Size())); err != nil {
+        log.WARN.Printf("Refused to serve shared file %s: %v", sh.Path, err)
+        ss.reject(c, http.StatusNotFound)
+        return
+    }
+
+    // Conditional and partial responses would be charged in full
+    for _, h := range []string{"Range", "If-Range", "If-Modified-Since"} {
+        c.Request.Header.Del(h)
+    }
+    c.Writer = mw.NewObfResponseWriter(c.Writer, chain, true)
+    http.ServeContent(c.Writer, c.Request, stat.Name(), stat.ModTime(), f)
+}
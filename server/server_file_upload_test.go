@@ -0,0 +1,196 @@
+package server
+
+import (
+    "bytes"
+    "encoding/json"
+    obfuscate "github.com/blackhillsinfosec/skyhook-obfuscation"
+    structs "github.com/blackhillsinfosec/skyhook/api_structs"
+    "github.com/blackhillsinfosec/skyhook/config"
+    mw "github.com/blackhillsinfosec/skyhook/server/middleware"
+    "github.com/blackhillsinfosec/skyhook/server/obf-stream"
+    "github.com/blackhillsinfosec/skyhook/server/upload"
+    "github.com/gin-gonic/gin"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+// testUploadServer initializes a SkyhookServer with an upload manager
+// restricted by limits and a temporary webroot.
+func testUploadServer(t *testing.T, limits upload.Limits) *SkyhookServer {
+    dir := t.TempDir()
+    store, err := upload.OpenStore(upload.StoreJSON, filepath.Join(dir, "registrants"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    maxDuration := uint(1)
+    m, err := upload.NewManager(store, &maxDuration, limits)
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { m.Close() })
+    return &SkyhookServer{
+        Webroot:         &dir,
+        UploadManager:   m,
+        ObfuscatorChain: mw.NewObfChain(&[]obfuscate.Obfuscator{}),
+    }
+}
+
+// uploadContext returns a context for an upload request for rel with
+// body obfuscated as the DeobfReqBody middleware expects, along with
+// the values set by the upload middleware.
+func uploadContext(t *testing.T, ss *SkyhookServer, rel string, body []byte, rangeStart uint64) (*gin.Context, *httptest.ResponseRecorder) {
+    gin.SetMode(gin.TestMode)
+    enc, err := obfuscate.Obfuscate(body, *ss.ObfuscatorChain.Load())
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    rec := httptest.NewRecorder()
+    c, _ := gin.CreateTestContext(rec)
+    c.Request = httptest.NewRequest(http.MethodPost, "/upload"+rel, nil)
+    c.Request.Body = mw.ByteReadCloser{Src: io.NopCloser(bytes.NewReader(enc)), Chain: ss.ObfuscatorChain.Load()}
+    c.Set("relFilePath", rel)
+    c.Set("absFilePath", filepath.Join(*ss.Webroot, rel))
+    c.Set("userRootPath", "/")
+    c.Set("rangeStart", rangeStart)
+    return c, rec
+}
+
+func TestSkyhookServer_UploadLimits(t *testing.T) {
+    ss := testUploadServer(t, upload.Limits{MaxFileSize: 10})
+
+    // Declared sizes beyond the limit are rejected at registration
+    payload, _ := json.Marshal(structs.RegisterUploadRequest{Size: 11})
+    c, rec := uploadContext(t, ss, "/big", payload, 0)
+    ss.RegisterUpload(c)
+    if rec.Code != http.StatusRequestEntityTooLarge {
+        t.Errorf("oversized registration answered with %d", rec.Code)
+    }
+
+    c, rec = uploadContext(t, ss, "/file", nil, 0)
+    ss.RegisterUpload(c)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("registration answered with %d", rec.Code)
+    }
+
+    // Chunks are rejected once they exceed the limit
+    c, rec = uploadContext(t, ss, "/file", make([]byte, 8), 0)
+    ss.ReceiveChunk(c)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("chunk answered with %d", rec.Code)
+    }
+    c, rec = uploadContext(t, ss, "/file", make([]byte, 8), 8)
+    ss.ReceiveChunk(c)
+    if rec.Code != http.StatusRequestEntityTooLarge {
+        t.Errorf("oversized chunk answered with %d", rec.Code)
+    }
+
+    // Registering an upload twice is a conflict
+    c, rec = uploadContext(t, ss, "/file", nil, 0)
+    ss.RegisterUpload(c)
+    if rec.Code != http.StatusConflict {
+        t.Errorf("duplicate registration answered with %d", rec.Code)
+    }
+}
+
+func TestSkyhookServer_UploadFinished(t *testing.T) {
+    ss := testUploadServer(t, upload.Limits{})
+    c, rec := uploadContext(t, ss, "/file", nil, 0)
+    ss.RegisterUpload(c)
+    c, rec = uploadContext(t, ss, "/file", []byte("01234"), 0)
+    ss.ReceiveChunk(c)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("chunk answered with %d", rec.Code)
+    }
+
+    // Finishing requires a known size
+    c, rec = uploadContext(t, ss, "/file", nil, 0)
+    ss.UploadFinished(c)
+    if rec.Code != http.StatusConflict {
+        t.Errorf("finish without a known size answered with %d", rec.Code)
+    }
+
+    // Missing chunks are listed in the response
+    size := uint64(10)
+    payload, _ := json.Marshal(structs.UploadFinishedRequest{Size: &size})
+    c, rec = uploadContext(t, ss, "/file", payload, 0)
+    ss.UploadFinished(c)
+    resp := structs.UploadFinishedResponse{}
+    if rec.Code != http.StatusConflict {
+        t.Fatalf("finish of a truncated upload answered with %d", rec.Code)
+    } else if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+        t.Fatal(err)
+    } else if len(resp.Gaps) != 1 || resp.Gaps[0] != (upload.ByteRange{Start: 5, End: 10}) {
+        t.Errorf("unexpected gaps: %v", resp.Gaps)
+    }
+    if !ss.UploadManager.RegistrantExists("/file") {
+        t.Fatal("truncated upload was deregistered")
+    }
+
+    c, rec = uploadContext(t, ss, "/file", []byte("56789"), 5)
+    ss.ReceiveChunk(c)
+    c, rec = uploadContext(t, ss, "/file", payload, 0)
+    ss.UploadFinished(c)
+    if rec.Code != http.StatusOK {
+        t.Errorf("finish of a complete upload answered with %d", rec.Code)
+    }
+}
+
+func TestSkyhookServer_ReceiveChunkCompressed(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    ss := testUploadServer(t, upload.Limits{})
+    ss.ObfuscatorChain.Store(&[]obfuscate.Obfuscator{&obfuscate.XOR{Key: "k"}, &obfuscate.Base64{Rounds: 1}})
+    opts := &config.FileServerCompressionOptions{
+        Name:       "Transfer-Coding",
+        Algorithms: []string{config.CompressionGzip, config.CompressionZstd},
+    }
+
+    r := gin.New()
+    r.POST("/upload/*filePath", func(c *gin.Context) {
+        c.Set("relFilePath", c.Param("filePath"))
+        c.Set("rangeStart", uint64(5))
+    }, mw.DeobfReqBody(ss.ObfuscatorChain), mw.Compression(opts), ss.ReceiveChunk)
+
+    content := bytes.Repeat([]byte("0123456789"), 1000)
+    for _, algo := range opts.Algorithms {
+        rel := "/" + algo
+        abs := filepath.Join(*ss.Webroot, algo)
+        if _, err := ss.UploadManager.Register(abs, rel, 0, *ss.Webroot, "op"); err != nil {
+            t.Fatal(err)
+        }
+
+        // Chunks are compressed before they're obfuscated
+        buf := bytes.Buffer{}
+        w, err := obf_stream.NewCompressor(&buf, algo)
+        if err != nil {
+            t.Fatal(err)
+        } else if _, err = w.Write(content); err != nil {
+            t.Fatal(err)
+        } else if err = w.Close(); err != nil {
+            t.Fatal(err)
+        }
+        enc, err := obfuscate.Obfuscate(buf.Bytes(), *ss.ObfuscatorChain.Load())
+        if err != nil {
+            t.Fatal(err)
+        }
+
+        req := httptest.NewRequest(http.MethodPost, "/upload"+rel, bytes.NewReader(enc))
+        req.Header.Set(opts.Name, algo)
+        rec := httptest.NewRecorder()
+        r.ServeHTTP(rec, req)
+        if rec.Code != http.StatusOK {
+            t.Fatalf("%s: chunk answered with %d", algo, rec.Code)
+        }
+
+        // The chunk is written decompressed at its offset
+        if got, err := os.ReadFile(abs); err != nil {
+            t.Fatal(err)
+        } else if !bytes.Equal(got, append(make([]byte, 5), content...)) {
+            t.Errorf("%s: chunk wasn't decompressed (%d bytes written)", algo, len(got))
+        }
+    }
+}
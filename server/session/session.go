@@ -0,0 +1,148 @@
+// Package session tracks the JWTs issued by the file and admin
+// servers, allowing them to be revoked before they expire.
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ClaimKey is the JWT claim holding the ID of a session.
+const ClaimKey = "jti"
+
+// Session describes a JWT issued upon login. Refreshed tokens carry
+// the ID of the original, so a session spans every refresh.
+type Session struct {
+	ID       string `json:"id" yaml:"id"`
+	Username string `json:"username" yaml:"username"`
+	// Server is the server that issued the token, i.e., "file" or
+	// "admin".
+	Server string    `json:"server" yaml:"server"`
+	Issued time.Time `json:"issued" yaml:"issued"`
+	// Expiration is the time beyond which no token of the session
+	// can be used or refreshed. It's extended by each refresh.
+	Expiration time.Time `json:"expiration" yaml:"expiration"`
+	// LastSeen is the time the session was last used to
+	// authenticate a request, and RemoteAddr is the address of the
+	// client that sent it.
+	LastSeen   time.Time `json:"last_seen" yaml:"last_seen"`
+	RemoteAddr string    `json:"remote_addr,omitempty" yaml:"remote_addr,omitempty"`
+}
+
+// Store holds the active sessions of both servers. It's safe for
+// concurrent use.
+//
+// Sessions are held only in memory, so restarting Skyhook revokes
+// every token.
+type Store struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+// NewStore initializes an empty Store.
+func NewStore() *Store {
+	return &Store{sessions: make(map[string]*Session)}
+}
+
+// Start creates a session for username on server that ends after
+// lifetime, returning its ID.
+func (s *Store) Start(username, server string, lifetime time.Duration) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	sess := &Session{
+		ID:         hex.EncodeToString(b),
+		Username:   username,
+		Server:     server,
+		Issued:     now,
+		Expiration: now.Add(lifetime),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[sess.ID] = sess
+	return sess.ID, nil
+}
+
+// Renew extends the session identified by id to end after lifetime,
+// as when its token is refreshed. False is returned when the session
+// isn't active.
+func (s *Store) Renew(id string, lifetime time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess := s.lookup(id)
+	if sess == nil {
+		return false
+	}
+	sess.Expiration = time.Now().Add(lifetime)
+	return true
+}
+
+// Touch determines if the session identified by id is active,
+// recording its use by remoteAddr when it is.
+func (s *Store) Touch(id, remoteAddr string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess := s.lookup(id)
+	if sess == nil {
+		return false
+	}
+	sess.LastSeen, sess.RemoteAddr = time.Now(), remoteAddr
+	return true
+}
+
+// Revoke ends the session identified by id, returning false when no
+// such session is active.
+func (s *Store) Revoke(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ok := s.lookup(id) != nil
+	delete(s.sessions, id)
+	return ok
+}
+
+// RevokeUser ends every session of username, returning the number
+// of sessions ended.
+func (s *Store) RevokeUser(username string) (n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, sess := range s.sessions {
+		if sess.Username == username {
+			delete(s.sessions, id)
+			n++
+		}
+	}
+	return n
+}
+
+// List returns copies of the active sessions, ordered by issue time.
+func (s *Store) List() []Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions := make([]Session, 0, len(s.sessions))
+	for id := range s.sessions {
+		if sess := s.lookup(id); sess != nil {
+			sessions = append(sessions, *sess)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Issued.Before(sessions[j].Issued) })
+	return sessions
+}
+
+// lookup returns the session identified by id, deleting it when
+// expired. s.mu must be held.
+func (s *Store) lookup(id string) *Session {
+	sess := s.sessions[id]
+	if sess != nil && time.Now().After(sess.Expiration) {
+		delete(s.sessions, id)
+		return nil
+	}
+	return sess
+}
@@ -0,0 +1,33 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	s := NewStore()
+
+	a, _ := s.Start("alice", "file", time.Hour)
+	b, _ := s.Start("alice", "admin", time.Hour)
+	c, _ := s.Start("bob", "file", time.Hour)
+	expired, _ := s.Start("bob", "file", -time.Second)
+
+	if !s.Touch(a, "127.0.0.1") {
+		t.Fatal("active session was rejected")
+	} else if s.Touch(expired, "127.0.0.1") || s.Renew(expired, time.Hour) {
+		t.Fatal("expired session was accepted")
+	}
+
+	if n := s.RevokeUser("alice"); n != 2 {
+		t.Fatalf("expected 2 sessions to be revoked, got %d", n)
+	} else if s.Touch(a, "") || s.Touch(b, "") {
+		t.Fatal("revoked session was accepted")
+	}
+
+	if !s.Revoke(c) || s.Revoke(c) {
+		t.Fatal("expected the session to be revoked exactly once")
+	} else if len(s.List()) != 0 {
+		t.Fatal("expected no sessions to remain")
+	}
+}
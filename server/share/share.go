@@ -0,0 +1,147 @@
+// Package share grants unauthenticated access to individual files
+// via expiring tokens.
+package share
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrUnknownShare is returned when a share token doesn't exist,
+	// has expired, or has already been used.
+	ErrUnknownShare = errors.New("unknown share token")
+	// ErrShareLimit is returned when serving a file would exceed the
+	// byte limit of a share token.
+	ErrShareLimit = errors.New("share token byte limit exceeded")
+)
+
+// Share grants access to a single file without authentication.
+type Share struct {
+	Token string `json:"token" yaml:"token"`
+	// Path is the path of the shared file, relative to the webroot.
+	Path       string    `json:"path" yaml:"path"`
+	Created    time.Time `json:"created" yaml:"created"`
+	Expiration time.Time `json:"expiration" yaml:"expiration"`
+	// SingleUse shares are revoked once the file is served.
+	SingleUse bool `json:"single_use" yaml:"single_use"`
+	// MaxBytes is the total number of bytes that can be served, or
+	// zero when unlimited.
+	MaxBytes uint64 `json:"max_bytes" yaml:"max_bytes"`
+	// Served is the number of bytes served so far.
+	Served uint64 `json:"served" yaml:"served"`
+	// Uses is the number of times the file has been served.
+	Uses uint `json:"uses" yaml:"uses"`
+}
+
+// Tokens holds the share tokens minted by the admin server. It's
+// shared with the file server, which redeems them, and is safe for
+// concurrent use.
+//
+// Tokens are held only in memory, so restarting Skyhook revokes
+// every share.
+type Tokens struct {
+	mu     sync.Mutex
+	shares map[string]*Share
+}
+
+// NewTokens initializes an empty set of share tokens.
+func NewTokens() *Tokens {
+	return &Tokens{shares: make(map[string]*Share)}
+}
+
+// Mint creates a share token for the file at rel, relative to the
+// webroot, that expires after ttl.
+func (s *Tokens) Mint(rel string, ttl time.Duration, singleUse bool, maxBytes uint64) (Share, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return Share{}, err
+	}
+
+	now := time.Now()
+	sh := &Share{
+		Token:      base64.RawURLEncoding.EncodeToString(b),
+		Path:       rel,
+		Created:    now,
+		Expiration: now.Add(ttl),
+		SingleUse:  singleUse,
+		MaxBytes:   maxBytes,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shares[sh.Token] = sh
+	return *sh, nil
+}
+
+// Get returns the unexpired share identified by token.
+func (s *Tokens) Get(token string) (Share, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sh := s.lookup(token); sh != nil {
+		return *sh, true
+	}
+	return Share{}, false
+}
+
+// Redeem charges size bytes to the share identified by token,
+// revoking it when it's single use. ErrShareLimit is returned when
+// size exceeds the bytes remaining.
+func (s *Tokens) Redeem(token string, size uint64) (Share, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sh := s.lookup(token)
+	if sh == nil {
+		return Share{}, ErrUnknownShare
+	} else if sh.MaxBytes > 0 && sh.Served+size > sh.MaxBytes {
+		return *sh, ErrShareLimit
+	}
+
+	sh.Served += size
+	sh.Uses++
+	if sh.SingleUse {
+		delete(s.shares, token)
+	}
+	return *sh, nil
+}
+
+// Revoke deletes the share identified by token, returning false
+// when no such share exists.
+func (s *Tokens) Revoke(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.shares[token]
+	delete(s.shares, token)
+	return ok
+}
+
+// List returns copies of all unexpired shares, ordered by creation.
+func (s *Tokens) List() []Share {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shares := make([]Share, 0, len(s.shares))
+	for token := range s.shares {
+		if sh := s.lookup(token); sh != nil {
+			shares = append(shares, *sh)
+		}
+	}
+	sort.Slice(shares, func(i, j int) bool { return shares[i].Created.Before(shares[j].Created) })
+	return shares
+}
+
+// lookup returns the share identified by token, deleting it when
+// expired. s.mu must be held.
+func (s *Tokens) lookup(token string) *Share {
+	sh := s.shares[token]
+	if sh != nil && time.Now().After(sh.Expiration) {
+		delete(s.shares, token)
+		return nil
+	}
+	return sh
+}
@@ -0,0 +1,33 @@
+package share
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokens_Redeem(t *testing.T) {
+	tokens := NewTokens()
+
+	single, _ := tokens.Mint("/a", time.Hour, true, 0)
+	if _, err := tokens.Redeem(single.Token, 10); err != nil {
+		t.Fatal(err)
+	} else if _, err = tokens.Redeem(single.Token, 10); err != ErrUnknownShare {
+		t.Fatalf("single use token was redeemed twice: %v", err)
+	}
+
+	limited, _ := tokens.Mint("/b", time.Hour, false, 15)
+	if _, err := tokens.Redeem(limited.Token, 10); err != nil {
+		t.Fatal(err)
+	} else if _, err = tokens.Redeem(limited.Token, 10); err != ErrShareLimit {
+		t.Fatalf("expected the byte limit to be exceeded: %v", err)
+	} else if sh, err := tokens.Redeem(limited.Token, 5); err != nil || sh.Uses != 2 {
+		t.Fatalf("expected the remaining bytes to be served: %v", err)
+	}
+
+	expired, _ := tokens.Mint("/c", -time.Second, false, 0)
+	if _, err := tokens.Redeem(expired.Token, 1); err != ErrUnknownShare {
+		t.Fatalf("expired token was redeemed: %v", err)
+	} else if len(tokens.List()) != 1 {
+		t.Fatalf("expected only the limited token to remain")
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd
+
+package upload
+
+import "errors"
+
+// freeSpace always fails because free space can't be determined
+// on this platform. Limits.MinFreeSpace must be zero.
+func freeSpace(dir string) (uint64, error) {
+	return 0, errors.New("free disk space can't be determined on this platform")
+}
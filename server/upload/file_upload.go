@@ -1,118 +1,283 @@
 package upload
 
 import (
-	"encoding/json"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"github.com/blackhillsinfosec/skyhook/audit"
 	"github.com/blackhillsinfosec/skyhook/log"
 	"golang.org/x/exp/maps"
 	"io"
+	"io/fs"
 	"os"
 	"path"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+var (
+	// ErrUnknownUpload is returned when an operation targets
+	// an upload that has not been registered.
+	ErrUnknownUpload = errors.New("upload does not exist")
+	// ErrIncomplete is returned by Manager.Finish when byte
+	// ranges of the file have not been received.
+	ErrIncomplete = errors.New("upload is missing chunks")
+	// ErrSizeMismatch is returned by Manager.Finish when the
+	// size of the file on disk differs from the expected size.
+	ErrSizeMismatch = errors.New("upload size does not match expected size")
+	// ErrChecksumMismatch is returned by Manager.Finish when the
+	// SHA-256 digest of the file differs from the expected value.
+	ErrChecksumMismatch = errors.New("upload checksum does not match expected checksum")
+	// ErrSizeUnknown is returned by Manager.Finish when the size of
+	// the file was neither declared at registration nor supplied.
+	ErrSizeUnknown = errors.New("upload size is unknown")
+)
+
+// Manager tracks registered uploads and writes their chunks to disk.
+//
+// A Manager is safe for concurrent use. Uploads are persisted to a
+// Store, allowing the server to recover them after a restart.
 type Manager struct {
-	registrants       map[string]*Upload
-	registrantsFile   *string
+	// mu guards registrants. The mutex of a registrant may be held
+	// while acquiring mu, but never the reverse.
+	mu                sync.Mutex
+	registrants       map[string]*registrant
+	store             Store
 	maxUploadDuration *uint
-	writeMu           sync.Mutex
+	limits            Limits
+	// freeSpace returns the free space of the filesystem containing
+	// a directory.
+	freeSpace func(dir string) (uint64, error)
+	// usageMu guards usageCache, which holds the disk usage of each
+	// user's root directory; see Manager.usage.
+	usageMu    sync.Mutex
+	usageCache map[string]*rootUsage
 }
 
-// Register manages creation of upload registrants.
-func (m Manager) Register(afp, rfp string) (up Upload, err error) {
-	if !m.RegistrantExists(rfp) {
-		if up, err = NewUpload(afp, rfp, *m.maxUploadDuration); err == nil {
-			m.registrants[rfp] = &up
-			if err = m.SaveRegistrants(); err != nil {
-				err = errors.New(fmt.Sprintf("failed to write upload registrant file: %v", err))
-			} else {
-				log.INFO.Printf("Created new upload for: %s", up.RelPath)
-			}
-		}
+// registrant is a registered upload. mu serializes changes to the
+// upload and writes to its file.
+type registrant struct {
+	mu sync.Mutex
+	up Upload
+	// removed is set once the upload is finished or canceled, failing
+	// any operation that was waiting on mu.
+	removed bool
+	// remaining is the number of declared bytes that have yet to be
+	// received. It's read without mu; see Manager.reserved.
+	remaining atomic.Uint64
+}
+
+// newRegistrant initializes a registrant for up.
+func newRegistrant(up Upload) *registrant {
+	r := &registrant{up: up}
+	r.updateRemaining()
+	return r
+}
+
+// updateRemaining recalculates remaining after bytes are received.
+func (r *registrant) updateRemaining() {
+	if received := r.up.BytesReceived(); r.up.Size > received {
+		r.remaining.Store(r.up.Size - received)
 	} else {
-		log.WARN.Printf("Upload already exists for: %s", up.RelPath)
-		log.WARN.Printf("Failed to create new upload for: %s", up.RelPath)
-		err = errors.New("upload already exists")
+		r.remaining.Store(0)
 	}
-	return up, err
 }
 
-// Deregister removes a registered upload from the registrants list
-// and updates the manifest file.
-func (m Manager) Deregister(relPath string) (err error) {
-	if !m.RegistrantExists(relPath) {
-		err = errors.New("upload does not exist")
-	} else {
-		log.INFO.Printf("Upload finished: %v", relPath)
-		delete(m.registrants, relPath)
-		m.SaveRegistrants()
+// acquire returns the registrant for relPath with its mutex locked,
+// or nil when no such upload is registered.
+func (m *Manager) acquire(relPath string) *registrant {
+	m.mu.Lock()
+	r := m.registrants[relPath]
+	m.mu.Unlock()
+	if r == nil {
+		return nil
 	}
-	return err
+
+	r.mu.Lock()
+	if r.removed {
+		r.mu.Unlock()
+		return nil
+	}
+	return r
 }
 
-// SaveRegistrants is responsible for saving current registrants
-// to disk, allowing the server to recover from fatal events.
-func (m Manager) SaveRegistrants() error {
-	m.writeMu.Lock()
-	defer m.writeMu.Unlock()
+// remove deregisters r, which must be locked, and deletes it from
+// the store.
+func (m *Manager) remove(r *registrant) error {
+	r.removed = true
+	m.mu.Lock()
+	if m.registrants[r.up.RelPath] == r {
+		delete(m.registrants, r.up.RelPath)
+	}
+	m.mu.Unlock()
+	return m.store.Delete(r.up.RelPath)
+}
 
-	if f, err := os.OpenFile(*m.registrantsFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600); err == nil {
-		var data []byte
-		if data, err = json.Marshal(&m.registrants); err == nil {
-			_, err = f.Write(data)
+// snapshot returns the registrants with a relative path accepted by
+// match, which are locked only long enough to copy their uploads.
+func (m *Manager) snapshot(match func(relPath string) bool) (u []Upload) {
+	m.mu.Lock()
+	regs := make([]*registrant, 0, len(m.registrants))
+	for relPath, r := range m.registrants {
+		if match(relPath) {
+			regs = append(regs, r)
 		}
-		return f.Close()
-	} else {
-		return err
 	}
+	m.mu.Unlock()
+
+	for _, r := range regs {
+		r.mu.Lock()
+		if !r.removed {
+			u = append(u, r.up.clone())
+		}
+		r.mu.Unlock()
+	}
+	return u
+}
+
+// Register manages creation of upload registrants.
+//
+// size is the expected size of the file in bytes, or zero when
+// unknown, quotaRoot is the absolute path to the root directory
+// of the registering user and owner is their username. The upload
+// is rejected when it exceeds the limits of the manager; see Limits.
+func (m *Manager) Register(afp, rfp string, size uint64, quotaRoot, owner string) (up Upload, err error) {
+	used, free, err := m.measure(afp, quotaRoot)
+	if err != nil {
+		return up, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.registrants[rfp] != nil {
+		log.WARN.Printf("Upload already exists for: %s", rfp)
+		log.WARN.Printf("Failed to create new upload for: %s", rfp)
+		return up, errors.New("upload already exists")
+	}
+
+	if up, err = NewUpload(afp, rfp, *m.maxUploadDuration); err != nil {
+		return up, err
+	} else if err = m.checkRegistration(size, quotaRoot, used, free); err != nil {
+		log.WARN.Printf("Rejected upload for %s: %v", rfp, err)
+		return up, err
+	}
+	up.Size, up.QuotaRoot, up.Owner = size, quotaRoot, owner
+
+	if err = m.store.Put(up); err != nil {
+		return up, errors.New(fmt.Sprintf("failed to persist upload registrant: %v", err))
+	}
+	m.registrants[rfp] = newRegistrant(up)
+	log.INFO.Printf("Created new upload for: %s", up.RelPath)
+	return up, nil
+}
+
+// Deregister removes a registered upload from the registrants list
+// and the store.
+func (m *Manager) Deregister(relPath string) error {
+	r := m.acquire(relPath)
+	if r == nil {
+		return ErrUnknownUpload
+	}
+	defer r.mu.Unlock()
+
+	log.INFO.Printf("Upload finished: %v", relPath)
+	if err := m.remove(r); err != nil {
+		log.ERR.Printf("Failed to remove upload registrant: %v", err)
+	}
+	return nil
 }
 
 // CancelUpload is responsible for removing any partially uploaded
 // files and removing the registered upload.
-func (m Manager) CancelUpload(relPath string) error {
-	up := m.registrants[relPath]
-	if up == nil {
-		return errors.New("unknown upload requested")
-	}
-
-	up.mu.Lock()
-	defer func() {
-		up.mu.Unlock()
-		delete(m.registrants, up.RelPath)
-		m.SaveRegistrants()
-	}()
-
-	if _, err := os.Stat(up.AbsPath); err == nil {
-		if err := os.Remove(up.AbsPath); err != nil {
-			return errors.New("failed to cancel upload")
-		}
+func (m *Manager) CancelUpload(relPath string) error {
+	r := m.acquire(relPath)
+	if r == nil {
+		return ErrUnknownUpload
 	}
+	defer r.mu.Unlock()
 
 	log.INFO.Printf("Canceling upload: %v", relPath)
+	return m.cancel(r)
+}
 
-	return nil
+// cancel removes the file and registrant of r, which must be
+// locked. The registrant is removed even when the file can't be.
+func (m *Manager) cancel(r *registrant) (err error) {
+	if rErr := os.Remove(r.up.AbsPath); rErr != nil && !errors.Is(rErr, fs.ErrNotExist) {
+		err = errors.New("failed to cancel upload")
+	}
+	if sErr := m.remove(r); sErr != nil {
+		log.ERR.Printf("Failed to remove upload registrant: %v", sErr)
+	}
+	return err
 }
 
-// ScanExpired iterates over each registered upload and removes
-// those with an expired timestamp.
+// Extend postpones the expiration of the upload identified by
+// relPath by d, returning a copy of the updated upload. Uploads that
+// have already expired are extended from the current time.
+func (m *Manager) Extend(relPath string, d time.Duration) (Upload, error) {
+	r := m.acquire(relPath)
+	if r == nil {
+		return Upload{}, ErrUnknownUpload
+	}
+	defer r.mu.Unlock()
+
+	if now := time.Now(); r.up.Expiration.Before(now) {
+		r.up.Expiration = now
+	}
+	r.up.Expiration = r.up.Expiration.Add(d)
+	if err := m.store.Put(r.up); err != nil {
+		return r.up.clone(), errors.New(fmt.Sprintf("failed to persist upload registrant: %v", err))
+	}
+	log.INFO.Printf("Extended expiration of upload %s to %v", relPath, r.up.Expiration)
+	return r.up.clone(), nil
+}
+
+// ScanExpired calls RemoveExpired every interval until stop is
+// closed. A nil stop channel scans indefinitely.
 //
 // This is effectively housekeeping to clean up after failures.
-func (m Manager) ScanExpired() {
+func (m *Manager) ScanExpired(interval time.Duration, stop <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
 	for {
-		for _, up := range m.registrants {
-			if up.mu.TryLock() {
-				if time.Now().After(up.Expiration) {
-					log.INFO.Printf("Upload expired: %v", up.RelPath)
-					up.mu.Unlock()
-					m.CancelUpload(up.RelPath)
-				} else {
-					up.mu.Unlock()
-				}
-			}
+		m.RemoveExpired()
+		select {
+		case <-stop:
+			return
+		case <-t.C:
 		}
-		time.Sleep(time.Minute)
+	}
+}
+
+// RemoveExpired cancels each registered upload with an expired
+// timestamp. Uploads that are busy, e.g., receiving a chunk, are
+// skipped until the next call.
+func (m *Manager) RemoveExpired() {
+	m.mu.Lock()
+	regs := maps.Values(m.registrants)
+	m.mu.Unlock()
+
+	for _, r := range regs {
+		if !r.mu.TryLock() {
+			continue
+		}
+		if !r.removed && time.Now().After(r.up.Expiration) {
+			log.INFO.Printf("Upload expired: %v", r.up.RelPath)
+			audit.Log(audit.Record{
+				Event:  audit.EventUploadExpire,
+				Server: "file",
+				Path:   r.up.RelPath,
+			})
+			m.cancel(r)
+		}
+		r.mu.Unlock()
 	}
 }
 
@@ -120,98 +285,352 @@ func (m Manager) ScanExpired() {
 // of the Upload identified by relPath. The chunk is written
 // to the file at the byte offset identified by off.
 //
-// An error is returned when opening or writing to the file
-// fails.
-func (m Manager) SaveChunk(relPath string, chunk []byte, off uint64) error {
-	up := m.registrants[relPath]
-	if up == nil {
-		return errors.New("unknown upload specified")
+// See SaveChunkFrom.
+func (m *Manager) SaveChunk(relPath string, chunk []byte, off uint64) error {
+	_, err := m.SaveChunkFrom(relPath, bytes.NewReader(chunk), off)
+	return err
+}
+
+// SaveChunkFrom streams a chunk of data from r to the
+// Upload.AbsPath of the Upload identified by relPath, starting
+// at the byte offset identified by off. The number of bytes
+// written is returned.
+//
+// The byte range covered by the chunk is recorded in
+// Upload.Received and persisted to the store, allowing clients
+// to resume interrupted uploads. Nothing is recorded when
+// reading from r fails, since the chunk may be incomplete.
+// Chunks of the same upload are written one at a time.
+//
+// An error is returned when opening, reading from r, or writing
+// to the file fails. Chunks that exceed the limits of the manager
+// fail with the corresponding error before the excess is written;
+// see IsLimitError.
+func (m *Manager) SaveChunkFrom(relPath string, r io.Reader, off uint64) (n int64, err error) {
+	reg := m.acquire(relPath)
+	if reg == nil {
+		return 0, ErrUnknownUpload
 	}
+	defer reg.mu.Unlock()
 
-	up.mu.Lock()
-	defer up.mu.Unlock()
+	if r, err = m.chunkLimit(reg, r, off); err != nil {
+		return 0, err
+	}
 
 	// Open/create the file for writing
-	if f, err := os.OpenFile(up.AbsPath, os.O_CREATE|os.O_RDWR, 0600); err != nil {
-		return errors.New("failed to open upload file for writing")
-	} else {
-		// Write at the specified offset
-		if _, err := f.WriteAt(chunk, int64(off)); err != nil {
-			return errors.New("failed to write to upload file")
-		}
-		return f.Close()
+	f, err := os.OpenFile(reg.up.AbsPath, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return 0, errors.New("failed to open upload file for writing")
+	}
+	var prev int64
+	if stat, sErr := f.Stat(); sErr == nil {
+		prev = stat.Size()
 	}
-}
 
-// Get attempts to retrieve the upload tracked by target.
-func (m Manager) Get(relPath string) (Upload, error) {
-	if m.registrants[relPath] == nil {
-		return Upload{}, errors.New("upload not found")
-	} else {
-		return *m.registrants[relPath], nil
+	// Write at the specified offset, charging the growth of the
+	// file to the cached usage of the user's root directory
+	n, err = writeAtFrom(f, r, int64(off))
+	if end := int64(off) + n; end > prev && reg.up.QuotaRoot != "" {
+		m.grow(reg.up.QuotaRoot, uint64(end-prev))
+	}
+	if err != nil {
+		f.Close()
+		return n, err
+	} else if err = f.Close(); err != nil {
+		return n, err
+	}
+
+	//==========================
+	// RECORD THE RECEIVED RANGE
+	//==========================
+
+	if n > 0 {
+		reg.up.addReceived(off, off+uint64(n))
+		reg.up.LastChunk = time.Now()
+		reg.updateRemaining()
+	}
+
+	if err = m.store.Put(reg.up); err != nil {
+		log.ERR.Printf("Failed to persist upload registrant: %v", err)
 	}
+	return n, nil
 }
 
-func (m Manager) ListAll() (u []Upload) {
-	m.writeMu.Lock()
-	defer m.writeMu.Unlock()
-	for _, v := range maps.Values(m.registrants) {
-		u = append(u, *v)
+// writeAtFrom copies r to f starting at off, returning the number
+// of bytes written.
+func writeAtFrom(f *os.File, r io.Reader, off int64) (n int64, err error) {
+	buf := make([]byte, 32*1024)
+	for {
+		rn, rErr := r.Read(buf)
+		if rn > 0 {
+			if _, err = f.WriteAt(buf[:rn], off+n); err != nil {
+				return n, errors.New("failed to write to upload file")
+			}
+			n += int64(rn)
+		}
+		if rErr == io.EOF {
+			return n, nil
+		} else if IsLimitError(rErr) {
+			return n, rErr
+		} else if rErr != nil {
+			return n, errors.New(fmt.Sprintf("failed to read chunk: %v", rErr))
+		}
 	}
-	return u
 }
 
-// RegistrantExists searches registrants to determine if one
-// exists.
+// Finish verifies the upload identified by relPath and deregisters
+// it once verification succeeds.
 //
-// See Get for more information on target.
-func (m Manager) RegistrantExists(relPath string) bool {
-	if _, err := m.Get(relPath); err != nil {
-		return false
+// size is the expected size of the file in bytes. When nil, the size
+// declared at registration is used, and ErrSizeUnknown is returned
+// when none was declared; the end of the furthest chunk received
+// can't be trusted, since the final chunks may be missing. sha256Sum
+// is the hex encoded SHA-256 digest of the expected file content, and
+// digest verification is skipped when it's empty.
+//
+// ErrIncomplete is returned along with the missing byte ranges when
+// chunks are absent, while ErrSizeMismatch and ErrChecksumMismatch
+// indicate that the content on disk is corrupt. The upload remains
+// registered in these cases so the client can resend chunks and try
+// again.
+func (m *Manager) Finish(relPath string, size *uint64, sha256Sum string) (gaps []ByteRange, err error) {
+	r := m.acquire(relPath)
+	if r == nil {
+		return nil, ErrUnknownUpload
+	}
+	defer r.mu.Unlock()
+
+	expected := r.up.Size
+	if size != nil {
+		expected = *size
+	} else if expected == 0 {
+		log.WARN.Printf("Upload verification failed for %s: %v", relPath, ErrSizeUnknown)
+		return nil, ErrSizeUnknown
+	}
+
+	if err = r.up.verify(expected, sha256Sum); err == ErrIncomplete {
+		gaps = r.up.Gaps(expected)
+	}
+
+	if err != nil {
+		log.WARN.Printf("Upload verification failed for %s: %v", relPath, err)
+		return gaps, err
+	}
+
+	log.INFO.Printf("Upload finished: %v", relPath)
+	if sErr := m.remove(r); sErr != nil {
+		log.ERR.Printf("Failed to remove upload registrant: %v", sErr)
+	}
+	return nil, nil
+}
+
+// Get attempts to retrieve a copy of the upload tracked by relPath.
+func (m *Manager) Get(relPath string) (Upload, error) {
+	r := m.acquire(relPath)
+	if r == nil {
+		return Upload{}, errors.New("upload not found")
 	}
-	return true
+	defer r.mu.Unlock()
+	return r.up.clone(), nil
 }
 
-// NewManager initializes an Manager. Should regFile
-// be non-nil, logic will attempt to read the file from disk and
-// parse it accordingly.
-func NewManager(regFile *string, maxUploadDuration *uint) (um Manager, err error) {
+// ListAll returns copies of all registered uploads.
+func (m *Manager) ListAll() []Upload {
+	return m.snapshot(func(string) bool { return true })
+}
 
-	r := make(map[string]*Upload)
-	if regFile != nil {
+// ListWithin returns all uploads with a relative path beneath the
+// web path root, e.g., "/engagement-1".
+func (m *Manager) ListWithin(root string) []Upload {
+	root = path.Clean("/" + root)
+	return m.snapshot(func(relPath string) bool {
+		return root == "/" || relPath == root || strings.HasPrefix(relPath, root+"/")
+	})
+}
 
-		//===========================
-		// LOAD REGISTRANTS FROM FILE
-		//===========================
+// RegistrantExists determines if an upload is registered for
+// relPath.
+func (m *Manager) RegistrantExists(relPath string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.registrants[relPath] != nil
+}
 
-		var f *os.File
-		if f, err = os.OpenFile(*regFile, os.O_CREATE|os.O_RDONLY, 0600); err == nil {
-			var b []byte
-			if b, err = io.ReadAll(f); err == nil && len(b) > 0 {
-				if err = json.Unmarshal(b, &r); err != nil {
-					return um, err
-				}
-			}
-			if err = f.Close(); err != nil {
-				return um, err
-			}
-		}
+// Close closes the store of the manager. The manager must not be
+// used afterward.
+func (m *Manager) Close() error {
+	return m.store.Close()
+}
 
+// NewManager initializes a Manager, recovering uploads registered
+// before a restart from store. Uploads are restricted by limits.
+func NewManager(store Store, maxUploadDuration *uint, limits Limits) (*Manager, error) {
+	ups, err := store.Load()
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("failed to load upload registrants: %v", err))
 	}
 
-	return Manager{
-		registrants:       r,
-		registrantsFile:   regFile,
+	m := &Manager{
+		registrants:       make(map[string]*registrant, len(ups)),
+		store:             store,
 		maxUploadDuration: maxUploadDuration,
-		writeMu:           sync.Mutex{},
-	}, err
+		limits:            limits,
+		freeSpace:         freeSpace,
+		usageCache:        make(map[string]*rootUsage),
+	}
+	for relPath, up := range ups {
+		m.registrants[relPath] = newRegistrant(up)
+	}
+	return m, nil
+}
+
+// ByteRange describes a range of bytes within a file. Start is
+// inclusive and End is exclusive.
+type ByteRange struct {
+	Start uint64 `json:"start" yaml:"start"`
+	End   uint64 `json:"end" yaml:"end"`
+}
+
+// Gaps returns the byte ranges between zero and size that are not
+// covered by received, which must be sorted and merged as maintained
+// by Upload.Received.
+//
+// When size is zero, the end of the final received range is used.
+func Gaps(received []ByteRange, size uint64) (gaps []ByteRange) {
+	if size == 0 && len(received) > 0 {
+		size = received[len(received)-1].End
+	}
+
+	var off uint64
+	for _, r := range received {
+		if r.Start > off {
+			gaps = append(gaps, ByteRange{Start: off, End: r.Start})
+		}
+		if r.End > off {
+			off = r.End
+		}
+	}
+
+	if off < size {
+		gaps = append(gaps, ByteRange{Start: off, End: size})
+	}
+
+	return gaps
 }
 
 type Upload struct {
 	AbsPath    string    `json:"abs_path" yaml:"abs_path"`
 	RelPath    string    `json:"rel_path" yaml:"rel_path"`
 	Expiration time.Time `json:"expiration" yaml:"expiration"`
-	mu         sync.Mutex
+	// Received is a sorted slice of non-overlapping byte ranges
+	// that have been written to AbsPath.
+	Received []ByteRange `json:"received" yaml:"received"`
+	// Size is the size of the file declared at registration, or
+	// zero when unknown.
+	Size uint64 `json:"size,omitempty" yaml:"size,omitempty"`
+	// QuotaRoot is the absolute path to the root directory of the
+	// user that registered the upload, which is charged for it.
+	QuotaRoot string `json:"quota_root,omitempty" yaml:"quota_root,omitempty"`
+	// Owner is the username of the user that registered the upload.
+	Owner string `json:"owner,omitempty" yaml:"owner,omitempty"`
+	// Started is the time the upload was registered.
+	Started time.Time `json:"started" yaml:"started"`
+	// LastChunk is the time the most recent chunk was received,
+	// or zero when none has been.
+	LastChunk time.Time `json:"last_chunk" yaml:"last_chunk"`
+}
+
+// BytesReceived returns the number of bytes of the upload that have
+// been written to AbsPath.
+func (u *Upload) BytesReceived() (n uint64) {
+	for _, r := range u.Received {
+		n += r.End - r.Start
+	}
+	return n
+}
+
+// clone returns a copy of u that shares no memory with it.
+func (u Upload) clone() Upload {
+	u.Received = append([]ByteRange(nil), u.Received...)
+	return u
+}
+
+// Gaps returns the byte ranges of the upload that have yet to be
+// received. See Gaps for more information on size.
+func (u *Upload) Gaps(size uint64) []ByteRange {
+	return Gaps(u.Received, size)
+}
+
+// addReceived records a received byte range, merging it with any
+// overlapping or adjacent ranges. Received is replaced rather than
+// modified in place, so copies of u are unaffected.
+func (u *Upload) addReceived(start, end uint64) {
+	rs := make([]ByteRange, 0, len(u.Received)+1)
+	rs = append(append(rs, u.Received...), ByteRange{Start: start, End: end})
+	sort.Slice(rs, func(i, j int) bool {
+		return rs[i].Start < rs[j].Start
+	})
+
+	merged := []ByteRange{rs[0]}
+	for _, r := range rs[1:] {
+		last := &merged[len(merged)-1]
+		if r.Start <= last.End {
+			if r.End > last.End {
+				last.End = r.End
+			}
+		} else {
+			merged = append(merged, r)
+		}
+	}
+	u.Received = merged
+}
+
+// verify checks that all bytes up to size have been received and
+// that the file on disk matches size and sha256Sum.
+//
+// See Manager.Finish for more information on the parameters.
+func (u *Upload) verify(size uint64, sha256Sum string) (err error) {
+	if len(u.Gaps(size)) > 0 {
+		return ErrIncomplete
+	}
+
+	//=========================
+	// OPEN THE FILE FOR HASHING
+	//=========================
+	// Zero-byte uploads never receive a chunk, so the file
+	// is created here when necessary.
+
+	var f *os.File
+	if f, err = os.OpenFile(u.AbsPath, os.O_CREATE|os.O_RDONLY, 0600); err != nil {
+		return errors.New("failed to open upload file for verification")
+	}
+	defer f.Close()
+
+	var stat os.FileInfo
+	if stat, err = f.Stat(); err != nil {
+		return errors.New("failed to stat upload file for verification")
+	} else if uint64(stat.Size()) != size {
+		return ErrSizeMismatch
+	}
+
+	if sha256Sum == "" {
+		return nil
+	}
+
+	//==================
+	// COMPARE THE DIGEST
+	//==================
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return errors.New("failed to hash upload file for verification")
+	}
+
+	if hex.EncodeToString(h.Sum(nil)) != strings.ToLower(sha256Sum) {
+		return ErrChecksumMismatch
+	}
+
+	return nil
 }
 
 func NewUpload(abs, rel string, maxDuration uint) (u Upload, err error) {
@@ -236,13 +655,13 @@ func NewUpload(abs, rel string, maxDuration uint) (u Upload, err error) {
 		}
 	}
 
-	// TODO should probably check disk space, too
+	now := time.Now()
 	u = Upload{
 		//Id:         uuid.New().String(),
 		AbsPath:    abs,
 		RelPath:    rel,
-		Expiration: time.Now().Add(time.Duration(maxDuration) * time.Hour),
-		mu:         sync.Mutex{},
+		Expiration: now.Add(time.Duration(maxDuration) * time.Hour),
+		Started:    now,
 	}
 	return u, err
 }
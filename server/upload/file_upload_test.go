@@ -0,0 +1,118 @@
+package upload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestUpload_AddReceived(t *testing.T) {
+	for name, test := range map[string]struct {
+		ranges [][2]uint64
+		want   []ByteRange
+	}{
+		"single":       {[][2]uint64{{0, 10}}, []ByteRange{{0, 10}}},
+		"disjoint":     {[][2]uint64{{0, 10}, {20, 30}}, []ByteRange{{0, 10}, {20, 30}}},
+		"adjacent":     {[][2]uint64{{0, 10}, {10, 20}}, []ByteRange{{0, 20}}},
+		"overlapping":  {[][2]uint64{{0, 15}, {10, 20}}, []ByteRange{{0, 20}}},
+		"contained":    {[][2]uint64{{0, 20}, {5, 10}}, []ByteRange{{0, 20}}},
+		"out of order": {[][2]uint64{{20, 30}, {0, 10}, {10, 20}}, []ByteRange{{0, 30}}},
+		"bridging":     {[][2]uint64{{0, 10}, {20, 30}, {40, 50}, {5, 45}}, []ByteRange{{0, 50}}},
+	} {
+		u := Upload{}
+		for _, r := range test.ranges {
+			u.addReceived(r[0], r[1])
+		}
+		if !reflect.DeepEqual(u.Received, test.want) {
+			t.Errorf("%s: got %v, want %v", name, u.Received, test.want)
+		}
+	}
+
+	// Copies of an upload are unaffected by ranges received later
+	u := Upload{}
+	u.addReceived(0, 10)
+	c := u.clone()
+	u.addReceived(10, 20)
+	if !reflect.DeepEqual(c.Received, []ByteRange{{0, 10}}) {
+		t.Errorf("copy was modified: %v", c.Received)
+	}
+}
+
+func TestGaps(t *testing.T) {
+	for name, test := range map[string]struct {
+		received []ByteRange
+		size     uint64
+		want     []ByteRange
+	}{
+		"complete":      {[]ByteRange{{0, 10}}, 10, nil},
+		"nothing":       {nil, 10, []ByteRange{{0, 10}}},
+		"empty file":    {nil, 0, nil},
+		"missing start": {[]ByteRange{{5, 10}}, 10, []ByteRange{{0, 5}}},
+		"missing end":   {[]ByteRange{{0, 5}}, 10, []ByteRange{{5, 10}}},
+		"missing middle": {
+			[]ByteRange{{0, 2}, {4, 6}, {8, 10}}, 10,
+			[]ByteRange{{2, 4}, {6, 8}},
+		},
+		"unknown size": {[]ByteRange{{0, 2}, {4, 6}}, 0, []ByteRange{{2, 4}}},
+	} {
+		if got := Gaps(test.received, test.size); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", name, got, test.want)
+		}
+	}
+}
+
+func TestManager_Finish(t *testing.T) {
+	m, webroot := testManager(t, StoreJSON, 1)
+	content := []byte("0123456789")
+	sum := sha256.Sum256(content)
+	size := func(n uint64) *uint64 { return &n }
+
+	// Without a declared size, the missing final chunk can't be
+	// detected, so the size must be supplied
+	if _, err := m.Register(filepath.Join(webroot, "file"), "/file", 0, webroot, "op"); err != nil {
+		t.Fatal(err)
+	} else if err = m.SaveChunk("/file", content[:5], 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Finish("/file", nil, ""); err != ErrSizeUnknown {
+		t.Errorf("upload without a known size was finished: %v", err)
+	}
+	if gaps, err := m.Finish("/file", size(10), ""); err != ErrIncomplete {
+		t.Errorf("truncated upload was finished: %v", err)
+	} else if !reflect.DeepEqual(gaps, []ByteRange{{5, 10}}) {
+		t.Errorf("unexpected gaps: %v", gaps)
+	}
+
+	// Verification failures leave the upload registered
+	if err := m.SaveChunk("/file", content[5:], 5); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Finish("/file", size(10), hex.EncodeToString(make([]byte, 32))); err != ErrChecksumMismatch {
+		t.Errorf("corrupt upload was finished: %v", err)
+	}
+	if _, err := m.Finish("/file", size(10), hex.EncodeToString(sum[:])); err != nil {
+		t.Fatal(err)
+	} else if m.RegistrantExists("/file") {
+		t.Error("finished upload remains registered")
+	}
+
+	// The size declared at registration is used when none is
+	// supplied
+	if _, err := m.Register(filepath.Join(webroot, "sized"), "/sized", 10, webroot, "op"); err != nil {
+		t.Fatal(err)
+	} else if err = m.SaveChunk("/sized", content[:5], 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Finish("/sized", nil, ""); err != ErrIncomplete {
+		t.Errorf("truncated upload was finished: %v", err)
+	}
+
+	// Zero-byte uploads are finished by supplying their size
+	if _, err := m.Register(filepath.Join(webroot, "empty"), "/empty", 0, webroot, "op"); err != nil {
+		t.Fatal(err)
+	} else if _, err = m.Finish("/empty", size(0), ""); err != nil {
+		t.Errorf("zero-byte upload wasn't finished: %v", err)
+	}
+}
@@ -0,0 +1,314 @@
+package upload
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrFileTooLarge is returned when an upload exceeds
+	// Limits.MaxFileSize.
+	ErrFileTooLarge = errors.New("upload exceeds the maximum file size")
+	// ErrExceedsSize is returned by Manager.SaveChunkFrom when a
+	// chunk extends beyond the size declared at registration.
+	ErrExceedsSize = errors.New("chunk exceeds the declared upload size")
+	// ErrQuotaExceeded is returned when an upload would exceed
+	// Limits.UserQuota.
+	ErrQuotaExceeded = errors.New("upload exceeds the user's quota")
+	// ErrInsufficientSpace is returned when an upload would reduce
+	// the free space of the filesystem below Limits.MinFreeSpace.
+	ErrInsufficientSpace = errors.New("insufficient free disk space for upload")
+)
+
+// IsLimitError determines if err indicates that an upload was
+// rejected by Limits.
+func IsLimitError(err error) bool {
+	switch err {
+	case ErrFileTooLarge, ErrExceedsSize, ErrQuotaExceeded, ErrInsufficientSpace:
+		return true
+	}
+	return false
+}
+
+// Limits restrict the size of uploads. Each limit is disabled when
+// zero.
+//
+// Limits are enforced by Manager.Register against the size declared
+// by the client and again by Manager.SaveChunkFrom as content is
+// received, since clients may omit the size or send more than they
+// declared.
+type Limits struct {
+	// MaxFileSize is the maximum size of an uploaded file in bytes.
+	MaxFileSize uint64
+	// UserQuota is the maximum number of bytes within a user's root
+	// directory, including bytes declared by uploads in progress.
+	UserQuota uint64
+	// MinFreeSpace is the number of bytes that must remain free on
+	// the filesystem receiving uploads.
+	MinFreeSpace uint64
+}
+
+// usageTtl is how long the disk usage of a user's root directory is
+// cached by Manager.usage.
+const usageTtl = 30 * time.Second
+
+// rootUsage is the cached disk usage of a user's root directory.
+type rootUsage struct {
+	mu sync.Mutex
+	n  uint64
+	at time.Time
+}
+
+// measure returns the disk usage of quotaRoot and the free space of
+// the filesystem receiving abs, as required by the limits of m. It
+// must be called without m.mu, since walking quotaRoot may be slow.
+func (m *Manager) measure(abs, quotaRoot string) (used, free uint64, err error) {
+	if m.limits.UserQuota > 0 {
+		if used, err = m.usage(quotaRoot); err != nil {
+			return 0, 0, err
+		}
+	}
+	if m.limits.MinFreeSpace > 0 {
+		if free, err = m.freeSpace(filepath.Dir(abs)); err != nil {
+			return 0, 0, err
+		}
+	}
+	return used, free, nil
+}
+
+// checkRegistration determines if an upload of size bytes within the
+// user's root directory quotaRoot is permitted, given the usage and
+// free space returned by measure. m.mu must be held.
+func (m *Manager) checkRegistration(size uint64, quotaRoot string, used, free uint64) error {
+	if m.limits.MaxFileSize > 0 && size > m.limits.MaxFileSize {
+		return ErrFileTooLarge
+	}
+	return m.checkSpace(size, quotaRoot, used, free)
+}
+
+// checkSpace determines if size bytes can be written within the
+// user's root directory quotaRoot without exceeding the quota or
+// free space, accounting for bytes reserved by uploads. m.mu must
+// be held.
+func (m *Manager) checkSpace(size uint64, quotaRoot string, used, free uint64) error {
+	if m.limits.UserQuota > 0 && used+m.reservedLocked(quotaRoot, nil)+size > m.limits.UserQuota {
+		return ErrQuotaExceeded
+	}
+	if m.limits.MinFreeSpace > 0 && free < m.limits.MinFreeSpace+m.reservedLocked("", nil)+size {
+		return ErrInsufficientSpace
+	}
+	return nil
+}
+
+// CheckCopy determines if the limits of m permit copying content
+// of size bytes to dst, an absolute path within the user's root
+// directory quotaRoot, as if it were uploaded. largest is the size
+// of the largest file being copied, which is checked against
+// Limits.MaxFileSize.
+//
+// Content written outside of uploads isn't tracked by m, so the
+// copied bytes must be charged to quotaRoot by Charge once written.
+func (m *Manager) CheckCopy(dst, quotaRoot string, size, largest uint64) (err error) {
+	if m.limits.MaxFileSize > 0 && largest > m.limits.MaxFileSize {
+		return ErrFileTooLarge
+	}
+	used, free, err := m.measure(dst, quotaRoot)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.checkSpace(size, quotaRoot, used, free)
+}
+
+// Charge adds n bytes written beneath quotaRoot outside of uploads,
+// e.g., by copies, to its disk usage.
+func (m *Manager) Charge(quotaRoot string, n uint64) {
+	m.grow(quotaRoot, n)
+}
+
+// chunkLimit returns a reader that streams a chunk from r to be
+// written to the upload of reg at off, failing before more bytes
+// are read than the limits permit. reg must be locked.
+//
+// A chunk's growth of the file is charged against the quota and
+// free space, while its end is checked against the maximum and
+// declared sizes. Bytes declared at registration were reserved
+// then, so only uploads without a declared size are charged
+// against the quota here. Bytes reserved by other uploads are
+// unavailable to the chunk.
+func (m *Manager) chunkLimit(reg *registrant, r io.Reader, off uint64) (io.Reader, error) {
+	up := &reg.up
+	lr := &limitReader{r: r, n: -1}
+	limit := func(n int64, err error) {
+		if n < 0 {
+			n = 0
+		}
+		if lr.n < 0 || n < lr.n {
+			lr.n, lr.err = n, err
+		}
+	}
+
+	if m.limits.MaxFileSize > 0 {
+		limit(int64(m.limits.MaxFileSize)-int64(off), ErrFileTooLarge)
+	}
+	if up.Size > 0 {
+		limit(int64(up.Size)-int64(off), ErrExceedsSize)
+	}
+
+	if m.limits.UserQuota == 0 && m.limits.MinFreeSpace == 0 {
+		return lr, nil
+	}
+
+	// Bytes overwritten within the current file don't grow it
+	var overlap int64
+	if stat, err := os.Stat(up.AbsPath); err == nil && uint64(stat.Size()) > off {
+		overlap = stat.Size() - int64(off)
+	}
+
+	if m.limits.UserQuota > 0 && up.Size == 0 && up.QuotaRoot != "" {
+		used, err := m.usage(up.QuotaRoot)
+		if err != nil {
+			return nil, err
+		}
+		used += m.reserved(up.QuotaRoot, reg)
+		limit(int64(m.limits.UserQuota)-int64(used)+overlap, ErrQuotaExceeded)
+	}
+
+	if m.limits.MinFreeSpace > 0 {
+		free, err := m.freeSpace(filepath.Dir(up.AbsPath))
+		if err != nil {
+			return nil, err
+		}
+		reserved := m.reserved("", reg)
+		limit(int64(free)-int64(m.limits.MinFreeSpace)-int64(reserved)+overlap, ErrInsufficientSpace)
+	}
+
+	return lr, nil
+}
+
+// usage returns the disk usage of root, which is walked at most once
+// per usageTtl. Chunks written in the meantime are added by grow, so
+// only changes made outside of uploads may go unnoticed until the
+// cache expires.
+func (m *Manager) usage(root string) (uint64, error) {
+	m.usageMu.Lock()
+	u := m.usageCache[root]
+	if u == nil {
+		u = &rootUsage{}
+		m.usageCache[root] = u
+	}
+	m.usageMu.Unlock()
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if !u.at.IsZero() && time.Since(u.at) < usageTtl {
+		return u.n, nil
+	}
+	n, err := diskUsage(root)
+	if err != nil {
+		return 0, err
+	}
+	u.n, u.at = n, time.Now()
+	return n, nil
+}
+
+// grow adds n bytes written to a file beneath root to its cached
+// disk usage.
+func (m *Manager) grow(root string, n uint64) {
+	m.usageMu.Lock()
+	u := m.usageCache[root]
+	m.usageMu.Unlock()
+	if u != nil {
+		u.mu.Lock()
+		u.n += n
+		u.mu.Unlock()
+	}
+}
+
+// reserved returns the number of bytes declared by uploads within
+// root that have yet to be received, excluding the registrant
+// exclude. All uploads are included when root is empty.
+func (m *Manager) reserved(root string, exclude *registrant) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.reservedLocked(root, exclude)
+}
+
+// reservedLocked is reserved for callers holding m.mu.
+//
+// The mutex of each registrant isn't acquired, which would invert
+// the lock order. The paths of an upload never change, while the
+// remaining bytes are maintained atomically.
+func (m *Manager) reservedLocked(root string, exclude *registrant) (n uint64) {
+	for _, r := range m.registrants {
+		if r == exclude {
+			continue
+		} else if root != "" && r.up.AbsPath != root && !strings.HasPrefix(r.up.AbsPath, root+string(filepath.Separator)) {
+			continue
+		}
+		n += r.remaining.Load()
+	}
+	return n
+}
+
+// diskUsage returns the total size of the regular files beneath
+// root. Symbolic links aren't followed.
+func diskUsage(root string) (n uint64, err error) {
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Content removed while walking occupies no space
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		} else if d.Type().IsRegular() {
+			var fi fs.FileInfo
+			if fi, err = d.Info(); err == nil {
+				n += uint64(fi.Size())
+			} else if !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+		return nil
+	})
+	return n, err
+}
+
+// limitReader reads from r, failing with err once more than n
+// bytes are available. A negative n is unlimited.
+//
+// Unlike io.LimitReader, content beyond the limit results in an
+// error rather than being silently discarded, and no byte beyond
+// it is ever returned to the caller.
+type limitReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (l *limitReader) Read(b []byte) (n int, err error) {
+	if l.n < 0 {
+		return l.r.Read(b)
+	} else if l.n == 0 {
+		// Probe for content beyond the limit
+		var p [1]byte
+		if n, err = l.r.Read(p[:]); n > 0 {
+			return 0, l.err
+		}
+		return 0, err
+	}
+
+	if int64(len(b)) > l.n {
+		b = b[:l.n]
+	}
+	n, err = l.r.Read(b)
+	l.n -= int64(n)
+	return n, err
+}
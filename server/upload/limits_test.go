@@ -0,0 +1,171 @@
+package upload
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// limitManager initializes a Manager restricted by limits within a
+// temporary directory, which is returned as the webroot.
+func limitManager(t *testing.T, limits Limits) (*Manager, string) {
+	m, webroot := testManager(t, StoreJSON, 1)
+	m.limits = limits
+	return m, webroot
+}
+
+func TestLimitReader(t *testing.T) {
+	for _, test := range []struct {
+		src  string
+		n    int64
+		want string
+		err  error
+	}{
+		{"content", -1, "content", nil},
+		{"content", 7, "content", nil},
+		{"content", 100, "content", nil},
+		{"content", 3, "con", ErrFileTooLarge},
+		{"content", 0, "", ErrFileTooLarge},
+		{"", 0, "", nil},
+	} {
+		// A reader returning one byte at a time ensures the limit
+		// isn't exceeded across reads
+		lr := &limitReader{r: io.LimitReader(strings.NewReader(test.src), int64(len(test.src))), n: test.n, err: ErrFileTooLarge}
+		var got bytes.Buffer
+		buf := make([]byte, 1)
+		var err error
+		for err == nil {
+			var n int
+			n, err = lr.Read(buf)
+			got.Write(buf[:n])
+		}
+		if err == io.EOF {
+			err = nil
+		}
+		if got.String() != test.want || err != test.err {
+			t.Errorf("%q limited to %d: got %q and %v, want %q and %v", test.src, test.n, got.String(), err, test.want, test.err)
+		}
+	}
+}
+
+func TestManager_MaxFileSize(t *testing.T) {
+	m, webroot := limitManager(t, Limits{MaxFileSize: 10})
+	abs := filepath.Join(webroot, "file")
+
+	if _, err := m.Register(abs, "/big", 11, webroot, "op"); err != ErrFileTooLarge {
+		t.Errorf("oversized upload was registered: %v", err)
+	}
+
+	// Without a declared size, the limit is enforced per chunk
+	if _, err := m.Register(abs, "/file", 0, webroot, "op"); err != nil {
+		t.Fatal(err)
+	} else if err = m.SaveChunk("/file", make([]byte, 6), 0); err != nil {
+		t.Fatal(err)
+	} else if err = m.SaveChunk("/file", make([]byte, 6), 6); err != ErrFileTooLarge {
+		t.Errorf("chunk beyond the maximum file size was saved: %v", err)
+	}
+	if stat, err := os.Stat(abs); err != nil || stat.Size() > 10 {
+		t.Errorf("content beyond the limit was written: %v", err)
+	}
+
+	// Chunks may not extend beyond the declared size
+	if _, err := m.Register(filepath.Join(webroot, "sized"), "/sized", 4, webroot, "op"); err != nil {
+		t.Fatal(err)
+	} else if err = m.SaveChunk("/sized", make([]byte, 5), 0); err != ErrExceedsSize {
+		t.Errorf("chunk beyond the declared size was saved: %v", err)
+	}
+}
+
+func TestManager_Quota(t *testing.T) {
+	m, webroot := limitManager(t, Limits{UserQuota: 100})
+	if err := os.WriteFile(filepath.Join(webroot, "existing"), make([]byte, 40), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Register(filepath.Join(webroot, "a"), "/a", 61, webroot, "op"); err != ErrQuotaExceeded {
+		t.Errorf("upload exceeding the quota was registered: %v", err)
+	}
+	if _, err := m.Register(filepath.Join(webroot, "a"), "/a", 60, webroot, "op"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The declared bytes of /a are reserved
+	if _, err := m.Register(filepath.Join(webroot, "b"), "/b", 1, webroot, "op"); err != ErrQuotaExceeded {
+		t.Errorf("upload exceeding the reserved quota was registered: %v", err)
+	}
+	if _, err := m.Register(filepath.Join(webroot, "c"), "/c", 0, webroot, "op"); err != nil {
+		t.Fatal(err)
+	} else if err = m.SaveChunk("/c", []byte{1}, 0); err != ErrQuotaExceeded {
+		t.Errorf("chunk exceeding the reserved quota was saved: %v", err)
+	}
+
+	// Receiving /a releases its reservation but grows the usage of
+	// the root directory, which remains at the quota
+	if err := m.SaveChunk("/a", make([]byte, 60), 0); err != nil {
+		t.Fatal(err)
+	} else if err = m.SaveChunk("/c", []byte{1}, 0); err != ErrQuotaExceeded {
+		t.Errorf("chunk exceeding the quota was saved: %v", err)
+	}
+
+	// Other users' roots are unaffected
+	other := filepath.Join(webroot, "other")
+	if err := os.Mkdir(other, 0700); err != nil {
+		t.Fatal(err)
+	} else if _, err = m.Register(filepath.Join(other, "d"), "/other/d", 100, other, "op2"); err != nil {
+		t.Errorf("upload within another root was rejected: %v", err)
+	}
+}
+
+func TestManager_MinFreeSpace(t *testing.T) {
+	m, webroot := limitManager(t, Limits{MinFreeSpace: 900})
+	m.freeSpace = func(string) (uint64, error) { return 1000, nil }
+
+	if _, err := m.Register(filepath.Join(webroot, "a"), "/a", 101, webroot, "op"); err != ErrInsufficientSpace {
+		t.Errorf("upload exceeding the free space was registered: %v", err)
+	}
+	if _, err := m.Register(filepath.Join(webroot, "a"), "/a", 60, webroot, "op"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Chunks of uploads without a declared size can't consume the
+	// space reserved by /a
+	if _, err := m.Register(filepath.Join(webroot, "b"), "/b", 0, webroot, "op"); err != nil {
+		t.Fatal(err)
+	} else if err = m.SaveChunk("/b", make([]byte, 41), 0); err != ErrInsufficientSpace {
+		t.Errorf("chunk consuming reserved space was saved: %v", err)
+	} else if err = m.SaveChunk("/b", make([]byte, 40), 0); err != nil {
+		t.Errorf("chunk within the free space was rejected: %v", err)
+	}
+}
+
+func TestManager_CheckCopy(t *testing.T) {
+	m, webroot := limitManager(t, Limits{MaxFileSize: 50, UserQuota: 100, MinFreeSpace: 900})
+	m.freeSpace = func(string) (uint64, error) { return 1000, nil }
+	dst := filepath.Join(webroot, "copy")
+
+	if err := m.CheckCopy(dst, webroot, 60, 51); err != ErrFileTooLarge {
+		t.Errorf("copy of an oversized file was permitted: %v", err)
+	}
+	if err := m.CheckCopy(dst, webroot, 100, 50); err != nil {
+		t.Errorf("copy within the limits was rejected: %v", err)
+	}
+
+	// Bytes reserved by uploads and charged by copies are unavailable
+	if _, err := m.Register(filepath.Join(webroot, "a"), "/a", 40, webroot, "op"); err != nil {
+		t.Fatal(err)
+	} else if err = m.CheckCopy(dst, webroot, 61, 50); err != ErrQuotaExceeded {
+		t.Errorf("copy exceeding the reserved quota was permitted: %v", err)
+	}
+	m.Charge(webroot, 50)
+	if err := m.CheckCopy(dst, webroot, 11, 11); err != ErrQuotaExceeded {
+		t.Errorf("copy exceeding the charged quota was permitted: %v", err)
+	}
+
+	m.limits.UserQuota = 0
+	if err := m.CheckCopy(dst, webroot, 61, 50); err != ErrInsufficientSpace {
+		t.Errorf("copy exceeding the free space was permitted: %v", err)
+	}
+}
@@ -0,0 +1,199 @@
+package upload
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testManager initializes a Manager backed by a store of kind within
+// a temporary directory, which is returned as the webroot.
+func testManager(t *testing.T, kind string, maxDuration uint) (*Manager, string) {
+	dir := t.TempDir()
+	store, err := OpenStore(kind, filepath.Join(dir, "registrants"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewManager(store, &maxDuration, Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.Close() })
+
+	webroot := filepath.Join(dir, "webroot")
+	if err = os.Mkdir(webroot, 0700); err != nil {
+		t.Fatal(err)
+	}
+	return m, webroot
+}
+
+// TestManager_ConcurrentChunks sends the chunks of one upload
+// concurrently and out of order.
+func TestManager_ConcurrentChunks(t *testing.T) {
+	for _, kind := range []string{StoreJSON, StoreBolt} {
+		t.Run(kind, func(t *testing.T) {
+			m, webroot := testManager(t, kind, 1)
+
+			content := make([]byte, 64*1024)
+			rand.Read(content)
+			if _, err := m.Register(filepath.Join(webroot, "file"), "/file", uint64(len(content)), webroot, "op"); err != nil {
+				t.Fatal(err)
+			}
+
+			const size = 1000
+			wg := sync.WaitGroup{}
+			for off := len(content) - len(content)%size; off >= 0; off -= size {
+				wg.Add(1)
+				go func(off int) {
+					defer wg.Done()
+					end := off + size
+					if end > len(content) {
+						end = len(content)
+					}
+					if err := m.SaveChunk("/file", content[off:end], uint64(off)); err != nil {
+						t.Error(err)
+					}
+				}(off)
+			}
+			wg.Wait()
+
+			if up, err := m.Get("/file"); err != nil {
+				t.Fatal(err)
+			} else if up.BytesReceived() != uint64(len(content)) {
+				t.Fatalf("expected %d bytes received, got %d", len(content), up.BytesReceived())
+			}
+
+			sum := sha256.Sum256(content)
+			if _, err := m.Finish("/file", nil, hex.EncodeToString(sum[:])); err != nil {
+				t.Fatal(err)
+			} else if m.RegistrantExists("/file") {
+				t.Fatal("finished upload remains registered")
+			}
+		})
+	}
+}
+
+// TestManager_Race registers, writes, finishes, cancels and expires
+// uploads concurrently. It's meaningful when run with -race.
+func TestManager_Race(t *testing.T) {
+	for _, kind := range []string{StoreJSON, StoreBolt} {
+		t.Run(kind, func(t *testing.T) {
+			// Uploads expire immediately, so the scanner competes
+			// with every other operation
+			m, webroot := testManager(t, kind, 0)
+
+			stop := make(chan struct{})
+			scanned := make(chan struct{})
+			go func() {
+				m.ScanExpired(time.Millisecond, stop)
+				close(scanned)
+			}()
+
+			chunk := make([]byte, 512)
+			wg := sync.WaitGroup{}
+			for w := 0; w < 8; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					for i := 0; i < 25; i++ {
+						// Workers share paths to contend for the same
+						// uploads
+						rel := fmt.Sprintf("/file-%d", (w+i)%5)
+						m.Register(filepath.Join(webroot, rel), rel, 0, webroot, "op")
+						m.Extend(rel, time.Millisecond)
+						m.SaveChunk(rel, chunk, uint64(i%4)*512)
+						m.Get(rel)
+						m.ListWithin("/")
+						switch i % 3 {
+						case 0:
+							m.CancelUpload(rel)
+						case 1:
+							m.Finish(rel, nil, "")
+						default:
+							m.RemoveExpired()
+						}
+					}
+				}(w)
+			}
+			wg.Wait()
+			close(stop)
+			<-scanned
+
+			// The store must agree with the manager
+			persisted, err := m.store.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, up := range m.ListAll() {
+				if _, ok := persisted[up.RelPath]; !ok {
+					t.Errorf("registered upload %s isn't persisted", up.RelPath)
+				}
+				delete(persisted, up.RelPath)
+			}
+			for rel := range persisted {
+				t.Errorf("upload %s is persisted but not registered", rel)
+			}
+		})
+	}
+}
+
+// TestStores verifies that uploads survive reopening each store.
+func TestStores(t *testing.T) {
+	for _, kind := range []string{StoreJSON, StoreBolt} {
+		t.Run(kind, func(t *testing.T) {
+			p := filepath.Join(t.TempDir(), "registrants")
+			s, err := OpenStore(kind, p)
+			if err != nil {
+				t.Fatal(err)
+			} else if _, err = s.Load(); err != nil {
+				t.Fatal(err)
+			}
+
+			up := Upload{
+				AbsPath:  "/webroot/a",
+				RelPath:  "/a",
+				Received: []ByteRange{{Start: 0, End: 10}},
+				Size:     20,
+			}
+			for _, err = range []error{
+				s.Put(up),
+				s.Put(Upload{RelPath: "/b"}),
+				s.Delete("/b"),
+				s.Delete("/unknown"),
+				s.Close(),
+			} {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if s, err = OpenStore(kind, p); err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+
+			uploads, err := s.Load()
+			if err != nil {
+				t.Fatal(err)
+			} else if len(uploads) != 1 {
+				t.Fatalf("expected 1 upload, got %d", len(uploads))
+			}
+			if got := uploads["/a"]; !reflect.DeepEqual(got, up) {
+				t.Fatalf("upload changed after reopening the store: %+v", got)
+			}
+		})
+	}
+}
+
+func TestOpenStore_Unsupported(t *testing.T) {
+	if _, err := OpenStore("xml", filepath.Join(t.TempDir(), "registrants")); err == nil {
+		t.Fatal("expected an error for an unsupported store")
+	}
+}
@@ -0,0 +1,127 @@
+package upload
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	// StoreJSON selects JSONStore.
+	StoreJSON = "json"
+	// StoreBolt selects BoltStore.
+	StoreBolt = "bolt"
+)
+
+// Store persists registered uploads, allowing a Manager to recover
+// them after a restart. Implementations must be safe for concurrent
+// use.
+type Store interface {
+	// Load returns all persisted uploads keyed by Upload.RelPath.
+	Load() (map[string]Upload, error)
+	// Put persists up, replacing any upload with the same RelPath.
+	Put(up Upload) error
+	// Delete removes the upload identified by relPath. Deleting an
+	// unknown upload isn't an error.
+	Delete(relPath string) error
+	// Close releases any resources held by the store.
+	Close() error
+}
+
+// OpenStore opens the store of kind, StoreJSON or StoreBolt, at the
+// file path.
+func OpenStore(kind, path string) (Store, error) {
+	switch kind {
+	case StoreJSON:
+		return NewJSONStore(path), nil
+	case StoreBolt:
+		return NewBoltStore(path)
+	}
+	return nil, errors.New(fmt.Sprintf("unsupported upload registrants store: %s", kind))
+}
+
+// JSONStore persists uploads to a JSON file, which is rewritten in
+// its entirety upon each change. It's suitable for a modest number
+// of uploads; see BoltStore otherwise.
+//
+// The file is replaced atomically, so a crash never leaves it
+// partially written.
+type JSONStore struct {
+	mu      sync.Mutex
+	path    string
+	uploads map[string]Upload
+}
+
+// NewJSONStore initializes a JSONStore that persists uploads to the
+// file at path.
+func NewJSONStore(path string) *JSONStore {
+	return &JSONStore{path: path, uploads: make(map[string]Upload)}
+}
+
+func (s *JSONStore) Load() (map[string]Upload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_RDONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var b []byte
+	if b, err = io.ReadAll(f); err != nil {
+		return nil, err
+	}
+
+	uploads := make(map[string]Upload)
+	if len(b) > 0 {
+		if err = json.Unmarshal(b, &uploads); err != nil {
+			return nil, err
+		}
+	}
+
+	s.uploads = make(map[string]Upload, len(uploads))
+	for k, up := range uploads {
+		s.uploads[k] = up
+	}
+	return uploads, nil
+}
+
+func (s *JSONStore) Put(up Upload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.uploads[up.RelPath] = up
+	return s.write()
+}
+
+func (s *JSONStore) Delete(relPath string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.uploads[relPath]; !ok {
+		return nil
+	}
+	delete(s.uploads, relPath)
+	return s.write()
+}
+
+func (s *JSONStore) Close() error {
+	return nil
+}
+
+// write replaces the file with the current uploads. s.mu must be
+// held.
+func (s *JSONStore) write() error {
+	data, err := json.Marshal(s.uploads)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
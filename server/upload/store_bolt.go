@@ -0,0 +1,71 @@
+package upload
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.etcd.io/bbolt"
+	"time"
+)
+
+// uploadsBucket is the bbolt bucket containing uploads.
+var uploadsBucket = []byte("uploads")
+
+// BoltStore persists uploads to an embedded bbolt database, in which
+// each upload is written individually.
+type BoltStore struct {
+	db *bbolt.DB
+}
+
+// NewBoltStore opens the bbolt database at path, creating it when
+// necessary. Only one process may open the database at a time.
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("failed to open upload registrants database: %v", err))
+	}
+
+	if err = db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(uploadsBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) Load() (uploads map[string]Upload, err error) {
+	uploads = make(map[string]Upload)
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(uploadsBucket).ForEach(func(k, v []byte) error {
+			var up Upload
+			if err := json.Unmarshal(v, &up); err != nil {
+				return errors.New(fmt.Sprintf("failed to parse upload %s: %v", k, err))
+			}
+			uploads[string(k)] = up
+			return nil
+		})
+	})
+	return uploads, err
+}
+
+func (s *BoltStore) Put(up Upload) error {
+	data, err := json.Marshal(up)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(uploadsBucket).Put([]byte(up.RelPath), data)
+	})
+}
+
+func (s *BoltStore) Delete(relPath string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(uploadsBucket).Delete([]byte(relPath))
+	})
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
@@ -143,6 +143,9 @@ export class AdminApi {
         this.getObfsConfig = this.getObfsConfig.bind(this);
         this.putObfsConfig = this.putObfsConfig.bind(this);
         this.setApiConfig = this.setApiConfig.bind(this);
+        this.getUploads = this.getUploads.bind(this);
+        this.patchUpload = this.patchUpload.bind(this);
+        this.deleteUpload = this.deleteUpload.bind(this);
     }
 
     headers(){
@@ -429,6 +432,74 @@ export class AdminApi {
         }
     }
 
+    //=============
+    // UPLOAD CALLS
+    //=============
+
+    @request("get", "/admin/uploads")
+    getUploads(data, response) {
+        if(response.status === 200){
+            return {
+                success: true,
+                uploads: response.data.uploads
+            }
+        } else {
+            return {
+                success: false,
+                alert: {
+                    variant: "danger",
+                    heading: "Failed to Get Uploads",
+                    message: `HTTP status code: ${response.status}`,
+                    timeout: 5,
+                    show: true
+                }
+            }
+        }
+    }
+
+    // data: {path: "/rel/path", hours: 24}
+    @request("patch", "/admin/uploads")
+    patchUpload(data, response) {
+        if(response.status === 200){
+            return {
+                success: true,
+                upload: response.data.upload
+            }
+        } else {
+            return {
+                success: false,
+                alert: {
+                    variant: "danger",
+                    heading: "Failed to Extend Upload",
+                    message: `HTTP status code: ${response.status}`,
+                    timeout: 5,
+                    show: true
+                }
+            }
+        }
+    }
+
+    // data: {path: "/rel/path"}
+    @request("delete", "/admin/uploads")
+    deleteUpload(data, response) {
+        if(response.status === 200){
+            return {
+                success: true,
+            }
+        } else {
+            return {
+                success: false,
+                alert: {
+                    variant: "danger",
+                    heading: "Failed to Cancel Upload",
+                    message: `HTTP status code: ${response.status}`,
+                    timeout: 5,
+                    show: true
+                }
+            }
+        }
+    }
+
     @request("get", "/admin/advanced")
     getAdvancedConfig(data, response){
         if(response.status === 200){
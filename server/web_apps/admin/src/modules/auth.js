@@ -12,6 +12,7 @@ export class Auth extends React.Component {
             username: "",
             password: "",
             token: "",
+            totp: "",
             token_expiration: "",
             show: true,
             alert: null,
@@ -25,7 +26,8 @@ export class Auth extends React.Component {
         localStorage.setItem("user_token", this.state.token);
         let o = await adminApi.login({
             username: this.state.username,
-            password: this.state.password
+            password: this.state.password,
+            totp: this.state.totp
         })
 
         if(o.ok){
@@ -36,10 +38,11 @@ export class Auth extends React.Component {
                 alert: o.output.alert,
                 username: "",
                 password: "",
+                totp: "",
                 token: ""});
         } else {
             // Reset the form
-            this.setState({username: "", password: "", alert: o.output.alert})
+            this.setState({username: "", password: "", totp: "", alert: o.output.alert})
         }
     }
 
@@ -97,6 +100,15 @@ export class Auth extends React.Component {
                           onChange={(e) => {this.updateField("password", e)}}
                       />
                   </Form.Group>
+                  <Form.Group className={"mb-3"} controlId={"login-totp"}>
+                      <Form.Control
+                          placeholder={"TOTP Code (if enrolled)"}
+                          inputMode={"numeric"}
+                          autoComplete={"one-time-code"}
+                          value={this.state.totp}
+                          onChange={(e) => {this.updateField("totp", e)}}
+                      />
+                  </Form.Group>
                   <Form.Group className={"mb-3"} controlId={"login-token"}>
                       <Form.Control
                           placeholder={"Token"}
@@ -11,7 +11,7 @@ export class UserForm extends React.Component {
             mode: this.props.mode === "new" ? "new" : "normal",
             deleted: false,
             username: props.username,
-            password: props.password,
+            password: props.password || "",
             is_admin: props.is_admin,
             token: props.token,
             show_password: false,
@@ -48,7 +48,7 @@ export class UserForm extends React.Component {
     toPropObj(){
         return {
             username: this.props.username,
-            password: this.props.password,
+            password: this.props.password || "",
             is_admin: this.props.is_admin,
             token: this.props.token,
         }
@@ -112,8 +112,10 @@ export class UserForm extends React.Component {
         })
     }
 
+    // Passwords are never returned by the server, so one is
+    // required only for new users.
     fieldsPopulated(){
-        return this.state.username && this.state.password && this.state.token;
+        return this.state.username && this.state.token && (this.state.password || this.state.mode !== "new");
     }
 
     render(){
@@ -122,7 +124,7 @@ export class UserForm extends React.Component {
         if (this.state.mode === "edit") {
             canSave = (
                 this.state.username !== this.props.username ||
-                this.state.password !== this.props.password ||
+                this.state.password !== (this.props.password || "") ||
                 this.state.is_admin !== this.props.is_admin ||
                 this.state.token !== this.props.token
             );
@@ -161,7 +163,7 @@ export class UserForm extends React.Component {
                                     </InputGroup>
                                     <InputGroup className={"mt-2 mb-1"}>
                                         <Form.Control
-                                            placeholder={this.state.password || "Password"}
+                                            placeholder={this.state.mode === "new" ? "Password" : "New Password (leave blank to keep current)"}
                                             value={this.state.password}
                                             type={this.state.show_password ? "" : "password"}
                                             onChange={(e) => {this.fieldChange("password", e)}}
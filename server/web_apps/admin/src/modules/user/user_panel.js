@@ -52,7 +52,9 @@ export class UserPanel extends React.Component {
                     return false;
                 } else {
                     changed=true
-                    users[i] = user
+                    // Retain fields not managed by the form, e.g.,
+                    // root_directory and permissions.
+                    users[i] = Object.assign({}, i_user, user)
                 }
                 break
             }
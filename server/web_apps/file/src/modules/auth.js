@@ -12,6 +12,7 @@ export class Auth extends React.Component {
             username: "",
             password: "",
             token: "",
+            totp: "",
             token_expiration: "",
             show: true,
             alert: null,
@@ -26,6 +27,7 @@ export class Auth extends React.Component {
         let o = await fileApi.postLogin({
             username: this.state.username,
             password: this.state.password,
+            totp: this.state.totp,
             token: this.state.token,
         })
 
@@ -37,12 +39,14 @@ export class Auth extends React.Component {
                 alert: o.output.alert,
                 username: "",
                 password: "",
+                totp: "",
                 token: ""});
         } else {
             // Reset the form
             this.setState({
                 username: "",
                 password: "",
+                totp: "",
                 token: "",
                 alert: o.output.alert})
         }
@@ -102,6 +106,15 @@ export class Auth extends React.Component {
                           onChange={(e) => {this.updateField("password", e)}}
                       />
                   </Form.Group>
+                  <Form.Group className={"mb-3"} controlId={"login-totp"}>
+                      <Form.Control
+                          placeholder={"TOTP Code (if enrolled)"}
+                          inputMode={"numeric"}
+                          autoComplete={"one-time-code"}
+                          value={this.state.totp}
+                          onChange={(e) => {this.updateField("totp", e)}}
+                      />
+                  </Form.Group>
                   <Form.Group className={"mb-3"} controlId={"login-token"}>
                       <Form.Control
                           placeholder={"Token"}
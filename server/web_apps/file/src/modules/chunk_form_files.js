@@ -23,6 +23,7 @@ export class ChunkFormFiles extends React.Component {
         this.sendChunk = this.sendChunk.bind(this);
         this.getObfConfig = this.getObfConfig.bind(this);
         this.registerUpload = this.registerUpload.bind(this);
+        this.obfuscateBody = this.obfuscateBody.bind(this);
         this.registerTransfer = this.registerTransfer.bind(this);
         this.deregisterTransfer = this.deregisterTransfer.bind(this);
     }
@@ -35,8 +36,34 @@ export class ChunkFormFiles extends React.Component {
         throw new Error("Child classes must implement deregisterTransfer");
     }
 
-    async registerUpload(filePath){
-        await fileApi.registerUpload({}, [filePath], null, this.getObfConfig(), true, "json")
+    // obfuscateBody returns data as an obfuscated JSON request body.
+    async obfuscateBody(data) {
+        let body;
+        let finished=false;
+        let worker = new Worker(wasm_worker);
+        worker.onmessage = (e) => {
+            worker.terminate();
+            body=e.data.output;
+            finished=true;
+        }
+        worker.postMessage({
+            wasm_exec: wasm_exec,
+            algos_wasm: algos_wasm,
+            wasm_helpers: wasm_helpers,
+            func: "RunObfs",
+            args: ["obf", JSON.stringify(data), this.getObfConfig()],
+            bytefi_in: [1],
+            stringify_out: true,
+        })
+        while(!finished){await wait(50)}
+        return body
+    }
+
+    // registerUpload declares the size of the file, allowing the
+    // server to detect missing chunks when the upload is finished.
+    async registerUpload(filePath, size){
+        let body = await this.obfuscateBody({size: size});
+        await fileApi.registerUpload(body, [filePath], null, this.getObfConfig(), true, "json")
             .then((e) => {
                 if(!e.output.success){
                     this.props.sendAlert(e.output.alert);
@@ -117,8 +144,9 @@ export class ChunkFormFiles extends React.Component {
     // chunksSent is called function once all chunks have been sent
     // to the server, allowing the component to modify its current
     // state.
-    async uploadFinished(webPath) {
-        await fileApi.uploadFinished({}, [webPath], null, this.getObfConfig())
+    async uploadFinished(webPath, size) {
+        let body = await this.obfuscateBody({size: size});
+        await fileApi.uploadFinished(body, [webPath], null, this.getObfConfig())
             .then((e) => {
                 if(!e.output.success) {
                     this.props.sendAlert(e.output.alert);
@@ -164,7 +192,7 @@ export class ChunkFormFiles extends React.Component {
             webPath = cwd + file.name;
         }
 
-        await this.registerUpload(webPath)
+        await this.registerUpload(webPath, file.size)
             .catch((e) => {
                 if(this.chunksSent){this.chunksSent()};
                 throw e;
@@ -234,7 +262,7 @@ export class ChunkFormFiles extends React.Component {
                 prog_callback(null);
 
                 // Notify component that the upload is complete
-                await this.uploadFinished(webPath);
+                await this.uploadFinished(webPath, file.size);
 
                 // Run callback function upon completion.
                 //